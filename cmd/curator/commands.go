@@ -0,0 +1,39 @@
+package main
+
+import (
+	"emperror.dev/errors"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord"
+	"github.com/spf13/pflag"
+)
+
+const (
+	unknownCommandsAction = errors.Sentinel("unknown commands action, expected sync")
+)
+
+// runCommands syncs the slash commands with Discord without starting the bot, to the guilds given with --guild or
+// where the bot syncs them on start
+func runCommands(f *pflag.FlagSet) error {
+	if action := f.Arg(1); action != "sync" {
+		return errors.WithDetails(unknownCommandsAction, "action", action)
+	}
+
+	guilds, _ := f.GetStringSlice("guild")
+	dryRun, _ := f.GetBool("dry-run")
+
+	bot := &discord.BotService{Logger: logger}
+	if err := bot.Init(config); err != nil {
+		return errors.Wrap(err, "failed to initialize bot")
+	}
+
+	if len(guilds) == 0 {
+		guilds = bot.Config.SyncGuilds()
+	}
+
+	for _, guild := range guilds {
+		if _, err := bot.SyncCommands(guild, dryRun); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
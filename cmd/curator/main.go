@@ -6,6 +6,8 @@ import (
 	"emperror.dev/errors"
 	"github.com/Sxtanna/chromatic_curator/internal/app"
 	"github.com/Sxtanna/chromatic_curator/internal/app/discord"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
+	"github.com/Sxtanna/chromatic_curator/internal/app/scheduler"
 	"github.com/Sxtanna/chromatic_curator/internal/common"
 	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
 	"github.com/Sxtanna/chromatic_curator/internal/system/logging"
@@ -18,22 +20,109 @@ import (
 	"syscall"
 )
 
+const (
+	unknownCommand = errors.Sentinel("unknown command, expected export, import or commands")
+)
+
 type curatorConfiguration struct {
-	Bot   *discord.BotConfiguration
-	Log   *logging.Config
-	Redis *backend.Config
+	Bot          *discord.BotConfiguration
+	Interactions *discord.InteractionsConfig
+	Sharding     *discord.ShardingConfig
+	Metrics      *discord.MetricsConfig
+	Log          *logging.Config
+	Redis        *backend.RedisConfig
+	Storage      *backend.StorageConfig
+	Coordination *backend.CoordinationConfig
+	Generations  *data.GenerationConfig
+	RateLimits   *data.RateLimitConfig
+	Scheduler    *scheduler.Config
 }
 
-func (c *curatorConfiguration) Validate() error {
+func (c *curatorConfiguration) Process() error {
+
+	if err := common.OptProcess(c.Storage); err != nil {
+		return err
+	}
+
+	if err := common.OptProcess(c.Redis); err != nil {
+		return err
+	}
+
+	if err := common.OptProcess(c.Coordination); err != nil {
+		return err
+	}
 
-	if err := common.OptValidate(c.Bot); err != nil {
+	if err := common.OptProcess(c.Interactions); err != nil {
 		return err
 	}
 
+	if err := common.OptProcess(c.Sharding); err != nil {
+		return err
+	}
+
+	if err := common.OptProcess(c.Generations); err != nil {
+		return err
+	}
+
+	if err := common.OptProcess(c.RateLimits); err != nil {
+		return err
+	}
+
+	if err := common.OptProcess(c.Scheduler); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *curatorConfiguration) Validate() error {
+
+	// The bot is not configured for the export and import commands
+	if c.Bot != nil {
+		if err := common.OptValidate(c.Bot); err != nil {
+			return err
+		}
+
+		if err := common.OptValidate(c.Interactions); err != nil {
+			return err
+		}
+
+		if err := common.OptValidate(c.Sharding); err != nil {
+			return err
+		}
+
+		if err := common.OptValidate(c.Metrics); err != nil {
+			return err
+		}
+	}
+
 	if err := common.OptValidate(c.Log); err != nil {
 		return err
 	}
 
+	if err := common.OptValidate(c.Storage); err != nil {
+		return err
+	}
+
+	// Redis is only required when it stores the data
+	if c.Storage == nil || c.Storage.Type == backend.StorageRedis {
+		if err := common.OptValidate(c.Redis); err != nil {
+			return err
+		}
+
+		if err := common.OptValidate(c.Coordination); err != nil {
+			return err
+		}
+	}
+
+	if err := common.OptValidate(c.Generations); err != nil {
+		return err
+	}
+
+	if err := common.OptValidate(c.Scheduler); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -49,8 +138,51 @@ func initializeConfiguration(v *viper.Viper, f *pflag.FlagSet) {
 
 	_ = v.BindEnv("bot.token", "BOT_TOKEN")
 	_ = v.BindEnv("bot.admins", "BOT_ADMINS")
+	_ = v.BindEnv("bot.commandguilds", "BOT_COMMAND_GUILDS")
+	_ = v.BindEnv("bot.membercleanup", "BOT_MEMBER_CLEANUP")
+	_ = v.BindEnv("interactions.mode", "INTERACTIONS_MODE")
+	_ = v.BindEnv("interactions.address", "INTERACTIONS_ADDRESS")
+	_ = v.BindEnv("interactions.publickey", "INTERACTIONS_PUBLIC_KEY")
+	_ = v.BindEnv("interactions.responsetimeout", "INTERACTIONS_RESPONSE_TIMEOUT")
+	_ = v.BindEnv("sharding.count", "SHARDING_COUNT")
+	_ = v.BindEnv("sharding.range", "SHARDING_RANGE")
+	_ = v.BindEnv("metrics.address", "METRICS_ADDRESS")
 	_ = v.BindEnv("redis.host", "REDIS_HOST")
 	_ = v.BindEnv("redis.port", "REDIS_PORT")
+	_ = v.BindEnv("redis.username", "REDIS_USERNAME")
+	_ = v.BindEnv("redis.password", "REDIS_PASSWORD")
+	_ = v.BindEnv("redis.mode", "REDIS_MODE")
+	_ = v.BindEnv("redis.addresses", "REDIS_ADDRESSES")
+	_ = v.BindEnv("redis.mastername", "REDIS_MASTER_NAME")
+	_ = v.BindEnv("redis.sentinelpassword", "REDIS_SENTINEL_PASSWORD")
+	_ = v.BindEnv("redis.db", "REDIS_DB")
+	_ = v.BindEnv("redis.prefix", "REDIS_PREFIX")
+	_ = v.BindEnv("redis.tls.enabled", "REDIS_TLS_ENABLED")
+	_ = v.BindEnv("redis.tls.ca", "REDIS_TLS_CA")
+	_ = v.BindEnv("redis.tls.servername", "REDIS_TLS_SERVER_NAME")
+	_ = v.BindEnv("redis.tls.insecureskipverify", "REDIS_TLS_INSECURE_SKIP_VERIFY")
+	_ = v.BindEnv("redis.retry.attempts", "REDIS_RETRY_ATTEMPTS")
+	_ = v.BindEnv("redis.retry.initialbackoff", "REDIS_RETRY_INITIAL_BACKOFF")
+	_ = v.BindEnv("redis.retry.maxbackoff", "REDIS_RETRY_MAX_BACKOFF")
+	_ = v.BindEnv("redis.poolsize", "REDIS_POOL_SIZE")
+	_ = v.BindEnv("redis.minidleconns", "REDIS_MIN_IDLE_CONNS")
+	_ = v.BindEnv("redis.dialtimeout", "REDIS_DIAL_TIMEOUT")
+	_ = v.BindEnv("redis.readtimeout", "REDIS_READ_TIMEOUT")
+	_ = v.BindEnv("redis.writetimeout", "REDIS_WRITE_TIMEOUT")
+	_ = v.BindEnv("storage.type", "STORAGE_TYPE")
+	_ = v.BindEnv("storage.snapshot", "STORAGE_SNAPSHOT")
+	_ = v.BindEnv("storage.database", "STORAGE_DATABASE")
+	_ = v.BindEnv("storage.healthinterval", "STORAGE_HEALTH_INTERVAL")
+	_ = v.BindEnv("coordination.instance", "COORDINATION_INSTANCE")
+	_ = v.BindEnv("coordination.leasettl", "COORDINATION_LEASE_TTL")
+	_ = v.BindEnv("coordination.lockttl", "COORDINATION_LOCK_TTL")
+	_ = v.BindEnv("generations.ttl", "GENERATIONS_TTL")
+	_ = v.BindEnv("generations.capacity", "GENERATIONS_CAPACITY")
+	_ = v.BindEnv("ratelimits.users", "RATE_LIMITS_USERS")
+	_ = v.BindEnv("ratelimits.guilds", "RATE_LIMITS_GUILDS")
+	_ = v.BindEnv("scheduler.tick", "SCHEDULER_TICK")
+	_ = v.BindEnv("scheduler.batchsize", "SCHEDULER_BATCH_SIZE")
+	_ = v.BindEnv("scheduler.reserve", "SCHEDULER_RESERVE")
 }
 
 func readPFlags(f *pflag.FlagSet) error {
@@ -63,7 +195,7 @@ func readPFlags(f *pflag.FlagSet) error {
 	return nil
 }
 
-func readConfig(v *viper.Viper) error {
+func readConfig(v *viper.Viper, command string) error {
 	var err error
 
 	if err = v.ReadInConfig(); err != nil && !errors.Is(err, viper.ConfigFileNotFoundError{}) {
@@ -71,9 +203,17 @@ func readConfig(v *viper.Viper) error {
 	}
 
 	conf := curatorConfiguration{
-		Bot:   &discord.BotConfiguration{},
-		Log:   &logging.Config{},
-		Redis: &backend.Config{},
+		Bot:          &discord.BotConfiguration{},
+		Interactions: &discord.InteractionsConfig{},
+		Sharding:     &discord.ShardingConfig{},
+		Metrics:      &discord.MetricsConfig{},
+		Log:          &logging.Config{},
+		Redis:        &backend.RedisConfig{AuthenticatedConfig: backend.AuthenticatedConfig{Config: &backend.Config{}}},
+		Storage:      &backend.StorageConfig{},
+		Coordination: &backend.CoordinationConfig{},
+		Generations:  &data.GenerationConfig{},
+		RateLimits:   &data.RateLimitConfig{},
+		Scheduler:    &scheduler.Config{},
 	}
 
 	if err = v.Unmarshal(&conf); err != nil {
@@ -82,6 +222,16 @@ func readConfig(v *viper.Viper) error {
 		config = &conf
 	}
 
+	// Exports can be written to standard output, so commands keep their logs out of it
+	if command != "" {
+		conf.Log.Output = []string{"stderr"}
+	}
+
+	// Only commands that talk to Discord need the bot to be configured
+	if command != "" && command != "commands" {
+		conf.Bot = nil
+	}
+
 	if err = common.OptProcess(config); err != nil {
 		return errors.Wrap(err, "failed to process config")
 	}
@@ -116,14 +266,29 @@ func main() {
 
 	f.Bool("version", false, "Show version")
 
+	initializeCommandFlags(f)
+
 	err = readPFlags(f)
 	emperror.Panic(err)
 
-	err = readConfig(v)
+	command := f.Arg(0)
+
+	err = readConfig(v, command)
 	emperror.Panic(err)
 
 	logging.SetStandardLogger(logger)
 
+	if command != "" {
+		if err = runCommand(command, f); err != nil {
+			logger.Error("command failed",
+				slog.String("command", command),
+				slog.Any("error", err))
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	handle = logging.NewSlogHandler(logger)
 	defer emperror.HandleRecover(handle)
 
@@ -141,6 +306,25 @@ func main() {
 	logger.Info("application closing...")
 }
 
+func initializeCommandFlags(f *pflag.FlagSet) {
+	f.StringSlice("guild", nil, "Guilds to export, to import from the file (all guilds in the file by default), or to sync commands to")
+	f.String("file", "-", "File to export to or import from, - for standard output or input")
+	f.String("mode", string(backend.ImportMerge), "How to import into data that already exists, merge or overwrite")
+	f.Bool("dry-run", false, "Report what an import or command sync would change without changing anything")
+}
+
+// runCommand runs a command given on the command line instead of starting the bot
+func runCommand(command string, f *pflag.FlagSet) error {
+	switch command {
+	case "export", "import":
+		return runTransfer(command, f)
+	case "commands":
+		return runCommands(f)
+	}
+
+	return errors.WithDetails(unknownCommand, "command", command)
+}
+
 func initializeServices() error {
 	serviceActors := app.InitializeApp(abort, logger, handle, config)
 	for _, actor := range serviceActors {
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"encoding/json"
+	"github.com/Sxtanna/chromatic_curator/internal/app"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/spf13/pflag"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+)
+
+const (
+	exportGuildsMissing = errors.Sentinel("at least one --guild is required to export")
+	importFileMissing   = errors.Sentinel("--file is required to import")
+)
+
+// runTransfer runs an export or import against the configured backend, without starting the bot
+func runTransfer(command string, f *pflag.FlagSet) error {
+	store := app.NewBackend(logger, config)
+
+	if err := store.Init(config); err != nil {
+		return errors.Wrap(err, "failed to initialize backend")
+	}
+
+	if err := store.Start(); err != nil && !errors.Is(err, common.ServiceStartedNormallyButDoesNotBlock) {
+		return errors.Combine(errors.Wrap(err, "failed to start backend"), store.Close(err))
+	}
+
+	var err error
+
+	switch command {
+	case "export":
+		err = runExport(store, f)
+	case "import":
+		err = runImport(store, f)
+	}
+
+	// The memory backend writes its snapshot on close, so imports into it are kept
+	return errors.Combine(err, store.Close(err))
+}
+
+func runExport(store backend.Backend, f *pflag.FlagSet) error {
+	guilds, _ := f.GetStringSlice("guild")
+	file, _ := f.GetString("file")
+
+	if len(guilds) == 0 {
+		return exportGuildsMissing
+	}
+
+	export, err := backend.ExportGuilds(context.Background(), store, guilds...)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode export")
+	}
+
+	if file == "-" {
+		_, err = os.Stdout.Write(append(encoded, '\n'))
+	} else {
+		err = os.WriteFile(file, encoded, 0o600)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "failed to write export")
+	}
+
+	logger.Info("exported guilds",
+		slog.Int("guilds", len(export.Guilds)),
+		slog.String("file", file))
+
+	return nil
+}
+
+func runImport(store backend.Backend, f *pflag.FlagSet) error {
+	guilds, _ := f.GetStringSlice("guild")
+	file, _ := f.GetString("file")
+	modeName, _ := f.GetString("mode")
+	dryRun, _ := f.GetBool("dry-run")
+
+	mode, err := backend.ParseImportMode(modeName)
+	if err != nil {
+		return err
+	}
+
+	var encoded []byte
+
+	switch file {
+	case "":
+		return importFileMissing
+	case "-":
+		encoded, err = io.ReadAll(os.Stdin)
+	default:
+		encoded, err = os.ReadFile(file)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "failed to read export")
+	}
+
+	var export backend.Export
+	if err = json.Unmarshal(encoded, &export); err != nil {
+		return errors.Wrap(err, "failed to decode export")
+	}
+
+	// Validate everything first, so a bad guild late in the file does not leave an import half done
+	if err = export.Validate(); err != nil {
+		return errors.Wrap(err, "export is not valid")
+	}
+
+	var total backend.ImportReport
+
+	for _, guild := range export.Guilds {
+		if len(guilds) > 0 && !slices.Contains(guilds, guild.Guild) {
+			continue
+		}
+
+		report, err := backend.ImportGuild(context.Background(), store, guild, mode, dryRun)
+		if err != nil {
+			return errors.WrapWithDetails(err, "failed to import guild", "guild", guild.Guild)
+		}
+
+		logger.Info("imported guild",
+			slog.String("guild", guild.Guild),
+			slog.Bool("dry_run", dryRun),
+			slog.Any("report", report))
+
+		total.Add(report)
+	}
+
+	logger.Info("import finished",
+		slog.String("mode", string(mode)),
+		slog.Bool("dry_run", dryRun),
+		slog.Any("report", total))
+
+	return nil
+}
@@ -5,7 +5,11 @@ import (
 	"emperror.dev/errors"
 	"github.com/Sxtanna/chromatic_curator/internal/app/backend"
 	"github.com/Sxtanna/chromatic_curator/internal/app/discord"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
+	"github.com/Sxtanna/chromatic_curator/internal/app/jobs"
+	"github.com/Sxtanna/chromatic_curator/internal/app/scheduler"
 	"github.com/Sxtanna/chromatic_curator/internal/common"
+	systembackend "github.com/Sxtanna/chromatic_curator/internal/system/backend"
 	"log/slog"
 )
 
@@ -13,6 +17,18 @@ var (
 	services = make([]Service, 0)
 )
 
+// StorageService is a backend that runs as a service of the app
+type StorageService interface {
+	systembackend.Backend
+	InitializedService
+}
+
+// CoordinationService is a coordinator that runs as a service of the app
+type CoordinationService interface {
+	systembackend.Coordinator
+	InitializedService
+}
+
 func InitializeApp(abort <-chan struct{}, logger *slog.Logger, handler emperror.ErrorHandler, config common.Configuration) common.Group {
 	group := make(common.Group, 0)
 
@@ -35,10 +51,34 @@ func InitializeApp(abort <-chan struct{}, logger *slog.Logger, handler emperror.
 		)
 	}
 
-	backendService := &backend.RedisBackend{}
+	backendService := NewBackend(logger, config)
+	coordinator := NewCoordinator(logger, backendService)
+
+	healthMonitor := &backend.HealthMonitor{Logger: logger, Backend: backendService}
+
+	settingsCache := backend.NewSettingsCache(logger, backendService, coordinator)
+
+	jobQueue := &jobs.Queue{Logger: logger, Abort: abort}
 
+	botService := &discord.BotService{
+		Logger:      logger,
+		Backend:     settingsCache,
+		Health:      healthMonitor,
+		Coordinator: coordinator,
+		Generations: NewGenerationStore(backendService, config),
+		RateLimiter: NewRateLimiter(backendService),
+		Jobs:        jobQueue,
+	}
+
+	// The coordinator is closed before the backend it shares the connection of, so it can still resign
+	services = append(services, coordinator)
 	services = append(services, backendService)
-	services = append(services, &discord.BotService{Logger: logger, Backend: backendService})
+	services = append(services, healthMonitor)
+	services = append(services, jobQueue)
+	services = append(services, botService)
+	services = append(services, &discord.InteractionServer{Logger: logger, Bot: botService})
+	services = append(services, &discord.MetricsServer{Logger: logger, Bot: botService})
+	services = append(services, &scheduler.Scheduler{Logger: logger, Backend: settingsCache, Health: healthMonitor, Coordinator: coordinator, Bot: botService})
 
 	for _, service := range services {
 		if inits, ok := service.(InitializedService); ok {
@@ -52,3 +92,53 @@ func InitializeApp(abort <-chan struct{}, logger *slog.Logger, handler emperror.
 
 	return group
 }
+
+// NewBackend returns the backend selected by the storage configuration, Redis unless another type is selected
+func NewBackend(logger *slog.Logger, config common.Configuration) StorageService {
+	if storage := common.FindConfiguration[systembackend.StorageConfig](config); storage != nil {
+		switch storage.Type {
+		case systembackend.StorageMemory:
+			return &backend.MemoryBackend{}
+		case systembackend.StorageSQLite:
+			return &backend.SQLiteBackend{}
+		}
+	}
+
+	return &backend.RedisBackend{Logger: logger}
+}
+
+// NewCoordinator returns a coordinator shared through redis when it stores the data, the other backends are
+// not shared between instances
+func NewCoordinator(logger *slog.Logger, store StorageService) CoordinationService {
+	if redis, ok := store.(*backend.RedisBackend); ok {
+		return backend.NewRedisCoordinator(logger, redis)
+	}
+
+	return backend.NewLocalCoordinator()
+}
+
+// NewGenerationStore returns a store of color previews kept in redis when it stores the data, so previews can be
+// shared from any instance, and in memory otherwise
+func NewGenerationStore(store StorageService, config common.Configuration) data.GenerationStore {
+	generations := common.FindConfiguration[data.GenerationConfig](config)
+	if generations == nil {
+		generations = &data.GenerationConfig{}
+		_ = generations.Process()
+	}
+
+	if redis, ok := store.(*backend.RedisBackend); ok {
+		return backend.NewRedisGenerationStore(redis, generations.TTL)
+	}
+
+	return data.NewMemoryGenerationStore(generations.Capacity, generations.TTL)
+}
+
+// NewRateLimiter returns a rate limiter with its buckets in redis when it stores the data, so every instance
+// enforces the same limits, and in memory otherwise
+func NewRateLimiter(store StorageService) data.RateLimiter {
+	if redis, ok := store.(*backend.RedisBackend); ok {
+		return backend.NewRedisRateLimiter(redis)
+	}
+
+	return data.NewMemoryRateLimiter()
+}
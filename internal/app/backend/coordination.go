@@ -0,0 +1,89 @@
+package backend
+
+import (
+	"context"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"sync"
+)
+
+// LocalCoordinator coordinates a single instance, used when the backend cannot be shared between instances.
+// It is always the leader, its locks only exclude goroutines and messages never leave the process.
+type LocalCoordinator struct {
+	mutex    sync.Mutex
+	locks    map[string]chan struct{}
+	handlers map[string][]func(message string)
+}
+
+// NewLocalCoordinator creates a coordinator for a single instance
+func NewLocalCoordinator() *LocalCoordinator {
+	return &LocalCoordinator{
+		locks:    make(map[string]chan struct{}),
+		handlers: make(map[string][]func(message string)),
+	}
+}
+
+func (l *LocalCoordinator) Init(_ common.Configuration) error {
+	return nil
+}
+
+func (l *LocalCoordinator) Start() error {
+	return common.ServiceStartedNormallyButDoesNotBlock
+}
+
+func (l *LocalCoordinator) Close(_ error) error {
+	return nil
+}
+
+func (l *LocalCoordinator) Leader() bool {
+	return true
+}
+
+func (l *LocalCoordinator) OnElected(handler func()) {
+	handler()
+}
+
+func (l *LocalCoordinator) Lock(ctx context.Context, name string) (func(), error) {
+	for {
+		l.mutex.Lock()
+		held, exists := l.locks[name]
+		if !exists {
+			released := make(chan struct{})
+			l.locks[name] = released
+			l.mutex.Unlock()
+
+			return func() {
+				l.mutex.Lock()
+				delete(l.locks, name)
+				l.mutex.Unlock()
+
+				close(released)
+			}, nil
+		}
+		l.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-held:
+		}
+	}
+}
+
+func (l *LocalCoordinator) Publish(_ context.Context, topic string, message string) error {
+	l.mutex.Lock()
+	handlers := l.handlers[topic]
+	l.mutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(message)
+	}
+
+	return nil
+}
+
+func (l *LocalCoordinator) Subscribe(topic string, handler func(message string)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.handlers[topic] = append(l.handlers[topic], handler)
+}
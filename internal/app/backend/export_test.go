@@ -0,0 +1,224 @@
+package backend
+
+import (
+	"context"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"testing"
+)
+
+func TestImportGuild(t *testing.T) {
+	ctx := context.Background()
+
+	export := backend.GuildExport{
+		Guild:     "guild",
+		Settings:  backend.GuildSettings{ApprovalRequired: true, ApprovalChannel: "channel"},
+		Roles:     []backend.PersonalRole{{User: "first", Role: "imported-first"}, {User: "second", Role: "imported-second"}},
+		History:   map[string][]backend.RoleState{"first": {{Color: 0x0000FF}, {Color: 0x00FF00}}},
+		Favorites: map[string][]backend.Favorite{"first": {{Color: 0xFF0000, Label: "red"}}},
+	}
+
+	tests := []struct {
+		name     string
+		mode     backend.ImportMode
+		dryRun   bool
+		want     map[string]string
+		settings bool
+		history  int
+	}{
+		{
+			name:    "merge keeps existing data",
+			mode:    backend.ImportMerge,
+			want:    map[string]string{"first": "existing-first", "second": "imported-second", "third": "existing-third"},
+			history: 1,
+		},
+		{
+			name:     "overwrite replaces the guild",
+			mode:     backend.ImportOverwrite,
+			want:     map[string]string{"first": "imported-first", "second": "imported-second"},
+			settings: true,
+			history:  2,
+		},
+		{
+			name:    "dry run writes nothing",
+			mode:    backend.ImportOverwrite,
+			dryRun:  true,
+			want:    map[string]string{"first": "existing-first", "third": "existing-third"},
+			history: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewMemoryBackend()
+
+			_ = store.SetRolesBatch(ctx, "guild", map[string]string{"first": "existing-first", "third": "existing-third"})
+			_ = store.SetGuildSettings(ctx, "guild", backend.GuildSettings{ApprovalChannel: "existing"})
+			_ = store.PushHistory(ctx, "guild", "first", backend.RoleState{Color: 0xFFFFFF})
+
+			if err := export.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			if _, err := backend.ImportGuild(ctx, store, export, test.mode, test.dryRun); err != nil {
+				t.Fatalf("ImportGuild() error = %v", err)
+			}
+
+			roles, _ := backend.ListAllRoles(ctx, store, "guild")
+			if len(roles) != len(test.want) {
+				t.Errorf("ImportGuild() left %d roles, want %d", len(roles), len(test.want))
+			}
+
+			for _, role := range roles {
+				if test.want[role.User] != role.Role {
+					t.Errorf("role of %s = %q, want %q", role.User, role.Role, test.want[role.User])
+				}
+			}
+
+			if settings, _ := store.GetGuildSettings(ctx, "guild"); settings.ApprovalRequired != test.settings {
+				t.Errorf("ApprovalRequired = %v, want %v", settings.ApprovalRequired, test.settings)
+			}
+
+			history, _ := store.GetHistory(ctx, "guild", "first")
+			if len(history) != test.history {
+				t.Fatalf("history length = %d, want %d", len(history), test.history)
+			}
+
+			if test.history == 2 && history[0].Color != 0x0000FF {
+				t.Errorf("most recent history color = %06X, want 0000FF", history[0].Color)
+			}
+		})
+	}
+}
+
+func TestExportGuild(t *testing.T) {
+	ctx := context.Background()
+	color := 0x123456
+
+	source := NewMemoryBackend()
+
+	_ = source.SetRole(ctx, "guild", "owner", "personal")
+	_ = source.PushHistory(ctx, "guild", "roleless", backend.RoleState{Color: 0x0000FF})
+	_ = source.AddFavorite(ctx, "guild", "roleless", backend.Favorite{Color: 0xFF0000, Label: "red"})
+	_ = source.SetSchedule(ctx, backend.Schedule{Guild: "guild", User: "owner", Source: backend.ScheduleSourceRandom})
+	_ = source.SetGuildTheme(ctx, backend.GuildTheme{Guild: "guild", Theme: "autumn", Applied: true, Originals: map[string]int{"personal": 0x00FF00}})
+	_ = source.SetGroup(ctx, backend.GroupRole{Guild: "guild", Role: "group", Owner: "owner", MaxMembers: 5})
+	_ = source.AddGroupMember(ctx, "guild", "group", "owner", 0)
+	_ = source.AddGroupMember(ctx, "guild", "group", "roleless", 0)
+	_ = source.SetApproval(ctx, backend.ApprovalRequest{Guild: "guild", ID: "request", User: "owner", Color: &color})
+
+	export, err := backend.ExportGuild(ctx, source, "guild")
+	if err != nil {
+		t.Fatalf("ExportGuild() error = %v", err)
+	}
+
+	if err = (&backend.Export{Version: backend.ExportVersion, Guilds: []backend.GuildExport{export}}).Validate(); err != nil {
+		t.Fatalf("Validate() of the export error = %v", err)
+	}
+
+	if len(export.History["roleless"]) != 1 || len(export.Favorites["roleless"]) != 1 {
+		t.Errorf("ExportGuild() left out the history or favorites of a user without a personal role")
+	}
+
+	if len(export.Schedules) != 1 || export.Theme == nil || len(export.Groups) != 1 || len(export.Approvals) != 1 {
+		t.Fatalf("ExportGuild() = %+v, want a schedule, theme, group and approval request", export)
+	}
+
+	target := NewMemoryBackend()
+
+	_ = target.SetSchedule(ctx, backend.Schedule{Guild: "guild", User: "stale", Source: backend.ScheduleSourceRandom})
+	_ = target.SetGroup(ctx, backend.GroupRole{Guild: "guild", Role: "group", Owner: "stale", MaxMembers: 2})
+	_ = target.AddGroupMember(ctx, "guild", "group", "stale", 0)
+	_ = target.AddFavorite(ctx, "guild", "stale", backend.Favorite{Color: 0xFFFFFF})
+
+	report, err := backend.ImportGuild(ctx, target, export, backend.ImportOverwrite, false)
+	if err != nil {
+		t.Fatalf("ImportGuild() error = %v", err)
+	}
+
+	if report.Schedules != 1 || report.Themes != 1 || report.Groups != 1 || report.Approvals != 1 || report.Removed != 2 {
+		t.Errorf("ImportGuild() report = %+v, want one of each and the stale schedule and favorite removed", report)
+	}
+
+	imported, err := backend.ExportGuild(ctx, target, "guild")
+	if err != nil {
+		t.Fatalf("ExportGuild() of the import error = %v", err)
+	}
+
+	if len(imported.Favorites) != 1 || len(imported.History) != 1 || len(imported.Schedules) != 1 {
+		t.Errorf("imported favorites, history and schedules = %v, %v, %v, want only the exported ones",
+			imported.Favorites, imported.History, imported.Schedules)
+	}
+
+	if group := imported.Groups[0]; group.Owner != "owner" || len(group.Members) != 2 || group.Members[1] != "roleless" {
+		t.Errorf("imported group = %+v, want the exported owner and members", group)
+	}
+
+	if imported.Theme == nil || imported.Theme.Originals["personal"] != 0x00FF00 {
+		t.Errorf("imported theme = %+v, want the exported theme", imported.Theme)
+	}
+
+	if request := imported.Approvals[0]; request.Color == nil || *request.Color != color {
+		t.Errorf("imported approval request = %+v, want the exported color", request)
+	}
+}
+
+func TestExportValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		export backend.Export
+		valid  bool
+	}{
+		{
+			name:   "current version",
+			export: backend.Export{Version: backend.ExportVersion, Guilds: []backend.GuildExport{{Guild: "guild"}}},
+			valid:  true,
+		},
+		{
+			name:   "unsupported version",
+			export: backend.Export{Version: backend.ExportVersion + 1},
+		},
+		{
+			name:   "missing guild",
+			export: backend.Export{Version: backend.ExportVersion, Guilds: []backend.GuildExport{{}}},
+		},
+		{
+			name: "duplicated user",
+			export: backend.Export{Version: backend.ExportVersion, Guilds: []backend.GuildExport{{
+				Guild: "guild",
+				Roles: []backend.PersonalRole{{User: "user", Role: "first"}, {User: "user", Role: "second"}},
+			}}},
+		},
+		{
+			name: "schedule of another guild",
+			export: backend.Export{Version: backend.ExportVersion, Guilds: []backend.GuildExport{{
+				Guild:     "guild",
+				Schedules: []backend.Schedule{{Guild: "other", User: "user"}},
+			}}},
+		},
+		{
+			name: "duplicated group",
+			export: backend.Export{Version: backend.ExportVersion, Guilds: []backend.GuildExport{{
+				Guild: "guild",
+				Groups: []backend.GroupExport{
+					{GroupRole: backend.GroupRole{Guild: "guild", Role: "group", Owner: "user"}},
+					{GroupRole: backend.GroupRole{Guild: "guild", Role: "group", Owner: "user"}},
+				},
+			}}},
+		},
+		{
+			name: "color out of range",
+			export: backend.Export{Version: backend.ExportVersion, Guilds: []backend.GuildExport{{
+				Guild:     "guild",
+				Favorites: map[string][]backend.Favorite{"user": {{Color: 0x1000000}}},
+			}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.export.Validate(); (err == nil) != test.valid {
+				t.Errorf("Validate() error = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
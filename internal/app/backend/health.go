@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"context"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthMonitor periodically pings the backend, so commands that need it can be refused while it is unreachable
+// instead of failing halfway through. The backend is assumed healthy until a ping fails.
+type HealthMonitor struct {
+	Logger  *slog.Logger
+	Backend backend.HealthBackend
+
+	interval time.Duration
+	degraded atomic.Bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (h *HealthMonitor) Init(config common.Configuration) error {
+	storageConfiguration := common.FindConfiguration[backend.StorageConfig](config)
+	if storageConfiguration == nil {
+		return storageConfigurationMissing
+	}
+
+	h.interval = storageConfiguration.HealthInterval
+	h.stop = make(chan struct{})
+
+	return nil
+}
+
+func (h *HealthMonitor) Start() error {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return nil
+		case <-ticker.C:
+			h.check()
+		}
+	}
+}
+
+func (h *HealthMonitor) Close(_ error) error {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+
+	return nil
+}
+
+// Healthy reports whether the backend answered the last ping
+func (h *HealthMonitor) Healthy() bool {
+	return !h.degraded.Load()
+}
+
+func (h *HealthMonitor) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), h.interval)
+	defer cancel()
+
+	err := h.Backend.Ping(ctx)
+
+	if err != nil && h.degraded.CompareAndSwap(false, true) {
+		h.Logger.Error("backend is unreachable, entering degraded mode",
+			slog.Any("error", err))
+	}
+
+	if err == nil && h.degraded.CompareAndSwap(true, false) {
+		h.Logger.Info("backend is reachable again, leaving degraded mode")
+	}
+}
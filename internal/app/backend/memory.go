@@ -0,0 +1,781 @@
+package backend
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"encoding/json"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// MemoryBackend keeps all data in memory, for tests and single node deployments that do not want to run redis.
+// When a snapshot file is configured, the data is loaded from it on init and written back to it on close.
+type MemoryBackend struct {
+	snapshot string
+
+	mutex sync.RWMutex
+	state memoryState
+
+	// owners is the reverse index of state.Roles, keyed by guild and then role
+	owners map[string]map[string]string
+}
+
+// memoryState is everything a MemoryBackend stores, in the form it is snapshotted in. Maps are keyed by guild
+// first, and then by user, role or request id.
+type memoryState struct {
+	Roles     map[string]map[string]string                  `json:"roles"`
+	History   map[string]map[string][]backend.RoleState     `json:"history"`
+	Favorites map[string]map[string][]backend.Favorite      `json:"favorites"`
+	Schedules map[string]map[string]backend.Schedule        `json:"schedules"`
+	Themes    map[string]backend.GuildTheme                 `json:"themes"`
+	Groups    map[string]map[string]backend.GroupRole       `json:"groups"`
+	Members   map[string]map[string][]string                `json:"members"`
+	Settings  map[string]backend.GuildSettings              `json:"settings"`
+	Approvals map[string]map[string]backend.ApprovalRequest `json:"approvals"`
+}
+
+// NewMemoryBackend creates an empty memory backend without a snapshot file
+func NewMemoryBackend() *MemoryBackend {
+	m := &MemoryBackend{}
+	m.reset(memoryState{})
+
+	return m
+}
+
+func (m *MemoryBackend) Init(config common.Configuration) error {
+	m.reset(memoryState{})
+
+	if storageConfiguration := common.FindConfiguration[backend.StorageConfig](config); storageConfiguration != nil {
+		m.snapshot = storageConfiguration.Snapshot
+	}
+
+	if m.snapshot == "" {
+		return nil
+	}
+
+	encoded, err := os.ReadFile(m.snapshot)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "could not read memory snapshot")
+	}
+
+	var state memoryState
+	if err = json.Unmarshal(encoded, &state); err != nil {
+		return errors.Wrap(err, "could not decode memory snapshot")
+	}
+
+	m.reset(state)
+
+	return nil
+}
+
+func (m *MemoryBackend) Start() error {
+	return common.ServiceStartedNormallyButDoesNotBlock
+}
+
+func (m *MemoryBackend) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (m *MemoryBackend) Close(_ error) error {
+	if m.snapshot == "" {
+		return nil
+	}
+
+	m.mutex.RLock()
+	encoded, err := json.Marshal(m.state)
+	m.mutex.RUnlock()
+
+	if err != nil {
+		return errors.Wrap(err, "could not encode memory snapshot")
+	}
+
+	// Write next to the snapshot first, so a crash while writing does not destroy the previous snapshot
+	temporary, err := os.CreateTemp(filepath.Dir(m.snapshot), filepath.Base(m.snapshot)+".*")
+	if err != nil {
+		return errors.Wrap(err, "could not create memory snapshot")
+	}
+
+	if _, err = temporary.Write(encoded); err != nil {
+		return errors.Combine(errors.Wrap(err, "could not write memory snapshot"), temporary.Close(), os.Remove(temporary.Name()))
+	}
+
+	if err = temporary.Close(); err != nil {
+		return errors.Combine(errors.Wrap(err, "could not write memory snapshot"), os.Remove(temporary.Name()))
+	}
+
+	return errors.Wrap(os.Rename(temporary.Name(), m.snapshot), "could not replace memory snapshot")
+}
+
+// reset replaces the stored data, filling in missing maps and rebuilding the reverse role index
+func (m *MemoryBackend) reset(state memoryState) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ensureMap(&state.Roles)
+	ensureMap(&state.History)
+	ensureMap(&state.Favorites)
+	ensureMap(&state.Schedules)
+	ensureMap(&state.Themes)
+	ensureMap(&state.Groups)
+	ensureMap(&state.Members)
+	ensureMap(&state.Settings)
+	ensureMap(&state.Approvals)
+
+	m.state = state
+	m.owners = make(map[string]map[string]string, len(state.Roles))
+
+	for guild, roles := range state.Roles {
+		for user, role := range roles {
+			guildMap(m.owners, guild)[role] = user
+		}
+	}
+}
+
+// lock takes the write lock, unless the context is already done
+func (m *MemoryBackend) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+
+	return nil
+}
+
+// rlock takes the read lock, unless the context is already done
+func (m *MemoryBackend) rlock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.RLock()
+
+	return nil
+}
+
+func ensureMap[K comparable, V any](target *map[K]V) {
+	if *target == nil {
+		*target = make(map[K]V)
+	}
+}
+
+// guildMap returns the inner map of a guild, creating it if it does not exist yet
+func guildMap[V any](outer map[string]map[string]V, guild string) map[string]V {
+	inner, ok := outer[guild]
+	if !ok {
+		inner = make(map[string]V)
+		outer[guild] = inner
+	}
+
+	return inner
+}
+
+func (m *MemoryBackend) GetRole(ctx context.Context, guild string, user string) (string, error) {
+	if err := m.rlock(ctx); err != nil {
+		return "", err
+	}
+
+	defer m.mutex.RUnlock()
+
+	return m.state.Roles[guild][user], nil
+}
+
+func (m *MemoryBackend) SetRole(ctx context.Context, guild string, user string, role string) error {
+	return m.SetRolesBatch(ctx, guild, map[string]string{user: role})
+}
+
+func (m *MemoryBackend) DeleteRole(ctx context.Context, guild string, user string) (string, error) {
+	if err := m.lock(ctx); err != nil {
+		return "", err
+	}
+
+	defer m.mutex.Unlock()
+
+	role, ok := m.state.Roles[guild][user]
+	if !ok {
+		return "", nil
+	}
+
+	delete(m.state.Roles[guild], user)
+	delete(m.owners[guild], role)
+
+	return role, nil
+}
+
+func (m *MemoryBackend) GetRoleOwner(ctx context.Context, guild string, role string) (string, error) {
+	if err := m.rlock(ctx); err != nil {
+		return "", err
+	}
+
+	defer m.mutex.RUnlock()
+
+	return m.owners[guild][role], nil
+}
+
+func (m *MemoryBackend) ListRoles(ctx context.Context, guild string, cursor string, limit int) ([]backend.PersonalRole, string, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, "", err
+	}
+
+	defer m.mutex.RUnlock()
+
+	// The cursor is the last user of the previous page, users are listed in order so pages never overlap
+	users := make([]string, 0, len(m.state.Roles[guild]))
+	for user := range m.state.Roles[guild] {
+		if user > cursor {
+			users = append(users, user)
+		}
+	}
+
+	sort.Strings(users)
+
+	next := ""
+	if limit > 0 && len(users) > limit {
+		users = users[:limit]
+		next = users[limit-1]
+	}
+
+	roles := make([]backend.PersonalRole, 0, len(users))
+	for _, user := range users {
+		roles = append(roles, backend.PersonalRole{User: user, Role: m.state.Roles[guild][user]})
+	}
+
+	return roles, next, nil
+}
+
+func (m *MemoryBackend) GetRolesBatch(ctx context.Context, guild string, users []string) (map[string]string, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	roles := make(map[string]string, len(users))
+
+	for _, user := range users {
+		if role, ok := m.state.Roles[guild][user]; ok {
+			roles[user] = role
+		}
+	}
+
+	return roles, nil
+}
+
+func (m *MemoryBackend) SetRolesBatch(ctx context.Context, guild string, roles map[string]string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	guildRoles := guildMap(m.state.Roles, guild)
+	guildOwners := guildMap(m.owners, guild)
+
+	for user, role := range roles {
+		// Replaced roles no longer belong to anyone, drop them from the reverse index
+		if old, ok := guildRoles[user]; ok && old != role {
+			delete(guildOwners, old)
+		}
+
+		guildRoles[user] = role
+		guildOwners[role] = user
+	}
+
+	return nil
+}
+
+func (m *MemoryBackend) PushHistory(ctx context.Context, guild string, user string, state backend.RoleState) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	guildHistory := guildMap(m.state.History, guild)
+
+	history := append([]backend.RoleState{state}, guildHistory[user]...)
+	if len(history) > backend.MaxHistoryEntries {
+		history = history[:backend.MaxHistoryEntries]
+	}
+
+	guildHistory[user] = history
+
+	return nil
+}
+
+func (m *MemoryBackend) PopHistory(ctx context.Context, guild string, user string) (*backend.RoleState, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.Unlock()
+
+	history := m.state.History[guild][user]
+	if len(history) == 0 {
+		return nil, nil
+	}
+
+	state := history[0]
+	m.state.History[guild][user] = history[1:]
+
+	return &state, nil
+}
+
+func (m *MemoryBackend) GetHistory(ctx context.Context, guild string, user string) ([]backend.RoleState, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	return slices.Clone(m.state.History[guild][user]), nil
+}
+
+func (m *MemoryBackend) ListHistoryUsers(ctx context.Context, guild string) ([]string, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	return usersWithEntries(m.state.History[guild]), nil
+}
+
+func (m *MemoryBackend) AddFavorite(ctx context.Context, guild string, user string, favorite backend.Favorite) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	guildFavorites := guildMap(m.state.Favorites, guild)
+	favorites := guildFavorites[user]
+
+	index := slices.IndexFunc(favorites, func(existing backend.Favorite) bool {
+		return existing.Color == favorite.Color
+	})
+
+	if index >= 0 {
+		favorites = slices.Delete(favorites, index, index+1)
+	} else if len(favorites) >= backend.MaxFavorites {
+		return backend.FavoriteLimitReached
+	}
+
+	guildFavorites[user] = append(favorites, favorite)
+
+	return nil
+}
+
+func (m *MemoryBackend) RemoveFavorite(ctx context.Context, guild string, user string, color int) (bool, error) {
+	if err := m.lock(ctx); err != nil {
+		return false, err
+	}
+
+	defer m.mutex.Unlock()
+
+	favorites := m.state.Favorites[guild][user]
+
+	index := slices.IndexFunc(favorites, func(existing backend.Favorite) bool {
+		return existing.Color == color
+	})
+
+	if index < 0 {
+		return false, nil
+	}
+
+	m.state.Favorites[guild][user] = slices.Delete(favorites, index, index+1)
+
+	return true, nil
+}
+
+func (m *MemoryBackend) GetFavorites(ctx context.Context, guild string, user string) ([]backend.Favorite, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	favorites := slices.Clone(m.state.Favorites[guild][user])
+	if favorites == nil {
+		favorites = make([]backend.Favorite, 0)
+	}
+
+	sort.SliceStable(favorites, func(i, j int) bool {
+		return favorites[i].Time.Before(favorites[j].Time)
+	})
+
+	return favorites, nil
+}
+
+func (m *MemoryBackend) ListFavoriteUsers(ctx context.Context, guild string) ([]string, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	return usersWithEntries(m.state.Favorites[guild]), nil
+}
+
+// usersWithEntries returns the sorted users of a guild whose list is not empty
+func usersWithEntries[V any](guildEntries map[string][]V) []string {
+	users := make([]string, 0, len(guildEntries))
+
+	for user, entries := range guildEntries {
+		if len(entries) > 0 {
+			users = append(users, user)
+		}
+	}
+
+	sort.Strings(users)
+
+	return users
+}
+
+func (m *MemoryBackend) SetSchedule(ctx context.Context, schedule backend.Schedule) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	guildMap(m.state.Schedules, schedule.Guild)[schedule.User] = schedule
+
+	return nil
+}
+
+func (m *MemoryBackend) GetSchedule(ctx context.Context, guild string, user string) (*backend.Schedule, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	schedule, ok := m.state.Schedules[guild][user]
+	if !ok {
+		return nil, nil
+	}
+
+	return &schedule, nil
+}
+
+func (m *MemoryBackend) DeleteSchedule(ctx context.Context, guild string, user string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	delete(m.state.Schedules[guild], user)
+
+	return nil
+}
+
+func (m *MemoryBackend) ListSchedules(ctx context.Context) ([]backend.Schedule, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	schedules := make([]backend.Schedule, 0)
+
+	for _, guildSchedules := range m.state.Schedules {
+		for _, schedule := range guildSchedules {
+			schedules = append(schedules, schedule)
+		}
+	}
+
+	return schedules, nil
+}
+
+func (m *MemoryBackend) ListGuildSchedules(ctx context.Context, guild string) ([]backend.Schedule, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	return slices.AppendSeq(make([]backend.Schedule, 0), maps.Values(m.state.Schedules[guild])), nil
+}
+
+func (m *MemoryBackend) SetGuildTheme(ctx context.Context, theme backend.GuildTheme) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	m.state.Themes[theme.Guild] = theme
+
+	return nil
+}
+
+func (m *MemoryBackend) GetGuildTheme(ctx context.Context, guild string) (*backend.GuildTheme, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	theme, ok := m.state.Themes[guild]
+	if !ok {
+		return nil, nil
+	}
+
+	return &theme, nil
+}
+
+func (m *MemoryBackend) DeleteGuildTheme(ctx context.Context, guild string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	delete(m.state.Themes, guild)
+
+	return nil
+}
+
+func (m *MemoryBackend) ListGuildThemes(ctx context.Context) ([]backend.GuildTheme, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	themes := make([]backend.GuildTheme, 0, len(m.state.Themes))
+	for _, theme := range m.state.Themes {
+		themes = append(themes, theme)
+	}
+
+	return themes, nil
+}
+
+func (m *MemoryBackend) SetGroup(ctx context.Context, group backend.GroupRole) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	guildMap(m.state.Groups, group.Guild)[group.Role] = group
+
+	return nil
+}
+
+func (m *MemoryBackend) GetGroup(ctx context.Context, guild string, role string) (*backend.GroupRole, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	group, ok := m.state.Groups[guild][role]
+	if !ok {
+		return nil, nil
+	}
+
+	return &group, nil
+}
+
+func (m *MemoryBackend) DeleteGroup(ctx context.Context, guild string, role string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	delete(m.state.Members[guild], role)
+	delete(m.state.Groups[guild], role)
+
+	return nil
+}
+
+func (m *MemoryBackend) AddGroupMember(ctx context.Context, guild string, role string, user string, limit int) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	guildMembers := guildMap(m.state.Members, guild)
+	members := guildMembers[role]
+
+	if slices.Contains(members, user) {
+		return nil
+	}
+
+	if limit > 0 && len(members) >= limit {
+		return backend.GroupMemberLimitReached
+	}
+
+	guildMembers[role] = append(members, user)
+
+	return nil
+}
+
+func (m *MemoryBackend) RemoveGroupMember(ctx context.Context, guild string, role string, user string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	members := m.state.Members[guild][role]
+
+	if index := slices.Index(members, user); index >= 0 {
+		m.state.Members[guild][role] = slices.Delete(members, index, index+1)
+	}
+
+	return nil
+}
+
+func (m *MemoryBackend) GetGroupMembers(ctx context.Context, guild string, role string) ([]string, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	members := append(make([]string, 0), m.state.Members[guild][role]...)
+	sort.Strings(members)
+
+	return members, nil
+}
+
+func (m *MemoryBackend) GetMemberGroups(ctx context.Context, guild string, user string) ([]string, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	groups := make([]string, 0)
+
+	for role, members := range m.state.Members[guild] {
+		if slices.Contains(members, user) {
+			groups = append(groups, role)
+		}
+	}
+
+	sort.Strings(groups)
+
+	return groups, nil
+}
+
+func (m *MemoryBackend) ListGroups(ctx context.Context, guild string) ([]backend.GroupRole, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	return slices.AppendSeq(make([]backend.GroupRole, 0), maps.Values(m.state.Groups[guild])), nil
+}
+
+func (m *MemoryBackend) GetGuildSettings(ctx context.Context, guild string) (backend.GuildSettings, error) {
+	if err := m.rlock(ctx); err != nil {
+		return backend.GuildSettings{}, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	return m.state.Settings[guild], nil
+}
+
+func (m *MemoryBackend) SetGuildSettings(ctx context.Context, guild string, settings backend.GuildSettings) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	// The rate limits are copied, so changing the given settings afterwards does not change the stored ones
+	settings.RateLimits = maps.Clone(settings.RateLimits)
+	m.state.Settings[guild] = settings
+
+	return nil
+}
+
+func (m *MemoryBackend) SetApproval(ctx context.Context, request backend.ApprovalRequest) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	guildMap(m.state.Approvals, request.Guild)[request.ID] = request
+
+	return nil
+}
+
+func (m *MemoryBackend) GetApproval(ctx context.Context, guild string, id string) (*backend.ApprovalRequest, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	request, ok := m.state.Approvals[guild][id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &request, nil
+}
+
+func (m *MemoryBackend) DeleteApproval(ctx context.Context, guild string, id string) error {
+	if err := m.lock(ctx); err != nil {
+		return err
+	}
+
+	defer m.mutex.Unlock()
+
+	delete(m.state.Approvals[guild], id)
+
+	return nil
+}
+
+func (m *MemoryBackend) ListApprovals(ctx context.Context) ([]backend.ApprovalRequest, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	requests := make([]backend.ApprovalRequest, 0)
+
+	for _, guildRequests := range m.state.Approvals {
+		for _, request := range guildRequests {
+			requests = append(requests, request)
+		}
+	}
+
+	return requests, nil
+}
+
+func (m *MemoryBackend) ListGuildApprovals(ctx context.Context, guild string) ([]backend.ApprovalRequest, error) {
+	if err := m.rlock(ctx); err != nil {
+		return nil, err
+	}
+
+	defer m.mutex.RUnlock()
+
+	return slices.AppendSeq(make([]backend.ApprovalRequest, 0), maps.Values(m.state.Approvals[guild])), nil
+}
@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"context"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend/backendtest"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		return NewMemoryBackend()
+	})
+}
+
+func TestMemoryBackendSnapshot(t *testing.T) {
+	ctx := context.Background()
+	config := &backend.StorageConfig{Type: backend.StorageMemory, Snapshot: filepath.Join(t.TempDir(), "snapshot.json")}
+
+	first := &MemoryBackend{}
+	if err := first.Init(config); err != nil {
+		t.Fatalf("Init() on missing snapshot error = %v", err)
+	}
+
+	if err := first.SetRole(ctx, "guild", "user", "role"); err != nil {
+		t.Fatalf("SetRole() error = %v", err)
+	}
+
+	if err := first.SetGuildSettings(ctx, "guild", backend.GuildSettings{ApprovalRequired: true}); err != nil {
+		t.Fatalf("SetGuildSettings() error = %v", err)
+	}
+
+	if err := first.Close(nil); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	second := &MemoryBackend{}
+	if err := second.Init(config); err != nil {
+		t.Fatalf("Init() on snapshot error = %v", err)
+	}
+
+	if role, _ := second.GetRole(ctx, "guild", "user"); role != "role" {
+		t.Errorf("GetRole() = %q, want %q", role, "role")
+	}
+
+	if owner, _ := second.GetRoleOwner(ctx, "guild", "role"); owner != "user" {
+		t.Errorf("GetRoleOwner() = %q, want %q", owner, "user")
+	}
+
+	if settings, _ := second.GetGuildSettings(ctx, "guild"); !settings.ApprovalRequired {
+		t.Errorf("GetGuildSettings() lost ApprovalRequired")
+	}
+}
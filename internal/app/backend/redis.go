@@ -2,51 +2,199 @@ package backend
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"emperror.dev/errors"
+	"encoding/json"
 	"github.com/Sxtanna/chromatic_curator/internal/common"
 	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
 	goredis "github.com/redis/go-redis/v9"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	configurationMissing = errors.Sentinel("redis configuration missing")
+	invalidCertificates  = errors.Sentinel("no certificates found in redis CA file")
 )
 
+// addFavorite saves a favorite unless the user is at the limit and it is not a color they already saved, checking
+// and writing in one step so concurrent adds cannot go past the limit. Returns 1 when the favorite was saved.
+var addFavorite = goredis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 and redis.call("HLEN", KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+
+return 1
+`)
+
+// addGroupMember adds a member to a group role unless it is at the limit and they are not a member yet, checking and
+// writing in one step so concurrent joins cannot go past the limit. Returns 1 when the user is a member afterwards.
+var addGroupMember = goredis.NewScript(`
+if redis.call("SISMEMBER", KEYS[1], ARGV[1]) == 0 and tonumber(ARGV[3]) > 0 and redis.call("SCARD", KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+
+redis.call("SADD", KEYS[1], ARGV[1])
+redis.call("SADD", KEYS[2], ARGV[2])
+
+return 1
+`)
+
 type RedisBackend struct {
-	client *goredis.Client
+	Logger *slog.Logger
+
+	client goredis.UniversalClient
+	retry  backend.RetryConfig
+
+	prefix  string
+	cluster bool
+
+	closing   chan struct{}
+	closeOnce sync.Once
 }
 
 func (r *RedisBackend) Init(config common.Configuration) error {
-	redisConfiguration := common.FindConfiguration[backend.Config](config)
+	redisConfiguration := common.FindConfiguration[backend.RedisConfig](config)
 	if redisConfiguration == nil {
 		return configurationMissing
 	}
 
-	r.client = goredis.NewClient(&goredis.Options{
-		Addr:     redisConfiguration.Host + ":" + strconv.Itoa(redisConfiguration.Port),
-		Password: "",
-		DB:       0,
-	})
+	options := &goredis.UniversalOptions{
+		Addrs:            redisConfiguration.Addresses,
+		MasterName:       redisConfiguration.MasterName,
+		Username:         redisConfiguration.Username,
+		Password:         redisConfiguration.Password,
+		SentinelPassword: redisConfiguration.SentinelPassword,
+		DB:               redisConfiguration.DB,
+		PoolSize:         redisConfiguration.PoolSize,
+		MinIdleConns:     redisConfiguration.MinIdleConns,
+		DialTimeout:      redisConfiguration.DialTimeout,
+		ReadTimeout:      redisConfiguration.ReadTimeout,
+		WriteTimeout:     redisConfiguration.WriteTimeout,
+	}
+
+	if len(options.Addrs) == 0 {
+		options.Addrs = []string{redisConfiguration.Host + ":" + strconv.Itoa(redisConfiguration.Port)}
+	}
+
+	if redisConfiguration.TLS.Enabled {
+		tlsConfig, err := redisTLSConfig(redisConfiguration.TLS)
+		if err != nil {
+			return err
+		}
+
+		options.TLSConfig = tlsConfig
+	}
+
+	r.prefix = redisConfiguration.Prefix
+	r.retry = redisConfiguration.Retry
+	r.closing = make(chan struct{})
+
+	switch redisConfiguration.Mode {
+	case backend.RedisSentinel:
+		r.client = goredis.NewFailoverClient(options.Failover())
+	case backend.RedisCluster:
+		r.client = goredis.NewClusterClient(options.Cluster())
+		r.cluster = true
+	default:
+		r.client = goredis.NewClient(options.Simple())
+	}
 
 	return nil
 }
 
+func redisTLSConfig(config backend.RedisTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if config.CA == "" {
+		return tlsConfig, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	certificates, err := os.ReadFile(config.CA)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read redis CA file")
+	}
+
+	if !pool.AppendCertsFromPEM(certificates) {
+		return nil, invalidCertificates
+	}
+
+	tlsConfig.RootCAs = pool
+
+	return tlsConfig, nil
+}
+
+// guildKey builds the key of data belonging to a guild. In cluster mode the guild is a hash tag, so every key
+// of a guild lives in the same slot and multi-key transactions of a guild stay possible
+func (r *RedisBackend) guildKey(guild string, parts ...string) string {
+	if r.cluster {
+		guild = "{" + guild + "}"
+	}
+
+	return r.globalKey(append([]string{guild}, parts...)...)
+}
+
+// globalKey builds the key of data shared by every guild
+func (r *RedisBackend) globalKey(parts ...string) string {
+	return r.prefix + ":" + strings.Join(parts, ":")
+}
+
 func (r *RedisBackend) Start() error {
+	// Redis is routinely still starting alongside the bot, give it time before giving up
+	err := common.Retry(r.closing, r.retry.Attempts, r.retry.InitialBackoff, r.retry.MaxBackoff,
+		func() error {
+			return r.Ping(context.Background())
+		},
+		func(attempt int, wait time.Duration, err error) {
+			r.Logger.Warn("could not connect to redis database, retrying",
+				slog.Any("error", err),
+				slog.Int("attempt", attempt+1),
+				slog.Duration("wait", wait))
+		})
 
-	if _, err := r.client.Ping(context.Background()).Result(); err != nil {
+	if err != nil {
 		return errors.Wrap(err, "could not connect to redis database")
 	}
 
+	if err := r.rebuildOwnerIndex(context.Background()); err != nil {
+		return errors.Wrap(err, "could not rebuild role owner index")
+	}
+
 	return common.ServiceStartedNormallyButDoesNotBlock
 }
 
 func (r *RedisBackend) Close(_ error) error {
+	r.closeOnce.Do(func() {
+		close(r.closing)
+	})
+
 	return r.client.Close()
 }
 
+func (r *RedisBackend) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
 func (r *RedisBackend) GetRole(ctx context.Context, guild string, user string) (string, error) {
-	val, err := r.client.HGet(ctx, "curator:"+guild+":roles", user).Result()
+	val, err := r.client.HGet(ctx, r.rolesKey(guild), user).Result()
 	if errors.Is(err, goredis.Nil) {
 		return "", nil
 	}
@@ -55,5 +203,731 @@ func (r *RedisBackend) GetRole(ctx context.Context, guild string, user string) (
 }
 
 func (r *RedisBackend) SetRole(ctx context.Context, guild string, user string, role string) error {
-	return r.client.HSet(ctx, "curator:"+guild+":roles", user, role).Err()
+	return r.SetRolesBatch(ctx, guild, map[string]string{user: role})
+}
+
+func (r *RedisBackend) DeleteRole(ctx context.Context, guild string, user string) (string, error) {
+	role, err := r.GetRole(ctx, guild, user)
+	if err != nil || role == "" {
+		return "", err
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HDel(ctx, r.rolesKey(guild), user)
+		pipe.HDel(ctx, r.ownersKey(guild), role)
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
+
+func (r *RedisBackend) GetRoleOwner(ctx context.Context, guild string, role string) (string, error) {
+	val, err := r.client.HGet(ctx, r.ownersKey(guild), role).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", nil
+	}
+
+	return val, err
+}
+
+func (r *RedisBackend) ListRoles(ctx context.Context, guild string, cursor string, limit int) ([]backend.PersonalRole, string, error) {
+	var position uint64
+
+	if cursor != "" {
+		parsed, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "invalid role cursor")
+		}
+
+		position = parsed
+	}
+
+	vals, next, err := r.client.HScan(ctx, r.rolesKey(guild), position, "", int64(limit)).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	roles := make([]backend.PersonalRole, 0, len(vals)/2)
+	for index := 0; index+1 < len(vals); index += 2 {
+		roles = append(roles, backend.PersonalRole{User: vals[index], Role: vals[index+1]})
+	}
+
+	if next == 0 {
+		return roles, "", nil
+	}
+
+	return roles, strconv.FormatUint(next, 10), nil
+}
+
+func (r *RedisBackend) GetRolesBatch(ctx context.Context, guild string, users []string) (map[string]string, error) {
+	roles := make(map[string]string, len(users))
+	if len(users) == 0 {
+		return roles, nil
+	}
+
+	vals, err := r.client.HMGet(ctx, r.rolesKey(guild), users...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for index, val := range vals {
+		if role, ok := val.(string); ok && role != "" {
+			roles[users[index]] = role
+		}
+	}
+
+	return roles, nil
+}
+
+func (r *RedisBackend) SetRolesBatch(ctx context.Context, guild string, roles map[string]string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	users := make([]string, 0, len(roles))
+	for user := range roles {
+		users = append(users, user)
+	}
+
+	previous, err := r.GetRolesBatch(ctx, guild, users)
+	if err != nil {
+		return errors.Wrap(err, "failed to get previous roles")
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for user, role := range roles {
+			// Replaced roles no longer belong to anyone, drop them from the reverse index
+			if old, ok := previous[user]; ok && old != role {
+				pipe.HDel(ctx, r.ownersKey(guild), old)
+			}
+
+			pipe.HSet(ctx, r.rolesKey(guild), user, role)
+			pipe.HSet(ctx, r.ownersKey(guild), role, user)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// rebuildOwnerIndex fills the reverse index of guilds whose personal roles were stored before it existed
+func (r *RedisBackend) rebuildOwnerIndex(ctx context.Context) error {
+	// Keys are spread across the masters of a cluster, each one has to be scanned
+	if cluster, ok := r.client.(*goredis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, client *goredis.Client) error {
+			return r.rebuildOwnerIndexOf(ctx, client)
+		})
+	}
+
+	return r.rebuildOwnerIndexOf(ctx, r.client)
+}
+
+func (r *RedisBackend) rebuildOwnerIndexOf(ctx context.Context, client goredis.Cmdable) error {
+	iter := client.Scan(ctx, 0, r.globalKey("*", "roles"), 0).Iterator()
+
+	for iter.Next(ctx) {
+		guild := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), r.prefix+":"), ":roles")
+		guild = strings.TrimSuffix(strings.TrimPrefix(guild, "{"), "}")
+
+		exists, err := r.client.Exists(ctx, r.ownersKey(guild)).Result()
+		if err != nil {
+			return err
+		}
+
+		if exists > 0 {
+			continue
+		}
+
+		roles, err := r.client.HGetAll(ctx, r.rolesKey(guild)).Result()
+		if err != nil {
+			return err
+		}
+
+		owners := make(map[string]string, len(roles))
+		for user, role := range roles {
+			owners[role] = user
+		}
+
+		if len(owners) > 0 {
+			if err = r.client.HSet(ctx, r.ownersKey(guild), owners).Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return iter.Err()
+}
+
+func (r *RedisBackend) rolesKey(guild string) string {
+	return r.guildKey(guild, "roles")
+}
+
+func (r *RedisBackend) ownersKey(guild string) string {
+	return r.guildKey(guild, "owners")
+}
+
+func (r *RedisBackend) PushHistory(ctx context.Context, guild string, user string, state backend.RoleState) error {
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode role state")
+	}
+
+	key := r.historyKey(guild, user)
+
+	_, err = r.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.LPush(ctx, key, encoded)
+		pipe.LTrim(ctx, key, 0, backend.MaxHistoryEntries-1)
+		return nil
+	})
+
+	return err
+}
+
+func (r *RedisBackend) PopHistory(ctx context.Context, guild string, user string) (*backend.RoleState, error) {
+	val, err := r.client.LPop(ctx, r.historyKey(guild, user)).Result()
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var state backend.RoleState
+	if err = json.Unmarshal([]byte(val), &state); err != nil {
+		return nil, errors.Wrap(err, "failed to decode role state")
+	}
+
+	return &state, nil
+}
+
+func (r *RedisBackend) GetHistory(ctx context.Context, guild string, user string) ([]backend.RoleState, error) {
+	vals, err := r.client.LRange(ctx, r.historyKey(guild, user), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]backend.RoleState, 0, len(vals))
+
+	for _, val := range vals {
+		var state backend.RoleState
+		if err = json.Unmarshal([]byte(val), &state); err != nil {
+			return nil, errors.Wrap(err, "failed to decode role state")
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+func (r *RedisBackend) ListHistoryUsers(ctx context.Context, guild string) ([]string, error) {
+	return r.scanGuildUsers(ctx, guild, "history")
+}
+
+// scanGuildUsers returns the users of a guild that have a key of the given kind, such as their history
+func (r *RedisBackend) scanGuildUsers(ctx context.Context, guild string, kind string) ([]string, error) {
+	prefix := r.guildKey(guild, kind) + ":"
+
+	var client goredis.Cmdable = r.client
+
+	// Every key of a guild lives in the slot of its hash tag, only the master owning it has to be scanned
+	if cluster, ok := r.client.(*goredis.ClusterClient); ok {
+		master, err := cluster.MasterForKey(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		client = master
+	}
+
+	users := make([]string, 0)
+	iter := client.Scan(ctx, 0, prefix+"*", 0).Iterator()
+
+	for iter.Next(ctx) {
+		users = append(users, strings.TrimPrefix(iter.Val(), prefix))
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	// A scan may return a key more than once
+	sort.Strings(users)
+
+	return slices.Compact(users), nil
+}
+
+func (r *RedisBackend) historyKey(guild string, user string) string {
+	return r.guildKey(guild, "history", user)
+}
+
+func (r *RedisBackend) AddFavorite(ctx context.Context, guild string, user string, favorite backend.Favorite) error {
+	encoded, err := json.Marshal(favorite)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode favorite")
+	}
+
+	added, err := addFavorite.Run(ctx, r.client, []string{r.favoritesKey(guild, user)},
+		strconv.Itoa(favorite.Color), encoded, backend.MaxFavorites).Int()
+	if err != nil {
+		return err
+	}
+
+	if added == 0 {
+		return backend.FavoriteLimitReached
+	}
+
+	return nil
+}
+
+func (r *RedisBackend) RemoveFavorite(ctx context.Context, guild string, user string, color int) (bool, error) {
+	removed, err := r.client.HDel(ctx, r.favoritesKey(guild, user), strconv.Itoa(color)).Result()
+	return removed > 0, err
+}
+
+func (r *RedisBackend) GetFavorites(ctx context.Context, guild string, user string) ([]backend.Favorite, error) {
+	vals, err := r.client.HVals(ctx, r.favoritesKey(guild, user)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	favorites := make([]backend.Favorite, 0, len(vals))
+
+	for _, val := range vals {
+		var favorite backend.Favorite
+		if err = json.Unmarshal([]byte(val), &favorite); err != nil {
+			return nil, errors.Wrap(err, "failed to decode favorite")
+		}
+
+		favorites = append(favorites, favorite)
+	}
+
+	sort.Slice(favorites, func(i, j int) bool {
+		return favorites[i].Time.Before(favorites[j].Time)
+	})
+
+	return favorites, nil
+}
+
+func (r *RedisBackend) ListFavoriteUsers(ctx context.Context, guild string) ([]string, error) {
+	return r.scanGuildUsers(ctx, guild, "favorites")
+}
+
+func (r *RedisBackend) favoritesKey(guild string, user string) string {
+	return r.guildKey(guild, "favorites", user)
+}
+
+func (r *RedisBackend) SetSchedule(ctx context.Context, schedule backend.Schedule) error {
+	encoded, err := json.Marshal(schedule)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode schedule")
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(ctx, r.schedulesKey(schedule.Guild), schedule.User, encoded)
+		pipe.SAdd(ctx, r.scheduleGuildsKey(), schedule.Guild)
+		return nil
+	})
+
+	return err
+}
+
+func (r *RedisBackend) GetSchedule(ctx context.Context, guild string, user string) (*backend.Schedule, error) {
+	val, err := r.client.HGet(ctx, r.schedulesKey(guild), user).Result()
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule backend.Schedule
+	if err = json.Unmarshal([]byte(val), &schedule); err != nil {
+		return nil, errors.Wrap(err, "failed to decode schedule")
+	}
+
+	return &schedule, nil
+}
+
+func (r *RedisBackend) DeleteSchedule(ctx context.Context, guild string, user string) error {
+	return r.client.HDel(ctx, r.schedulesKey(guild), user).Err()
+}
+
+func (r *RedisBackend) ListSchedules(ctx context.Context) ([]backend.Schedule, error) {
+	guilds, err := r.client.SMembers(ctx, r.scheduleGuildsKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := make([]backend.Schedule, 0)
+
+	for _, guild := range guilds {
+		guildSchedules, err := r.ListGuildSchedules(ctx, guild)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(guildSchedules) == 0 {
+			r.client.SRem(ctx, r.scheduleGuildsKey(), guild)
+			continue
+		}
+
+		schedules = append(schedules, guildSchedules...)
+	}
+
+	return schedules, nil
+}
+
+func (r *RedisBackend) ListGuildSchedules(ctx context.Context, guild string) ([]backend.Schedule, error) {
+	vals, err := r.client.HVals(ctx, r.schedulesKey(guild)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := make([]backend.Schedule, 0, len(vals))
+
+	for _, val := range vals {
+		var schedule backend.Schedule
+		if err = json.Unmarshal([]byte(val), &schedule); err != nil {
+			return nil, errors.Wrap(err, "failed to decode schedule")
+		}
+
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, nil
+}
+
+func (r *RedisBackend) scheduleGuildsKey() string {
+	return r.globalKey("schedules", "guilds")
+}
+
+func (r *RedisBackend) schedulesKey(guild string) string {
+	return r.guildKey(guild, "schedules")
+}
+
+func (r *RedisBackend) SetGuildTheme(ctx context.Context, theme backend.GuildTheme) error {
+	encoded, err := json.Marshal(theme)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode guild theme")
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Set(ctx, r.themeKey(theme.Guild), encoded, 0)
+		pipe.SAdd(ctx, r.themeGuildsKey(), theme.Guild)
+		return nil
+	})
+
+	return err
+}
+
+func (r *RedisBackend) GetGuildTheme(ctx context.Context, guild string) (*backend.GuildTheme, error) {
+	val, err := r.client.Get(ctx, r.themeKey(guild)).Result()
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var theme backend.GuildTheme
+	if err = json.Unmarshal([]byte(val), &theme); err != nil {
+		return nil, errors.Wrap(err, "failed to decode guild theme")
+	}
+
+	return &theme, nil
+}
+
+func (r *RedisBackend) DeleteGuildTheme(ctx context.Context, guild string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Del(ctx, r.themeKey(guild))
+		pipe.SRem(ctx, r.themeGuildsKey(), guild)
+		return nil
+	})
+
+	return err
+}
+
+func (r *RedisBackend) ListGuildThemes(ctx context.Context) ([]backend.GuildTheme, error) {
+	guilds, err := r.client.SMembers(ctx, r.themeGuildsKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	themes := make([]backend.GuildTheme, 0, len(guilds))
+
+	for _, guild := range guilds {
+		theme, err := r.GetGuildTheme(ctx, guild)
+		if err != nil {
+			return nil, err
+		}
+
+		if theme != nil {
+			themes = append(themes, *theme)
+		}
+	}
+
+	return themes, nil
+}
+
+func (r *RedisBackend) themeGuildsKey() string {
+	return r.globalKey("themes", "guilds")
+}
+
+func (r *RedisBackend) themeKey(guild string) string {
+	return r.guildKey(guild, "theme")
+}
+
+func (r *RedisBackend) SetGroup(ctx context.Context, group backend.GroupRole) error {
+	encoded, err := json.Marshal(group)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode group role")
+	}
+
+	return r.client.HSet(ctx, r.groupsKey(group.Guild), group.Role, encoded).Err()
+}
+
+func (r *RedisBackend) GetGroup(ctx context.Context, guild string, role string) (*backend.GroupRole, error) {
+	val, err := r.client.HGet(ctx, r.groupsKey(guild), role).Result()
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var group backend.GroupRole
+	if err = json.Unmarshal([]byte(val), &group); err != nil {
+		return nil, errors.Wrap(err, "failed to decode group role")
+	}
+
+	return &group, nil
+}
+
+func (r *RedisBackend) DeleteGroup(ctx context.Context, guild string, role string) error {
+	members, err := r.GetGroupMembers(ctx, guild, role)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, member := range members {
+			pipe.SRem(ctx, r.memberGroupsKey(guild, member), role)
+		}
+
+		pipe.Del(ctx, r.groupMembersKey(guild, role))
+		pipe.HDel(ctx, r.groupsKey(guild), role)
+		return nil
+	})
+
+	return err
+}
+
+func (r *RedisBackend) AddGroupMember(ctx context.Context, guild string, role string, user string, limit int) error {
+	added, err := addGroupMember.Run(ctx, r.client, []string{r.groupMembersKey(guild, role), r.memberGroupsKey(guild, user)},
+		user, role, limit).Int()
+	if err != nil {
+		return err
+	}
+
+	if added == 0 {
+		return backend.GroupMemberLimitReached
+	}
+
+	return nil
+}
+
+func (r *RedisBackend) RemoveGroupMember(ctx context.Context, guild string, role string, user string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.SRem(ctx, r.groupMembersKey(guild, role), user)
+		pipe.SRem(ctx, r.memberGroupsKey(guild, user), role)
+		return nil
+	})
+
+	return err
+}
+
+func (r *RedisBackend) GetGroupMembers(ctx context.Context, guild string, role string) ([]string, error) {
+	members, err := r.client.SMembers(ctx, r.groupMembersKey(guild, role)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(members)
+
+	return members, nil
+}
+
+func (r *RedisBackend) GetMemberGroups(ctx context.Context, guild string, user string) ([]string, error) {
+	groups, err := r.client.SMembers(ctx, r.memberGroupsKey(guild, user)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(groups)
+
+	return groups, nil
+}
+
+func (r *RedisBackend) ListGroups(ctx context.Context, guild string) ([]backend.GroupRole, error) {
+	vals, err := r.client.HVals(ctx, r.groupsKey(guild)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]backend.GroupRole, 0, len(vals))
+
+	for _, val := range vals {
+		var group backend.GroupRole
+		if err = json.Unmarshal([]byte(val), &group); err != nil {
+			return nil, errors.Wrap(err, "failed to decode group role")
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+func (r *RedisBackend) groupsKey(guild string) string {
+	return r.guildKey(guild, "groups")
+}
+
+func (r *RedisBackend) groupMembersKey(guild string, role string) string {
+	return r.guildKey(guild, "group", role, "members")
+}
+
+func (r *RedisBackend) memberGroupsKey(guild string, user string) string {
+	return r.guildKey(guild, "member", user, "groups")
+}
+
+func (r *RedisBackend) GetGuildSettings(ctx context.Context, guild string) (backend.GuildSettings, error) {
+	var settings backend.GuildSettings
+
+	val, err := r.client.Get(ctx, r.settingsKey(guild)).Result()
+	if errors.Is(err, goredis.Nil) {
+		return settings, nil
+	}
+
+	if err != nil {
+		return settings, err
+	}
+
+	if err = json.Unmarshal([]byte(val), &settings); err != nil {
+		return settings, errors.Wrap(err, "failed to decode guild settings")
+	}
+
+	return settings, nil
+}
+
+func (r *RedisBackend) SetGuildSettings(ctx context.Context, guild string, settings backend.GuildSettings) error {
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode guild settings")
+	}
+
+	return r.client.Set(ctx, r.settingsKey(guild), encoded, 0).Err()
+}
+
+func (r *RedisBackend) SetApproval(ctx context.Context, request backend.ApprovalRequest) error {
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode approval request")
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(ctx, r.approvalsKey(request.Guild), request.ID, encoded)
+		pipe.SAdd(ctx, r.approvalGuildsKey(), request.Guild)
+		return nil
+	})
+
+	return err
+}
+
+func (r *RedisBackend) GetApproval(ctx context.Context, guild string, id string) (*backend.ApprovalRequest, error) {
+	val, err := r.client.HGet(ctx, r.approvalsKey(guild), id).Result()
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var request backend.ApprovalRequest
+	if err = json.Unmarshal([]byte(val), &request); err != nil {
+		return nil, errors.Wrap(err, "failed to decode approval request")
+	}
+
+	return &request, nil
+}
+
+func (r *RedisBackend) DeleteApproval(ctx context.Context, guild string, id string) error {
+	return r.client.HDel(ctx, r.approvalsKey(guild), id).Err()
+}
+
+func (r *RedisBackend) ListApprovals(ctx context.Context) ([]backend.ApprovalRequest, error) {
+	guilds, err := r.client.SMembers(ctx, r.approvalGuildsKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]backend.ApprovalRequest, 0)
+
+	for _, guild := range guilds {
+		guildRequests, err := r.ListGuildApprovals(ctx, guild)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(guildRequests) == 0 {
+			r.client.SRem(ctx, r.approvalGuildsKey(), guild)
+			continue
+		}
+
+		requests = append(requests, guildRequests...)
+	}
+
+	return requests, nil
+}
+
+func (r *RedisBackend) ListGuildApprovals(ctx context.Context, guild string) ([]backend.ApprovalRequest, error) {
+	vals, err := r.client.HVals(ctx, r.approvalsKey(guild)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]backend.ApprovalRequest, 0, len(vals))
+
+	for _, val := range vals {
+		var request backend.ApprovalRequest
+		if err = json.Unmarshal([]byte(val), &request); err != nil {
+			return nil, errors.Wrap(err, "failed to decode approval request")
+		}
+
+		requests = append(requests, request)
+	}
+
+	return requests, nil
+}
+
+func (r *RedisBackend) approvalGuildsKey() string {
+	return r.globalKey("approvals", "guilds")
+}
+
+func (r *RedisBackend) settingsKey(guild string) string {
+	return r.guildKey(guild, "settings")
+}
+
+func (r *RedisBackend) approvalsKey(guild string) string {
+	return r.guildKey(guild, "approvals")
 }
@@ -0,0 +1,267 @@
+package backend
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"fmt"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	goredis "github.com/redis/go-redis/v9"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	coordinationConfigurationMissing = errors.Sentinel("coordination configuration missing")
+)
+
+// lockPollInterval is how often a lock held by another instance is tried again
+const lockPollInterval = 100 * time.Millisecond
+
+// renewIfHeld extends the expiry of a key, but only while it still holds the value of this instance
+var renewIfHeld = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseIfHeld deletes a key, but only while it still holds the value of this instance
+var releaseIfHeld = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisCoordinator coordinates every instance connected to the same redis database. Leadership is a key
+// holding the instance, renewed three times per lease, locks are keys that expire if their holder stops,
+// and messages are sent over redis pub/sub.
+type RedisCoordinator struct {
+	Logger *slog.Logger
+	Redis  *RedisBackend
+
+	instance string
+	leaseTTL time.Duration
+	lockTTL  time.Duration
+
+	leader atomic.Bool
+
+	// campaigning serializes campaigns with resigning, so a campaign cannot take leadership back after it
+	campaigning sync.Mutex
+	resigned    bool
+
+	mutex    sync.Mutex
+	elected  []func()
+	handlers map[string][]func(message string)
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRedisCoordinator creates a coordinator sharing the connection of the redis backend
+func NewRedisCoordinator(logger *slog.Logger, redis *RedisBackend) *RedisCoordinator {
+	return &RedisCoordinator{
+		Logger:   logger,
+		Redis:    redis,
+		handlers: make(map[string][]func(message string)),
+	}
+}
+
+func (c *RedisCoordinator) Init(config common.Configuration) error {
+	coordinationConfiguration := common.FindConfiguration[backend.CoordinationConfig](config)
+	if coordinationConfiguration == nil {
+		return coordinationConfigurationMissing
+	}
+
+	c.instance = coordinationConfiguration.Instance
+	c.leaseTTL = coordinationConfiguration.LeaseTTL
+	c.lockTTL = coordinationConfiguration.LockTTL
+	c.stop = make(chan struct{})
+
+	return nil
+}
+
+func (c *RedisCoordinator) Start() error {
+	pubsub := c.Redis.client.PSubscribe(context.Background(), c.Redis.globalKey("events", "*"))
+	defer func() {
+		_ = pubsub.Close()
+	}()
+
+	messages := pubsub.Channel()
+
+	ticker := time.NewTicker(c.leaseTTL / 3)
+	defer ticker.Stop()
+
+	c.campaign()
+
+	for {
+		select {
+		case <-c.stop:
+			return nil
+		case <-ticker.C:
+			c.campaign()
+		case message, ok := <-messages:
+			if ok {
+				c.dispatch(message)
+			}
+		}
+	}
+}
+
+func (c *RedisCoordinator) Close(_ error) error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+		c.resign()
+	})
+
+	return nil
+}
+
+func (c *RedisCoordinator) Leader() bool {
+	return c.leader.Load()
+}
+
+func (c *RedisCoordinator) OnElected(handler func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.elected = append(c.elected, handler)
+
+	if c.leader.Load() {
+		go handler()
+	}
+}
+
+func (c *RedisCoordinator) Lock(ctx context.Context, name string) (func(), error) {
+	key := c.Redis.globalKey("lock", name)
+	token := fmt.Sprintf("%s:%016x", c.instance, rand.Uint64())
+
+	for {
+		acquired, err := c.Redis.client.SetNX(ctx, key, token, c.lockTTL).Result()
+		if err != nil {
+			return nil, errors.WrapWithDetails(err, "failed to acquire lock", "lock", name)
+		}
+
+		if acquired {
+			return func() {
+				// The lock is released even when the context it was acquired with is already done
+				ctx, cancel := context.WithTimeout(context.Background(), c.lockTTL)
+				defer cancel()
+
+				if err := releaseIfHeld.Run(ctx, c.Redis.client, []string{key}, token).Err(); err != nil {
+					c.Logger.Error("failed to release lock, it is released once it expires",
+						slog.Any("error", err),
+						slog.String("lock", name))
+				}
+			}, nil
+		}
+
+		timer := time.NewTimer(lockPollInterval)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *RedisCoordinator) Publish(ctx context.Context, topic string, message string) error {
+	return c.Redis.client.Publish(ctx, c.Redis.globalKey("events", topic), message).Err()
+}
+
+func (c *RedisCoordinator) Subscribe(topic string, handler func(message string)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.handlers[topic] = append(c.handlers[topic], handler)
+}
+
+// campaign renews the leadership of this instance, or takes it over when no instance holds it
+func (c *RedisCoordinator) campaign() {
+	c.campaigning.Lock()
+	defer c.campaigning.Unlock()
+
+	if c.resigned {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.leaseTTL/3)
+	defer cancel()
+
+	key := c.Redis.globalKey("leader")
+
+	var held bool
+	var err error
+
+	if c.leader.Load() {
+		var renewed int
+		renewed, err = renewIfHeld.Run(ctx, c.Redis.client, []string{key}, c.instance, c.leaseTTL.Milliseconds()).Int()
+		held = renewed == 1
+	} else {
+		held, err = c.Redis.client.SetNX(ctx, key, c.instance, c.leaseTTL).Result()
+	}
+
+	// Step down when leadership cannot be confirmed, another instance takes over once the lease expires
+	if err != nil {
+		held = false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if held && c.leader.CompareAndSwap(false, true) {
+		c.Logger.Info("elected as leader",
+			slog.String("instance", c.instance))
+
+		for _, handler := range c.elected {
+			go handler()
+		}
+	}
+
+	if !held && c.leader.CompareAndSwap(true, false) {
+		c.Logger.Warn("lost leadership",
+			slog.Any("error", err),
+			slog.String("instance", c.instance))
+	}
+}
+
+// resign gives up leadership for good on shutdown, so another instance does not have to wait for the lease to
+// expire
+func (c *RedisCoordinator) resign() {
+	c.campaigning.Lock()
+	defer c.campaigning.Unlock()
+
+	c.resigned = true
+
+	if !c.leader.Swap(false) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.leaseTTL/3)
+	defer cancel()
+
+	if err := releaseIfHeld.Run(ctx, c.Redis.client, []string{c.Redis.globalKey("leader")}, c.instance).Err(); err != nil {
+		c.Logger.Error("failed to resign leadership, it is released once the lease expires",
+			slog.Any("error", err),
+			slog.String("instance", c.instance))
+	}
+}
+
+func (c *RedisCoordinator) dispatch(message *goredis.Message) {
+	topic := strings.TrimPrefix(message.Channel, c.Redis.globalKey("events")+":")
+
+	c.mutex.Lock()
+	handlers := c.handlers[topic]
+	c.mutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(message.Payload)
+	}
+}
@@ -0,0 +1,168 @@
+package backend
+
+import (
+	"context"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/alicebob/miniredis/v2"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestCoordinator(t *testing.T, server *miniredis.Miniredis, instance string) *RedisCoordinator {
+	port, _ := strconv.Atoi(server.Port())
+
+	config := &backend.RedisConfig{AuthenticatedConfig: backend.AuthenticatedConfig{Config: &backend.Config{Host: server.Host(), Port: port}}}
+	if err := config.Process(); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	redis := &RedisBackend{Logger: slog.Default()}
+	if err := redis.Init(config); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	coordinator := NewRedisCoordinator(slog.Default(), redis)
+	if err := coordinator.Init(&backend.CoordinationConfig{Instance: instance, LeaseTTL: 3 * time.Second, LockTTL: time.Second}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = coordinator.Close(nil)
+		_ = redis.Close(nil)
+	})
+
+	return coordinator
+}
+
+func TestRedisCoordinatorLeadership(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	first := newTestCoordinator(t, server, "first")
+	second := newTestCoordinator(t, server, "second")
+
+	elected := make(chan struct{}, 1)
+	second.OnElected(func() {
+		elected <- struct{}{}
+	})
+
+	first.campaign()
+	second.campaign()
+
+	if !first.Leader() || second.Leader() {
+		t.Fatalf("Leader() = %v and %v, want only the first instance to lead", first.Leader(), second.Leader())
+	}
+
+	// Renewing keeps the lease of the leader
+	first.campaign()
+	second.campaign()
+
+	if !first.Leader() || second.Leader() {
+		t.Fatalf("after renewal Leader() = %v and %v, want only the first instance to lead", first.Leader(), second.Leader())
+	}
+
+	_ = first.Close(nil)
+	first.campaign()
+	second.campaign()
+
+	if first.Leader() || !second.Leader() {
+		t.Fatalf("after closing Leader() = %v and %v, want only the second instance to lead", first.Leader(), second.Leader())
+	}
+
+	select {
+	case <-elected:
+	case <-time.After(time.Second):
+		t.Errorf("OnElected() handler was not called")
+	}
+
+	// An expired lease is taken over by the next instance to campaign
+	third := newTestCoordinator(t, server, "third")
+
+	server.FastForward(4 * time.Second)
+	third.campaign()
+	second.campaign()
+
+	if !third.Leader() || second.Leader() {
+		t.Errorf("after expiry Leader() = %v and %v, want only the third instance to lead", third.Leader(), second.Leader())
+	}
+}
+
+func TestRedisCoordinatorLock(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	first := newTestCoordinator(t, server, "first")
+	second := newTestCoordinator(t, server, "second")
+
+	ctx := context.Background()
+
+	unlock, err := first.Lock(ctx, "lock")
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	waiting, cancel := context.WithTimeout(ctx, 3*lockPollInterval)
+	defer cancel()
+
+	if _, err = second.Lock(waiting, "lock"); err == nil {
+		t.Fatalf("Lock() of a held lock succeeded")
+	}
+
+	unlock()
+
+	unlock, err = second.Lock(ctx, "lock")
+	if err != nil {
+		t.Fatalf("Lock() after unlock error = %v", err)
+	}
+
+	// Releasing a lock that expired and was taken over must not release the new holder
+	server.FastForward(2 * time.Second)
+
+	taken, err := first.Lock(ctx, "lock")
+	if err != nil {
+		t.Fatalf("Lock() after expiry error = %v", err)
+	}
+
+	unlock()
+
+	if _, err = second.Lock(waiting, "lock"); err == nil {
+		t.Errorf("Lock() succeeded after a stale unlock")
+	}
+
+	taken()
+}
+
+func TestRedisCoordinatorPublish(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	first := newTestCoordinator(t, server, "first")
+	second := newTestCoordinator(t, server, "second")
+
+	received := make(chan string, 16)
+	second.Subscribe("topic", func(message string) {
+		received <- message
+	})
+
+	go func() { _ = first.Start() }()
+	go func() { _ = second.Start() }()
+
+	// Subscribing happens in the background, publish until the message arrives
+	deadline := time.After(5 * time.Second)
+
+	for {
+		if err := first.Publish(context.Background(), "topic", "message"); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+
+		select {
+		case message := <-received:
+			if message != "message" {
+				t.Errorf("received %q, want %q", message, "message")
+			}
+			return
+		case <-deadline:
+			t.Fatalf("message was not received")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
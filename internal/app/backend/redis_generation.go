@@ -0,0 +1,65 @@
+package backend
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"encoding/json"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
+	goredis "github.com/redis/go-redis/v9"
+	"time"
+)
+
+// RedisGenerationStore keeps generations in redis, so they can be shared after a restart or from another
+// instance. Redis expires them, so they are not bounded in number.
+type RedisGenerationStore struct {
+	Redis *RedisBackend
+
+	ttl time.Duration
+}
+
+// NewRedisGenerationStore creates a store keeping generations in the database of the redis backend
+func NewRedisGenerationStore(redis *RedisBackend, ttl time.Duration) *RedisGenerationStore {
+	return &RedisGenerationStore{
+		Redis: redis,
+		ttl:   ttl,
+	}
+}
+
+func (r *RedisGenerationStore) generationKey(id string) string {
+	return r.Redis.globalKey("generation", id)
+}
+
+func (r *RedisGenerationStore) Save(ctx context.Context, id string, generation *data.ColorGeneration) error {
+	encoded, err := json.Marshal(generation)
+	if err != nil {
+		return errors.Wrap(err, "could not encode generation")
+	}
+
+	return r.Redis.client.Set(ctx, r.generationKey(id), encoded, r.ttl).Err()
+}
+
+func (r *RedisGenerationStore) Take(ctx context.Context, id string) (*data.ColorGeneration, error) {
+	var get *goredis.StringCmd
+
+	// Taken in a transaction, so a generation is only ever shared once when clicked on two instances
+	_, err := r.Redis.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		get = pipe.Get(ctx, r.generationKey(id))
+		pipe.Del(ctx, r.generationKey(id))
+		return nil
+	})
+
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var generation data.ColorGeneration
+	if err = json.Unmarshal([]byte(get.Val()), &generation); err != nil {
+		return nil, errors.Wrap(err, "could not decode generation")
+	}
+
+	return &generation, nil
+}
@@ -0,0 +1,43 @@
+package backend
+
+import (
+	"context"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
+	"github.com/alicebob/miniredis/v2"
+	"testing"
+	"time"
+)
+
+func TestRedisGenerationStore(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	store := NewRedisGenerationStore(newTestCoordinator(t, server, "instance").Redis, time.Minute)
+
+	if err := store.Save(ctx, "first", &data.ColorGeneration{Input: "red", ImageData: []byte{1, 2, 3}}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	generation, err := store.Take(ctx, "first")
+	if err != nil || generation == nil {
+		t.Fatalf("Take() = %v, error = %v", generation, err)
+	}
+
+	if generation.Input != "red" || len(generation.ImageData) != 3 {
+		t.Errorf("Take() = %+v, want the saved generation", generation)
+	}
+
+	if again, err := store.Take(ctx, "first"); again != nil || err != nil {
+		t.Errorf("second Take() = %v, error = %v, want nothing", again, err)
+	}
+
+	if err = store.Save(ctx, "second", &data.ColorGeneration{}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	server.FastForward(2 * time.Minute)
+
+	if expired, err := store.Take(ctx, "second"); expired != nil || err != nil {
+		t.Errorf("Take() of expired generation = %v, error = %v, want nothing", expired, err)
+	}
+}
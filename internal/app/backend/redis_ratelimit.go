@@ -0,0 +1,102 @@
+package backend
+
+import (
+	"context"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
+	goredis "github.com/redis/go-redis/v9"
+	"strings"
+	"time"
+)
+
+// takeTokens refills the buckets for the time since they were last used and takes a use from each of them, unless
+// one is empty. Returns the position of the first empty bucket, starting at 1, and the milliseconds to wait for a
+// use from it, or zero for both when the uses were taken. Buckets expire once they would be full again.
+var takeTokens = goredis.NewScript(`
+local now = tonumber(ARGV[1])
+local tokens = {}
+
+for index, key in ipairs(KEYS) do
+	local uses = tonumber(ARGV[index * 2])
+	local per = tonumber(ARGV[index * 2 + 1])
+
+	local bucket = redis.call("HMGET", key, "tokens", "updated")
+	local current = tonumber(bucket[1]) or uses
+	local updated = tonumber(bucket[2]) or now
+
+	tokens[index] = math.min(uses, current + math.max(0, now - updated) * uses / per)
+end
+
+local empty = 0
+local wait = 0
+
+for index = 1, #KEYS do
+	if tokens[index] < 1 then
+		local uses = tonumber(ARGV[index * 2])
+		local per = tonumber(ARGV[index * 2 + 1])
+
+		empty = index
+		wait = math.ceil((1 - tokens[index]) * per / uses)
+		break
+	end
+end
+
+for index, key in ipairs(KEYS) do
+	if empty == 0 then
+		tokens[index] = tokens[index] - 1
+	end
+
+	redis.call("HMSET", key, "tokens", tostring(tokens[index]), "updated", now)
+	redis.call("PEXPIRE", key, tonumber(ARGV[index * 2 + 1]))
+end
+
+return {empty, wait}
+`)
+
+// RedisRateLimiter keeps the buckets in redis, so every instance takes from the same ones
+type RedisRateLimiter struct {
+	Redis *RedisBackend
+}
+
+// NewRedisRateLimiter creates a rate limiter keeping its buckets in the database of the redis backend
+func NewRedisRateLimiter(redis *RedisBackend) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		Redis: redis,
+	}
+}
+
+func (r *RedisRateLimiter) Take(ctx context.Context, buckets ...data.Bucket) (int, time.Duration, error) {
+	if len(buckets) == 0 {
+		return 0, 0, nil
+	}
+
+	keys := make([]string, 0, len(buckets))
+	args := []any{time.Now().UnixMilli()}
+
+	for _, bucket := range buckets {
+		keys = append(keys, r.bucketKey(bucket.Key))
+		args = append(args, bucket.Limit.Uses, bucket.Limit.Per.Milliseconds())
+	}
+
+	result, err := takeTokens.Run(ctx, r.Redis.client, keys, args...).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if result[0] == 0 {
+		return 0, 0, nil
+	}
+
+	return int(result[0]) - 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+// bucketKey builds the key of a bucket. In cluster mode the part before the first colon is a hash tag, so buckets
+// taken together live in the same slot.
+func (r *RedisRateLimiter) bucketKey(key string) string {
+	if r.Redis.cluster {
+		if scope, rest, found := strings.Cut(key, ":"); found {
+			key = "{" + scope + "}:" + rest
+		}
+	}
+
+	return r.Redis.globalKey("ratelimit", key)
+}
@@ -0,0 +1,72 @@
+package backend
+
+import (
+	"context"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/alicebob/miniredis/v2"
+	"testing"
+	"time"
+)
+
+func TestRedisRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	limiter := NewRedisRateLimiter(newTestCoordinator(t, server, "instance").Redis)
+	bucket := data.Bucket{Key: "guild:role:user", Limit: backend.RateLimit{Uses: 2, Per: time.Minute}}
+
+	for use := range 2 {
+		if _, wait, err := limiter.Take(ctx, bucket); wait != 0 || err != nil {
+			t.Fatalf("Take() use %d = %v, error = %v, want no wait", use, wait, err)
+		}
+	}
+
+	_, wait, err := limiter.Take(ctx, bucket)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+
+	if wait <= 0 || wait > 30*time.Second {
+		t.Errorf("Take() of empty bucket = %v, want a wait of at most 30s", wait)
+	}
+
+	if _, wait, _ = limiter.Take(ctx, data.Bucket{Key: "guild:role:other", Limit: bucket.Limit}); wait != 0 {
+		t.Errorf("Take() of another bucket = %v, want no wait", wait)
+	}
+}
+
+func TestRedisRateLimiterTakesTogether(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	limiter := NewRedisRateLimiter(newTestCoordinator(t, server, "instance").Redis)
+
+	user := data.Bucket{Key: "guild:role:user:user", Limit: backend.RateLimit{Uses: 1, Per: time.Minute}}
+	guild := data.Bucket{Key: "guild:role", Limit: backend.RateLimit{Uses: 2, Per: time.Minute}}
+
+	if _, wait, err := limiter.Take(ctx, user, guild); wait != 0 || err != nil {
+		t.Fatalf("Take() of both buckets = %v, error = %v, want no wait", wait, err)
+	}
+
+	// The user bucket is empty, the refused use must not be taken from the guild bucket
+	for range 3 {
+		if empty, wait, _ := limiter.Take(ctx, user, guild); wait == 0 || empty != 0 {
+			t.Fatalf("Take() with an empty user bucket = %d, %v, want a wait for bucket 0", empty, wait)
+		}
+	}
+
+	if _, wait, _ := limiter.Take(ctx, guild); wait != 0 {
+		t.Fatalf("Take() of the guild bucket = %v, want its last use left", wait)
+	}
+
+	other := data.Bucket{Key: "guild:role:user:other", Limit: user.Limit}
+
+	if empty, wait, _ := limiter.Take(ctx, other, guild); wait == 0 || empty != 1 {
+		t.Fatalf("Take() with an empty guild bucket = %d, %v, want a wait for bucket 1", empty, wait)
+	}
+
+	if _, wait, _ := limiter.Take(ctx, other); wait != 0 {
+		t.Errorf("Take() of the other user bucket = %v, want its use left", wait)
+	}
+}
@@ -0,0 +1,36 @@
+package backend
+
+import (
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend/backendtest"
+	"github.com/alicebob/miniredis/v2"
+	"strconv"
+	"testing"
+)
+
+func TestRedisBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		server := miniredis.RunT(t)
+
+		port, err := strconv.Atoi(server.Port())
+		if err != nil {
+			t.Fatalf("miniredis port = %q, error = %v", server.Port(), err)
+		}
+
+		config := &backend.RedisConfig{AuthenticatedConfig: backend.AuthenticatedConfig{Config: &backend.Config{Host: server.Host(), Port: port}}}
+		if err = config.Process(); err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+
+		r := &RedisBackend{}
+		if err = r.Init(config); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+
+		t.Cleanup(func() {
+			_ = r.Close(nil)
+		})
+
+		return r
+	})
+}
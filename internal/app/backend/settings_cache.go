@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"context"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// settingsCacheExpiry bounds how long settings changed without a published invalidation, like by an import,
+// stay stale
+const settingsCacheExpiry = time.Minute
+
+type cachedSettings struct {
+	settings backend.GuildSettings
+	loaded   time.Time
+}
+
+// SettingsCache keeps guild settings in memory, they are read on every role change but rarely change. Changes
+// are published to every instance, so none of them keep using settings that were changed elsewhere.
+type SettingsCache struct {
+	backend.Backend
+
+	logger      *slog.Logger
+	coordinator backend.Coordinator
+
+	mutex    sync.RWMutex
+	settings map[string]cachedSettings
+}
+
+// NewSettingsCache wraps the backend with a cache of guild settings invalidated through the coordinator
+func NewSettingsCache(logger *slog.Logger, store backend.Backend, coordinator backend.Coordinator) *SettingsCache {
+	cache := &SettingsCache{
+		Backend:     store,
+		logger:      logger,
+		coordinator: coordinator,
+		settings:    make(map[string]cachedSettings),
+	}
+
+	coordinator.Subscribe(backend.SettingsTopic, cache.invalidate)
+
+	return cache
+}
+
+func (s *SettingsCache) GetGuildSettings(ctx context.Context, guild string) (backend.GuildSettings, error) {
+	s.mutex.RLock()
+	cached, exists := s.settings[guild]
+	s.mutex.RUnlock()
+
+	if exists && time.Since(cached.loaded) < settingsCacheExpiry {
+		return cached.settings, nil
+	}
+
+	settings, err := s.Backend.GetGuildSettings(ctx, guild)
+	if err != nil {
+		return settings, err
+	}
+
+	s.mutex.Lock()
+	s.settings[guild] = cachedSettings{settings: settings, loaded: time.Now()}
+	s.mutex.Unlock()
+
+	return settings, nil
+}
+
+func (s *SettingsCache) SetGuildSettings(ctx context.Context, guild string, settings backend.GuildSettings) error {
+	if err := s.Backend.SetGuildSettings(ctx, guild, settings); err != nil {
+		return err
+	}
+
+	s.invalidate(guild)
+
+	if err := s.coordinator.Publish(ctx, backend.SettingsTopic, guild); err != nil {
+		s.logger.Error("failed to publish changed guild settings, other instances see them once their copy expires",
+			slog.Any("error", err),
+			slog.String("guild", guild))
+	}
+
+	return nil
+}
+
+func (s *SettingsCache) invalidate(guild string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.settings, guild)
+}
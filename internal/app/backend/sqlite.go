@@ -0,0 +1,765 @@
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"emperror.dev/errors"
+	"encoding/json"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	storageConfigurationMissing = errors.Sentinel("storage configuration missing")
+	schemaTooNew                = errors.Sentinel("database schema is newer than this version of the bot")
+)
+
+const (
+	roleActionSet    = "set"
+	roleActionDelete = "delete"
+)
+
+// SQLiteBackend keeps all data in a SQLite database file, using a pure go driver
+type SQLiteBackend struct {
+	db *sql.DB
+}
+
+func (q *SQLiteBackend) Init(config common.Configuration) error {
+	storageConfiguration := common.FindConfiguration[backend.StorageConfig](config)
+	if storageConfiguration == nil {
+		return storageConfigurationMissing
+	}
+
+	db, err := sql.Open("sqlite", storageConfiguration.Database+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return errors.Wrap(err, "could not open sqlite database")
+	}
+
+	// SQLite allows a single writer, sharing one connection avoids busy errors between our own writers
+	db.SetMaxOpenConns(1)
+
+	q.db = db
+
+	if err = q.migrate(context.Background()); err != nil {
+		return errors.Combine(errors.Wrap(err, "could not migrate sqlite database"), db.Close())
+	}
+
+	return nil
+}
+
+func (q *SQLiteBackend) Start() error {
+	if err := q.Ping(context.Background()); err != nil {
+		return errors.Wrap(err, "could not connect to sqlite database")
+	}
+
+	return common.ServiceStartedNormallyButDoesNotBlock
+}
+
+func (q *SQLiteBackend) Close(_ error) error {
+	return q.db.Close()
+}
+
+func (q *SQLiteBackend) Ping(ctx context.Context) error {
+	return q.db.PingContext(ctx)
+}
+
+// migrate applies every migration newer than the schema version of the database
+func (q *SQLiteBackend) migrate(ctx context.Context) error {
+	if _, err := q.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	var version int
+	if err := q.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	if version > len(sqliteMigrations) {
+		return schemaTooNew
+	}
+
+	for index := version; index < len(sqliteMigrations); index++ {
+		err := q.transaction(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, sqliteMigrations[index]); err != nil {
+				return err
+			}
+
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_version (version) VALUES (?)`, index+1)
+			return err
+		})
+
+		if err != nil {
+			return errors.WrapWithDetails(err, "failed to apply migration", "version", index+1)
+		}
+	}
+
+	return nil
+}
+
+// transaction runs the function in a transaction, committing it if the function succeeds
+func (q *SQLiteBackend) transaction(ctx context.Context, function func(tx *sql.Tx) error) error {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = function(tx); err != nil {
+		return errors.Combine(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
+
+func (q *SQLiteBackend) GetRole(ctx context.Context, guild string, user string) (string, error) {
+	var role string
+
+	err := q.db.QueryRowContext(ctx, `SELECT role FROM roles WHERE guild = ? AND user = ?`, guild, user).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	return role, err
+}
+
+func (q *SQLiteBackend) SetRole(ctx context.Context, guild string, user string, role string) error {
+	return q.SetRolesBatch(ctx, guild, map[string]string{user: role})
+}
+
+func (q *SQLiteBackend) DeleteRole(ctx context.Context, guild string, user string) (string, error) {
+	var role string
+
+	err := q.transaction(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `DELETE FROM roles WHERE guild = ? AND user = ? RETURNING role`, guild, user).Scan(&role)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return insertRoleAudit(ctx, tx, guild, user, roleActionDelete, "", role)
+	})
+
+	return role, err
+}
+
+func (q *SQLiteBackend) GetRoleOwner(ctx context.Context, guild string, role string) (string, error) {
+	var user string
+
+	err := q.db.QueryRowContext(ctx, `SELECT user FROM roles WHERE guild = ? AND role = ? LIMIT 1`, guild, role).Scan(&user)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+
+	return user, err
+}
+
+func (q *SQLiteBackend) ListRoles(ctx context.Context, guild string, cursor string, limit int) ([]backend.PersonalRole, string, error) {
+	if limit <= 0 {
+		limit = backend.RolePageSize
+	}
+
+	// The cursor is the last user of the previous page, one extra row is read to know whether another page follows
+	rows, err := q.db.QueryContext(ctx, `SELECT user, role FROM roles WHERE guild = ? AND user > ? ORDER BY user LIMIT ?`, guild, cursor, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer rows.Close()
+
+	roles := make([]backend.PersonalRole, 0, limit)
+
+	for rows.Next() {
+		var role backend.PersonalRole
+		if err = rows.Scan(&role.User, &role.Role); err != nil {
+			return nil, "", err
+		}
+
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(roles) <= limit {
+		return roles, "", nil
+	}
+
+	roles = roles[:limit]
+
+	return roles, roles[limit-1].User, nil
+}
+
+func (q *SQLiteBackend) GetRolesBatch(ctx context.Context, guild string, users []string) (map[string]string, error) {
+	roles := make(map[string]string, len(users))
+	if len(users) == 0 {
+		return roles, nil
+	}
+
+	args := make([]any, 0, len(users)+1)
+	args = append(args, guild)
+
+	for _, user := range users {
+		args = append(args, user)
+	}
+
+	rows, err := q.db.QueryContext(ctx, `SELECT user, role FROM roles WHERE guild = ? AND user IN (?`+strings.Repeat(", ?", len(users)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var user, role string
+		if err = rows.Scan(&user, &role); err != nil {
+			return nil, err
+		}
+
+		roles[user] = role
+	}
+
+	return roles, rows.Err()
+}
+
+func (q *SQLiteBackend) SetRolesBatch(ctx context.Context, guild string, roles map[string]string) error {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	return q.transaction(ctx, func(tx *sql.Tx) error {
+		for user, role := range roles {
+			var previous string
+
+			err := tx.QueryRowContext(ctx, `SELECT role FROM roles WHERE guild = ? AND user = ?`, guild, user).Scan(&previous)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			if previous == role {
+				continue
+			}
+
+			_, err = tx.ExecContext(ctx, `INSERT INTO roles (guild, user, role) VALUES (?, ?, ?)
+				ON CONFLICT (guild, user) DO UPDATE SET role = excluded.role`, guild, user, role)
+			if err != nil {
+				return err
+			}
+
+			if err = insertRoleAudit(ctx, tx, guild, user, roleActionSet, role, previous); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// insertRoleAudit records a change to the personal role of a user, as part of the transaction making the change
+func insertRoleAudit(ctx context.Context, tx *sql.Tx, guild string, user string, action string, role string, previous string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO role_audit (guild, user, action, role, previous, time) VALUES (?, ?, ?, ?, ?, ?)`,
+		guild, user, action, role, previous, toUnixNanos(time.Now()))
+
+	return errors.Wrap(err, "failed to record role audit")
+}
+
+func (q *SQLiteBackend) PushHistory(ctx context.Context, guild string, user string, state backend.RoleState) error {
+	return q.transaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO history (guild, user, name, color, time) VALUES (?, ?, ?, ?, ?)`,
+			guild, user, state.Name, state.Color, toUnixNanos(state.Time))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM history WHERE guild = ? AND user = ? AND id NOT IN
+			(SELECT id FROM history WHERE guild = ? AND user = ? ORDER BY id DESC LIMIT ?)`,
+			guild, user, guild, user, backend.MaxHistoryEntries)
+
+		return err
+	})
+}
+
+func (q *SQLiteBackend) PopHistory(ctx context.Context, guild string, user string) (*backend.RoleState, error) {
+	var state backend.RoleState
+	var stateTime int64
+
+	err := q.db.QueryRowContext(ctx, `DELETE FROM history WHERE id =
+		(SELECT id FROM history WHERE guild = ? AND user = ? ORDER BY id DESC LIMIT 1)
+		RETURNING name, color, time`, guild, user).Scan(&state.Name, &state.Color, &stateTime)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	state.Time = fromUnixNanos(stateTime)
+
+	return &state, nil
+}
+
+func (q *SQLiteBackend) GetHistory(ctx context.Context, guild string, user string) ([]backend.RoleState, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT name, color, time FROM history WHERE guild = ? AND user = ? ORDER BY id DESC`, guild, user)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	states := make([]backend.RoleState, 0)
+
+	for rows.Next() {
+		var state backend.RoleState
+		var stateTime int64
+
+		if err = rows.Scan(&state.Name, &state.Color, &stateTime); err != nil {
+			return nil, err
+		}
+
+		state.Time = fromUnixNanos(stateTime)
+		states = append(states, state)
+	}
+
+	return states, rows.Err()
+}
+
+func (q *SQLiteBackend) ListHistoryUsers(ctx context.Context, guild string) ([]string, error) {
+	return q.queryStrings(ctx, `SELECT DISTINCT user FROM history WHERE guild = ? ORDER BY user`, guild)
+}
+
+func (q *SQLiteBackend) AddFavorite(ctx context.Context, guild string, user string, favorite backend.Favorite) error {
+	return q.transaction(ctx, func(tx *sql.Tx) error {
+		var exists bool
+		var count int
+
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(color = ?), 0) > 0 FROM favorites WHERE guild = ? AND user = ?`,
+			favorite.Color, guild, user).Scan(&count, &exists)
+		if err != nil {
+			return err
+		}
+
+		if !exists && count >= backend.MaxFavorites {
+			return backend.FavoriteLimitReached
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO favorites (guild, user, color, label, time) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (guild, user, color) DO UPDATE SET label = excluded.label, time = excluded.time`,
+			guild, user, favorite.Color, favorite.Label, toUnixNanos(favorite.Time))
+
+		return err
+	})
+}
+
+func (q *SQLiteBackend) RemoveFavorite(ctx context.Context, guild string, user string, color int) (bool, error) {
+	result, err := q.db.ExecContext(ctx, `DELETE FROM favorites WHERE guild = ? AND user = ? AND color = ?`, guild, user, color)
+	if err != nil {
+		return false, err
+	}
+
+	removed, err := result.RowsAffected()
+
+	return removed > 0, err
+}
+
+func (q *SQLiteBackend) GetFavorites(ctx context.Context, guild string, user string) ([]backend.Favorite, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT color, label, time FROM favorites WHERE guild = ? AND user = ? ORDER BY time`, guild, user)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	favorites := make([]backend.Favorite, 0)
+
+	for rows.Next() {
+		var favorite backend.Favorite
+		var favoriteTime int64
+
+		if err = rows.Scan(&favorite.Color, &favorite.Label, &favoriteTime); err != nil {
+			return nil, err
+		}
+
+		favorite.Time = fromUnixNanos(favoriteTime)
+		favorites = append(favorites, favorite)
+	}
+
+	return favorites, rows.Err()
+}
+
+func (q *SQLiteBackend) ListFavoriteUsers(ctx context.Context, guild string) ([]string, error) {
+	return q.queryStrings(ctx, `SELECT DISTINCT user FROM favorites WHERE guild = ? ORDER BY user`, guild)
+}
+
+func (q *SQLiteBackend) SetSchedule(ctx context.Context, schedule backend.Schedule) error {
+	_, err := q.db.ExecContext(ctx, `INSERT INTO schedules (guild, user, source, palette, base_color, interval, step, next_run)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (guild, user) DO UPDATE SET source = excluded.source, palette = excluded.palette,
+			base_color = excluded.base_color, interval = excluded.interval, step = excluded.step, next_run = excluded.next_run`,
+		schedule.Guild, schedule.User, string(schedule.Source), schedule.Palette, schedule.BaseColor,
+		int64(schedule.Interval), schedule.Step, toUnixNanos(schedule.NextRun))
+
+	return err
+}
+
+func (q *SQLiteBackend) GetSchedule(ctx context.Context, guild string, user string) (*backend.Schedule, error) {
+	schedules, err := q.querySchedules(ctx, `WHERE guild = ? AND user = ?`, guild, user)
+	if err != nil || len(schedules) == 0 {
+		return nil, err
+	}
+
+	return &schedules[0], nil
+}
+
+func (q *SQLiteBackend) DeleteSchedule(ctx context.Context, guild string, user string) error {
+	_, err := q.db.ExecContext(ctx, `DELETE FROM schedules WHERE guild = ? AND user = ?`, guild, user)
+	return err
+}
+
+func (q *SQLiteBackend) ListSchedules(ctx context.Context) ([]backend.Schedule, error) {
+	return q.querySchedules(ctx, ``)
+}
+
+func (q *SQLiteBackend) ListGuildSchedules(ctx context.Context, guild string) ([]backend.Schedule, error) {
+	return q.querySchedules(ctx, `WHERE guild = ?`, guild)
+}
+
+func (q *SQLiteBackend) querySchedules(ctx context.Context, where string, args ...any) ([]backend.Schedule, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT guild, user, source, palette, base_color, interval, step, next_run FROM schedules `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	schedules := make([]backend.Schedule, 0)
+
+	for rows.Next() {
+		var schedule backend.Schedule
+		var interval, nextRun int64
+
+		err = rows.Scan(&schedule.Guild, &schedule.User, &schedule.Source, &schedule.Palette, &schedule.BaseColor,
+			&interval, &schedule.Step, &nextRun)
+		if err != nil {
+			return nil, err
+		}
+
+		schedule.Interval = time.Duration(interval)
+		schedule.NextRun = fromUnixNanos(nextRun)
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+func (q *SQLiteBackend) SetGuildTheme(ctx context.Context, theme backend.GuildTheme) error {
+	originals, err := json.Marshal(theme.Originals)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode original role colors")
+	}
+
+	_, err = q.db.ExecContext(ctx, `INSERT INTO themes (guild, theme, start_at, end_at, applied, originals) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (guild) DO UPDATE SET theme = excluded.theme, start_at = excluded.start_at, end_at = excluded.end_at,
+			applied = excluded.applied, originals = excluded.originals`,
+		theme.Guild, theme.Theme, toUnixNanos(theme.StartAt), toUnixNanos(theme.EndAt), theme.Applied, string(originals))
+
+	return err
+}
+
+func (q *SQLiteBackend) GetGuildTheme(ctx context.Context, guild string) (*backend.GuildTheme, error) {
+	themes, err := q.queryGuildThemes(ctx, `WHERE guild = ?`, guild)
+	if err != nil || len(themes) == 0 {
+		return nil, err
+	}
+
+	return &themes[0], nil
+}
+
+func (q *SQLiteBackend) DeleteGuildTheme(ctx context.Context, guild string) error {
+	_, err := q.db.ExecContext(ctx, `DELETE FROM themes WHERE guild = ?`, guild)
+	return err
+}
+
+func (q *SQLiteBackend) ListGuildThemes(ctx context.Context) ([]backend.GuildTheme, error) {
+	return q.queryGuildThemes(ctx, ``)
+}
+
+func (q *SQLiteBackend) queryGuildThemes(ctx context.Context, where string, args ...any) ([]backend.GuildTheme, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT guild, theme, start_at, end_at, applied, originals FROM themes `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	themes := make([]backend.GuildTheme, 0)
+
+	for rows.Next() {
+		var theme backend.GuildTheme
+		var startAt, endAt int64
+		var originals string
+
+		if err = rows.Scan(&theme.Guild, &theme.Theme, &startAt, &endAt, &theme.Applied, &originals); err != nil {
+			return nil, err
+		}
+
+		if err = json.Unmarshal([]byte(originals), &theme.Originals); err != nil {
+			return nil, errors.Wrap(err, "failed to decode original role colors")
+		}
+
+		theme.StartAt = fromUnixNanos(startAt)
+		theme.EndAt = fromUnixNanos(endAt)
+		themes = append(themes, theme)
+	}
+
+	return themes, rows.Err()
+}
+
+func (q *SQLiteBackend) SetGroup(ctx context.Context, group backend.GroupRole) error {
+	_, err := q.db.ExecContext(ctx, `INSERT INTO groups (guild, role, owner, co_edit, max_members) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (guild, role) DO UPDATE SET owner = excluded.owner, co_edit = excluded.co_edit, max_members = excluded.max_members`,
+		group.Guild, group.Role, group.Owner, group.CoEdit, group.MaxMembers)
+
+	return err
+}
+
+func (q *SQLiteBackend) GetGroup(ctx context.Context, guild string, role string) (*backend.GroupRole, error) {
+	group := backend.GroupRole{Guild: guild, Role: role}
+
+	err := q.db.QueryRowContext(ctx, `SELECT owner, co_edit, max_members FROM groups WHERE guild = ? AND role = ?`, guild, role).
+		Scan(&group.Owner, &group.CoEdit, &group.MaxMembers)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+func (q *SQLiteBackend) DeleteGroup(ctx context.Context, guild string, role string) error {
+	return q.transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM group_members WHERE guild = ? AND role = ?`, guild, role); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM groups WHERE guild = ? AND role = ?`, guild, role)
+		return err
+	})
+}
+
+func (q *SQLiteBackend) AddGroupMember(ctx context.Context, guild string, role string, user string, limit int) error {
+	return q.transaction(ctx, func(tx *sql.Tx) error {
+		var exists bool
+		var count int
+
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(user = ?), 0) > 0 FROM group_members WHERE guild = ? AND role = ?`,
+			user, guild, role).Scan(&count, &exists)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return nil
+		}
+
+		if limit > 0 && count >= limit {
+			return backend.GroupMemberLimitReached
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO group_members (guild, role, user) VALUES (?, ?, ?)`, guild, role, user)
+		return err
+	})
+}
+
+func (q *SQLiteBackend) RemoveGroupMember(ctx context.Context, guild string, role string, user string) error {
+	_, err := q.db.ExecContext(ctx, `DELETE FROM group_members WHERE guild = ? AND role = ? AND user = ?`, guild, role, user)
+	return err
+}
+
+func (q *SQLiteBackend) GetGroupMembers(ctx context.Context, guild string, role string) ([]string, error) {
+	return q.queryStrings(ctx, `SELECT user FROM group_members WHERE guild = ? AND role = ? ORDER BY user`, guild, role)
+}
+
+func (q *SQLiteBackend) GetMemberGroups(ctx context.Context, guild string, user string) ([]string, error) {
+	return q.queryStrings(ctx, `SELECT role FROM group_members WHERE guild = ? AND user = ? ORDER BY role`, guild, user)
+}
+
+func (q *SQLiteBackend) ListGroups(ctx context.Context, guild string) ([]backend.GroupRole, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT role, owner, co_edit, max_members FROM groups WHERE guild = ? ORDER BY role`, guild)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	groups := make([]backend.GroupRole, 0)
+
+	for rows.Next() {
+		group := backend.GroupRole{Guild: guild}
+
+		if err = rows.Scan(&group.Role, &group.Owner, &group.CoEdit, &group.MaxMembers); err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+func (q *SQLiteBackend) queryStrings(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	values := make([]string, 0)
+
+	for rows.Next() {
+		var value string
+		if err = rows.Scan(&value); err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+func (q *SQLiteBackend) GetGuildSettings(ctx context.Context, guild string) (backend.GuildSettings, error) {
+	var settings backend.GuildSettings
+	var rateLimits string
+
+	err := q.db.QueryRowContext(ctx, `SELECT approval_required, approval_channel, rate_limits FROM settings WHERE guild = ?`, guild).
+		Scan(&settings.ApprovalRequired, &settings.ApprovalChannel, &rateLimits)
+	if errors.Is(err, sql.ErrNoRows) {
+		return settings, nil
+	}
+
+	if err != nil {
+		return settings, err
+	}
+
+	if err = json.Unmarshal([]byte(rateLimits), &settings.RateLimits); err != nil {
+		return settings, errors.Wrap(err, "failed to decode rate limits")
+	}
+
+	if len(settings.RateLimits) == 0 {
+		settings.RateLimits = nil
+	}
+
+	return settings, nil
+}
+
+func (q *SQLiteBackend) SetGuildSettings(ctx context.Context, guild string, settings backend.GuildSettings) error {
+	rateLimits, err := json.Marshal(settings.RateLimits)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode rate limits")
+	}
+
+	_, err = q.db.ExecContext(ctx, `INSERT INTO settings (guild, approval_required, approval_channel, rate_limits) VALUES (?, ?, ?, ?)
+		ON CONFLICT (guild) DO UPDATE SET approval_required = excluded.approval_required, approval_channel = excluded.approval_channel,
+			rate_limits = excluded.rate_limits`,
+		guild, settings.ApprovalRequired, settings.ApprovalChannel, string(rateLimits))
+
+	return err
+}
+
+func (q *SQLiteBackend) SetApproval(ctx context.Context, request backend.ApprovalRequest) error {
+	_, err := q.db.ExecContext(ctx, `INSERT INTO approvals
+		(guild, id, user, requester, name, color, channel, message, app_id, token, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (guild, id) DO UPDATE SET user = excluded.user, requester = excluded.requester, name = excluded.name,
+			color = excluded.color, channel = excluded.channel, message = excluded.message, app_id = excluded.app_id,
+			token = excluded.token, created_at = excluded.created_at, expires_at = excluded.expires_at`,
+		request.Guild, request.ID, request.User, request.Requester, request.Name, request.Color, request.Channel,
+		request.Message, request.AppID, request.Token, toUnixNanos(request.CreatedAt), toUnixNanos(request.ExpiresAt))
+
+	return err
+}
+
+func (q *SQLiteBackend) GetApproval(ctx context.Context, guild string, id string) (*backend.ApprovalRequest, error) {
+	requests, err := q.queryApprovals(ctx, `WHERE guild = ? AND id = ?`, guild, id)
+	if err != nil || len(requests) == 0 {
+		return nil, err
+	}
+
+	return &requests[0], nil
+}
+
+func (q *SQLiteBackend) DeleteApproval(ctx context.Context, guild string, id string) error {
+	_, err := q.db.ExecContext(ctx, `DELETE FROM approvals WHERE guild = ? AND id = ?`, guild, id)
+	return err
+}
+
+func (q *SQLiteBackend) ListApprovals(ctx context.Context) ([]backend.ApprovalRequest, error) {
+	return q.queryApprovals(ctx, ``)
+}
+
+func (q *SQLiteBackend) ListGuildApprovals(ctx context.Context, guild string) ([]backend.ApprovalRequest, error) {
+	return q.queryApprovals(ctx, `WHERE guild = ?`, guild)
+}
+
+func (q *SQLiteBackend) queryApprovals(ctx context.Context, where string, args ...any) ([]backend.ApprovalRequest, error) {
+	rows, err := q.db.QueryContext(ctx, `SELECT guild, id, user, requester, name, color, channel, message, app_id, token,
+		created_at, expires_at FROM approvals `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	requests := make([]backend.ApprovalRequest, 0)
+
+	for rows.Next() {
+		var request backend.ApprovalRequest
+		var color sql.NullInt64
+		var createdAt, expiresAt int64
+
+		err = rows.Scan(&request.Guild, &request.ID, &request.User, &request.Requester, &request.Name, &color,
+			&request.Channel, &request.Message, &request.AppID, &request.Token, &createdAt, &expiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if color.Valid {
+			value := int(color.Int64)
+			request.Color = &value
+		}
+
+		request.CreatedAt = fromUnixNanos(createdAt)
+		request.ExpiresAt = fromUnixNanos(expiresAt)
+		requests = append(requests, request)
+	}
+
+	return requests, rows.Err()
+}
+
+// toUnixNanos stores the zero time as 0, so it is read back as the zero time instead of the unix epoch
+func toUnixNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+func fromUnixNanos(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
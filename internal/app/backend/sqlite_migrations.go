@@ -0,0 +1,112 @@
+package backend
+
+// sqliteMigrations are applied in order, each in its own transaction. The index of a migration plus one is its
+// schema version, so migrations must only ever be appended.
+var sqliteMigrations = []string{
+	// 1: initial schema
+	`
+	CREATE TABLE roles (
+		guild TEXT NOT NULL,
+		user  TEXT NOT NULL,
+		role  TEXT NOT NULL,
+		PRIMARY KEY (guild, user)
+	);
+	CREATE INDEX roles_by_role ON roles (guild, role);
+
+	CREATE TABLE role_audit (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		guild    TEXT    NOT NULL,
+		user     TEXT    NOT NULL,
+		action   TEXT    NOT NULL,
+		role     TEXT    NOT NULL,
+		previous TEXT    NOT NULL,
+		time     INTEGER NOT NULL
+	);
+	CREATE INDEX role_audit_by_user ON role_audit (guild, user, id);
+
+	CREATE TABLE history (
+		id    INTEGER PRIMARY KEY AUTOINCREMENT,
+		guild TEXT    NOT NULL,
+		user  TEXT    NOT NULL,
+		name  TEXT    NOT NULL,
+		color INTEGER NOT NULL,
+		time  INTEGER NOT NULL
+	);
+	CREATE INDEX history_by_user ON history (guild, user, id);
+
+	CREATE TABLE favorites (
+		guild TEXT    NOT NULL,
+		user  TEXT    NOT NULL,
+		color INTEGER NOT NULL,
+		label TEXT    NOT NULL,
+		time  INTEGER NOT NULL,
+		PRIMARY KEY (guild, user, color)
+	);
+
+	CREATE TABLE schedules (
+		guild      TEXT    NOT NULL,
+		user       TEXT    NOT NULL,
+		source     TEXT    NOT NULL,
+		palette    TEXT    NOT NULL,
+		base_color INTEGER NOT NULL,
+		interval   INTEGER NOT NULL,
+		step       INTEGER NOT NULL,
+		next_run   INTEGER NOT NULL,
+		PRIMARY KEY (guild, user)
+	);
+	CREATE INDEX schedules_by_next_run ON schedules (next_run);
+
+	CREATE TABLE themes (
+		guild     TEXT    NOT NULL PRIMARY KEY,
+		theme     TEXT    NOT NULL,
+		start_at  INTEGER NOT NULL,
+		end_at    INTEGER NOT NULL,
+		applied   INTEGER NOT NULL,
+		originals TEXT    NOT NULL
+	);
+
+	CREATE TABLE groups (
+		guild       TEXT    NOT NULL,
+		role        TEXT    NOT NULL,
+		owner       TEXT    NOT NULL,
+		co_edit     INTEGER NOT NULL,
+		max_members INTEGER NOT NULL,
+		PRIMARY KEY (guild, role)
+	);
+
+	CREATE TABLE group_members (
+		guild TEXT NOT NULL,
+		role  TEXT NOT NULL,
+		user  TEXT NOT NULL,
+		PRIMARY KEY (guild, role, user)
+	);
+	CREATE INDEX group_members_by_user ON group_members (guild, user);
+
+	CREATE TABLE settings (
+		guild             TEXT    NOT NULL PRIMARY KEY,
+		approval_required INTEGER NOT NULL,
+		approval_channel  TEXT    NOT NULL
+	);
+
+	CREATE TABLE approvals (
+		guild      TEXT    NOT NULL,
+		id         TEXT    NOT NULL,
+		user       TEXT    NOT NULL,
+		requester  TEXT    NOT NULL,
+		name       TEXT    NOT NULL,
+		color      INTEGER,
+		channel    TEXT    NOT NULL,
+		message    TEXT    NOT NULL,
+		app_id     TEXT    NOT NULL,
+		token      TEXT    NOT NULL,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		PRIMARY KEY (guild, id)
+	);
+	CREATE INDEX approvals_by_expiry ON approvals (expires_at);
+	`,
+	// 2: per-guild rate limits of commands
+	`
+	ALTER TABLE settings ADD COLUMN rate_limits TEXT NOT NULL DEFAULT '{}';
+	`,
+}
@@ -0,0 +1,23 @@
+package backend
+
+import (
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend/backendtest"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteBackend(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) backend.Backend {
+		q := &SQLiteBackend{}
+		if err := q.Init(&backend.StorageConfig{Type: backend.StorageSQLite, Database: filepath.Join(t.TempDir(), "curator.db")}); err != nil {
+			t.Fatalf("Init() error = %v", err)
+		}
+
+		t.Cleanup(func() {
+			_ = q.Close(nil)
+		})
+
+		return q
+	})
+}
@@ -0,0 +1,356 @@
+package cmdstest
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Call is a request made to the fake session, with the arguments it was made with
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// Session is a fake Discord session recording every request made to it. Guild and CachedRoles return the guilds as
+// they are set, like a state that has not caught up yet, while the role requests work on the roles of each guild.
+type Session struct {
+	mutex sync.Mutex
+	calls []Call
+
+	Guilds  map[string]*discordgo.Guild
+	Roles   map[string][]*discordgo.Role
+	Members map[string]map[string][]string
+	Users   map[string]*discordgo.User
+
+	// Errors are returned by the method of the same name instead of doing anything
+	Errors map[string]error
+
+	nextID int
+}
+
+// NewSession creates a fake session without any guilds or users
+func NewSession() *Session {
+	return &Session{
+		Guilds:  make(map[string]*discordgo.Guild),
+		Roles:   make(map[string][]*discordgo.Role),
+		Members: make(map[string]map[string][]string),
+		Users:   make(map[string]*discordgo.User),
+		Errors:  make(map[string]error),
+	}
+}
+
+// NotFound returns the error Discord responds with when something does not exist
+func NotFound() error {
+	return &discordgo.RESTError{
+		Response: &http.Response{StatusCode: http.StatusNotFound},
+		Message:  &discordgo.APIErrorMessage{Code: discordgo.ErrCodeUnknownRole, Message: "Unknown Role"},
+	}
+}
+
+// AddGuild adds a guild to the session, the state of the guild and its roles start out the same
+func (s *Session) AddGuild(id string, roles ...*discordgo.Role) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Guilds[id] = &discordgo.Guild{ID: id, Roles: slices.Clone(roles)}
+	s.Roles[id] = slices.Clone(roles)
+}
+
+// Calls returns the requests made to the session, only those to the given methods when any are given
+func (s *Session) Calls(methods ...string) []Call {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	calls := make([]Call, 0, len(s.calls))
+	for _, call := range s.calls {
+		if len(methods) == 0 || slices.Contains(methods, call.Method) {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Replies returns the content of every response, edit and follow-up sent to interactions, in order
+func (s *Session) Replies() []string {
+	replies := make([]string, 0)
+
+	for _, call := range s.Calls("InteractionRespond", "InteractionResponseEdit", "FollowupMessageCreate") {
+		switch data := call.Args[1].(type) {
+		case *discordgo.InteractionResponse:
+			if data.Data != nil && data.Data.Content != "" {
+				replies = append(replies, data.Data.Content)
+			}
+		case *discordgo.WebhookEdit:
+			if data.Content != nil {
+				replies = append(replies, *data.Content)
+			}
+		case *discordgo.WebhookParams:
+			if data.Content != "" {
+				replies = append(replies, data.Content)
+			}
+		}
+	}
+
+	return replies
+}
+
+// MemberRoles returns the roles given to a member of a guild
+func (s *Session) MemberRoles(guildID, userID string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return slices.Clone(s.Members[guildID][userID])
+}
+
+// CachedRoles returns the roles of a guild as they are set, without recording a request
+func (s *Session) CachedRoles(guildID string) ([]*discordgo.Role, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	guild, exists := s.Guilds[guildID]
+	if !exists {
+		return nil, false
+	}
+
+	return slices.Clone(guild.Roles), true
+}
+
+// record records a call and returns the error set for its method
+func (s *Session) record(method string, args ...any) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.calls = append(s.calls, Call{Method: method, Args: args})
+
+	return s.Errors[method]
+}
+
+func (s *Session) newID() string {
+	s.nextID++
+	return strconv.Itoa(s.nextID)
+}
+
+func (s *Session) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, _ ...discordgo.RequestOption) error {
+	return s.record("InteractionRespond", interaction, resp)
+}
+
+func (s *Session) InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := s.record("InteractionResponseEdit", interaction, newresp); err != nil {
+		return nil, err
+	}
+
+	return &discordgo.Message{}, nil
+}
+
+func (s *Session) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := s.record("FollowupMessageCreate", interaction, data, wait); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return &discordgo.Message{ID: s.newID(), Content: data.Content}, nil
+}
+
+func (s *Session) FollowupMessageEdit(interaction *discordgo.Interaction, messageID string, data *discordgo.WebhookEdit, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := s.record("FollowupMessageEdit", interaction, messageID, data); err != nil {
+		return nil, err
+	}
+
+	return &discordgo.Message{ID: messageID}, nil
+}
+
+func (s *Session) FollowupMessageDelete(interaction *discordgo.Interaction, messageID string, _ ...discordgo.RequestOption) error {
+	return s.record("FollowupMessageDelete", interaction, messageID)
+}
+
+func (s *Session) ChannelMessageSend(channelID string, content string, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := s.record("ChannelMessageSend", channelID, content); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return &discordgo.Message{ID: s.newID(), ChannelID: channelID, Content: content}, nil
+}
+
+func (s *Session) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := s.record("ChannelMessageSendComplex", channelID, data); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return &discordgo.Message{ID: s.newID(), ChannelID: channelID, Content: data.Content}, nil
+}
+
+func (s *Session) ChannelMessageEditComplex(m *discordgo.MessageEdit, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	if err := s.record("ChannelMessageEditComplex", m); err != nil {
+		return nil, err
+	}
+
+	return &discordgo.Message{ID: m.ID, ChannelID: m.Channel}, nil
+}
+
+func (s *Session) ChannelMessageDelete(channelID, messageID string, _ ...discordgo.RequestOption) error {
+	return s.record("ChannelMessageDelete", channelID, messageID)
+}
+
+func (s *Session) User(userID string, _ ...discordgo.RequestOption) (*discordgo.User, error) {
+	if err := s.record("User", userID); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, exists := s.Users[userID]
+	if !exists {
+		return nil, NotFound()
+	}
+
+	return user, nil
+}
+
+func (s *Session) UserChannelCreate(recipientID string, _ ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	if err := s.record("UserChannelCreate", recipientID); err != nil {
+		return nil, err
+	}
+
+	return &discordgo.Channel{ID: "dm:" + recipientID, Type: discordgo.ChannelTypeDM}, nil
+}
+
+func (s *Session) Guild(guildID string, _ ...discordgo.RequestOption) (*discordgo.Guild, error) {
+	if err := s.record("Guild", guildID); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	guild, exists := s.Guilds[guildID]
+	if !exists {
+		return nil, NotFound()
+	}
+
+	return guild, nil
+}
+
+func (s *Session) GuildRoles(guildID string, _ ...discordgo.RequestOption) ([]*discordgo.Role, error) {
+	if err := s.record("GuildRoles", guildID); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return slices.Clone(s.Roles[guildID]), nil
+}
+
+func (s *Session) GuildRoleCreate(guildID string, data *discordgo.RoleParams, _ ...discordgo.RequestOption) (*discordgo.Role, error) {
+	if err := s.record("GuildRoleCreate", guildID, data); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	role := &discordgo.Role{ID: "role:" + s.newID()}
+	applyRoleParams(role, data)
+
+	s.Roles[guildID] = append(s.Roles[guildID], role)
+
+	return role, nil
+}
+
+func (s *Session) GuildRoleEdit(guildID, roleID string, data *discordgo.RoleParams, _ ...discordgo.RequestOption) (*discordgo.Role, error) {
+	if err := s.record("GuildRoleEdit", guildID, roleID, data); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	index := slices.IndexFunc(s.Roles[guildID], func(role *discordgo.Role) bool { return role.ID == roleID })
+	if index < 0 {
+		return nil, NotFound()
+	}
+
+	role := *s.Roles[guildID][index]
+	applyRoleParams(&role, data)
+
+	s.Roles[guildID][index] = &role
+
+	return &role, nil
+}
+
+func (s *Session) GuildRoleDelete(guildID, roleID string, _ ...discordgo.RequestOption) error {
+	if err := s.record("GuildRoleDelete", guildID, roleID); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	roles := s.Roles[guildID]
+	if !slices.ContainsFunc(roles, func(role *discordgo.Role) bool { return role.ID == roleID }) {
+		return NotFound()
+	}
+
+	s.Roles[guildID] = slices.DeleteFunc(roles, func(role *discordgo.Role) bool { return role.ID == roleID })
+
+	return nil
+}
+
+func (s *Session) GuildMemberRoleAdd(guildID, userID, roleID string, _ ...discordgo.RequestOption) error {
+	if err := s.record("GuildMemberRoleAdd", guildID, userID, roleID); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Members[guildID] == nil {
+		s.Members[guildID] = make(map[string][]string)
+	}
+
+	if !slices.Contains(s.Members[guildID][userID], roleID) {
+		s.Members[guildID][userID] = append(s.Members[guildID][userID], roleID)
+	}
+
+	return nil
+}
+
+func (s *Session) GuildMemberRoleRemove(guildID, userID, roleID string, _ ...discordgo.RequestOption) error {
+	if err := s.record("GuildMemberRoleRemove", guildID, userID, roleID); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Members[guildID] == nil {
+		return nil
+	}
+
+	s.Members[guildID][userID] = slices.DeleteFunc(s.Members[guildID][userID], func(id string) bool { return id == roleID })
+
+	return nil
+}
+
+func applyRoleParams(role *discordgo.Role, data *discordgo.RoleParams) {
+	if data.Name != "" {
+		role.Name = data.Name
+	}
+
+	if data.Color != nil {
+		role.Color = *data.Color
+	}
+}
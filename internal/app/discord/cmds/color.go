@@ -2,6 +2,7 @@ package cmds
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
 	"github.com/Sxtanna/chromatic_curator/internal/common"
@@ -13,14 +14,21 @@ import (
 	"strings"
 )
 
+// shareColorNamespace is the custom ID namespace of the "Share to Channel" button of color and palette previews
+// Format: share_color:<generation id>
+const shareColorNamespace = "share_color"
+
 // ColorCommand represents a command to preview colors
 type ColorCommand struct {
 	BaseCommand
+
+	generations data.GenerationStore
 }
 
 // NewColorCommand creates a new color preview command
-func NewColorCommand() *ColorCommand {
+func NewColorCommand(generations data.GenerationStore) *ColorCommand {
 	return &ColorCommand{
+		generations: generations,
 		BaseCommand: BaseCommand{
 			Name:        "color",
 			Description: "Preview colors from the available color set",
@@ -44,8 +52,70 @@ func NewColorCommand() *ColorCommand {
 	}
 }
 
+// ComponentHandlers returns the handler of the "Share to Channel" button, which palette previews use as well
+func (c *ColorCommand) ComponentHandlers() map[string]ComponentHandler {
+	return map[string]ComponentHandler{shareColorNamespace: c.handleShareButton}
+}
+
+// ModalHandlers returns no handlers, the command has no modals
+func (c *ColorCommand) ModalHandlers() map[string]ComponentHandler {
+	return nil
+}
+
+// handleShareButton posts a preview to the channel, replacing the preview only visible to the caller
+func (c *ColorCommand) handleShareButton(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, args ComponentArgs) error {
+	imageID, err := args.String(0)
+	if err != nil {
+		return err
+	}
+
+	generation, err := c.generations.Take(context.Background(), imageID)
+	if err != nil {
+		return err
+	}
+
+	// The preview expired or was already shared
+	if generation == nil {
+		return ComponentExpired
+	}
+
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{generation.Embed},
+			Files: []*discordgo.File{
+				{
+					Name:   "color_preview.png",
+					Reader: bytes.NewReader(generation.ImageData),
+				},
+			},
+		},
+	})
+
+	if err != nil {
+		logger.Error("Failed to respond to button interaction",
+			slog.Any("error", err))
+
+		empty := make([]discordgo.MessageComponent, 0)
+
+		if _, err = s.FollowupMessageEdit(i.Interaction, generation.TempMsgID, &discordgo.WebhookEdit{Components: &empty}); err != nil {
+			logger.Error("Failed to remove button interaction",
+				slog.Any("error", err))
+		}
+
+		return nil
+	}
+
+	if err = s.FollowupMessageDelete(i.Interaction, generation.TempMsgID); err != nil {
+		logger.Error("Failed to delete temp message",
+			slog.Any("error", err))
+	}
+
+	return nil
+}
+
 // Execute handles the command execution
-func (c *ColorCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+func (c *ColorCommand) Execute(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
 	// Get the color name/hex from the options
 	colorOption := GetOptionByName(i.Interaction, "name")
 	if colorOption == nil {
@@ -144,13 +214,30 @@ func (c *ColorCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCre
 	generation.ImageData = imageData
 	generation.Embed = generateColorGenerationEmbed(generation, similarColors, randomColors)
 
-	// Generate a UUID for the image and store it in the cache
-	imageID := data.SaveGeneration(generation)
+	// The preview is saved once it is sent, the share button needs its ID before that
+	imageID := data.NewGenerationID()
 
 	// Create a custom ID for the share button that includes the UUID
-	shareButtonID := fmt.Sprintf("share_color:%s", imageID)
+	shareButtonID := ComponentID(shareColorNamespace, imageID)
+
+	buttons := []discordgo.MessageComponent{
+		discordgo.Button{
+			Label:    "Share to Channel",
+			Style:    discordgo.PrimaryButton,
+			CustomID: shareButtonID,
+		},
+	}
 
-	// Then, send a follow-up message with the image and a share button
+	// Favorites are stored per guild, so only offer to save one when used in a guild
+	if i.GuildID != "" {
+		buttons = append(buttons, discordgo.Button{
+			Label:    "Add to Favorites",
+			Style:    discordgo.SecondaryButton,
+			CustomID: ComponentID(favoriteColorNamespace, strconv.Itoa(colorInt)),
+		})
+	}
+
+	// Then, send a follow-up message with the image and the buttons
 	tempMessage, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
 		Flags:  discordgo.MessageFlagsEphemeral,
 		Embeds: []*discordgo.MessageEmbed{generation.Embed},
@@ -162,13 +249,7 @@ func (c *ColorCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCre
 		},
 		Components: []discordgo.MessageComponent{
 			discordgo.ActionsRow{
-				Components: []discordgo.MessageComponent{
-					discordgo.Button{
-						Label:    "Share to Channel",
-						Style:    discordgo.PrimaryButton,
-						CustomID: shareButtonID,
-					},
-				},
+				Components: buttons,
 			},
 		},
 	})
@@ -180,6 +261,11 @@ func (c *ColorCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCre
 
 	generation.TempMsgID = tempMessage.ID
 
+	if err = c.generations.Save(context.Background(), imageID, generation); err != nil {
+		logger.Error("Failed to save generation, it cannot be shared",
+			slog.Any("error", err))
+	}
+
 	return nil
 }
 
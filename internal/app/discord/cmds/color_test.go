@@ -0,0 +1,180 @@
+package cmds
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds/cmdstest"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// previewInteraction returns an invocation of a preview command with the options in the test guild
+func previewInteraction(command string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	interaction := newTestInteraction("guild", "member")
+	interaction.Data = discordgo.ApplicationCommandInteractionData{Name: command, Options: options}
+
+	return interaction
+}
+
+func intOption(name string, value int) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionInteger, Name: name, Value: float64(value)}
+}
+
+// sentPreview returns the follow-up a preview was sent with, or nil when none was sent
+func sentPreview(session *cmdstest.Session) *discordgo.WebhookParams {
+	calls := session.Calls("FollowupMessageCreate")
+	if len(calls) != 1 {
+		return nil
+	}
+
+	params, _ := calls[0].Args[1].(*discordgo.WebhookParams)
+	return params
+}
+
+func TestColorCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		interaction *discordgo.InteractionCreate
+		reply       string
+		buttons     int
+		similar     bool
+	}{
+		{
+			name:        "previews a named color",
+			interaction: previewInteraction("color", stringOption("name", "red")),
+			buttons:     2,
+		},
+		{
+			name:        "previews similar colors",
+			interaction: previewInteraction("color", stringOption("name", "#336699"), intOption("range", 3)),
+			buttons:     2,
+			similar:     true,
+		},
+		{
+			name:        "previews random colors",
+			interaction: previewInteraction("color", stringOption("name", "random"), intOption("range", 2)),
+			buttons:     2,
+			similar:     true,
+		},
+		{
+			name: "does not offer favorites outside a guild",
+			interaction: func() *discordgo.InteractionCreate {
+				interaction := newTestInteraction("", "member")
+				interaction.Data = discordgo.ApplicationCommandInteractionData{Name: "color", Options: []*discordgo.ApplicationCommandInteractionDataOption{stringOption("name", "red")}}
+				return interaction
+			}(),
+			buttons: 1,
+		},
+		{
+			name:        "refuses an unknown color",
+			interaction: previewInteraction("color", stringOption("name", "not a color")),
+			reply:       "Could not parse color",
+		},
+		{
+			name:        "requires a color",
+			interaction: previewInteraction("color"),
+			reply:       "Color name or hex code is required",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := cmdstest.NewSession()
+			generations := data.NewMemoryGenerationStore(10, time.Minute)
+
+			if err := NewColorCommand(generations).Execute(session, test.interaction, slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			preview := sentPreview(session)
+
+			if test.reply != "" {
+				if replies := session.Replies(); len(replies) != 1 || !strings.Contains(replies[0], test.reply) {
+					t.Errorf("expected a reply containing %q, got %v", test.reply, replies)
+				}
+
+				if preview != nil {
+					t.Errorf("expected no preview, got %v", preview)
+				}
+
+				return
+			}
+
+			if preview == nil || len(preview.Embeds) != 1 || len(preview.Files) != 1 {
+				t.Fatalf("expected a preview with an embed and an image, got %v", session.Calls())
+			}
+
+			if buttons := preview.Components[0].(discordgo.ActionsRow).Components; len(buttons) != test.buttons {
+				t.Errorf("expected %d buttons, got %d", test.buttons, len(buttons))
+			}
+
+			if similar := len(preview.Embeds[0].Fields) > 2; similar != test.similar {
+				t.Errorf("expected similar colors listed to be %v, got %v", test.similar, similar)
+			}
+		})
+	}
+}
+
+func TestColorCommandShareButton(t *testing.T) {
+	tests := []struct {
+		name      string
+		saved     bool
+		respond   error
+		err       error
+		followups []string
+	}{
+		{
+			name:      "shares the preview and removes the private one",
+			saved:     true,
+			followups: []string{"FollowupMessageDelete"},
+		},
+		{
+			name:      "removes the button when the preview cannot be shared",
+			saved:     true,
+			respond:   errors.New("missing permissions"),
+			followups: []string{"FollowupMessageEdit"},
+		},
+		{
+			name: "reports an expired preview",
+			err:  ComponentExpired,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := cmdstest.NewSession()
+			session.Errors["InteractionRespond"] = test.respond
+
+			generations := data.NewMemoryGenerationStore(10, time.Minute)
+			if test.saved {
+				_ = generations.Save(context.Background(), "preview", &data.ColorGeneration{TempMsgID: "temporary", Embed: &discordgo.MessageEmbed{}})
+			}
+
+			command := NewColorCommand(generations)
+			err := command.handleShareButton(session, newTestInteraction("guild", "member"), slog.New(slog.DiscardHandler), ComponentArgs{values: []string{"preview"}})
+
+			if !errors.Is(err, test.err) {
+				t.Errorf("expected error %v, got %v", test.err, err)
+			}
+
+			calls := session.Calls("FollowupMessageDelete", "FollowupMessageEdit")
+			if len(calls) != len(test.followups) {
+				t.Fatalf("expected follow-ups %v, got %v", test.followups, calls)
+			}
+
+			for index, call := range calls {
+				if call.Method != test.followups[index] || call.Args[1] != "temporary" {
+					t.Errorf("expected %s of the private preview, got %v", test.followups[index], call)
+				}
+			}
+
+			if generation, _ := generations.Take(context.Background(), "preview"); generation != nil {
+				t.Error("expected a preview to only be shared once")
+			}
+		})
+	}
+}
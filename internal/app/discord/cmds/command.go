@@ -1,10 +1,17 @@
 package cmds
 
 import (
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
 	"github.com/bwmarrin/discordgo"
 	"log/slog"
+	"slices"
+	"strings"
+	"unicode/utf8"
 )
 
+// maxEmbedFieldLength is the most characters Discord accepts in the value of an embed field
+const maxEmbedFieldLength = 1024
+
 // Command represents a Discord slash command
 type Command interface {
 	// GetName returns the name of the command
@@ -17,14 +24,49 @@ type Command interface {
 	GetOptions() []*discordgo.ApplicationCommandOption
 
 	// Execute handles the command execution
-	Execute(s *discordgo.Session, i *discordgo.InteractionCreate, logger *slog.Logger) error
+	Execute(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error
+
+	// ApplicationCommand returns the command as it is registered with Discord
+	ApplicationCommand() *discordgo.ApplicationCommand
+
+	// GetMiddlewares returns the middlewares that run around the command, after those of the registry
+	GetMiddlewares() []Middleware
+}
+
+// AutocompleteCommand is a Command with options that offer autocomplete choices
+type AutocompleteCommand interface {
+	Command
+
+	// Autocomplete responds with the choices for the currently focused option
+	Autocomplete(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error
+}
+
+// BackendCommand is a Command that reads or writes the backend, it is refused while the backend is unreachable
+type BackendCommand interface {
+	Command
+
+	// RequiresBackend reports whether the command needs the backend to work
+	RequiresBackend() bool
 }
 
-// BaseCommand provides a basic implementation of the Command interface
+// BaseCommand provides a basic implementation of the Command interface. Commands with subcommands declare them
+// in Subcommands and Groups, and call Dispatch from Execute to run the handler of the invoked one.
 type BaseCommand struct {
 	Name        string
 	Description string
 	Options     []*discordgo.ApplicationCommandOption
+	Subcommands []*Subcommand
+	Groups      []*SubcommandGroup
+	Middlewares []Middleware
+
+	// DefaultMemberPermissions are the permissions members need to see the command, until guilds override them
+	DefaultMemberPermissions *int64
+	// DMPermission is whether the command can be used in direct messages, Discord allows it by default
+	DMPermission *bool
+	NSFW         bool
+
+	NameLocalizations        map[discordgo.Locale]string
+	DescriptionLocalizations map[discordgo.Locale]string
 }
 
 // GetName returns the name of the command
@@ -37,13 +79,87 @@ func (c *BaseCommand) GetDescription() string {
 	return c.Description
 }
 
-// GetOptions returns the options/arguments for the command
+// GetMiddlewares returns the middlewares that run around the command
+func (c *BaseCommand) GetMiddlewares() []Middleware {
+	return c.Middlewares
+}
+
+// GetOptions returns the options/arguments for the command, followed by its subcommand groups and subcommands
 func (c *BaseCommand) GetOptions() []*discordgo.ApplicationCommandOption {
-	return c.Options
+	options := slices.Clone(c.Options)
+
+	for _, group := range c.Groups {
+		options = append(options, group.option())
+	}
+
+	for _, subcommand := range c.Subcommands {
+		options = append(options, subcommand.option())
+	}
+
+	return options
 }
 
-func GetOptionByName(i *discordgo.Interaction, name string) *discordgo.ApplicationCommandInteractionDataOption {
+// ApplicationCommand returns the command as it is registered with Discord, along with its permissions
+func (c *BaseCommand) ApplicationCommand() *discordgo.ApplicationCommand {
+	command := &discordgo.ApplicationCommand{
+		Name:                     c.Name,
+		Description:              c.Description,
+		Options:                  c.GetOptions(),
+		DefaultMemberPermissions: c.DefaultMemberPermissions,
+		DMPermission:             c.DMPermission,
+	}
+
+	if c.NSFW {
+		command.NSFW = &c.NSFW
+	}
+
+	if len(c.NameLocalizations) > 0 {
+		command.NameLocalizations = &c.NameLocalizations
+	}
+
+	if len(c.DescriptionLocalizations) > 0 {
+		command.DescriptionLocalizations = &c.DescriptionLocalizations
+	}
+
+	return command
+}
+
+// GetSubcommandGroup returns the invoked subcommand group option, or nil if the command has no subcommand groups
+func GetSubcommandGroup(i *discordgo.Interaction) *discordgo.ApplicationCommandInteractionDataOption {
 	for _, option := range i.ApplicationCommandData().Options {
+		if option.Type == discordgo.ApplicationCommandOptionSubCommandGroup {
+			return option
+		}
+	}
+
+	return nil
+}
+
+// GetSubcommand returns the invoked subcommand option, looking inside the invoked subcommand group if there is one,
+// or nil if the command has no subcommands
+func GetSubcommand(i *discordgo.Interaction) *discordgo.ApplicationCommandInteractionDataOption {
+	options := i.ApplicationCommandData().Options
+	if group := GetSubcommandGroup(i); group != nil {
+		options = group.Options
+	}
+
+	for _, option := range options {
+		if option.Type == discordgo.ApplicationCommandOptionSubCommand {
+			return option
+		}
+	}
+
+	return nil
+}
+
+// GetOptionByName returns the named option, looking inside the invoked subcommand if there is one
+func GetOptionByName(i *discordgo.Interaction, name string) *discordgo.ApplicationCommandInteractionDataOption {
+	options := i.ApplicationCommandData().Options
+	if subcommand := GetSubcommand(i); subcommand != nil {
+		options = subcommand.Options
+	}
+
+	for _, option := range options {
 		if option.Name == name {
 			return option
 		}
@@ -52,25 +168,229 @@ func GetOptionByName(i *discordgo.Interaction, name string) *discordgo.Applicati
 	return nil
 }
 
-// Registry manages all available commands
+// GetUserOption returns the user of a user option, as resolved by Discord with the interaction or fetched when it
+// was not, and nil when the option is missing or the user cannot be found
+func GetUserOption(s Session, i *discordgo.Interaction, name string) *discordgo.User {
+	option := GetOptionByName(i, name)
+	if option == nil || option.Type != discordgo.ApplicationCommandOptionUser {
+		return nil
+	}
+
+	id, _ := option.Value.(string)
+
+	if resolved := i.ApplicationCommandData().Resolved; resolved != nil {
+		if user, exists := resolved.Users[id]; exists {
+			return user
+		}
+	}
+
+	user, err := s.User(id)
+	if err != nil {
+		return nil
+	}
+
+	return user
+}
+
+// GetFocusedOption returns the option currently being autocompleted, looking inside the invoked subcommand if there is one
+func GetFocusedOption(i *discordgo.Interaction) *discordgo.ApplicationCommandInteractionDataOption {
+	options := i.ApplicationCommandData().Options
+	if subcommand := GetSubcommand(i); subcommand != nil {
+		options = subcommand.Options
+	}
+
+	for _, option := range options {
+		if option.Focused {
+			return option
+		}
+	}
+
+	return nil
+}
+
+// getInteractionUser returns the user that created the interaction, in either a guild or a direct message
+func getInteractionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.User != nil {
+		return i.User
+	}
+
+	if i.Member != nil {
+		return i.Member.User
+	}
+
+	return nil
+}
+
+// respondWithEphemeralMessage replies to the interaction with a message only visible to the caller
+func respondWithEphemeralMessage(s Session, i *discordgo.InteractionCreate, content string) error {
+	return respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// respondWithUpdatedMessage replaces the message a component belongs to, removing its components
+func respondWithUpdatedMessage(s Session, i *discordgo.InteractionCreate, content string) error {
+	return respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+}
+
+// respondWithAutocompleteChoices replies to an autocomplete interaction with the given choices
+func respondWithAutocompleteChoices(s Session, i *discordgo.InteractionCreate, choices []*discordgo.ApplicationCommandOptionChoice) error {
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+}
+
+// splitEmbedFields lays out lines over as many fields as they need to stay within the length of a field, the first
+// field is named and the others continue it. A line too long for a field on its own is cut short.
+func splitEmbedFields(name string, lines []string) []*discordgo.MessageEmbedField {
+	fields := make([]*discordgo.MessageEmbedField, 0)
+
+	var (
+		value  strings.Builder
+		length int
+	)
+
+	flush := func() {
+		if length == 0 {
+			return
+		}
+
+		fieldName := name
+		if len(fields) > 0 {
+			// Field names cannot be empty, a zero width space continues the previous field
+			fieldName = "\u200b"
+		}
+
+		fields = append(fields, &discordgo.MessageEmbedField{Name: fieldName, Value: value.String()})
+
+		value.Reset()
+		length = 0
+	}
+
+	for _, line := range lines {
+		if runes := []rune(line); len(runes) >= maxEmbedFieldLength {
+			line = string(runes[:maxEmbedFieldLength-2]) + "…"
+		}
+
+		lineLength := utf8.RuneCountInString(line) + 1
+		if length+lineLength > maxEmbedFieldLength {
+			flush()
+		}
+
+		value.WriteString(line)
+		value.WriteString("\n")
+		length += lineLength
+	}
+
+	flush()
+
+	return fields
+}
+
+// Registry manages all available commands, and routes the components and modals they own
 type Registry struct {
-	commands map[string]Command
-	logger   *slog.Logger
+	commands    map[string]Command
+	middlewares []Middleware
+	components  map[string]ComponentHandler
+	modals      map[string]ComponentHandler
+	signer      *ComponentSigner
+	logger      *slog.Logger
+	health      backend.HealthReporter
 }
 
-// NewRegistry creates a new command registry
-func NewRegistry(logger *slog.Logger) *Registry {
+// NewRegistry creates a new command registry, verifying signed custom IDs with the signer
+func NewRegistry(logger *slog.Logger, signer *ComponentSigner) *Registry {
 	return &Registry{
-		commands: make(map[string]Command),
-		logger:   logger,
+		commands:   make(map[string]Command),
+		components: make(map[string]ComponentHandler),
+		modals:     make(map[string]ComponentHandler),
+		signer:     signer,
+		logger:     logger,
 	}
 }
 
-// RegisterCommand adds a command to the registry
+// RegisterCommand adds a command to the registry, along with its component and modal handlers
 func (r *Registry) RegisterCommand(cmd Command) {
 	r.commands[cmd.GetName()] = cmd
 	r.logger.Info("Registered command",
 		slog.String("command", cmd.GetName()))
+
+	if interactive, ok := cmd.(InteractiveCommand); ok {
+		stateful, requiresBackend := cmd.(BackendCommand)
+		requiresBackend = requiresBackend && stateful.RequiresBackend()
+
+		for namespace, handler := range interactive.ComponentHandlers() {
+			if requiresBackend {
+				handler = r.requireBackend(handler)
+			}
+
+			r.RegisterComponent(namespace, handler)
+		}
+
+		for namespace, handler := range interactive.ModalHandlers() {
+			if requiresBackend {
+				handler = r.requireBackend(handler)
+			}
+
+			r.RegisterModal(namespace, handler)
+		}
+	}
+}
+
+// SetHealth sets the health of the backend, the components, modals and autocomplete of commands that need the
+// backend are refused while it is unreachable. Commands themselves are refused by the RequireBackend middleware.
+func (r *Registry) SetHealth(health backend.HealthReporter) {
+	r.health = health
+}
+
+// backendUnavailable reports whether a command that needs the backend would currently fail
+func (r *Registry) backendUnavailable(cmd Command) bool {
+	stateful, ok := cmd.(BackendCommand)
+
+	return ok && stateful.RequiresBackend() && r.health != nil && !r.health.Healthy()
+}
+
+// requireBackend refuses a component or modal while the backend is unreachable
+func (r *Registry) requireBackend(handler ComponentHandler) ComponentHandler {
+	return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, args ComponentArgs) error {
+		if r.health != nil && !r.health.Healthy() {
+			return Reply(backendUnavailableMessage)
+		}
+
+		return handler(s, i, logger, args)
+	}
+}
+
+// Autocomplete offers the choices of the command being typed, none while the command cannot be used
+func (r *Registry) Autocomplete(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+	cmd, exists := r.GetCommand(i.ApplicationCommandData().Name)
+	if !exists {
+		return nil
+	}
+
+	autocomplete, ok := cmd.(AutocompleteCommand)
+	if !ok {
+		return nil
+	}
+
+	if r.backendUnavailable(cmd) {
+		return respondWithAutocompleteChoices(s, i, nil)
+	}
+
+	return autocomplete.Autocomplete(s, i, logger)
 }
 
 // GetCommand returns a command by name
@@ -88,15 +408,16 @@ func (r *Registry) GetAllCommands() []Command {
 	return cmds
 }
 
-// GetApplicationCommands returns all commands as ApplicationCommand objects
+// GetApplicationCommands returns all commands as ApplicationCommand objects, sorted by name
 func (r *Registry) GetApplicationCommands() []*discordgo.ApplicationCommand {
 	cmds := make([]*discordgo.ApplicationCommand, 0, len(r.commands))
 	for _, cmd := range r.commands {
-		cmds = append(cmds, &discordgo.ApplicationCommand{
-			Name:        cmd.GetName(),
-			Description: cmd.GetDescription(),
-			Options:     cmd.GetOptions(),
-		})
+		cmds = append(cmds, cmd.ApplicationCommand())
 	}
+
+	slices.SortFunc(cmds, func(a, b *discordgo.ApplicationCommand) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
 	return cmds
 }
@@ -0,0 +1,232 @@
+package cmds
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"emperror.dev/errors"
+	"encoding/base64"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ComponentInvalid is returned for custom IDs that are malformed, forged or missing arguments
+	ComponentInvalid = errors.Sentinel("this is no longer valid")
+	// ComponentExpired is returned for custom IDs past their expiry, or whose state is gone
+	ComponentExpired = errors.Sentinel("this has expired")
+)
+
+// signatureLength is the number of HMAC bytes kept in a signed custom ID, Discord limits them to 100 characters
+const signatureLength = 12
+
+// ComponentHandler handles the buttons, select menus or modals of a custom ID namespace. Returned errors are
+// replied to the user, see Reply.
+type ComponentHandler func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, args ComponentArgs) error
+
+// InteractiveCommand is a Command owning components or modals, their handlers are registered along with it
+type InteractiveCommand interface {
+	Command
+
+	// ComponentHandlers returns the handlers of the component custom ID namespaces owned by the command
+	ComponentHandlers() map[string]ComponentHandler
+
+	// ModalHandlers returns the handlers of the modal custom ID namespaces owned by the command
+	ModalHandlers() map[string]ComponentHandler
+}
+
+// ComponentArgs are the parts of a custom ID after its namespace
+type ComponentArgs struct {
+	values []string
+	signed bool
+}
+
+// Len returns the number of arguments
+func (a ComponentArgs) Len() int {
+	return len(a.values)
+}
+
+// Signed reports whether the custom ID was signed, so its arguments were chosen by the bot
+func (a ComponentArgs) Signed() bool {
+	return a.signed
+}
+
+// String returns the argument at the index
+func (a ComponentArgs) String(index int) (string, error) {
+	if index < 0 || index >= len(a.values) {
+		return "", errors.WithDetails(ComponentInvalid, "argument", index)
+	}
+
+	return a.values[index], nil
+}
+
+// Int returns the argument at the index as a number
+func (a ComponentArgs) Int(index int) (int, error) {
+	value, err := a.String(index)
+	if err != nil {
+		return 0, err
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.WithDetails(ComponentInvalid, "argument", index)
+	}
+
+	return number, nil
+}
+
+type replyError struct {
+	message string
+}
+
+func (e replyError) Error() string {
+	return e.message
+}
+
+// Reply returns an error whose message is shown to the user as is
+func Reply(message string) error {
+	return replyError{message: message}
+}
+
+// ComponentID builds the custom ID of a component or modal in the namespace
+func ComponentID(namespace string, args ...string) string {
+	return strings.Join(append([]string{namespace}, args...), ":")
+}
+
+// ComponentSigner signs custom IDs, so their arguments cannot be forged and they can expire
+type ComponentSigner struct {
+	key []byte
+}
+
+// NewComponentSigner creates a signer with a key derived from the secret. Every instance of the bot has to use
+// the same secret to accept the custom IDs signed by the others.
+func NewComponentSigner(secret string) *ComponentSigner {
+	key := sha256.Sum256([]byte("curator-components:" + secret))
+
+	return &ComponentSigner{key: key[:]}
+}
+
+// Sign builds a signed custom ID in the namespace, expiring at the given time or never when it is zero
+func (c *ComponentSigner) Sign(expiry time.Time, namespace string, args ...string) string {
+	unsigned := ComponentID(namespace, args...)
+
+	expires := int64(0)
+	if !expiry.IsZero() {
+		expires = expiry.Unix()
+	}
+
+	stamp := strconv.FormatInt(expires, 36)
+
+	return unsigned + ":~" + stamp + "." + c.signature(unsigned, stamp)
+}
+
+func (c *ComponentSigner) signature(unsigned string, stamp string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(unsigned + ":~" + stamp))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureLength])
+}
+
+// parse splits a custom ID into its namespace and arguments, verifying the signature when it has one
+func (c *ComponentSigner) parse(customID string, now time.Time) (string, ComponentArgs, error) {
+	parts := strings.Split(customID, ":")
+	namespace, args := parts[0], ComponentArgs{values: parts[1:]}
+
+	last := len(parts) - 1
+	if last == 0 || !strings.HasPrefix(parts[last], "~") {
+		return namespace, args, nil
+	}
+
+	stamp, signature, found := strings.Cut(strings.TrimPrefix(parts[last], "~"), ".")
+	unsigned := strings.Join(parts[:last], ":")
+
+	if !found || !hmac.Equal([]byte(signature), []byte(c.signature(unsigned, stamp))) {
+		return namespace, args, ComponentInvalid
+	}
+
+	expires, err := strconv.ParseInt(stamp, 36, 64)
+	if err != nil {
+		return namespace, args, ComponentInvalid
+	}
+
+	if expires != 0 && now.Unix() >= expires {
+		return namespace, args, ComponentExpired
+	}
+
+	args.values = parts[1:last]
+	args.signed = true
+
+	return namespace, args, nil
+}
+
+// RegisterComponent routes the components with custom IDs in the namespace to the handler
+func (r *Registry) RegisterComponent(namespace string, handler ComponentHandler) {
+	r.components[namespace] = handler
+}
+
+// RegisterModal routes the modals with custom IDs in the namespace to the handler
+func (r *Registry) RegisterModal(namespace string, handler ComponentHandler) {
+	r.modals[namespace] = handler
+}
+
+// HandleComponent routes a component or modal interaction to the handler of its custom ID namespace, replying
+// to the user when it is unknown, invalid, expired or fails
+func (r *Registry) HandleComponent(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) {
+	var customID string
+	var handlers map[string]ComponentHandler
+
+	switch i.Type {
+	case discordgo.InteractionMessageComponent:
+		customID, handlers = i.MessageComponentData().CustomID, r.components
+	case discordgo.InteractionModalSubmit:
+		customID, handlers = i.ModalSubmitData().CustomID, r.modals
+	default:
+		return
+	}
+
+	logger.Info("Received component interaction",
+		slog.String("customID", customID))
+
+	namespace, args, err := r.signer.parse(customID, time.Now())
+
+	handler, exists := handlers[namespace]
+	if !exists {
+		err = errors.WithDetails(ComponentInvalid, "namespace", namespace)
+	}
+
+	if err == nil {
+		err = handler(s, i, logger, args)
+	}
+
+	if err != nil {
+		r.replyWithError(s, i, logger, customID, err)
+	}
+}
+
+// replyWithError tells the user why their interaction failed, as a follow-up if the handler already responded
+func (r *Registry) replyWithError(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, customID string, err error) {
+	var reply replyError
+
+	content := "Something went wrong, please try again"
+
+	switch {
+	case errors.As(err, &reply):
+		content = reply.message
+	case errors.Is(err, ComponentExpired):
+		content = "This has expired, please run the command again"
+	case errors.Is(err, ComponentInvalid):
+		content = "This is no longer valid"
+	default:
+		logger.Error("Failed to handle component interaction",
+			slog.Any("error", err),
+			slog.String("customID", customID))
+	}
+
+	if err = replyWithEphemeralMessage(s, i, content); err != nil {
+		logger.Error("Failed to reply to component interaction",
+			slog.Any("error", err),
+			slog.String("customID", customID))
+	}
+}
@@ -0,0 +1,106 @@
+package cmds
+
+import (
+	"emperror.dev/errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComponentSignerParse(t *testing.T) {
+	signer := NewComponentSigner("secret")
+	now := time.Unix(1_700_000_000, 0)
+
+	signed := signer.Sign(time.Time{}, "group", "accept", "role", "user")
+	expiring := signer.Sign(now.Add(time.Minute), "share_color", "id")
+
+	tests := []struct {
+		name      string
+		customID  string
+		now       time.Time
+		namespace string
+		args      []string
+		signed    bool
+		err       error
+	}{
+		{
+			name:      "plain custom ID",
+			customID:  ComponentID("favorite_color", "255"),
+			now:       now,
+			namespace: "favorite_color",
+			args:      []string{"255"},
+		},
+		{
+			name:      "namespace without arguments",
+			customID:  "namespace",
+			now:       now,
+			namespace: "namespace",
+		},
+		{
+			name:      "signed custom ID",
+			customID:  signed,
+			now:       now,
+			namespace: "group",
+			args:      []string{"accept", "role", "user"},
+			signed:    true,
+		},
+		{
+			name:     "forged argument",
+			customID: strings.Replace(signed, "user", "other", 1),
+			now:      now,
+			err:      ComponentInvalid,
+		},
+		{
+			name:     "signed by another secret",
+			customID: NewComponentSigner("other").Sign(time.Time{}, "group", "accept", "role", "user"),
+			now:      now,
+			err:      ComponentInvalid,
+		},
+		{
+			name:      "before expiry",
+			customID:  expiring,
+			now:       now,
+			namespace: "share_color",
+			args:      []string{"id"},
+			signed:    true,
+		},
+		{
+			name:     "after expiry",
+			customID: expiring,
+			now:      now.Add(time.Hour),
+			err:      ComponentExpired,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			namespace, args, err := signer.parse(test.customID, test.now)
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("parse() error = %v, want %v", err, test.err)
+			}
+
+			if test.err != nil {
+				return
+			}
+
+			if namespace != test.namespace {
+				t.Errorf("parse() namespace = %q, want %q", namespace, test.namespace)
+			}
+
+			if args.Len() != len(test.args) || args.Signed() != test.signed {
+				t.Fatalf("parse() args = %v signed %v, want %v signed %v", args.values, args.Signed(), test.args, test.signed)
+			}
+
+			for index, want := range test.args {
+				if got, _ := args.String(index); got != want {
+					t.Errorf("args.String(%d) = %q, want %q", index, got, want)
+				}
+			}
+		})
+	}
+
+	if len(signer.Sign(now, "group", "decline", "1234567890123456789", "1234567890123456789")) > 100 {
+		t.Errorf("signed group invite is longer than the 100 characters Discord allows")
+	}
+}
@@ -0,0 +1,597 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"emperror.dev/errors"
+	"encoding/json"
+	"fmt"
+	"github.com/Sxtanna/chromatic_curator/internal/app/jobs"
+	"github.com/Sxtanna/chromatic_curator/internal/app/themes"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	unrecognizedTime = errors.Sentinel("time must be a duration like 12h or 3d, or a UTC date like 2025-10-31 or 2025-10-31 18:00")
+)
+
+// curatorPermissions hides the command from members who cannot manage the guild, until the guild overrides it
+var curatorPermissions int64 = discordgo.PermissionManageServer
+
+// CuratorCommand represents the admin command to manage the bot for a whole guild
+type CuratorCommand struct {
+	BaseCommand
+
+	backend         backend.Backend
+	jobs            *jobs.Queue
+	isAdminFunction func(id string) bool
+}
+
+// NewCuratorCommand creates a new guild administration command
+func NewCuratorCommand(curatorBackend backend.Backend, queue *jobs.Queue, isAdminFunction func(id string) bool) *CuratorCommand {
+	themeChoices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(common.Themes))
+	for _, theme := range common.Themes {
+		themeChoices = append(themeChoices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  theme.DisplayName,
+			Value: theme.Name,
+		})
+	}
+
+	command := &CuratorCommand{
+		backend:         curatorBackend,
+		jobs:            queue,
+		isAdminFunction: isAdminFunction,
+	}
+
+	command.BaseCommand = BaseCommand{
+		Name:                     "curator",
+		Description:              "Manage chromatic curator for this guild",
+		DefaultMemberPermissions: &curatorPermissions,
+		DMPermission:             new(bool),
+		Middlewares:              []Middleware{GuildOnly(), AdminOnly(isAdminFunction), AutoDefer(DefaultDeferThreshold, true)},
+		Groups: []*SubcommandGroup{
+			{
+				Name:        "theme",
+				Description: "Temporarily recolor every personal role for an event",
+				Subcommands: []*Subcommand{
+					{
+						Name:        "apply",
+						Description: "Apply a themed palette to every personal role",
+						Handler:     command.executeThemeApply,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "theme",
+								Description: "The theme to apply",
+								Required:    true,
+								Choices:     themeChoices,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "start",
+								Description: "When to apply the theme, like 12h or 2025-10-31 (now by default)",
+								Required:    false,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "end",
+								Description: "When to revert the theme, like 3d or 2025-11-01 (never by default)",
+								Required:    false,
+							},
+						},
+					},
+					{
+						Name:        "revert",
+						Description: "Restore the original colors, or cancel a scheduled theme",
+						Handler:     command.executeThemeRevert,
+					},
+					{
+						Name:        "status",
+						Description: "Show the applied or scheduled theme",
+						Handler:     command.executeThemeStatus,
+					},
+				},
+			},
+			{
+				Name:        "approval",
+				Description: "Require staff sign-off before role changes are applied",
+				Subcommands: []*Subcommand{
+					{
+						Name:        "enable",
+						Description: "Send role changes to a staff channel for approval",
+						Handler:     command.executeApprovalEnable,
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionChannel,
+								Name:         "channel",
+								Description:  "The staff channel approval requests are posted in",
+								Required:     true,
+								ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+							},
+						},
+					},
+					{
+						Name:        "disable",
+						Description: "Apply role changes immediately again",
+						Handler:     command.executeApprovalDisable,
+					},
+				},
+			},
+			{
+				Name:        "ratelimit",
+				Description: "Limit how often members use commands in this guild",
+				Subcommands: []*Subcommand{
+					{
+						Name:        "set",
+						Description: "Replace the configured rate limits of a command",
+						Handler:     command.executeRateLimitSet,
+						Options: []*discordgo.ApplicationCommandOption{
+							rateLimitCommandOption(),
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "member",
+								Description: "How often each member can use the command, like 5/1m",
+								Required:    false,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "server",
+								Description: "How often every member together can use the command, like 30/1m",
+								Required:    false,
+							},
+						},
+					},
+					{
+						Name:        "reset",
+						Description: "Use the configured rate limits of a command again",
+						Handler:     command.executeRateLimitReset,
+						Options:     []*discordgo.ApplicationCommandOption{rateLimitCommandOption()},
+					},
+					{
+						Name:        "show",
+						Description: "Show the rate limits set for this guild",
+						Handler:     command.executeRateLimitShow,
+					},
+				},
+			},
+		},
+		Subcommands: []*Subcommand{
+			{
+				Name:        "export",
+				Description: "Download the personal roles, history, favorites and settings of this guild",
+				Handler:     command.executeExport,
+			},
+		},
+	}
+
+	return command
+}
+
+// RequiresBackend reports that the command needs the backend to work
+func (c *CuratorCommand) RequiresBackend() bool {
+	return true
+}
+
+// Execute handles the command execution
+func (c *CuratorCommand) Execute(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+	return c.Dispatch(s, i, logger)
+}
+
+func (c *CuratorCommand) executeExport(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, _ Options) error {
+	export, err := backend.ExportGuilds(context.Background(), c.backend, i.GuildID)
+	if err != nil {
+		logger.Error("failed to export guild",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		return respondWithEphemeralMessage(s, i, "Could not export this guild")
+	}
+
+	encoded, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode guild export")
+	}
+
+	return respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("Exported %d personal roles, import the file with `curator import`", len(export.Guilds[0].Roles)),
+			Flags:   discordgo.MessageFlagsEphemeral,
+			Files: []*discordgo.File{
+				{
+					Name:        fmt.Sprintf("curator-%s.json", i.GuildID),
+					ContentType: "application/json",
+					Reader:      bytes.NewReader(encoded),
+				},
+			},
+		},
+	})
+}
+
+func (c *CuratorCommand) executeApprovalEnable(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, options Options) error {
+	channel, _ := options.ID("channel")
+	return c.executeApprovalToggle(s, i, logger, true, channel)
+}
+
+func (c *CuratorCommand) executeApprovalDisable(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, _ Options) error {
+	return c.executeApprovalToggle(s, i, logger, false, "")
+}
+
+// executeApprovalToggle enables or disables approval, keeping the approval channel when none is given
+func (c *CuratorCommand) executeApprovalToggle(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, enabled bool, channel string) error {
+	ctx := context.Background()
+
+	settings, err := c.backend.GetGuildSettings(ctx, i.GuildID)
+	if err != nil {
+		logger.Error("failed to get guild settings",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		return respondWithEphemeralMessage(s, i, "Could not load guild settings")
+	}
+
+	settings.ApprovalRequired = enabled
+
+	if channel != "" {
+		settings.ApprovalChannel = channel
+	}
+
+	if err = c.backend.SetGuildSettings(ctx, i.GuildID, settings); err != nil {
+		logger.Error("failed to store guild settings",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		return respondWithEphemeralMessage(s, i, "Could not store guild settings")
+	}
+
+	if !enabled {
+		return respondWithEphemeralMessage(s, i, "Role changes are applied immediately again, pending requests can still be reviewed")
+	}
+
+	return respondWithEphemeralMessage(s, i, fmt.Sprintf("Role changes by members are now sent to <#%s> for approval", settings.ApprovalChannel))
+}
+
+func (c *CuratorCommand) executeThemeApply(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, options Options) error {
+	ctx := context.Background()
+	now := time.Now()
+
+	guildTheme := backend.GuildTheme{
+		Guild:   i.GuildID,
+		StartAt: now,
+	}
+
+	guildTheme.Theme, _ = options.String("theme")
+
+	theme, err := common.ThemeFromString(guildTheme.Theme)
+	if err != nil {
+		return respondWithEphemeralMessage(s, i, err.Error())
+	}
+
+	if start, ok := options.String("start"); ok {
+		if guildTheme.StartAt, err = parseThemeTime(start, now); err != nil {
+			return respondWithEphemeralMessage(s, i, "Could not read start: "+err.Error())
+		}
+	}
+
+	if end, ok := options.String("end"); ok {
+		if guildTheme.EndAt, err = parseThemeTime(end, now); err != nil {
+			return respondWithEphemeralMessage(s, i, "Could not read end: "+err.Error())
+		}
+
+		if !guildTheme.EndAt.After(guildTheme.StartAt) {
+			return respondWithEphemeralMessage(s, i, "The end of a theme must be after its start")
+		}
+	}
+
+	existing, err := c.backend.GetGuildTheme(ctx, i.GuildID)
+	if err != nil {
+		logger.Error("failed to get guild theme",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		return respondWithEphemeralMessage(s, i, "Could not load the current theme")
+	}
+
+	if existing != nil && existing.Applied {
+		return respondWithEphemeralMessage(s, i, "A theme is already applied, use `/curator theme revert` first")
+	}
+
+	// Scheduled themes are picked up by the scheduler once their start time passes
+	if guildTheme.StartAt.After(now) {
+		if err = c.backend.SetGuildTheme(ctx, guildTheme); err != nil {
+			logger.Error("failed to schedule guild theme",
+				slog.Any("error", err),
+				slog.String("guild", i.GuildID))
+
+			return respondWithEphemeralMessage(s, i, "Could not schedule theme")
+		}
+
+		return respondWithEphemeralMessage(s, i, fmt.Sprintf("The %s theme will be applied <t:%d:R>%s",
+			theme.DisplayName, guildTheme.StartAt.Unix(), describeThemeEnd(guildTheme)))
+	}
+
+	// Recoloring every role can take a while, so acknowledge the interaction first
+	if err = deferNow(s, i, true); err != nil {
+		logger.Error("Failed to send deferred response", slog.Any("error", err))
+		return err
+	}
+
+	content := ""
+
+	progress := jobs.InteractionProgress(s, i.Interaction, logger, "Applying the "+theme.DisplayName+" theme")
+
+	if edited, err := themes.Apply(ctx, s, c.jobs, c.backend, logger, guildTheme, progress); err != nil {
+		logger.Error("failed to apply guild theme",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		content = "Could not apply theme: " + err.Error()
+	} else {
+		content = fmt.Sprintf("Applied the %s theme to %d roles%s", theme.DisplayName, edited, describeThemeEnd(guildTheme))
+	}
+
+	// The summary replaces the progress shown in the deferred response
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+	})
+
+	return err
+}
+
+func (c *CuratorCommand) executeThemeRevert(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, _ Options) error {
+	ctx := context.Background()
+
+	guildTheme, err := c.backend.GetGuildTheme(ctx, i.GuildID)
+	if err != nil {
+		logger.Error("failed to get guild theme",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		return respondWithEphemeralMessage(s, i, "Could not load the current theme")
+	}
+
+	if guildTheme == nil {
+		return respondWithEphemeralMessage(s, i, "There is no theme to revert")
+	}
+
+	if !guildTheme.Applied {
+		if err = c.backend.DeleteGuildTheme(ctx, i.GuildID); err != nil {
+			logger.Error("failed to cancel guild theme",
+				slog.Any("error", err),
+				slog.String("guild", i.GuildID))
+
+			return respondWithEphemeralMessage(s, i, "Could not cancel the scheduled theme")
+		}
+
+		return respondWithEphemeralMessage(s, i, "The scheduled theme has been cancelled")
+	}
+
+	if err = deferNow(s, i, true); err != nil {
+		logger.Error("Failed to send deferred response", slog.Any("error", err))
+		return err
+	}
+
+	content := ""
+
+	progress := jobs.InteractionProgress(s, i.Interaction, logger, "Restoring the original colors")
+
+	if edited, err := themes.Revert(ctx, s, c.jobs, c.backend, logger, *guildTheme, progress); err != nil {
+		logger.Error("failed to revert guild theme",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		content = "Could not revert theme: " + err.Error()
+	} else {
+		content = fmt.Sprintf("Restored the original colors of %d roles", edited)
+	}
+
+	// The summary replaces the progress shown in the deferred response
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Content: &content,
+	})
+
+	return err
+}
+
+func (c *CuratorCommand) executeThemeStatus(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, _ Options) error {
+	guildTheme, err := c.backend.GetGuildTheme(context.Background(), i.GuildID)
+	if err != nil {
+		logger.Error("failed to get guild theme",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		return respondWithEphemeralMessage(s, i, "Could not load the current theme")
+	}
+
+	if guildTheme == nil {
+		return respondWithEphemeralMessage(s, i, "No theme is applied or scheduled")
+	}
+
+	theme, err := common.ThemeFromString(guildTheme.Theme)
+	if err != nil {
+		return respondWithEphemeralMessage(s, i, err.Error())
+	}
+
+	if !guildTheme.Applied {
+		return respondWithEphemeralMessage(s, i, fmt.Sprintf("The %s theme will be applied <t:%d:R>%s",
+			theme.DisplayName, guildTheme.StartAt.Unix(), describeThemeEnd(*guildTheme)))
+	}
+
+	return respondWithEphemeralMessage(s, i, fmt.Sprintf("The %s theme was applied to %d roles <t:%d:R>%s",
+		theme.DisplayName, len(guildTheme.Originals), guildTheme.StartAt.Unix(), describeThemeEnd(*guildTheme)))
+}
+
+// rateLimitedCommands are the commands whose rate limits guilds can set
+var rateLimitedCommands = []string{"role", "group", "color", "palette", "favorites"}
+
+func rateLimitCommandOption() *discordgo.ApplicationCommandOption {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(rateLimitedCommands))
+	for _, name := range rateLimitedCommands {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+	}
+
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "command",
+		Description: "The command to limit",
+		Required:    true,
+		Choices:     choices,
+	}
+}
+
+func (c *CuratorCommand) executeRateLimitSet(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, options Options) error {
+	command, _ := options.String("command")
+
+	var limits backend.CommandRateLimits
+
+	for _, option := range []struct {
+		name  string
+		limit **backend.RateLimit
+	}{
+		{"member", &limits.User},
+		{"server", &limits.Guild},
+	} {
+		input, ok := options.String(option.name)
+		if !ok {
+			continue
+		}
+
+		limit, err := backend.ParseRateLimit(input)
+		if err != nil {
+			return respondWithEphemeralMessage(s, i, fmt.Sprintf("Could not read %s: a rate limit is uses per duration, like 5/1m", option.name))
+		}
+
+		*option.limit = &limit
+	}
+
+	if limits.User == nil && limits.Guild == nil {
+		return respondWithEphemeralMessage(s, i, "Give a member or server rate limit to set")
+	}
+
+	err := c.updateRateLimits(i.GuildID, func(rateLimits map[string]backend.CommandRateLimits) {
+		rateLimits[command] = limits
+	})
+	if err != nil {
+		logger.Error("failed to store rate limits",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		return respondWithEphemeralMessage(s, i, "Could not store rate limits")
+	}
+
+	return respondWithEphemeralMessage(s, i, fmt.Sprintf("`/%s` is now limited to %s", command, describeRateLimits(limits)))
+}
+
+func (c *CuratorCommand) executeRateLimitReset(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, options Options) error {
+	command, _ := options.String("command")
+
+	err := c.updateRateLimits(i.GuildID, func(rateLimits map[string]backend.CommandRateLimits) {
+		delete(rateLimits, command)
+	})
+	if err != nil {
+		logger.Error("failed to store rate limits",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		return respondWithEphemeralMessage(s, i, "Could not store rate limits")
+	}
+
+	return respondWithEphemeralMessage(s, i, fmt.Sprintf("`/%s` uses the configured rate limits again", command))
+}
+
+func (c *CuratorCommand) executeRateLimitShow(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, _ Options) error {
+	settings, err := c.backend.GetGuildSettings(context.Background(), i.GuildID)
+	if err != nil {
+		logger.Error("failed to get guild settings",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		return respondWithEphemeralMessage(s, i, "Could not load guild settings")
+	}
+
+	if len(settings.RateLimits) == 0 {
+		return respondWithEphemeralMessage(s, i, "Every command uses the configured rate limits")
+	}
+
+	var lines strings.Builder
+	lines.WriteString("Rate limits set for this guild, other commands use the configured ones:")
+
+	for _, command := range slices.Sorted(maps.Keys(settings.RateLimits)) {
+		fmt.Fprintf(&lines, "\n`/%s` %s", command, describeRateLimits(settings.RateLimits[command]))
+	}
+
+	return respondWithEphemeralMessage(s, i, lines.String())
+}
+
+// updateRateLimits changes a copy of the rate limits of the guild, so the cached settings are not changed in place
+func (c *CuratorCommand) updateRateLimits(guild string, update func(rateLimits map[string]backend.CommandRateLimits)) error {
+	ctx := context.Background()
+
+	settings, err := c.backend.GetGuildSettings(ctx, guild)
+	if err != nil {
+		return err
+	}
+
+	rateLimits := maps.Clone(settings.RateLimits)
+	if rateLimits == nil {
+		rateLimits = make(map[string]backend.CommandRateLimits)
+	}
+
+	update(rateLimits)
+	settings.RateLimits = rateLimits
+
+	return c.backend.SetGuildSettings(ctx, guild, settings)
+}
+
+func describeRateLimits(limits backend.CommandRateLimits) string {
+	var parts []string
+
+	if limits.User != nil {
+		parts = append(parts, fmt.Sprintf("%d uses per %s for each member", limits.User.Uses, limits.User.Per))
+	}
+
+	if limits.Guild != nil {
+		parts = append(parts, fmt.Sprintf("%d uses per %s for the whole server", limits.Guild.Uses, limits.Guild.Per))
+	}
+
+	return strings.Join(parts, " and ")
+}
+
+func describeThemeEnd(guildTheme backend.GuildTheme) string {
+	if guildTheme.EndAt.IsZero() {
+		return ""
+	}
+
+	return fmt.Sprintf(" and reverted <t:%d:R>", guildTheme.EndAt.Unix())
+}
+
+// parseThemeTime reads either a duration from now, with an additional "d" unit for days, or a UTC date and time
+func parseThemeTime(input string, now time.Time) (time.Time, error) {
+	input = strings.TrimSpace(input)
+
+	if days, found := strings.CutSuffix(input, "d"); found {
+		if count, err := strconv.Atoi(days); err == nil && count >= 0 {
+			return now.Add(time.Duration(count) * 24 * time.Hour), nil
+		}
+	}
+
+	if duration, err := time.ParseDuration(input); err == nil && duration >= 0 {
+		return now.Add(duration), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		if parsed, err := time.ParseInLocation(layout, input, time.UTC); err == nil {
+			return parsed, nil
+		}
+	}
+
+	return time.Time{}, unrecognizedTime
+}
@@ -0,0 +1,314 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"emperror.dev/errors"
+	"fmt"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/Sxtanna/chromatic_curator/internal/system/imaging"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// favoriteColorNamespace is the custom ID namespace of the "Add to Favorites" button
+// Format: favorite_color:<color int>
+const favoriteColorNamespace = "favorite_color"
+
+// maxAutocompleteChoices is the most choices Discord accepts in an autocomplete response
+const maxAutocompleteChoices = 25
+
+// FavoritesCommand represents a command to manage saved favorite colors
+type FavoritesCommand struct {
+	BaseCommand
+
+	backend backend.Backend
+}
+
+// NewFavoritesCommand creates a new favorites management command
+func NewFavoritesCommand(favoritesBackend backend.Backend) *FavoritesCommand {
+	command := &FavoritesCommand{
+		backend: favoritesBackend,
+	}
+
+	command.BaseCommand = BaseCommand{
+		Name:         "favorites",
+		Description:  "Manage your favorite colors",
+		DMPermission: new(bool),
+		Middlewares:  []Middleware{GuildOnly(), AutoDefer(DefaultDeferThreshold, true)},
+		Subcommands: []*Subcommand{
+			{
+				Name:        "add",
+				Description: "Save a color to your favorites",
+				Handler:     command.executeAdd,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "color",
+						Description: "The name or hex code of the color to save",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "label",
+						Description: "An optional label for the color",
+						Required:    false,
+						MaxLength:   32,
+					},
+				},
+			},
+			{
+				Name:        "remove",
+				Description: "Remove a color from your favorites",
+				Handler:     command.executeRemove,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "color",
+						Description:  "The favorite color to remove",
+						Required:     true,
+						Autocomplete: true,
+					},
+				},
+			},
+			{
+				Name:        "list",
+				Description: "Show your favorite colors",
+				Handler:     command.executeList,
+			},
+		},
+	}
+
+	return command
+}
+
+// RequiresBackend reports that the command needs the backend to work
+func (c *FavoritesCommand) RequiresBackend() bool {
+	return true
+}
+
+// ComponentHandlers returns the handler of the "Add to Favorites" button
+func (c *FavoritesCommand) ComponentHandlers() map[string]ComponentHandler {
+	return map[string]ComponentHandler{favoriteColorNamespace: c.handleFavoriteButton}
+}
+
+// ModalHandlers returns no handlers, the command has no modals
+func (c *FavoritesCommand) ModalHandlers() map[string]ComponentHandler {
+	return nil
+}
+
+// Execute handles the command execution
+func (c *FavoritesCommand) Execute(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+	return c.Dispatch(s, i, logger)
+}
+
+// Autocomplete offers the caller's favorites as choices for the color being removed
+func (c *FavoritesCommand) Autocomplete(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+	focused := GetFocusedOption(i.Interaction)
+	user := getInteractionUser(i)
+
+	if focused == nil || user == nil || i.GuildID == "" {
+		return respondWithAutocompleteChoices(s, i, nil)
+	}
+
+	return respondWithAutocompleteChoices(s, i, favoriteColorChoices(c.backend, i.GuildID, user.ID, focused.StringValue(), logger))
+}
+
+// handleFavoriteButton saves the color attached to an "Add to Favorites" button for the user who clicked it
+func (c *FavoritesCommand) handleFavoriteButton(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, args ComponentArgs) error {
+	if i.GuildID == "" {
+		return Reply("Favorites can only be saved in a guild")
+	}
+
+	user := getInteractionUser(i)
+	if user == nil {
+		return Reply("Could not resolve user")
+	}
+
+	color, err := args.Int(0)
+	if err != nil {
+		return err
+	}
+
+	return c.saveFavorite(s, i, logger, user, backend.Favorite{Color: color, Time: time.Now()})
+}
+
+func (c *FavoritesCommand) executeAdd(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, options Options) error {
+	user := getInteractionUser(i)
+
+	colorText, ok := options.String("color")
+	if !ok {
+		return respondWithEphemeralMessage(s, i, "Color name or hex code is required")
+	}
+
+	color, err := parseRoleColor(colorText)
+	if err != nil {
+		return respondWithEphemeralMessage(s, i, "Invalid color: "+err.Error())
+	}
+
+	favorite := backend.Favorite{Color: color, Time: time.Now()}
+
+	if label, ok := options.String("label"); ok {
+		favorite.Label = strings.TrimSpace(label)
+	}
+
+	return c.saveFavorite(s, i, logger, user, favorite)
+}
+
+func (c *FavoritesCommand) saveFavorite(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, user *discordgo.User, favorite backend.Favorite) error {
+	err := c.backend.AddFavorite(context.Background(), i.GuildID, user.ID, favorite)
+
+	switch {
+	case errors.Is(err, backend.FavoriteLimitReached):
+		return respondWithEphemeralMessage(s, i, fmt.Sprintf("You can only save %d favorites, remove one with `/favorites remove` first", backend.MaxFavorites))
+	case err != nil:
+		logger.Error("failed to save favorite",
+			slog.Any("error", err),
+			slog.String("user", user.ID),
+			slog.Int("color", favorite.Color))
+
+		return respondWithEphemeralMessage(s, i, "Could not save favorite")
+	}
+
+	return respondWithEphemeralMessage(s, i, "Saved "+favoriteDisplayName(favorite)+" (`"+common.FormatColorHex(favorite.Color)+"`) to your favorites")
+}
+
+func (c *FavoritesCommand) executeRemove(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, options Options) error {
+	user := getInteractionUser(i)
+
+	colorText, ok := options.String("color")
+	if !ok {
+		return respondWithEphemeralMessage(s, i, "Color name or hex code is required")
+	}
+
+	color, err := parseRoleColor(colorText)
+	if err != nil {
+		return respondWithEphemeralMessage(s, i, "Invalid color: "+err.Error())
+	}
+
+	removed, err := c.backend.RemoveFavorite(context.Background(), i.GuildID, user.ID, color)
+	if err != nil {
+		logger.Error("failed to remove favorite",
+			slog.Any("error", err),
+			slog.String("user", user.ID),
+			slog.Int("color", color))
+
+		return respondWithEphemeralMessage(s, i, "Could not remove favorite")
+	}
+
+	if !removed {
+		return respondWithEphemeralMessage(s, i, "`"+common.FormatColorHex(color)+"` is not one of your favorites")
+	}
+
+	return respondWithEphemeralMessage(s, i, "Removed `"+common.FormatColorHex(color)+"` from your favorites")
+}
+
+func (c *FavoritesCommand) executeList(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, _ Options) error {
+	user := getInteractionUser(i)
+
+	favorites, err := c.backend.GetFavorites(context.Background(), i.GuildID, user.ID)
+	if err != nil {
+		logger.Error("failed to get favorites",
+			slog.Any("error", err),
+			slog.String("user", user.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not load favorites")
+	}
+
+	if len(favorites) == 0 {
+		return respondWithEphemeralMessage(s, i, "You have no favorite colors yet, save some with `/favorites add` or from `/color`")
+	}
+
+	colors := make([]int, len(favorites))
+	for index, favorite := range favorites {
+		colors[index] = favorite.Color
+	}
+
+	imageData, err := imaging.GenerateSwatchGrid(colors, imaging.MAX_SQUARES_PER_ROW)
+	if err != nil {
+		logger.Error("Failed to generate favorites image", slog.Any("error", err))
+		return respondWithEphemeralMessage(s, i, "Failed to generate favorites image")
+	}
+
+	return respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags:  discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{generateFavoritesEmbed(favorites)},
+			Files: []*discordgo.File{
+				{
+					Name:   "favorites.png",
+					Reader: bytes.NewReader(imageData),
+				},
+			},
+		},
+	})
+}
+
+func generateFavoritesEmbed(favorites []backend.Favorite) *discordgo.MessageEmbed {
+	lines := make([]string, len(favorites))
+
+	for index, favorite := range favorites {
+		lines[index] = fmt.Sprintf("`%-2d` **%s** `%s`",
+			index+1, favoriteDisplayName(favorite), common.FormatColorHex(favorite.Color))
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:  "Favorite Colors",
+		Color:  favorites[len(favorites)-1].Color,
+		Fields: splitEmbedFields(fmt.Sprintf("Favorites (%d/%d)", len(favorites), backend.MaxFavorites), lines),
+		Image: &discordgo.MessageEmbedImage{
+			URL: "attachment://favorites.png",
+		},
+	}
+}
+
+// favoriteDisplayName returns the label of a favorite, or the closest named color if it has none
+func favoriteDisplayName(favorite backend.Favorite) string {
+	if favorite.Label != "" {
+		return favorite.Label
+	}
+
+	r, g, b := common.IntToRGB(favorite.Color)
+
+	return common.FindExactOrClosestNamedColor(r, g, b).Name
+}
+
+// favoriteColorChoices returns the user's favorites matching the partially typed input as autocomplete choices
+func favoriteColorChoices(favoritesBackend backend.FavoriteBackend, guild string, user string, input string, logger *slog.Logger) []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+
+	favorites, err := favoritesBackend.GetFavorites(context.Background(), guild, user)
+	if err != nil {
+		logger.Error("failed to get favorites for autocomplete",
+			slog.Any("error", err),
+			slog.String("user", user))
+
+		return choices
+	}
+
+	input = strings.ToLower(strings.TrimSpace(input))
+
+	for _, favorite := range favorites {
+		name := favoriteDisplayName(favorite)
+		hex := common.FormatColorHex(favorite.Color)
+
+		if input != "" && !strings.Contains(strings.ToLower(name), input) && !strings.Contains(strings.ToLower(hex), input) {
+			continue
+		}
+
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  "★ " + name + " (" + hex + ")",
+			Value: hex,
+		})
+
+		if len(choices) == maxAutocompleteChoices {
+			break
+		}
+	}
+
+	return choices
+}
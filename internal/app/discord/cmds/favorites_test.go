@@ -0,0 +1,97 @@
+package cmds
+
+import (
+	"context"
+	appbackend "github.com/Sxtanna/chromatic_curator/internal/app/backend"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds/cmdstest"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// favoritesInteraction returns an invocation of a favorites subcommand by a member of the test guild
+func favoritesInteraction(subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	interaction := newTestInteraction("guild", "member")
+	interaction.Data = discordgo.ApplicationCommandInteractionData{
+		Name: "favorites",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{
+			{Type: discordgo.ApplicationCommandOptionSubCommand, Name: subcommand, Options: options},
+		},
+	}
+
+	return interaction
+}
+
+func TestFavoritesCommandAdd(t *testing.T) {
+	tests := []struct {
+		name   string
+		color  string
+		reply  string
+		stored int
+	}{
+		{
+			name:   "saves a color",
+			color:  "#336699",
+			reply:  "to your favorites",
+			stored: 1,
+		},
+		{
+			name:  "refuses a color beyond the range of colors",
+			color: "99999999",
+			reply: "Invalid color",
+		},
+		{
+			name:  "refuses a negative color",
+			color: "-1",
+			reply: "Invalid color",
+		},
+		{
+			name:  "refuses an unknown color",
+			color: "not a color",
+			reply: "Invalid color",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := cmdstest.NewSession()
+			store := appbackend.NewMemoryBackend()
+
+			if err := NewFavoritesCommand(store).Execute(session, favoritesInteraction("add", stringOption("color", test.color)), slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if replies := session.Replies(); len(replies) != 1 || !strings.Contains(replies[0], test.reply) {
+				t.Errorf("expected a reply containing %q, got %v", test.reply, replies)
+			}
+
+			if favorites, _ := store.GetFavorites(context.Background(), "guild", "member"); len(favorites) != test.stored {
+				t.Errorf("expected %d favorites stored, got %v", test.stored, favorites)
+			}
+		})
+	}
+}
+
+func TestGenerateFavoritesEmbedFitsFields(t *testing.T) {
+	favorites := make([]backend.Favorite, backend.MaxFavorites)
+	for index := range favorites {
+		favorites[index] = backend.Favorite{Color: index, Label: strings.Repeat("é", 32)}
+	}
+
+	embed := generateFavoritesEmbed(favorites)
+
+	entries := 0
+	for _, field := range embed.Fields {
+		if length := len([]rune(field.Value)); length > maxEmbedFieldLength {
+			t.Errorf("expected fields within %d characters, got %d", maxEmbedFieldLength, length)
+		}
+
+		entries += strings.Count(field.Value, "\n")
+	}
+
+	if entries != len(favorites) {
+		t.Errorf("expected every favorite listed, got %d of %d", entries, len(favorites))
+	}
+}
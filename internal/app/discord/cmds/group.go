@@ -0,0 +1,829 @@
+package cmds
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"fmt"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// groupNamespace is the custom ID namespace of the group role buttons, invites are signed so they cannot be
+// forged to join a group uninvited
+// Format: group:<action>:<role>[:<user>]
+const groupNamespace = "group"
+
+const (
+	groupActionAccept  = "accept"
+	groupActionDecline = "decline"
+	groupActionLeave   = "leave"
+)
+
+// defaultGroupMembers is the member cap of a group role created without one
+const defaultGroupMembers = 10
+
+// groupInviteExpiry is how long the buttons of a group role invite can be used
+const groupInviteExpiry = 24 * time.Hour
+
+// GroupCommand represents a command to manage roles shared by several members
+type GroupCommand struct {
+	BaseCommand
+
+	backend         backend.Backend
+	signer          *ComponentSigner
+	isAdminFunction func(id string) bool
+}
+
+// NewGroupCommand creates a new group role management command
+func NewGroupCommand(groupBackend backend.Backend, signer *ComponentSigner, isAdminFunction func(id string) bool) *GroupCommand {
+	groupOption := func(description string) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionRole,
+			Name:        "group",
+			Description: description,
+			Required:    true,
+		}
+	}
+
+	memberCapOption := &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionInteger,
+		Name:        "max_members",
+		Description: fmt.Sprintf("The most members the group can have (2-%d)", backend.MaxGroupMembers),
+		Required:    false,
+		MinValue:    &[]float64{2}[0],
+		MaxValue:    backend.MaxGroupMembers,
+	}
+
+	command := &GroupCommand{
+		backend:         groupBackend,
+		signer:          signer,
+		isAdminFunction: isAdminFunction,
+	}
+
+	command.BaseCommand = BaseCommand{
+		Name:        "group",
+		Description: "manage roles shared with other members",
+		Middlewares: []Middleware{GuildOnly(), AutoDefer(DefaultDeferThreshold, true)},
+		Subcommands: []*Subcommand{
+			{
+				Name:        "create",
+				Description: "Create a new role to share with other members",
+				Handler:     command.withCaller(command.executeCreate),
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "The name of the group role",
+						Required:    true,
+						MaxLength:   maxRoleNameLength,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "color",
+						Description: "The color of the group role",
+						Required:    false,
+					},
+					memberCapOption,
+				},
+			},
+			{
+				Name:        "invite",
+				Description: "Invite a member to your group role",
+				Handler:     command.withGroup(command.executeInvite),
+				Options: []*discordgo.ApplicationCommandOption{
+					groupOption("The group role to invite to"),
+					{
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Name:        "user",
+						Description: "The member to invite",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Name:        "edit",
+				Description: "Change the name or color of a group role",
+				Handler:     command.withGroup(command.executeEdit),
+				Options: []*discordgo.ApplicationCommandOption{
+					groupOption("The group role to edit"),
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "The new name of the group role",
+						Required:    false,
+						MaxLength:   maxRoleNameLength,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "color",
+						Description: "The new color of the group role",
+						Required:    false,
+					},
+				},
+			},
+			{
+				Name:        "settings",
+				Description: "Change who can edit a group role and how many members it can have",
+				Handler:     command.withGroup(command.executeSettings),
+				Options: []*discordgo.ApplicationCommandOption{
+					groupOption("The group role to change"),
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "co_edit",
+						Description: "Allow every member to change the name and color",
+						Required:    false,
+					},
+					memberCapOption,
+				},
+			},
+			{
+				Name:        "kick",
+				Description: "Remove a member from your group role",
+				Handler:     command.withGroup(command.executeKick),
+				Options: []*discordgo.ApplicationCommandOption{
+					groupOption("The group role to remove the member from"),
+					{
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Name:        "user",
+						Description: "The member to remove",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Name:        "leave",
+				Description: "Leave a group role",
+				Handler:     command.withGroup(command.executeLeave),
+				Options: []*discordgo.ApplicationCommandOption{
+					groupOption("The group role to leave"),
+				},
+			},
+			{
+				Name:        "info",
+				Description: "Show the members and settings of a group role",
+				Handler:     command.withGroup(command.executeInfo),
+				Options: []*discordgo.ApplicationCommandOption{
+					groupOption("The group role to show"),
+				},
+			},
+			{
+				Name:        "disband",
+				Description: "Delete your group role for every member",
+				Handler:     command.withGroup(command.executeDisband),
+				Options: []*discordgo.ApplicationCommandOption{
+					groupOption("The group role to delete"),
+				},
+			},
+		},
+	}
+
+	return command
+}
+
+// GroupUpdateContext carries the state shared by every group role subcommand and button
+type GroupUpdateContext struct {
+	ctx context.Context
+	log *slog.Logger
+
+	bot    Session
+	data   *discordgo.InteractionCreate
+	caller *discordgo.User
+}
+
+// RequiresBackend reports that the command needs the backend to work
+func (c *GroupCommand) RequiresBackend() bool {
+	return true
+}
+
+// ComponentHandlers returns the handler of the accept, decline and leave buttons
+func (c *GroupCommand) ComponentHandlers() map[string]ComponentHandler {
+	return map[string]ComponentHandler{groupNamespace: c.handleGroupButton}
+}
+
+// ModalHandlers returns no handlers, the command has no modals
+func (c *GroupCommand) ModalHandlers() map[string]ComponentHandler {
+	return nil
+}
+
+// Execute handles the command execution
+func (c *GroupCommand) Execute(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+	return c.Dispatch(s, i, logger)
+}
+
+// withCaller runs a subcommand with the context of the member who invoked it
+func (c *GroupCommand) withCaller(handler func(ctx *GroupUpdateContext, options Options) error) SubcommandHandler {
+	return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, options Options) error {
+		ctx := &GroupUpdateContext{
+			ctx:    context.Background(),
+			log:    logger,
+			bot:    s,
+			data:   i,
+			caller: getInteractionUser(i),
+		}
+
+		if ctx.caller == nil {
+			return respondWithEphemeralMessage(s, i, "Could not resolve user")
+		}
+
+		return handler(ctx, options)
+	}
+}
+
+// withGroup runs a subcommand on the group role given in its group option, refusing roles that are not group roles
+func (c *GroupCommand) withGroup(handler func(ctx *GroupUpdateContext, group *backend.GroupRole, options Options) error) SubcommandHandler {
+	return c.withCaller(func(ctx *GroupUpdateContext, options Options) error {
+		s, i, logger := ctx.bot, ctx.data, ctx.log
+
+		role, _ := options.ID("group")
+
+		group, err := c.backend.GetGroup(ctx.ctx, i.GuildID, role)
+		if err != nil {
+			logger.Error("failed to get group role",
+				slog.Any("error", err),
+				slog.String("role", role))
+
+			return respondWithEphemeralMessage(s, i, "Could not load group role")
+		}
+
+		if group == nil {
+			return respondWithEphemeralMessage(s, i, "That role is not a group role")
+		}
+
+		return handler(ctx, group, options)
+	})
+}
+
+// handleGroupButton handles the accept, decline and leave buttons of group roles
+func (c *GroupCommand) handleGroupButton(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, args ComponentArgs) error {
+	action, err := args.String(0)
+	if err != nil {
+		return err
+	}
+
+	role, err := args.String(1)
+	if err != nil || i.GuildID == "" {
+		return ComponentInvalid
+	}
+
+	ctx := &GroupUpdateContext{
+		ctx:    context.Background(),
+		log:    logger,
+		bot:    s,
+		data:   i,
+		caller: getInteractionUser(i),
+	}
+
+	// Invites can only be answered by the member they were sent to
+	if action == groupActionAccept || action == groupActionDecline {
+		invitee, err := args.String(2)
+		if err != nil || !args.Signed() {
+			return Reply("This invite is no longer valid, ask for a new one")
+		}
+
+		if ctx.caller == nil || ctx.caller.ID != invitee {
+			return Reply("This invite is not for you")
+		}
+	}
+
+	group, err := c.backend.GetGroup(ctx.ctx, i.GuildID, role)
+	if err != nil {
+		logger.Error("failed to get group role",
+			slog.Any("error", err),
+			slog.String("role", role))
+
+		return respondWithEphemeralMessage(s, i, "Could not load group role")
+	}
+
+	if group == nil {
+		return respondWithUpdatedMessage(s, i, "This group role no longer exists")
+	}
+
+	switch action {
+	case groupActionAccept:
+		return c.acceptInvite(ctx, group)
+	case groupActionDecline:
+		return respondWithUpdatedMessage(s, i, fmt.Sprintf("<@%s> declined the invite to <@&%s>", ctx.caller.ID, group.Role))
+	case groupActionLeave:
+		return c.leaveGroup(ctx, group, ctx.caller.ID)
+	}
+
+	return ComponentInvalid
+}
+
+func (c *GroupCommand) executeCreate(ctx *GroupUpdateContext, options Options) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	if handled, err := c.refuseWhenModerated(ctx, "created"); handled {
+		return err
+	}
+
+	if !c.isAdminFunction(ctx.caller.ID) {
+		groups, err := c.backend.ListGroups(ctx.ctx, i.GuildID)
+		if err != nil {
+			logger.Error("failed to list group roles",
+				slog.Any("error", err),
+				slog.String("guild", i.GuildID))
+
+			return respondWithEphemeralMessage(s, i, "Could not load group roles")
+		}
+
+		owned := 0
+		for _, group := range groups {
+			if group.Owner == ctx.caller.ID {
+				owned++
+			}
+		}
+
+		if owned >= backend.MaxOwnedGroups {
+			return respondWithEphemeralMessage(s, i, fmt.Sprintf("You can only own %d group roles, disband one with `/group disband` first", backend.MaxOwnedGroups))
+		}
+	}
+
+	params := &discordgo.RoleParams{}
+
+	if value, ok := options.String("name"); ok {
+		name, err := validateRoleName(value)
+		if err != nil {
+			return respondWithEphemeralMessage(s, i, "Invalid role name: "+err.Error())
+		}
+
+		params.Name = name
+	}
+
+	if value, ok := options.String("color"); ok {
+		color, err := parseRoleColor(value)
+		if err != nil {
+			return respondWithEphemeralMessage(s, i, "Invalid role color: "+err.Error())
+		}
+
+		params.Color = &color
+	}
+
+	group := backend.GroupRole{
+		Guild:      i.GuildID,
+		Owner:      ctx.caller.ID,
+		MaxMembers: defaultGroupMembers,
+	}
+
+	if maxMembers, ok := options.Int("max_members"); ok {
+		group.MaxMembers = int(maxMembers)
+	}
+
+	role, err := s.GuildRoleCreate(i.GuildID, params)
+	if err != nil {
+		logger.Error("failed to create group role",
+			slog.Any("error", err),
+			slog.String("owner", ctx.caller.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not create group role")
+	}
+
+	group.Role = role.ID
+
+	if err = c.backend.SetGroup(ctx.ctx, group); err == nil {
+		err = c.backend.AddGroupMember(ctx.ctx, i.GuildID, role.ID, ctx.caller.ID, group.MaxMembers)
+	}
+
+	if err != nil {
+		logger.Error("failed to store group role",
+			slog.Any("error", err),
+			slog.String("role", role.ID))
+
+		if err = s.GuildRoleDelete(i.GuildID, role.ID); err != nil {
+			logger.Error("failed to delete unstored group role",
+				slog.Any("error", err),
+				slog.String("role", role.ID))
+		}
+
+		return respondWithEphemeralMessage(s, i, "Could not store group role")
+	}
+
+	if err = s.GuildMemberRoleAdd(i.GuildID, ctx.caller.ID, role.ID); err != nil {
+		logger.Error("failed to add group role to owner",
+			slog.Any("error", err),
+			slog.String("role", role.ID))
+	}
+
+	logger.Info("created group role",
+		slog.String("owner", ctx.caller.ID),
+		slog.String("role", role.ID))
+
+	return respondWithEphemeralMessage(s, i, fmt.Sprintf("Created <@&%s>, invite members with `/group invite`", role.ID))
+}
+
+func (c *GroupCommand) executeInvite(ctx *GroupUpdateContext, group *backend.GroupRole, options Options) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	if group.Owner != ctx.caller.ID && !c.isAdminFunction(ctx.caller.ID) {
+		return respondWithEphemeralMessage(s, i, "Only the owner of a group role can invite members")
+	}
+
+	invitee, ok := options.User("user")
+
+	if !ok || invitee.Bot {
+		return respondWithEphemeralMessage(s, i, "Could not find that member")
+	}
+
+	members, err := c.backend.GetGroupMembers(ctx.ctx, i.GuildID, group.Role)
+	if err != nil {
+		logger.Error("failed to get group members",
+			slog.Any("error", err),
+			slog.String("role", group.Role))
+
+		return respondWithEphemeralMessage(s, i, "Could not load group members")
+	}
+
+	if slices.Contains(members, invitee.ID) {
+		return respondWithEphemeralMessage(s, i, "<@"+invitee.ID+"> is already a member")
+	}
+
+	if len(members) >= group.MaxMembers {
+		return respondWithEphemeralMessage(s, i, fmt.Sprintf("This group role is full (%d/%d)", len(members), group.MaxMembers))
+	}
+
+	expiry := time.Now().Add(groupInviteExpiry)
+
+	return respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: fmt.Sprintf("<@%s>, <@%s> invited you to join <@&%s>", invitee.ID, ctx.caller.ID, group.Role),
+			AllowedMentions: &discordgo.MessageAllowedMentions{
+				Users: []string{invitee.ID},
+			},
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.Button{
+							Label:    "Accept",
+							Style:    discordgo.SuccessButton,
+							CustomID: c.signer.Sign(expiry, groupNamespace, groupActionAccept, group.Role, invitee.ID),
+						},
+						discordgo.Button{
+							Label:    "Decline",
+							Style:    discordgo.SecondaryButton,
+							CustomID: c.signer.Sign(expiry, groupNamespace, groupActionDecline, group.Role, invitee.ID),
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+func (c *GroupCommand) acceptInvite(ctx *GroupUpdateContext, group *backend.GroupRole) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	members, err := c.backend.GetGroupMembers(ctx.ctx, i.GuildID, group.Role)
+	if err != nil {
+		logger.Error("failed to get group members",
+			slog.Any("error", err),
+			slog.String("role", group.Role))
+
+		return respondWithEphemeralMessage(s, i, "Could not load group members")
+	}
+
+	if slices.Contains(members, ctx.caller.ID) {
+		return respondWithUpdatedMessage(s, i, fmt.Sprintf("<@%s> is already a member of <@&%s>", ctx.caller.ID, group.Role))
+	}
+
+	// The member is stored first so the cap is checked in the same step, concurrent accepts cannot overfill the group
+	err = c.backend.AddGroupMember(ctx.ctx, i.GuildID, group.Role, ctx.caller.ID, group.MaxMembers)
+	if errors.Is(err, backend.GroupMemberLimitReached) {
+		return respondWithEphemeralMessage(s, i, fmt.Sprintf("This group role is full (%d/%d)", group.MaxMembers, group.MaxMembers))
+	}
+
+	if err != nil {
+		logger.Error("failed to store group member",
+			slog.Any("error", err),
+			slog.String("role", group.Role),
+			slog.String("user", ctx.caller.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not join the group role")
+	}
+
+	if err = s.GuildMemberRoleAdd(i.GuildID, ctx.caller.ID, group.Role); err != nil {
+		logger.Error("failed to add group role to member",
+			slog.Any("error", err),
+			slog.String("role", group.Role),
+			slog.String("user", ctx.caller.ID))
+
+		if err = c.backend.RemoveGroupMember(ctx.ctx, i.GuildID, group.Role, ctx.caller.ID); err != nil {
+			logger.Error("failed to remove group member without the role",
+				slog.Any("error", err),
+				slog.String("role", group.Role),
+				slog.String("user", ctx.caller.ID))
+		}
+
+		return respondWithEphemeralMessage(s, i, "Could not give you the group role")
+	}
+
+	return respondWithUpdatedMessage(s, i, fmt.Sprintf("<@%s> joined <@&%s>", ctx.caller.ID, group.Role))
+}
+
+func (c *GroupCommand) executeEdit(ctx *GroupUpdateContext, group *backend.GroupRole, options Options) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	canEdit := group.Owner == ctx.caller.ID || c.isAdminFunction(ctx.caller.ID)
+
+	if !canEdit && group.CoEdit {
+		members, err := c.backend.GetGroupMembers(ctx.ctx, i.GuildID, group.Role)
+		if err != nil {
+			logger.Error("failed to get group members",
+				slog.Any("error", err),
+				slog.String("role", group.Role))
+
+			return respondWithEphemeralMessage(s, i, "Could not load group members")
+		}
+
+		canEdit = slices.Contains(members, ctx.caller.ID)
+	}
+
+	if !canEdit {
+		return respondWithEphemeralMessage(s, i, "You do not have permission to edit this group role")
+	}
+
+	if handled, err := c.refuseWhenModerated(ctx, "edited"); handled {
+		return err
+	}
+
+	params := &discordgo.RoleParams{}
+
+	if value, ok := options.String("name"); ok {
+		name, err := validateRoleName(value)
+		if err != nil {
+			return respondWithEphemeralMessage(s, i, "Invalid role name: "+err.Error())
+		}
+
+		params.Name = name
+	}
+
+	if value, ok := options.String("color"); ok {
+		color, err := parseRoleColor(value)
+		if err != nil {
+			return respondWithEphemeralMessage(s, i, "Invalid role color: "+err.Error())
+		}
+
+		params.Color = &color
+	}
+
+	if params.Name == "" && params.Color == nil {
+		return respondWithEphemeralMessage(s, i, "Specify a new name or color for the role")
+	}
+
+	if _, err := s.GuildRoleEdit(i.GuildID, group.Role, params); err != nil {
+		logger.Error("failed to edit group role",
+			slog.Any("error", err),
+			slog.String("role", group.Role))
+
+		return respondWithEphemeralMessage(s, i, "Could not edit group role")
+	}
+
+	return respondWithEphemeralMessage(s, i, fmt.Sprintf("Updated <@&%s>", group.Role))
+}
+
+// refuseWhenModerated refuses a change to the name or color of a group role by a member of a guild that holds role
+// changes for staff sign-off, approval requests only cover personal roles. Nothing more should be done when it
+// returns handled.
+func (c *GroupCommand) refuseWhenModerated(ctx *GroupUpdateContext, action string) (bool, error) {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	_, required, err := approvalRequired(ctx.ctx, c.backend, i.GuildID, ctx.caller.ID, c.isAdminFunction)
+	if err != nil {
+		logger.Error("failed to get guild settings",
+			slog.Any("error", err),
+			slog.String("guild", i.GuildID))
+
+		return true, respondWithEphemeralMessage(s, i, "Could not load guild settings")
+	}
+
+	if required {
+		return true, respondWithEphemeralMessage(s, i, "Role changes need staff approval in this server, so group roles can only be "+action+" by staff")
+	}
+
+	return false, nil
+}
+
+func (c *GroupCommand) executeSettings(ctx *GroupUpdateContext, group *backend.GroupRole, options Options) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	if group.Owner != ctx.caller.ID && !c.isAdminFunction(ctx.caller.ID) {
+		return respondWithEphemeralMessage(s, i, "Only the owner of a group role can change its settings")
+	}
+
+	if coEdit, ok := options.Bool("co_edit"); ok {
+		group.CoEdit = coEdit
+	}
+
+	if value, ok := options.Int("max_members"); ok {
+		members, err := c.backend.GetGroupMembers(ctx.ctx, i.GuildID, group.Role)
+		if err != nil {
+			logger.Error("failed to get group members",
+				slog.Any("error", err),
+				slog.String("role", group.Role))
+
+			return respondWithEphemeralMessage(s, i, "Could not load group members")
+		}
+
+		maxMembers := int(value)
+		if maxMembers < len(members) {
+			return respondWithEphemeralMessage(s, i, fmt.Sprintf("<@&%s> already has %d members, remove some with `/group kick` before lowering the cap to %d",
+				group.Role, len(members), maxMembers))
+		}
+
+		group.MaxMembers = maxMembers
+	}
+
+	if err := c.backend.SetGroup(ctx.ctx, *group); err != nil {
+		logger.Error("failed to store group role",
+			slog.Any("error", err),
+			slog.String("role", group.Role))
+
+		return respondWithEphemeralMessage(s, i, "Could not store group settings")
+	}
+
+	return respondWithEphemeralMessage(s, i, fmt.Sprintf("<@&%s> now allows up to %d members, co-editing is %s",
+		group.Role, group.MaxMembers, map[bool]string{true: "on", false: "off"}[group.CoEdit]))
+}
+
+func (c *GroupCommand) executeKick(ctx *GroupUpdateContext, group *backend.GroupRole, options Options) error {
+	s, i := ctx.bot, ctx.data
+
+	if group.Owner != ctx.caller.ID && !c.isAdminFunction(ctx.caller.ID) {
+		return respondWithEphemeralMessage(s, i, "Only the owner of a group role can remove members")
+	}
+
+	target, ok := options.ID("user")
+	if !ok {
+		return respondWithEphemeralMessage(s, i, "Could not find that member")
+	}
+
+	if target == group.Owner {
+		return respondWithEphemeralMessage(s, i, "The owner cannot be removed, use `/group disband` instead")
+	}
+
+	return c.leaveGroup(ctx, group, target)
+}
+
+func (c *GroupCommand) executeLeave(ctx *GroupUpdateContext, group *backend.GroupRole, _ Options) error {
+	return c.leaveGroup(ctx, group, ctx.caller.ID)
+}
+
+// leaveGroup removes a member from a group role, handing the role to the next member when the owner leaves
+// and deleting it when nobody is left
+func (c *GroupCommand) leaveGroup(ctx *GroupUpdateContext, group *backend.GroupRole, user string) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	members, err := c.backend.GetGroupMembers(ctx.ctx, i.GuildID, group.Role)
+	if err != nil {
+		logger.Error("failed to get group members",
+			slog.Any("error", err),
+			slog.String("role", group.Role))
+
+		return respondWithEphemeralMessage(s, i, "Could not load group members")
+	}
+
+	if !slices.Contains(members, user) {
+		return respondWithEphemeralMessage(s, i, "<@"+user+"> is not a member of <@&"+group.Role+">")
+	}
+
+	remaining := slices.DeleteFunc(slices.Clone(members), func(member string) bool { return member == user })
+
+	if len(remaining) == 0 {
+		return c.disbandGroup(ctx, group)
+	}
+
+	if err = s.GuildMemberRoleRemove(i.GuildID, user, group.Role); err != nil {
+		logger.Error("failed to remove group role from member",
+			slog.Any("error", err),
+			slog.String("role", group.Role),
+			slog.String("user", user))
+
+		return respondWithEphemeralMessage(s, i, "Could not remove the group role")
+	}
+
+	if err = c.backend.RemoveGroupMember(ctx.ctx, i.GuildID, group.Role, user); err != nil {
+		logger.Error("failed to remove group member",
+			slog.Any("error", err),
+			slog.String("role", group.Role),
+			slog.String("user", user))
+	}
+
+	content := fmt.Sprintf("<@%s> left <@&%s>", user, group.Role)
+
+	if user == group.Owner {
+		group.Owner = remaining[0]
+
+		if err = c.backend.SetGroup(ctx.ctx, *group); err != nil {
+			logger.Error("failed to transfer group role",
+				slog.Any("error", err),
+				slog.String("role", group.Role))
+		}
+
+		content += fmt.Sprintf(", <@%s> is the new owner", group.Owner)
+	}
+
+	return respondWithEphemeralMessage(s, i, content)
+}
+
+func (c *GroupCommand) executeInfo(ctx *GroupUpdateContext, group *backend.GroupRole, _ Options) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	members, err := c.backend.GetGroupMembers(ctx.ctx, i.GuildID, group.Role)
+	if err != nil {
+		logger.Error("failed to get group members",
+			slog.Any("error", err),
+			slog.String("role", group.Role))
+
+		return respondWithEphemeralMessage(s, i, "Could not load group members")
+	}
+
+	var membersText strings.Builder
+	for _, member := range members {
+		membersText.WriteString("<@" + member + ">")
+		if member == group.Owner {
+			membersText.WriteString(" (owner)")
+		}
+		membersText.WriteString("\n")
+	}
+
+	if membersText.Len() == 0 {
+		membersText.WriteString("No members")
+	}
+
+	data := &discordgo.InteractionResponseData{
+		Flags: discordgo.MessageFlagsEphemeral,
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       "Group Role",
+				Description: "<@&" + group.Role + ">",
+				Fields: []*discordgo.MessageEmbedField{
+					{
+						Name:   fmt.Sprintf("Members (%d/%d)", len(members), group.MaxMembers),
+						Value:  membersText.String(),
+						Inline: true,
+					},
+					{
+						Name:   "Co-Editing",
+						Value:  map[bool]string{true: "Every member", false: "Owner only"}[group.CoEdit],
+						Inline: true,
+					},
+				},
+			},
+		},
+	}
+
+	if slices.Contains(members, ctx.caller.ID) {
+		data.Components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Leave Group",
+						Style:    discordgo.DangerButton,
+						CustomID: ComponentID(groupNamespace, groupActionLeave, group.Role),
+					},
+				},
+			},
+		}
+	}
+
+	return respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+}
+
+func (c *GroupCommand) executeDisband(ctx *GroupUpdateContext, group *backend.GroupRole, _ Options) error {
+	if group.Owner != ctx.caller.ID && !c.isAdminFunction(ctx.caller.ID) {
+		return respondWithEphemeralMessage(ctx.bot, ctx.data, "Only the owner of a group role can disband it")
+	}
+
+	return c.disbandGroup(ctx, group)
+}
+
+func (c *GroupCommand) disbandGroup(ctx *GroupUpdateContext, group *backend.GroupRole) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	if err := s.GuildRoleDelete(i.GuildID, group.Role); err != nil {
+		logger.Error("failed to delete group role",
+			slog.Any("error", err),
+			slog.String("role", group.Role))
+
+		return respondWithEphemeralMessage(s, i, "Could not delete the group role")
+	}
+
+	if err := c.backend.DeleteGroup(ctx.ctx, i.GuildID, group.Role); err != nil {
+		logger.Error("failed to remove group role",
+			slog.Any("error", err),
+			slog.String("role", group.Role))
+	}
+
+	logger.Info("disbanded group role",
+		slog.String("caller", ctx.caller.ID),
+		slog.String("role", group.Role))
+
+	return respondWithEphemeralMessage(s, i, "The group role has been deleted")
+}
@@ -0,0 +1,294 @@
+package cmds
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"fmt"
+	appbackend "github.com/Sxtanna/chromatic_curator/internal/app/backend"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds/cmdstest"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// groupInteraction returns an invocation of a group subcommand by the caller in the test guild
+func groupInteraction(caller string, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	interaction := newTestInteraction("guild", caller)
+	interaction.Data = discordgo.ApplicationCommandInteractionData{
+		Name: "group",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{
+			{Type: discordgo.ApplicationCommandOptionSubCommand, Name: subcommand, Options: options},
+		},
+		Resolved: &discordgo.ApplicationCommandInteractionDataResolved{
+			Users: map[string]*discordgo.User{"invitee": {ID: "invitee"}, "member": {ID: "member"}},
+		},
+	}
+
+	return interaction
+}
+
+func groupOption(role string) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionRole, Name: "group", Value: role}
+}
+
+func TestGroupCommandModerated(t *testing.T) {
+	tests := []struct {
+		name        string
+		interaction *discordgo.InteractionCreate
+		reply       string
+		edits       int
+	}{
+		{
+			name:        "members cannot create group roles",
+			interaction: groupInteraction("member", "create", stringOption("name", "Friends"), stringOption("color", "red")),
+			reply:       "can only be created by staff",
+		},
+		{
+			name:        "members cannot edit group roles",
+			interaction: groupInteraction("member", "edit", groupOption("group"), stringOption("color", "red")),
+			reply:       "can only be edited by staff",
+		},
+		{
+			name:        "admins create group roles",
+			interaction: groupInteraction("admin", "create", stringOption("name", "Friends"), stringOption("color", "red")),
+			reply:       "Created",
+			edits:       1,
+		},
+		{
+			name:        "admins edit group roles",
+			interaction: groupInteraction("admin", "edit", groupOption("group"), stringOption("color", "red")),
+			reply:       "Updated",
+			edits:       1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := cmdstest.NewSession()
+			session.AddGuild("guild", &discordgo.Role{ID: "group", Name: "Group"})
+
+			store := appbackend.NewMemoryBackend()
+			moderate(store)
+			_ = store.SetGroup(context.Background(), backend.GroupRole{Guild: "guild", Role: "group", Owner: "member", MaxMembers: 2})
+
+			command := NewGroupCommand(store, NewComponentSigner("secret"), func(id string) bool {
+				return strings.HasPrefix(id, "admin")
+			})
+
+			if err := command.Execute(session, test.interaction, slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if replies := session.Replies(); len(replies) != 1 || !strings.Contains(replies[0], test.reply) {
+				t.Errorf("expected a reply containing %q, got %v", test.reply, replies)
+			}
+
+			if calls := session.Calls("GuildRoleCreate", "GuildRoleEdit"); len(calls) != test.edits {
+				t.Errorf("expected %d role changes, got %v", test.edits, calls)
+			}
+		})
+	}
+}
+
+func TestGroupCommandInviteExpires(t *testing.T) {
+	session := cmdstest.NewSession()
+	session.AddGuild("guild", &discordgo.Role{ID: "group", Name: "Group"})
+
+	store := appbackend.NewMemoryBackend()
+	_ = store.SetGroup(context.Background(), backend.GroupRole{Guild: "guild", Role: "group", Owner: "owner", MaxMembers: 2})
+
+	signer := NewComponentSigner("secret")
+	command := NewGroupCommand(store, signer, func(id string) bool {
+		return false
+	})
+
+	interaction := groupInteraction("owner", "invite", groupOption("group"),
+		&discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionUser, Name: "user", Value: "invitee"})
+
+	if err := command.Execute(session, interaction, slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	calls := session.Calls("InteractionRespond")
+	if len(calls) != 1 {
+		t.Fatalf("expected one response, got %v", calls)
+	}
+
+	row := calls[0].Args[1].(*discordgo.InteractionResponse).Data.Components[0].(discordgo.ActionsRow)
+
+	for _, component := range row.Components {
+		customID := component.(discordgo.Button).CustomID
+
+		if _, _, err := signer.parse(customID, time.Now().Add(groupInviteExpiry-time.Minute)); err != nil {
+			t.Errorf("parse() of %q before the invite expired error = %v", customID, err)
+		}
+
+		if _, _, err := signer.parse(customID, time.Now().Add(groupInviteExpiry+time.Minute)); !errors.Is(err, ComponentExpired) {
+			t.Errorf("parse() of %q after the invite expired error = %v, want %v", customID, err, ComponentExpired)
+		}
+	}
+}
+
+func TestGroupCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		interaction *discordgo.InteractionCreate
+		reply       string
+		check       func(t *testing.T, session *cmdstest.Session, store backend.Backend)
+	}{
+		{
+			name:        "unknown subcommands leave the group role alone",
+			interaction: groupInteraction("owner", "archive", groupOption("group")),
+			reply:       "Unknown subcommand",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if calls := session.Calls("GuildRoleDelete"); len(calls) != 0 {
+					t.Errorf("expected no role to be deleted, got %v", calls)
+				}
+
+				if group, _ := store.GetGroup(context.Background(), "guild", "group"); group == nil {
+					t.Errorf("expected the group role to be kept")
+				}
+			},
+		},
+		{
+			name:        "settings refuses a cap below the member count",
+			interaction: groupInteraction("owner", "settings", groupOption("group"), intOption("max_members", 2)),
+			reply:       "already has 3 members",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if group, _ := store.GetGroup(context.Background(), "guild", "group"); group.MaxMembers != 5 {
+					t.Errorf("expected the cap to be kept, got %d", group.MaxMembers)
+				}
+			},
+		},
+		{
+			name:        "settings lowers the cap to the member count",
+			interaction: groupInteraction("owner", "settings", groupOption("group"), intOption("max_members", 3)),
+			reply:       "up to 3 members",
+		},
+		{
+			name:        "create refuses members owning too many group roles",
+			interaction: groupInteraction("owner", "create", stringOption("name", "Friends")),
+			reply:       fmt.Sprintf("only own %d group roles", backend.MaxOwnedGroups),
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if calls := session.Calls("GuildRoleCreate"); len(calls) != 0 {
+					t.Errorf("expected no role to be created, got %v", calls)
+				}
+			},
+		},
+		{
+			name:        "create allows admins past the owned group limit",
+			interaction: groupInteraction("admin", "create", stringOption("name", "Friends")),
+			reply:       "Created",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			session := cmdstest.NewSession()
+			session.AddGuild("guild", &discordgo.Role{ID: "group", Name: "Group"})
+
+			store := appbackend.NewMemoryBackend()
+			_ = store.SetGroup(ctx, backend.GroupRole{Guild: "guild", Role: "group", Owner: "owner", MaxMembers: 5})
+
+			for _, member := range []string{"owner", "first", "second"} {
+				_ = store.AddGroupMember(ctx, "guild", "group", member, 0)
+			}
+
+			for index := 1; index < backend.MaxOwnedGroups; index++ {
+				_ = store.SetGroup(ctx, backend.GroupRole{Guild: "guild", Role: fmt.Sprintf("owned-%d", index), Owner: "owner", MaxMembers: 5})
+				_ = store.SetGroup(ctx, backend.GroupRole{Guild: "guild", Role: fmt.Sprintf("admin-%d", index), Owner: "admin", MaxMembers: 5})
+			}
+
+			_ = store.SetGroup(ctx, backend.GroupRole{Guild: "guild", Role: "admin-last", Owner: "admin", MaxMembers: 5})
+
+			command := NewGroupCommand(store, NewComponentSigner("secret"), func(id string) bool {
+				return strings.HasPrefix(id, "admin")
+			})
+
+			if err := command.Execute(session, test.interaction, slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if replies := session.Replies(); len(replies) != 1 || !strings.Contains(replies[0], test.reply) {
+				t.Errorf("expected a reply containing %q, got %v", test.reply, replies)
+			}
+
+			if test.check != nil {
+				test.check(t, session, store)
+			}
+		})
+	}
+}
+
+func TestGroupCommandAcceptInvite(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []string
+		err     error
+		reply   string
+		member  bool
+	}{
+		{
+			name:    "accept joins the group",
+			members: []string{"owner"},
+			reply:   "joined",
+			member:  true,
+		},
+		{
+			name:    "accept refuses a full group",
+			members: []string{"owner", "other"},
+			reply:   "full (2/2)",
+		},
+		{
+			name:    "accept forgets the member when the role cannot be given",
+			members: []string{"owner"},
+			err:     errors.New("missing permissions"),
+			reply:   "Could not give you the group role",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			session := cmdstest.NewSession()
+			session.AddGuild("guild", &discordgo.Role{ID: "group", Name: "Group"})
+
+			if test.err != nil {
+				session.Errors["GuildMemberRoleAdd"] = test.err
+			}
+
+			store := appbackend.NewMemoryBackend()
+			_ = store.SetGroup(ctx, backend.GroupRole{Guild: "guild", Role: "group", Owner: "owner", MaxMembers: 2})
+
+			for _, member := range test.members {
+				_ = store.AddGroupMember(ctx, "guild", "group", member, 0)
+			}
+
+			command := NewGroupCommand(store, NewComponentSigner("secret"), func(id string) bool {
+				return false
+			})
+
+			args := ComponentArgs{values: []string{groupActionAccept, "group", "invitee"}, signed: true}
+
+			if err := command.handleGroupButton(session, newTestInteraction("guild", "invitee"), slog.New(slog.DiscardHandler), args); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if replies := session.Replies(); len(replies) != 1 || !strings.Contains(replies[0], test.reply) {
+				t.Errorf("expected a reply containing %q, got %v", test.reply, replies)
+			}
+
+			members, _ := store.GetGroupMembers(ctx, "guild", "group")
+			if member := slices.Contains(members, "invitee"); member != test.member {
+				t.Errorf("expected the invitee to be a member %v, got members %v", test.member, members)
+			}
+		})
+	}
+}
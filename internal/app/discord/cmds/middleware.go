@@ -0,0 +1,417 @@
+package cmds
+
+import (
+	"context"
+	"crypto/rand"
+	"emperror.dev/errors"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"math"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	commandPanicked = errors.Sentinel("command panicked")
+)
+
+// DefaultDeferThreshold leaves AutoDefer enough time to defer before Discord fails the interaction after three
+// seconds
+const DefaultDeferThreshold = 2 * time.Second
+
+// backendUnavailableMessage is the reply to interactions refused while the backend is unreachable
+const backendUnavailableMessage = "This is temporarily unavailable, please try again in a few minutes"
+
+// CommandMetrics counts the executions, errors and seconds spent of every command, published with expvar and served
+// by the metrics endpoint along with the shard metrics
+var CommandMetrics = expvar.NewMap("commands")
+
+// Handler executes a command interaction
+type Handler func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error
+
+// Middleware wraps the execution of a command, it can stop the command by returning without calling next
+type Middleware func(command Command, next Handler) Handler
+
+// Use adds middlewares that run around every command, before the middlewares declared by the command
+func (r *Registry) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Execute runs the invoked command through the middlewares of the registry and the command
+func (r *Registry) Execute(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+	name := i.ApplicationCommandData().Name
+
+	command, exists := r.GetCommand(name)
+	if !exists {
+		return respondWithEphemeralMessage(s, i, "Unknown command: "+name)
+	}
+
+	middlewares := append(append([]Middleware{}, r.middlewares...), command.GetMiddlewares()...)
+
+	handler := Handler(command.Execute)
+	for index := len(middlewares) - 1; index >= 0; index-- {
+		handler = middlewares[index](command, handler)
+	}
+
+	return handler(s, i, logger)
+}
+
+// GuildOnly refuses the command in direct messages
+func GuildOnly() Middleware {
+	return func(_ Command, next Handler) Handler {
+		return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+			if i.GuildID == "" || i.Member == nil {
+				return respondWithEphemeralMessage(s, i, "This command can only be used in a guild")
+			}
+
+			return next(s, i, logger)
+		}
+	}
+}
+
+// AdminOnly refuses the command to users who are not admins of the bot
+func AdminOnly(isAdminFunction func(id string) bool) Middleware {
+	return func(_ Command, next Handler) Handler {
+		return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+			if caller := getInteractionUser(i); caller == nil || !isAdminFunction(caller.ID) {
+				return respondWithEphemeralMessage(s, i, "You do not have permission to use this command")
+			}
+
+			return next(s, i, logger)
+		}
+	}
+}
+
+// RequireBackend refuses commands that need the backend while it is unreachable, they would only fail halfway
+// through
+func RequireBackend(health backend.HealthReporter) Middleware {
+	return func(command Command, next Handler) Handler {
+		return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+			if stateful, ok := command.(BackendCommand); ok && stateful.RequiresBackend() && !health.Healthy() {
+				return respondWithEphemeralMessage(s, i, backendUnavailableMessage)
+			}
+
+			return next(s, i, logger)
+		}
+	}
+}
+
+// RateLimit limits how often members use commands, by the configured limits or those their guild sets. Admins of
+// the bot are never limited, and commands are allowed when the limits cannot be checked.
+func RateLimit(limiter data.RateLimiter, config *data.RateLimitConfig, settings backend.Backend, isAdminFunction func(id string) bool) Middleware {
+	return func(command Command, next Handler) Handler {
+		return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+			caller := getInteractionUser(i)
+			if caller == nil || i.GuildID == "" || isAdminFunction(caller.ID) {
+				return next(s, i, logger)
+			}
+
+			ctx := context.Background()
+
+			guild, err := settings.GetGuildSettings(ctx, i.GuildID)
+			if err != nil {
+				logger.Warn("failed to get guild settings, using the configured rate limits",
+					slog.Any("error", err),
+					slog.String("guild", i.GuildID))
+			}
+
+			limits := config.Limits(command.GetName(), guild)
+			key := i.GuildID + ":" + command.GetName()
+
+			buckets := make([]data.Bucket, 0, 2)
+			messages := make([]string, 0, 2)
+
+			if limits.User != nil {
+				buckets = append(buckets, data.Bucket{Key: key + ":user:" + caller.ID, Limit: *limits.User})
+				messages = append(messages, "You are using `/%s` too often, try again in %ds")
+			}
+
+			if limits.Guild != nil {
+				buckets = append(buckets, data.Bucket{Key: key, Limit: *limits.Guild})
+				messages = append(messages, "`/%s` is being used too often in this server, try again in %ds")
+			}
+
+			if len(buckets) == 0 {
+				return next(s, i, logger)
+			}
+
+			// Both buckets are taken from together, so a use refused by one is not counted against the other
+			empty, wait, err := limiter.Take(ctx, buckets...)
+			if err != nil {
+				logger.Error("failed to check rate limit, allowing the command",
+					slog.Any("error", err),
+					slog.String("bucket", key))
+
+				return next(s, i, logger)
+			}
+
+			if wait > 0 {
+				seconds := int(math.Ceil(wait.Seconds()))
+				return respondWithEphemeralMessage(s, i, fmt.Sprintf(messages[empty], command.GetName(), seconds))
+			}
+
+			return next(s, i, logger)
+		}
+	}
+}
+
+// AutoDefer defers the response when the command has not responded within the threshold, so Discord does not
+// fail the interaction after three seconds. Responses sent through respond after that replace the loading message,
+// so commands declaring it must not call InteractionRespond themselves.
+func AutoDefer(threshold time.Duration, ephemeral bool) Middleware {
+	return func(_ Command, next Handler) Handler {
+		return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+			state := &responseState{}
+
+			pending.Store(i.ID, state)
+			defer pending.Delete(i.ID)
+
+			timer := time.AfterFunc(threshold, func() {
+				state.deferResponse(s, i, ephemeral, logger)
+			})
+			defer timer.Stop()
+
+			return next(s, i, logger)
+		}
+	}
+}
+
+// Recover replies to the user with an error ID when the command panics, so it can be found in the logs
+func Recover() Middleware {
+	return func(command Command, next Handler) Handler {
+		return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) (err error) {
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+
+				errorID := newErrorID()
+
+				logger.Error("command panicked",
+					slog.Any("panic", recovered),
+					slog.String("command", command.GetName()),
+					slog.String("error_id", errorID),
+					slog.String("stack", string(debug.Stack())))
+
+				err = errors.WithDetails(commandPanicked, "command", command.GetName(), "error_id", errorID)
+
+				if replyErr := replyWithEphemeralMessage(s, i, fmt.Sprintf("Something went wrong, please report error ID `%s`", errorID)); replyErr != nil {
+					logger.Error("Failed to reply to panicked command",
+						slog.Any("error", replyErr),
+						slog.String("error_id", errorID))
+				}
+			}()
+
+			return next(s, i, logger)
+		}
+	}
+}
+
+// Logging logs every execution with its caller, subcommand and duration, and gives the command a logger with them
+func Logging() Middleware {
+	return func(command Command, next Handler) Handler {
+		return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+			name := command.GetName()
+
+			if group := GetSubcommandGroup(i.Interaction); group != nil {
+				name += " " + group.Name
+			}
+
+			if subcommand := GetSubcommand(i.Interaction); subcommand != nil {
+				name += " " + subcommand.Name
+			}
+
+			logger = logger.With(
+				slog.String("command", name),
+				slog.String("guild", i.GuildID))
+
+			if caller := getInteractionUser(i); caller != nil {
+				logger = logger.With(slog.String("user", caller.ID))
+			}
+
+			start := time.Now()
+			err := next(s, i, logger)
+
+			if err != nil {
+				logger.Error("Failed to execute command",
+					slog.Any("error", err),
+					slog.Duration("duration", time.Since(start)))
+			} else {
+				logger.Info("Executed command",
+					slog.Duration("duration", time.Since(start)))
+			}
+
+			return err
+		}
+	}
+}
+
+// Metrics counts the executions, errors and seconds spent of every command in CommandMetrics
+func Metrics() Middleware {
+	return func(command Command, next Handler) Handler {
+		return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+			name := command.GetName()
+
+			start := time.Now()
+			err := next(s, i, logger)
+
+			CommandMetrics.Add(name+".executions", 1)
+			CommandMetrics.AddFloat(name+".seconds", time.Since(start).Seconds())
+
+			if err != nil {
+				CommandMetrics.Add(name+".errors", 1)
+			}
+
+			return err
+		}
+	}
+}
+
+func newErrorID() string {
+	id := make([]byte, 4)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// pending tracks the responses of interactions running with AutoDefer, by interaction ID
+var pending sync.Map
+
+type responseState struct {
+	mutex     sync.Mutex
+	deferred  bool
+	responded bool
+}
+
+func (r *responseState) deferResponse(s Session, i *discordgo.InteractionCreate, ephemeral bool, logger *slog.Logger) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.responded || r.deferred {
+		return
+	}
+
+	var flags discordgo.MessageFlags
+	if ephemeral {
+		flags = discordgo.MessageFlagsEphemeral
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: flags,
+		},
+	})
+	if err != nil {
+		logger.Error("Failed to send deferred response", slog.Any("error", err))
+		return
+	}
+
+	r.deferred = true
+}
+
+// deferNow defers the response right away, for commands that edit their loading message with progress. Under
+// AutoDefer it does nothing once the interaction was deferred or responded to.
+func deferNow(s Session, i *discordgo.InteractionCreate, ephemeral bool) error {
+	var flags discordgo.MessageFlags
+	if ephemeral {
+		flags = discordgo.MessageFlagsEphemeral
+	}
+
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Flags: flags,
+		},
+	}
+
+	value, tracked := pending.Load(i.ID)
+	if !tracked {
+		return s.InteractionRespond(i.Interaction, response)
+	}
+
+	state := value.(*responseState)
+
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.deferred || state.responded {
+		return nil
+	}
+
+	if err := s.InteractionRespond(i.Interaction, response); err != nil {
+		return err
+	}
+
+	state.deferred = true
+
+	return nil
+}
+
+// respond responds to the interaction, or replaces the loading message when AutoDefer already deferred it
+func respond(s Session, i *discordgo.InteractionCreate, response *discordgo.InteractionResponse) error {
+	value, tracked := pending.Load(i.ID)
+	if !tracked {
+		return s.InteractionRespond(i.Interaction, response)
+	}
+
+	state := value.(*responseState)
+
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if !state.deferred {
+		err := s.InteractionRespond(i.Interaction, response)
+		if err == nil {
+			state.responded = true
+		}
+
+		return err
+	}
+
+	switch response.Type {
+	case discordgo.InteractionResponseDeferredChannelMessageWithSource, discordgo.InteractionResponseDeferredMessageUpdate:
+		return nil
+	}
+
+	edit := &discordgo.WebhookEdit{}
+
+	if data := response.Data; data != nil {
+		edit.Content = &data.Content
+		edit.Files = data.Files
+		edit.AllowedMentions = data.AllowedMentions
+
+		if len(data.Embeds) > 0 {
+			edit.Embeds = &data.Embeds
+		}
+
+		if data.Components != nil {
+			edit.Components = &data.Components
+		}
+	}
+
+	_, err := s.InteractionResponseEdit(i.Interaction, edit)
+	return err
+}
+
+// replyWithEphemeralMessage responds with a message only visible to the caller, as a follow-up if the interaction
+// was already responded to
+func replyWithEphemeralMessage(s Session, i *discordgo.InteractionCreate, content string) error {
+	if respondWithEphemeralMessage(s, i, content) == nil {
+		return nil
+	}
+
+	_, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Content: content,
+		Flags:   discordgo.MessageFlagsEphemeral,
+	})
+
+	return err
+}
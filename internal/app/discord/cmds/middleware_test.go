@@ -0,0 +1,368 @@
+package cmds
+
+import (
+	"context"
+	"emperror.dev/errors"
+	appbackend "github.com/Sxtanna/chromatic_curator/internal/app/backend"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds/cmdstest"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCommand struct {
+	BaseCommand
+
+	execute Handler
+}
+
+func (c *testCommand) Execute(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+	return c.execute(s, i, logger)
+}
+
+func newTestInteraction(guild string, user string) *discordgo.InteractionCreate {
+	interaction := &discordgo.Interaction{
+		ID:      "interaction",
+		Type:    discordgo.InteractionApplicationCommand,
+		GuildID: guild,
+		Data:    discordgo.ApplicationCommandInteractionData{Name: "test"},
+	}
+
+	if guild != "" {
+		interaction.Member = &discordgo.Member{User: &discordgo.User{ID: user}}
+	} else {
+		interaction.User = &discordgo.User{ID: user}
+	}
+
+	return &discordgo.InteractionCreate{Interaction: interaction}
+}
+
+func TestRegistryExecuteMiddlewares(t *testing.T) {
+	var order []string
+
+	trace := func(name string) Middleware {
+		return func(_ Command, next Handler) Handler {
+			return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+				order = append(order, name)
+				return next(s, i, logger)
+			}
+		}
+	}
+
+	command := &testCommand{
+		BaseCommand: BaseCommand{Name: "test", Middlewares: []Middleware{trace("command")}},
+		execute: func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+			order = append(order, "execute")
+			return nil
+		},
+	}
+
+	registry := NewRegistry(slog.New(slog.DiscardHandler), NewComponentSigner("secret"))
+	registry.Use(trace("first"), trace("second"))
+	registry.RegisterCommand(command)
+
+	session := cmdstest.NewSession()
+
+	if err := registry.Execute(session, newTestInteraction("guild", "user"), slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Join(order, ",") != "first,second,command,execute" {
+		t.Errorf("unexpected order %v", order)
+	}
+}
+
+func TestMiddlewares(t *testing.T) {
+	tests := []struct {
+		name        string
+		middleware  Middleware
+		interaction func() *discordgo.InteractionCreate
+		calls       int
+		executed    int
+		reply       string
+		err         error
+	}{
+		{
+			name:        "guild only in a guild",
+			middleware:  GuildOnly(),
+			interaction: func() *discordgo.InteractionCreate { return newTestInteraction("guild", "user") },
+			calls:       1,
+			executed:    1,
+		},
+		{
+			name:        "guild only in a direct message",
+			middleware:  GuildOnly(),
+			interaction: func() *discordgo.InteractionCreate { return newTestInteraction("", "user") },
+			calls:       1,
+			reply:       "only be used in a guild",
+		},
+		{
+			name:        "admin only refuses other users",
+			middleware:  AdminOnly(func(id string) bool { return id == "admin" }),
+			interaction: func() *discordgo.InteractionCreate { return newTestInteraction("guild", "user") },
+			calls:       1,
+			reply:       "do not have permission",
+		},
+		{
+			name:        "rate limit refuses a use over the limit",
+			middleware:  RateLimit(data.NewMemoryRateLimiter(), testRateLimits(t), appbackend.NewMemoryBackend(), func(string) bool { return false }),
+			interaction: func() *discordgo.InteractionCreate { return newTestInteraction("guild", "user") },
+			calls:       2,
+			executed:    1,
+			reply:       "too often",
+		},
+		{
+			name:        "rate limit lets admins through",
+			middleware:  RateLimit(data.NewMemoryRateLimiter(), testRateLimits(t), appbackend.NewMemoryBackend(), func(string) bool { return true }),
+			interaction: func() *discordgo.InteractionCreate { return newTestInteraction("guild", "user") },
+			calls:       2,
+			executed:    2,
+		},
+		{
+			name:        "recover replies with an error ID",
+			middleware:  Recover(),
+			interaction: func() *discordgo.InteractionCreate { return newTestInteraction("guild", "panic") },
+			calls:       1,
+			executed:    1,
+			reply:       "error ID",
+			err:         commandPanicked,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := cmdstest.NewSession()
+			executed := 0
+
+			command := &testCommand{
+				BaseCommand: BaseCommand{Name: "test"},
+				execute: func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+					executed++
+
+					if getInteractionUser(i).ID == "panic" {
+						panic("boom")
+					}
+
+					return nil
+				},
+			}
+
+			var err error
+			for range test.calls {
+				err = test.middleware(command, command.Execute)(session, test.interaction(), slog.New(slog.DiscardHandler))
+			}
+
+			if !errors.Is(err, test.err) {
+				t.Errorf("expected error %v, got %v", test.err, err)
+			}
+
+			if executed != test.executed {
+				t.Errorf("expected %d executions, got %d", test.executed, executed)
+			}
+
+			sent := strings.Join(session.Replies(), "\n")
+			if test.reply == "" && sent != "" {
+				t.Errorf("expected no reply, got %s", sent)
+			}
+
+			if !strings.Contains(sent, test.reply) {
+				t.Errorf("expected a reply containing %q, got %s", test.reply, sent)
+			}
+		})
+	}
+}
+
+func testRateLimits(t *testing.T) *data.RateLimitConfig {
+	config := &data.RateLimitConfig{Users: "test=1/1m", Guilds: "test=10/1m"}
+	if err := config.Process(); err != nil {
+		t.Fatalf("failed to process rate limits: %v", err)
+	}
+
+	return config
+}
+
+func TestRateLimitRefusedUsesAreNotCounted(t *testing.T) {
+	config := &data.RateLimitConfig{Users: "test=2/1m", Guilds: "test=1/1m"}
+	if err := config.Process(); err != nil {
+		t.Fatalf("failed to process rate limits: %v", err)
+	}
+
+	limiter := data.NewMemoryRateLimiter()
+	session := cmdstest.NewSession()
+	executed := 0
+
+	command := &testCommand{
+		BaseCommand: BaseCommand{Name: "test"},
+		execute: func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+			executed++
+			return nil
+		},
+	}
+
+	handler := RateLimit(limiter, config, appbackend.NewMemoryBackend(), func(string) bool { return false })(command, command.Execute)
+
+	for range 2 {
+		if err := handler(session, newTestInteraction("guild", "user"), slog.New(slog.DiscardHandler)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if executed != 1 {
+		t.Fatalf("expected 1 execution, got %d", executed)
+	}
+
+	if replies := session.Replies(); len(replies) != 1 || !strings.Contains(replies[0], "in this server") {
+		t.Fatalf("expected the guild limit to refuse the second use, got %v", replies)
+	}
+
+	// The use refused by the guild limit must not have been taken from the user
+	user := data.Bucket{Key: "guild:test:user:user", Limit: *config.Limits("test", backend.GuildSettings{}).User}
+	if _, wait, _ := limiter.Take(context.Background(), user); wait != 0 {
+		t.Errorf("expected the user to have a use left, got a wait of %v", wait)
+	}
+}
+
+func TestAutoDeferEditsAfterThreshold(t *testing.T) {
+	session := cmdstest.NewSession()
+
+	command := &testCommand{
+		BaseCommand: BaseCommand{Name: "test"},
+		execute: func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+			time.Sleep(50 * time.Millisecond)
+			return respondWithEphemeralMessage(s, i, "done")
+		},
+	}
+
+	handler := AutoDefer(10*time.Millisecond, true)(command, command.Execute)
+	if err := handler(session, newTestInteraction("guild", "user"), slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	calls := session.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected a deferral and an edit, got %v", calls)
+	}
+
+	deferral, _ := calls[0].Args[1].(*discordgo.InteractionResponse)
+	if deferral == nil || deferral.Type != discordgo.InteractionResponseDeferredChannelMessageWithSource {
+		t.Errorf("expected a deferral first, got %v", calls[0])
+	}
+
+	if replies := session.Replies(); len(replies) != 1 || replies[0] != "done" {
+		t.Errorf("expected the response to be edited to done, got %v", replies)
+	}
+}
+
+func TestAutoDeferAfterDeferNow(t *testing.T) {
+	session := cmdstest.NewSession()
+
+	command := &testCommand{
+		BaseCommand: BaseCommand{Name: "test"},
+		execute: func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+			if err := deferNow(s, i, true); err != nil {
+				return err
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			return respondWithEphemeralMessage(s, i, "done")
+		},
+	}
+
+	handler := AutoDefer(10*time.Millisecond, true)(command, command.Execute)
+	if err := handler(session, newTestInteraction("guild", "user"), slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if deferrals := session.Calls("InteractionRespond"); len(deferrals) != 1 {
+		t.Fatalf("expected a single deferral, got %v", deferrals)
+	}
+
+	if replies := session.Replies(); len(replies) != 1 || replies[0] != "done" {
+		t.Errorf("expected the response to be edited to done, got %v", replies)
+	}
+}
+
+// testHealth reports the backend as reachable or not
+type testHealth bool
+
+func (h testHealth) Healthy() bool {
+	return bool(h)
+}
+
+func TestRegistryRefusesWhileBackendUnavailable(t *testing.T) {
+	component := func() *discordgo.InteractionCreate {
+		interaction := newTestInteraction("guild", "member")
+		interaction.Type = discordgo.InteractionMessageComponent
+		interaction.Data = discordgo.MessageComponentInteractionData{CustomID: ComponentID(favoriteColorNamespace, "255")}
+		return interaction
+	}
+
+	autocomplete := func() *discordgo.InteractionCreate {
+		interaction := favoritesInteraction("remove", &discordgo.ApplicationCommandInteractionDataOption{
+			Type: discordgo.ApplicationCommandOptionString, Name: "color", Value: "", Focused: true,
+		})
+		interaction.Type = discordgo.InteractionApplicationCommandAutocomplete
+		return interaction
+	}
+
+	tests := []struct {
+		name    string
+		healthy bool
+		handle  func(registry *Registry, session *cmdstest.Session)
+		reply   string
+	}{
+		{
+			name: "refuses components",
+			handle: func(registry *Registry, session *cmdstest.Session) {
+				registry.HandleComponent(session, component(), slog.New(slog.DiscardHandler))
+			},
+			reply: backendUnavailableMessage,
+		},
+		{
+			name:    "handles components while healthy",
+			healthy: true,
+			handle: func(registry *Registry, session *cmdstest.Session) {
+				registry.HandleComponent(session, component(), slog.New(slog.DiscardHandler))
+			},
+			reply: "to your favorites",
+		},
+		{
+			name: "offers no choices",
+			handle: func(registry *Registry, session *cmdstest.Session) {
+				_ = registry.Autocomplete(session, autocomplete(), slog.New(slog.DiscardHandler))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// A saved favorite would be offered as a choice if the backend was asked
+			store := appbackend.NewMemoryBackend()
+			_ = store.AddFavorite(context.Background(), "guild", "member", backend.Favorite{Color: 0xFF0000, Label: "red"})
+
+			registry := NewRegistry(slog.New(slog.DiscardHandler), NewComponentSigner("secret"))
+			registry.SetHealth(testHealth(test.healthy))
+			registry.RegisterCommand(NewFavoritesCommand(store))
+
+			session := cmdstest.NewSession()
+			test.handle(registry, session)
+
+			if test.reply == "" {
+				calls := session.Calls("InteractionRespond")
+				if len(calls) != 1 || len(calls[0].Args[1].(*discordgo.InteractionResponse).Data.Choices) != 0 {
+					t.Errorf("expected a response without choices, got %v", calls)
+				}
+
+				return
+			}
+
+			if replies := session.Replies(); len(replies) != 1 || !strings.Contains(replies[0], test.reply) {
+				t.Errorf("expected a reply containing %q, got %v", test.reply, replies)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package cmds
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
 	"github.com/Sxtanna/chromatic_curator/internal/common"
@@ -16,11 +17,14 @@ import (
 // PaletteCommand represents a command to generate color palettes
 type PaletteCommand struct {
 	BaseCommand
+
+	generations data.GenerationStore
 }
 
 // NewPaletteCommand creates a new color palette generation command
-func NewPaletteCommand() *PaletteCommand {
+func NewPaletteCommand(generations data.GenerationStore) *PaletteCommand {
 	return &PaletteCommand{
+		generations: generations,
 		BaseCommand: BaseCommand{
 			Name:        "palette",
 			Description: "Generate color palettes of different types",
@@ -30,32 +34,7 @@ func NewPaletteCommand() *PaletteCommand {
 					Name:        "type",
 					Description: "The type of palette to generate",
 					Required:    true,
-					Choices: []*discordgo.ApplicationCommandOptionChoice{
-						{
-							Name:  common.PaletteTypeMonochromatic.DisplayName(),
-							Value: common.PaletteTypeMonochromatic.String(),
-						},
-						{
-							Name:  common.PaletteTypeComplementary.DisplayName(),
-							Value: common.PaletteTypeComplementary.String(),
-						},
-						{
-							Name:  common.PaletteTypeSplitComplementary.DisplayName(),
-							Value: common.PaletteTypeSplitComplementary.String(),
-						},
-						{
-							Name:  common.PaletteTypeAnalogous.DisplayName(),
-							Value: common.PaletteTypeAnalogous.String(),
-						},
-						{
-							Name:  common.PaletteTypeTriadic.DisplayName(),
-							Value: common.PaletteTypeTriadic.String(),
-						},
-						{
-							Name:  common.PaletteTypeTetradic.DisplayName(),
-							Value: common.PaletteTypeTetradic.String(),
-						},
-					},
+					Choices:     paletteTypeChoices(),
 				},
 				{
 					Type:        discordgo.ApplicationCommandOptionString,
@@ -76,8 +55,30 @@ func NewPaletteCommand() *PaletteCommand {
 	}
 }
 
+// paletteTypeChoices returns every palette type as an option choice
+func paletteTypeChoices() []*discordgo.ApplicationCommandOptionChoice {
+	paletteTypes := []common.PaletteType{
+		common.PaletteTypeMonochromatic,
+		common.PaletteTypeComplementary,
+		common.PaletteTypeSplitComplementary,
+		common.PaletteTypeAnalogous,
+		common.PaletteTypeTriadic,
+		common.PaletteTypeTetradic,
+	}
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(paletteTypes))
+	for _, paletteType := range paletteTypes {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  paletteType.DisplayName(),
+			Value: paletteType.String(),
+		})
+	}
+
+	return choices
+}
+
 // Execute handles the command execution
-func (c *PaletteCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+func (c *PaletteCommand) Execute(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
 	// Get the palette type from the options
 	typeOption := GetOptionByName(i.Interaction, "type")
 	if typeOption == nil {
@@ -187,11 +188,11 @@ func (c *PaletteCommand) Execute(s *discordgo.Session, i *discordgo.InteractionC
 	// Generate the embed
 	generation.Embed = generatePaletteEmbed(generation, paletteColors, paletteType)
 
-	// Generate a UUID for the image and store it in the cache
-	imageID := data.SaveGeneration(generation)
+	// The preview is saved once it is sent, the share button needs its ID before that
+	imageID := data.NewGenerationID()
 
-	// Create a custom ID for the share button that includes the UUID
-	shareButtonID := fmt.Sprintf("share_color:%s", imageID)
+	// Create a custom ID for the share button that includes the UUID, it is handled by the color command
+	shareButtonID := ComponentID(shareColorNamespace, imageID)
 
 	// Send a follow-up message with the image and a share button
 	tempMessage, err := s.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
@@ -223,6 +224,11 @@ func (c *PaletteCommand) Execute(s *discordgo.Session, i *discordgo.InteractionC
 
 	generation.TempMsgID = tempMessage.ID
 
+	if err = c.generations.Save(context.Background(), imageID, generation); err != nil {
+		logger.Error("Failed to save generation, it cannot be shared",
+			slog.Any("error", err))
+	}
+
 	return nil
 }
 
@@ -0,0 +1,82 @@
+package cmds
+
+import (
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds/cmdstest"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPaletteCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		interaction *discordgo.InteractionCreate
+		reply       string
+	}{
+		{
+			name:        "previews a palette",
+			interaction: previewInteraction("palette", stringOption("type", "complementary"), stringOption("color", "red")),
+		},
+		{
+			name:        "previews several layers of a random palette",
+			interaction: previewInteraction("palette", stringOption("type", "triadic"), stringOption("color", "random"), intOption("count", 3)),
+		},
+		{
+			name:        "refuses an unknown palette type",
+			interaction: previewInteraction("palette", stringOption("type", "plaid"), stringOption("color", "red")),
+			reply:       "plaid",
+		},
+		{
+			name:        "refuses an unknown color",
+			interaction: previewInteraction("palette", stringOption("type", "complementary"), stringOption("color", "not a color")),
+			reply:       "Could not parse color",
+		},
+		{
+			name:        "requires a palette type",
+			interaction: previewInteraction("palette", stringOption("color", "red")),
+			reply:       "Palette type is required",
+		},
+		{
+			name:        "requires a color",
+			interaction: previewInteraction("palette", stringOption("type", "complementary")),
+			reply:       "Base color is required",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := cmdstest.NewSession()
+			generations := data.NewMemoryGenerationStore(10, time.Minute)
+
+			if err := NewPaletteCommand(generations).Execute(session, test.interaction, slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			preview := sentPreview(session)
+
+			if test.reply != "" {
+				if replies := session.Replies(); len(replies) != 1 || !strings.Contains(replies[0], test.reply) {
+					t.Errorf("expected a reply containing %q, got %v", test.reply, replies)
+				}
+
+				if preview != nil {
+					t.Errorf("expected no preview, got %v", preview)
+				}
+
+				return
+			}
+
+			if preview == nil || len(preview.Embeds) != 1 || len(preview.Files) != 1 {
+				t.Fatalf("expected a preview with an embed and an image, got %v", session.Calls())
+			}
+
+			buttons := preview.Components[0].(discordgo.ActionsRow).Components
+			if len(buttons) != 1 || !strings.HasPrefix(buttons[0].(discordgo.Button).CustomID, shareColorNamespace) {
+				t.Errorf("expected only a share button, got %v", buttons)
+			}
+		})
+	}
+}
@@ -1,236 +1,692 @@
 package cmds
 
 import (
+	"bytes"
 	"context"
+	"emperror.dev/errors"
+	"fmt"
 	"github.com/Sxtanna/chromatic_curator/internal/common"
 	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/Sxtanna/chromatic_curator/internal/system/imaging"
 	"github.com/bwmarrin/discordgo"
 	"log/slog"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+const (
+	roleNameEmpty       = errors.Sentinel("role name cannot be empty")
+	roleNameTooLong     = errors.Sentinel("role name cannot be longer than 100 characters")
+	roleColorOutOfRange = errors.Sentinel("color must be between #000000 and #FFFFFF")
+)
+
+// maxRoleNameLength is the longest role name Discord accepts
+const maxRoleNameLength = 100
+
+// roleLockTimeout is how long to wait for another instance to finish creating the role of the same user. The wait
+// can outlast the three seconds Discord gives an interaction, AutoDefer defers the response before then.
+const roleLockTimeout = 10 * time.Second
+
+// RoleCache holds the roles of the guilds the bot is in, kept current by gateway events
+type RoleCache interface {
+	// CachedRoles returns the roles of a guild, and whether the cache holds the guild
+	CachedRoles(guildID string) ([]*discordgo.Role, bool)
+}
+
 type RoleCommand struct {
 	BaseCommand
 
 	backend         backend.Backend
+	coordinator     backend.Coordinator
+	roles           RoleCache
 	isAdminFunction func(id string) bool
 }
 
-func NewRoleCommand(backend backend.Backend, isAdminFunction func(id string) bool) *RoleCommand {
-	return &RoleCommand{
-		backend:         backend,
+// NewRoleCommand creates a new personal role command, looking up roles in the cache before asking Discord when a
+// cache is given
+func NewRoleCommand(roleBackend backend.Backend, coordinator backend.Coordinator, roles RoleCache, isAdminFunction func(id string) bool) *RoleCommand {
+	command := &RoleCommand{
+		backend:         roleBackend,
+		coordinator:     coordinator,
+		roles:           roles,
 		isAdminFunction: isAdminFunction,
-		BaseCommand: BaseCommand{
-			Name:        "role",
-			Description: "manage your personal role",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "name",
-					Description: "The new name of your role",
-					Required:    false,
+	}
+
+	command.BaseCommand = BaseCommand{
+		Name:        "role",
+		Description: "manage your personal role",
+		Middlewares: []Middleware{GuildOnly(), AutoDefer(DefaultDeferThreshold, true)},
+		Subcommands: []*Subcommand{
+			{
+				Name:        "set",
+				Description: "Change the name or color of your role",
+				Handler:     command.withTarget(command.executeSet),
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "The new name of your role",
+						Required:    false,
+						MaxLength:   maxRoleNameLength,
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "color",
+						Description:  "The new color of your role",
+						Required:     false,
+						Autocomplete: true,
+					},
+					roleUserOption(),
 				},
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "color",
-					Description: "The new color of your role",
-					Required:    false,
+			},
+			{
+				Name:        "history",
+				Description: "Show the previous names and colors of your role",
+				Handler:     command.withTarget(command.executeHistory),
+				Options: []*discordgo.ApplicationCommandOption{
+					roleUserOption(),
 				},
-				{
-					Type:        discordgo.ApplicationCommandOptionUser,
-					Name:        "user",
-					Description: "The user to modify (yourself by default)",
-					Required:    false,
+			},
+			{
+				Name:        "undo",
+				Description: "Revert your role to its previous name and color",
+				Handler:     command.withTarget(command.executeUndo),
+				Options: []*discordgo.ApplicationCommandOption{
+					roleUserOption(),
+				},
+			},
+			{
+				Name:        "restore",
+				Description: "Restore your role to an entry from its history",
+				Handler:     command.withTarget(command.executeRestore),
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "index",
+						Description: "The history entry to restore",
+						Required:    true,
+						MinValue:    &[]float64{1}[0],
+						MaxValue:    backend.MaxHistoryEntries,
+					},
+					roleUserOption(),
+				},
+			},
+			{
+				Name:        "schedule",
+				Description: "Automatically change the color of your role over time",
+				Handler:     command.withTarget(command.executeSchedule),
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "source",
+						Description: "Where the next color comes from",
+						Required:    true,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Random Color", Value: string(backend.ScheduleSourceRandom)},
+							{Name: "Palette Rotation", Value: string(backend.ScheduleSourcePalette)},
+							{Name: "Favorites Rotation", Value: string(backend.ScheduleSourceFavorites)},
+							{Name: "Hue Drift", Value: string(backend.ScheduleSourceHueDrift)},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "interval",
+						Description: "How often the color changes",
+						Required:    true,
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "Hourly", Value: 1},
+							{Name: "Every 6 Hours", Value: 6},
+							{Name: "Every 12 Hours", Value: 12},
+							{Name: "Daily", Value: 24},
+							{Name: "Weekly", Value: 168},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "palette",
+						Description: "The palette to rotate through (monochromatic by default)",
+						Required:    false,
+						Choices:     paletteTypeChoices(),
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "color",
+						Description:  "The base color of the palette or hue drift (current color by default)",
+						Required:     false,
+						Autocomplete: true,
+					},
+					roleUserOption(),
+				},
+			},
+			{
+				Name:        "unschedule",
+				Description: "Stop automatically changing the color of your role",
+				Handler:     command.withTarget(command.executeUnschedule),
+				Options: []*discordgo.ApplicationCommandOption{
+					roleUserOption(),
 				},
 			},
 		},
 	}
+
+	return command
 }
 
-func (r *RoleCommand) Execute(s *discordgo.Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
-	if i.GuildID == "" {
-		return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "This command can only be used in a guild",
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		})
+func roleUserOption() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionUser,
+		Name:        "user",
+		Description: "The user to modify (yourself by default)",
+		Required:    false,
 	}
+}
 
-	ctx := &RoleUpdateContext{
-		ctx:  context.Background(),
-		log:  logger,
-		bot:  s,
-		data: i,
-	}
+// RequiresBackend reports that the command needs the backend to work
+func (r *RoleCommand) RequiresBackend() bool {
+	return true
+}
 
-	if g, err := s.Guild(i.GuildID); err == nil {
-		ctx.guild = g
-	} else {
-		logger.Error("failed to get guild",
-			slog.Any("error", err),
-			slog.String("guild", i.GuildID))
+func (r *RoleCommand) Execute(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+	return r.Dispatch(s, i, logger)
+}
 
-		return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Could not get current guild",
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		})
+// withTarget runs a subcommand on the personal role of the user given in its user option, the caller by default.
+// Only admins can change the role of another user, and not that of another admin.
+func (r *RoleCommand) withTarget(handler func(ctx *RoleUpdateContext, caller, target *discordgo.User, options Options) error) SubcommandHandler {
+	return func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, options Options) error {
+		ctx := &RoleUpdateContext{
+			ctx:   context.Background(),
+			log:   logger,
+			bot:   s,
+			data:  i,
+			guild: i.GuildID,
+		}
+
+		caller := getInteractionUser(i)
+		if caller == nil {
+			return respondWithEphemeralMessage(s, i, "Could not resolve user")
+		}
+
+		target := caller
+
+		if id, given := options.ID("user"); given {
+			// Users missing from the resolved data of the interaction are fetched instead
+			specifiedUser, ok := options.User("user")
+			if !ok {
+				fetched, err := s.User(id)
+				if err != nil {
+					return respondWithEphemeralMessage(s, i, "Could not find user with ID: "+id)
+				}
+
+				specifiedUser = fetched
+			}
+
+			target = specifiedUser
+
+			if target.ID != caller.ID {
+				if !r.isAdminFunction(caller.ID) {
+					return respondWithEphemeralMessage(s, i, "You do not have permission to modify another user's role")
+				}
+
+				if r.isAdminFunction(target.ID) { // maybe don't keep this
+					return respondWithEphemeralMessage(s, i, "You cannot modify another admin's role")
+				}
+			}
+		}
+
+		return handler(ctx, caller, target, options)
 	}
+}
 
-	var (
-		caller *discordgo.User
-		target *discordgo.User
-	)
+// Autocomplete offers the caller's favorites, followed by matching named colors, as choices for the role color
+func (r *RoleCommand) Autocomplete(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+	focused := GetFocusedOption(i.Interaction)
+	if focused == nil || focused.Name != "color" {
+		return respondWithAutocompleteChoices(s, i, nil)
+	}
 
-	caller = i.User
-	if caller == nil {
-		caller = i.Member.User
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+
+	if caller := getInteractionUser(i); caller != nil && i.GuildID != "" {
+		choices = favoriteColorChoices(r.backend, i.GuildID, caller.ID, focused.StringValue(), logger)
 	}
 
-	target = caller
+	input := strings.ToLower(strings.TrimSpace(focused.StringValue()))
 
-	if userOption := GetOptionByName(i.Interaction, "user"); userOption != nil {
-		specifiedUser := userOption.UserValue(s)
+	for _, named := range common.ColorsAndNames {
+		if len(choices) >= maxAutocompleteChoices {
+			break
+		}
 
-		if specifiedUser == nil {
-			return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: "Could not find user with ID: " + userOption.StringValue() + "",
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
-			})
+		if input == "" || !strings.Contains(strings.ToLower(named.Name), input) {
+			continue
 		}
 
-		target = specifiedUser
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  named.Name + " (#" + named.Color + ")",
+			Value: named.Name,
+		})
+	}
 
-		if target.ID != caller.ID {
-			if !r.isAdminFunction(caller.ID) {
-				return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-					Type: discordgo.InteractionResponseChannelMessageWithSource,
-					Data: &discordgo.InteractionResponseData{
-						Content: "You do not have permission to modify another user's role",
-						Flags:   discordgo.MessageFlagsEphemeral,
-					},
-				})
-			}
+	return respondWithAutocompleteChoices(s, i, choices)
+}
 
-			if r.isAdminFunction(target.ID) { // maybe don't keep this
-				return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-					Type: discordgo.InteractionResponseChannelMessageWithSource,
-					Data: &discordgo.InteractionResponseData{
-						Content: "You cannot modify another admin's role",
-						Flags:   discordgo.MessageFlagsEphemeral,
-					},
-				})
-			}
+func (r *RoleCommand) executeSet(ctx *RoleUpdateContext, caller, target *discordgo.User, options Options) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	nameValue, hasName := options.String("name")
+	colorValue, hasColor := options.String("color")
+
+	if !hasName && !hasColor {
+		return respondWithEphemeralMessage(s, i, "Specify a new name or color for the role")
+	}
+
+	var (
+		name  string
+		color *int
+	)
+
+	if hasName {
+		validated, err := validateRoleName(nameValue)
+		if err != nil {
+			return respondWithEphemeralMessage(s, i, "Invalid role name: "+err.Error())
 		}
+
+		name = validated
 	}
 
-	if target == nil {
-		return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Could not resolve target user",
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		})
+	if hasColor {
+		parsed, err := parseRoleColor(colorValue)
+		if err != nil {
+			return respondWithEphemeralMessage(s, i, "Invalid role color: "+err.Error())
+		}
+
+		color = &parsed
+	}
+
+	// Moderated guilds hold changes by members for staff sign-off
+	if settings, required, handled, err := r.checkApproval(ctx, caller); handled {
+		return err
+	} else if required {
+		return r.submitForApproval(ctx, caller, target, settings, name, color)
 	}
 
 	var role *discordgo.Role
 
-	if resolved, err := ctx.resolvePersonalRoleForTarget(caller, target, r); err != nil {
+	if resolved, err := ctx.resolvePersonalRoleForTarget(caller, target, r); err != nil || resolved == nil {
 		return err
 	} else {
 		role = resolved
 	}
 
-	responses := make([]string, 0)
+	var (
+		responses = make([]string, 0)
+		updated   bool
+	)
 
-	if nameOption := GetOptionByName(i.Interaction, "name"); nameOption != nil {
-		err := ctx.updatePersonalRoleName(role, nameOption.StringValue())
+	if hasName {
+		err := ctx.updatePersonalRoleName(role, nameValue)
 		if err == nil {
-			responses = append(responses, "Role name updated to \""+nameOption.StringValue()+"\"")
+			updated = true
+			responses = append(responses, "Role name updated to \""+nameValue+"\"")
 		} else {
 			logger.Error("failed to update role name",
 				slog.Any("error", err),
 				slog.String("role", role.ID),
-				slog.String("name", nameOption.StringValue()))
+				slog.String("name", nameValue))
 
 			responses = append(responses, "Could not update role name")
 		}
 	}
 
-	if colorOption := GetOptionByName(i.Interaction, "color"); colorOption != nil {
-		err := ctx.updatePersonalRoleColor(role, colorOption.StringValue())
+	if hasColor {
+		err := ctx.updatePersonalRoleColor(role, colorValue)
 		if err == nil {
-			responses = append(responses, "Role color updated to \""+colorOption.StringValue()+"\"")
+			updated = true
+			responses = append(responses, "Role color updated to \""+colorValue+"\"")
 		} else {
 			logger.Error("failed to update role color",
 				slog.Any("error", err),
 				slog.String("role", role.ID),
-				slog.String("color", colorOption.StringValue()))
+				slog.String("color", colorValue))
 
 			responses = append(responses, "Could not update role color")
 		}
 	}
 
-	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	// History only holds changes that were made, the role still holds the state from before them
+	if updated {
+		ctx.recordRoleState(target, role, r)
+	}
+
+	return respondWithEphemeralMessage(s, i, strings.Join(responses, "\n"))
+}
+
+func (r *RoleCommand) executeHistory(ctx *RoleUpdateContext, _, target *discordgo.User, _ Options) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	history, err := r.backend.GetHistory(ctx.ctx, ctx.guild, target.ID)
+	if err != nil {
+		logger.Error("failed to get role history",
+			slog.Any("error", err),
+			slog.String("target", target.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not load role history for user: "+target.ID)
+	}
+
+	if len(history) == 0 {
+		return respondWithEphemeralMessage(s, i, "There is no role history for this user yet")
+	}
+
+	colors := make([]int, len(history))
+	for index, state := range history {
+		colors[index] = state.Color
+	}
+
+	imageData, err := imaging.GenerateSwatchStrip(colors)
+	if err != nil {
+		logger.Error("Failed to generate history image", slog.Any("error", err))
+		return respondWithEphemeralMessage(s, i, "Failed to generate history image")
+	}
+
+	return respond(s, i, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: strings.Join(responses, "\n"),
-			Flags:   discordgo.MessageFlagsEphemeral,
+			Flags:  discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{generateHistoryEmbed(target, history)},
+			Files: []*discordgo.File{
+				{
+					Name:   "role_history.png",
+					Reader: bytes.NewReader(imageData),
+				},
+			},
 		},
 	})
 }
 
+func (r *RoleCommand) executeUndo(ctx *RoleUpdateContext, caller, target *discordgo.User, _ Options) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	history, err := r.backend.GetHistory(ctx.ctx, ctx.guild, target.ID)
+	if err != nil {
+		logger.Error("failed to get role history",
+			slog.Any("error", err),
+			slog.String("target", target.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not load role history for user: "+target.ID)
+	}
+
+	if len(history) == 0 {
+		return respondWithEphemeralMessage(s, i, "There is nothing to undo")
+	}
+
+	// Undoing is a change to the previous name and color, held for sign-off like any other
+	if settings, required, handled, err := r.checkApproval(ctx, caller); handled {
+		return err
+	} else if required {
+		return r.submitForApproval(ctx, caller, target, settings, history[0].Name, &history[0].Color)
+	}
+
+	var role *discordgo.Role
+
+	if resolved, err := ctx.resolvePersonalRoleForTarget(caller, target, r); err != nil || resolved == nil {
+		return err
+	} else {
+		role = resolved
+	}
+
+	if err = ctx.applyRoleState(role, history[0]); err != nil {
+		logger.Error("failed to undo role change",
+			slog.Any("error", err),
+			slog.String("role", role.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not undo role change")
+	}
+
+	if _, err = r.backend.PopHistory(ctx.ctx, ctx.guild, target.ID); err != nil {
+		logger.Error("failed to pop role history",
+			slog.Any("error", err),
+			slog.String("target", target.ID))
+	}
+
+	return respondWithEphemeralMessage(s, i, "Role reverted to \""+history[0].Name+"\" ("+common.FormatColorHex(history[0].Color)+")")
+}
+
+func (r *RoleCommand) executeRestore(ctx *RoleUpdateContext, caller, target *discordgo.User, options Options) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	value, _ := options.Int("index")
+	index := int(value)
+
+	history, err := r.backend.GetHistory(ctx.ctx, ctx.guild, target.ID)
+	if err != nil {
+		logger.Error("failed to get role history",
+			slog.Any("error", err),
+			slog.String("target", target.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not load role history for user: "+target.ID)
+	}
+
+	if index < 1 || index > len(history) {
+		return respondWithEphemeralMessage(s, i, fmt.Sprintf("There is no history entry %d", index))
+	}
+
+	state := history[index-1]
+
+	if settings, required, handled, err := r.checkApproval(ctx, caller); handled {
+		return err
+	} else if required {
+		return r.submitForApproval(ctx, caller, target, settings, state.Name, &state.Color)
+	}
+
+	var role *discordgo.Role
+
+	if resolved, err := ctx.resolvePersonalRoleForTarget(caller, target, r); err != nil || resolved == nil {
+		return err
+	} else {
+		role = resolved
+	}
+
+	if err = ctx.applyRoleState(role, state); err != nil {
+		logger.Error("failed to restore role state",
+			slog.Any("error", err),
+			slog.String("role", role.ID),
+			slog.Int("index", index))
+
+		return respondWithEphemeralMessage(s, i, "Could not restore role")
+	}
+
+	// The role still holds the state from before the edit
+	ctx.recordRoleState(target, role, r)
+
+	return respondWithEphemeralMessage(s, i, "Role restored to \""+state.Name+"\" ("+common.FormatColorHex(state.Color)+")")
+}
+
+func (r *RoleCommand) executeSchedule(ctx *RoleUpdateContext, caller, target *discordgo.User, options Options) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	schedule := backend.Schedule{
+		Guild:   ctx.guild,
+		User:    target.ID,
+		Palette: common.PaletteTypeMonochromatic.String(),
+		NextRun: time.Now(),
+	}
+
+	if source, ok := options.String("source"); ok {
+		schedule.Source = backend.ScheduleSource(source)
+	}
+
+	if interval, ok := options.Int("interval"); ok {
+		schedule.Interval = time.Duration(interval) * time.Hour
+	}
+
+	if schedule.Interval <= 0 {
+		return respondWithEphemeralMessage(s, i, "Choose how often the color should change")
+	}
+
+	// Every change of a schedule would need its own sign-off, so members cannot schedule colors in moderated guilds
+	if _, required, handled, err := r.checkApproval(ctx, caller); handled {
+		return err
+	} else if required {
+		return respondWithEphemeralMessage(s, i, "Role changes need staff approval in this server, so color schedules are not available")
+	}
+
+	if palette, ok := options.String("palette"); ok {
+		schedule.Palette = palette
+	}
+
+	// The base color defaults to the current color of the role
+	var baseColor *int
+
+	if value, ok := options.String("color"); ok {
+		color, err := parseRoleColor(value)
+		if err != nil {
+			return respondWithEphemeralMessage(s, i, "Invalid base color: "+err.Error())
+		}
+
+		baseColor = &color
+	}
+
+	if schedule.Source == backend.ScheduleSourceFavorites {
+		favorites, err := r.backend.GetFavorites(ctx.ctx, ctx.guild, target.ID)
+		if err != nil || len(favorites) == 0 {
+			return respondWithEphemeralMessage(s, i, "Save some colors with `/favorites add` before rotating through favorites")
+		}
+	}
+
+	var role *discordgo.Role
+
+	if resolved, err := ctx.resolvePersonalRoleForTarget(caller, target, r); err != nil || resolved == nil {
+		return err
+	} else {
+		role = resolved
+	}
+
+	schedule.BaseColor = role.Color
+	if baseColor != nil {
+		schedule.BaseColor = *baseColor
+	}
+
+	if err := r.backend.SetSchedule(ctx.ctx, schedule); err != nil {
+		logger.Error("failed to save schedule",
+			slog.Any("error", err),
+			slog.String("target", target.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not save schedule")
+	}
+
+	every := "hour"
+	if hours := int(schedule.Interval.Hours()); hours > 1 {
+		every = fmt.Sprintf("%d hours", hours)
+	}
+
+	return respondWithEphemeralMessage(s, i, "Role color will now change every "+every+", use `/role unschedule` to stop")
+}
+
+func (r *RoleCommand) executeUnschedule(ctx *RoleUpdateContext, _, target *discordgo.User, _ Options) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	schedule, err := r.backend.GetSchedule(ctx.ctx, ctx.guild, target.ID)
+	if err == nil && schedule == nil {
+		return respondWithEphemeralMessage(s, i, "There is no color schedule for this user")
+	}
+
+	if err == nil {
+		err = r.backend.DeleteSchedule(ctx.ctx, ctx.guild, target.ID)
+	}
+
+	if err != nil {
+		logger.Error("failed to remove schedule",
+			slog.Any("error", err),
+			slog.String("target", target.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not remove schedule")
+	}
+
+	return respondWithEphemeralMessage(s, i, "Role color schedule stopped")
+}
+
+func generateHistoryEmbed(target *discordgo.User, history []backend.RoleState) *discordgo.MessageEmbed {
+	lines := make([]string, len(history))
+
+	for index, state := range history {
+		lines[index] = fmt.Sprintf("`%-2d` **%s** `%s` <t:%d:R>",
+			index+1, state.Name, common.FormatColorHex(state.Color), state.Time.Unix())
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       "Role History",
+		Description: fmt.Sprintf("Previous roles of <@%s>, most recent first", target.ID),
+		Color:       history[0].Color,
+		Fields:      splitEmbedFields(fmt.Sprintf("Entries (%d)", len(history)), lines),
+		Image: &discordgo.MessageEmbedImage{
+			URL: "attachment://role_history.png",
+		},
+	}
+}
+
 type RoleUpdateContext struct {
 	ctx context.Context
 	log *slog.Logger
 
-	bot   *discordgo.Session
+	bot   Session
 	data  *discordgo.InteractionCreate
-	guild *discordgo.Guild
+	guild string
 }
 
 func (c *RoleUpdateContext) resolvePersonalRoleForTarget(caller, target *discordgo.User, r *RoleCommand) (*discordgo.Role, error) {
 	var role *discordgo.Role
 
-	if existingPersonalRoleID, err := r.backend.GetRole(c.ctx, c.guild.ID, target.ID); err != nil {
+	// Another instance may be creating the role of the same user, creating it twice would leave one behind
+	lockCtx, cancel := context.WithTimeout(c.ctx, roleLockTimeout)
+	defer cancel()
+
+	unlock, err := r.coordinator.Lock(lockCtx, backend.RoleLock(c.guild, target.ID))
+	if err != nil {
+		c.log.Error("failed to lock role for user",
+			slog.Any("error", err),
+			slog.String("target", target.ID),
+			slog.String("caller", caller.ID))
+
+		return nil, respondWithEphemeralMessage(c.bot, c.data, "The role of this user is being changed, please try again")
+	}
+	defer unlock()
+
+	if existingPersonalRoleID, err := r.backend.GetRole(c.ctx, c.guild, target.ID); err != nil {
 		c.log.Error("failed to get role for user",
 			slog.Any("error", err),
 			slog.String("target", target.ID),
 			slog.String("caller", caller.ID))
 
-		return nil, c.bot.InteractionRespond(c.data.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "Could not resolve role for user: " + target.ID,
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		})
+		return nil, respondWithEphemeralMessage(c.bot, c.data, "Could not resolve role for user: "+target.ID)
 	} else if existingPersonalRoleID != "" {
 
-		for _, guildRole := range c.guild.Roles {
-			if guildRole.ID == existingPersonalRoleID {
-				role = guildRole
-				break
-			}
+		if role, err = c.findGuildRole(existingPersonalRoleID, r); err != nil {
+			c.log.Error("failed to get guild roles",
+				slog.Any("error", err),
+				slog.String("target", target.ID),
+				slog.String("caller", caller.ID))
+
+			return nil, respondWithEphemeralMessage(c.bot, c.data, "Could not get current guild")
 		}
 
 		if role == nil {
 			c.log.Error("failed to find role for user, falling back to creating a new one",
 				slog.String("target", target.ID),
 				slog.String("caller", caller.ID))
+
+			if _, err := r.backend.DeleteRole(c.ctx, c.guild, target.ID); err != nil {
+				c.log.Error("failed to remove missing role for user",
+					slog.Any("error", err),
+					slog.String("target", target.ID),
+					slog.String("caller", caller.ID))
+			}
 		}
 	}
 
 	if role == nil {
-		newRole, err := c.bot.GuildRoleCreate(c.guild.ID,
+		newRole, err := c.bot.GuildRoleCreate(c.guild,
 			&discordgo.RoleParams{
 				Name: target.GlobalName + "'s Role",
 			},
@@ -242,13 +698,7 @@ func (c *RoleUpdateContext) resolvePersonalRoleForTarget(caller, target *discord
 				slog.String("target", target.ID),
 				slog.String("caller", caller.ID))
 
-			return nil, c.bot.InteractionRespond(c.data.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: "Could not create role for user: " + target.ID,
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
-			})
+			return nil, respondWithEphemeralMessage(c.bot, c.data, "Could not create role for user: "+target.ID)
 		}
 
 		role = newRole
@@ -258,43 +708,65 @@ func (c *RoleUpdateContext) resolvePersonalRoleForTarget(caller, target *discord
 			slog.String("target", target.ID),
 			slog.String("role", role.ID))
 
-		if err := r.backend.SetRole(c.ctx, c.guild.ID, target.ID, role.ID); err != nil {
+		if err := r.backend.SetRole(c.ctx, c.guild, target.ID, role.ID); err != nil {
 			c.log.Error("failed to set role for user",
 				slog.Any("error", err),
 				slog.String("target", target.ID),
 				slog.String("caller", caller.ID))
 
-			return nil, c.bot.InteractionRespond(c.data.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: "Could not store role for user: " + target.ID,
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
-			})
+			return nil, respondWithEphemeralMessage(c.bot, c.data, "Could not store role for user: "+target.ID)
 		}
 
-		if err := c.bot.GuildMemberRoleAdd(c.guild.ID, target.ID, role.ID); err != nil {
+		if err := c.bot.GuildMemberRoleAdd(c.guild, target.ID, role.ID); err != nil {
 			c.log.Error("failed to add role to user",
 				slog.Any("error", err),
 				slog.String("target", target.ID),
 				slog.String("caller", caller.ID))
 
-			return nil, c.bot.InteractionRespond(c.data.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: "Could not add role to user: " + target.ID,
-					Flags:   discordgo.MessageFlagsEphemeral,
-				},
-			})
+			return nil, respondWithEphemeralMessage(c.bot, c.data, "Could not add role to user: "+target.ID)
 		}
 	}
 
 	return role, nil
 }
 
-func (c *RoleUpdateContext) updatePersonalRoleName(role *discordgo.Role, name string) error {
+// findGuildRole returns a role of the guild, or nil when the guild does not have it. Discord is asked when the
+// cache does not have the role, a role just created by another instance may not have reached the cache of this one yet.
+func (c *RoleUpdateContext) findGuildRole(id string, r *RoleCommand) (*discordgo.Role, error) {
+	if r.roles != nil {
+		if roles, cached := r.roles.CachedRoles(c.guild); cached {
+			if role := findRole(roles, id); role != nil {
+				return role, nil
+			}
+		}
+	}
+
+	roles, err := c.bot.GuildRoles(c.guild)
+	if err != nil {
+		return nil, err
+	}
+
+	return findRole(roles, id), nil
+}
+
+func findRole(roles []*discordgo.Role, id string) *discordgo.Role {
+	for _, role := range roles {
+		if role.ID == id {
+			return role
+		}
+	}
 
-	_, err := c.bot.GuildRoleEdit(c.guild.ID, role.ID, &discordgo.RoleParams{
+	return nil
+}
+
+func (c *RoleUpdateContext) updatePersonalRoleName(role *discordgo.Role, input string) error {
+
+	name, err := validateRoleName(input)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.bot.GuildRoleEdit(c.guild, role.ID, &discordgo.RoleParams{
 		Name: name,
 	})
 
@@ -303,14 +775,69 @@ func (c *RoleUpdateContext) updatePersonalRoleName(role *discordgo.Role, name st
 
 func (c *RoleUpdateContext) updatePersonalRoleColor(role *discordgo.Role, input string) error {
 
-	color, err := common.ParseTextToColorInt(input)
+	color, err := parseRoleColor(input)
 	if err != nil {
 		return err
 	}
 
-	_, err = c.bot.GuildRoleEdit(c.guild.ID, role.ID, &discordgo.RoleParams{
+	_, err = c.bot.GuildRoleEdit(c.guild, role.ID, &discordgo.RoleParams{
 		Color: &color,
 	})
 
 	return err
 }
+
+func (c *RoleUpdateContext) recordRoleState(target *discordgo.User, role *discordgo.Role, r *RoleCommand) {
+	state := backend.RoleState{
+		Name:  role.Name,
+		Color: role.Color,
+		Time:  time.Now(),
+	}
+
+	if err := r.backend.PushHistory(c.ctx, c.guild, target.ID, state); err != nil {
+		c.log.Error("failed to record role history",
+			slog.Any("error", err),
+			slog.String("target", target.ID),
+			slog.String("role", role.ID))
+	}
+}
+
+func (c *RoleUpdateContext) applyRoleState(role *discordgo.Role, state backend.RoleState) error {
+	color := state.Color
+
+	_, err := c.bot.GuildRoleEdit(c.guild, role.ID, &discordgo.RoleParams{
+		Name:  state.Name,
+		Color: &color,
+	})
+
+	return err
+}
+
+// validateRoleName trims a requested role name and checks that Discord will accept it
+func validateRoleName(input string) (string, error) {
+	name := strings.TrimSpace(input)
+
+	if name == "" {
+		return "", roleNameEmpty
+	}
+
+	if utf8.RuneCountInString(name) > maxRoleNameLength {
+		return "", roleNameTooLong
+	}
+
+	return name, nil
+}
+
+// parseRoleColor parses a requested role color and checks that Discord will accept it
+func parseRoleColor(input string) (int, error) {
+	color, err := common.ParseTextToColorInt(strings.TrimSpace(input))
+	if err != nil {
+		return 0, err
+	}
+
+	if color < 0 || color > 0xFFFFFF {
+		return 0, roleColorOutOfRange
+	}
+
+	return color, nil
+}
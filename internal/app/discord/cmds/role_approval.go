@@ -0,0 +1,497 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// approvalNamespace is the custom ID namespace of the staff approval buttons
+// Format: approval:<action>:<id>
+const approvalNamespace = "approval"
+
+// approvalModalNamespace is the custom ID namespace of the modal used to edit a request before approving it
+// Format: approval_edit:<id>
+const approvalModalNamespace = "approval_edit"
+
+const (
+	approvalActionApprove = "approve"
+	approvalActionDeny    = "deny"
+	approvalActionEdit    = "edit"
+)
+
+// interactionTokenLifetime is how long Discord accepts follow-ups for an interaction
+const interactionTokenLifetime = 15 * time.Minute
+
+// approvalRequired reports whether changes by the caller are held for staff sign-off in the guild, changes by
+// admins never are
+func approvalRequired(ctx context.Context, settingsBackend backend.SettingsBackend, guild string, caller string, isAdmin func(id string) bool) (backend.GuildSettings, bool, error) {
+	if isAdmin(caller) {
+		return backend.GuildSettings{}, false, nil
+	}
+
+	settings, err := settingsBackend.GetGuildSettings(ctx, guild)
+	if err != nil {
+		return settings, false, err
+	}
+
+	return settings, settings.ApprovalRequired, nil
+}
+
+// checkApproval loads whether the changes of the caller need staff approval, replying to the interaction when the
+// settings cannot be loaded. Nothing more should be done when it returns handled.
+func (r *RoleCommand) checkApproval(ctx *RoleUpdateContext, caller *discordgo.User) (settings backend.GuildSettings, required bool, handled bool, err error) {
+	settings, required, err = approvalRequired(ctx.ctx, r.backend, ctx.guild, caller.ID, r.isAdminFunction)
+	if err != nil {
+		ctx.log.Error("failed to get guild settings",
+			slog.Any("error", err),
+			slog.String("guild", ctx.guild))
+
+		return settings, false, true, respondWithEphemeralMessage(ctx.bot, ctx.data, "Could not load guild settings")
+	}
+
+	return settings, required, false, nil
+}
+
+// submitForApproval queues a role change for staff sign-off instead of applying it
+func (r *RoleCommand) submitForApproval(ctx *RoleUpdateContext, caller, target *discordgo.User, settings backend.GuildSettings, name string, color *int) error {
+	s, i, logger := ctx.bot, ctx.data, ctx.log
+
+	if settings.ApprovalChannel == "" {
+		return respondWithEphemeralMessage(s, i, "Role changes need staff approval, but no approval channel is set up")
+	}
+
+	now := time.Now()
+
+	request := backend.ApprovalRequest{
+		ID:        uuid.New().String(),
+		Guild:     ctx.guild,
+		User:      target.ID,
+		Requester: caller.ID,
+		Name:      name,
+		Color:     color,
+		Channel:   settings.ApprovalChannel,
+		AppID:     i.AppID,
+		Token:     i.Token,
+		CreatedAt: now,
+		ExpiresAt: now.Add(backend.ApprovalExpiry),
+	}
+
+	message, err := s.ChannelMessageSendComplex(settings.ApprovalChannel, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{generateApprovalEmbed(request, "")},
+		Components: approvalButtons(request.ID),
+		AllowedMentions: &discordgo.MessageAllowedMentions{
+			Parse: []discordgo.AllowedMentionType{},
+		},
+	})
+	if err != nil {
+		logger.Error("failed to post approval request",
+			slog.Any("error", err),
+			slog.String("channel", settings.ApprovalChannel))
+
+		return respondWithEphemeralMessage(s, i, "Could not submit the change for approval")
+	}
+
+	request.Message = message.ID
+
+	if err = r.backend.SetApproval(ctx.ctx, request); err != nil {
+		logger.Error("failed to store approval request",
+			slog.Any("error", err),
+			slog.String("request", request.ID))
+
+		if err = s.ChannelMessageDelete(settings.ApprovalChannel, message.ID); err != nil {
+			logger.Error("failed to delete unstored approval request",
+				slog.Any("error", err),
+				slog.String("request", request.ID))
+		}
+
+		return respondWithEphemeralMessage(s, i, "Could not submit the change for approval")
+	}
+
+	return respondWithEphemeralMessage(s, i, fmt.Sprintf("Your change has been sent to staff for approval, it expires <t:%d:R>", request.ExpiresAt.Unix()))
+}
+
+// ComponentHandlers returns the handler of the staff approval buttons
+func (r *RoleCommand) ComponentHandlers() map[string]ComponentHandler {
+	return map[string]ComponentHandler{approvalNamespace: r.handleApprovalButton}
+}
+
+// ModalHandlers returns the handler of the modal used to edit a request before approving it
+func (r *RoleCommand) ModalHandlers() map[string]ComponentHandler {
+	return map[string]ComponentHandler{approvalModalNamespace: r.handleApprovalModal}
+}
+
+// handleApprovalButton handles the approve, deny and edit buttons of an approval request
+func (r *RoleCommand) handleApprovalButton(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, args ComponentArgs) error {
+	action, err := args.String(0)
+	if err != nil {
+		return err
+	}
+
+	id, err := args.String(1)
+	if err != nil || i.GuildID == "" {
+		return ComponentInvalid
+	}
+
+	if !r.isStaff(i) {
+		return Reply("Only staff can review role changes")
+	}
+
+	request, err := r.findPendingApproval(s, i, logger, id)
+	if err != nil || request == nil {
+		return err
+	}
+
+	switch action {
+	case approvalActionApprove:
+		return r.approve(s, i, logger, request)
+	case approvalActionDeny:
+		return r.deny(s, i, logger, request)
+	case approvalActionEdit:
+		return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseModal,
+			Data: &discordgo.InteractionResponseData{
+				CustomID: ComponentID(approvalModalNamespace, request.ID),
+				Title:    "Edit Role Change",
+				Components: []discordgo.MessageComponent{
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.TextInput{
+								CustomID:  "name",
+								Label:     "Name (leave empty to keep the current name)",
+								Style:     discordgo.TextInputShort,
+								Value:     request.Name,
+								Required:  false,
+								MaxLength: maxRoleNameLength,
+							},
+						},
+					},
+					discordgo.ActionsRow{
+						Components: []discordgo.MessageComponent{
+							discordgo.TextInput{
+								CustomID: "color",
+								Label:    "Color (leave empty to keep the current color)",
+								Style:    discordgo.TextInputShort,
+								Value:    approvalColorInput(request),
+								Required: false,
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+
+	return ComponentInvalid
+}
+
+// handleApprovalModal approves a request with the name and color entered by staff
+func (r *RoleCommand) handleApprovalModal(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, args ComponentArgs) error {
+	data := i.ModalSubmitData()
+
+	id, err := args.String(0)
+	if err != nil {
+		return err
+	}
+
+	if !r.isStaff(i) {
+		return Reply("Only staff can review role changes")
+	}
+
+	request, err := r.findPendingApproval(s, i, logger, id)
+	if err != nil || request == nil {
+		return err
+	}
+
+	request.Name, request.Color = "", nil
+
+	for _, row := range data.Components {
+		actionsRow, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+
+		for _, component := range actionsRow.Components {
+			input, ok := component.(*discordgo.TextInput)
+			if !ok || strings.TrimSpace(input.Value) == "" {
+				continue
+			}
+
+			switch input.CustomID {
+			case "name":
+				name, err := validateRoleName(input.Value)
+				if err != nil {
+					return respondWithEphemeralMessage(s, i, "Invalid role name: "+err.Error())
+				}
+
+				request.Name = name
+			case "color":
+				color, err := parseRoleColor(input.Value)
+				if err != nil {
+					return respondWithEphemeralMessage(s, i, "Invalid role color: "+err.Error())
+				}
+
+				request.Color = &color
+			}
+		}
+	}
+
+	if request.Name == "" && request.Color == nil {
+		return respondWithEphemeralMessage(s, i, "Enter a name or color to approve, or deny the request instead")
+	}
+
+	return r.approve(s, i, logger, request)
+}
+
+// findPendingApproval loads an approval request, closing the staff message when it is gone or has expired
+func (r *RoleCommand) findPendingApproval(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, id string) (*backend.ApprovalRequest, error) {
+	request, err := r.backend.GetApproval(context.Background(), i.GuildID, id)
+	if err != nil {
+		logger.Error("failed to get approval request",
+			slog.Any("error", err),
+			slog.String("request", id))
+
+		return nil, respondWithEphemeralMessage(s, i, "Could not load the approval request")
+	}
+
+	if request == nil {
+		return nil, respondWithUpdatedMessage(s, i, "This request is no longer pending")
+	}
+
+	if !request.ExpiresAt.After(time.Now()) {
+		ExpireApproval(s, r.backend, logger, *request)
+		return nil, respondWithEphemeralMessage(s, i, "This request has expired")
+	}
+
+	return request, nil
+}
+
+func (r *RoleCommand) approve(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, request *backend.ApprovalRequest) error {
+	ctx := &RoleUpdateContext{
+		ctx:   context.Background(),
+		log:   logger,
+		bot:   s,
+		data:  i,
+		guild: request.Guild,
+	}
+
+	var target *discordgo.User
+
+	caller, err := s.User(request.Requester)
+	if err == nil {
+		target, err = s.User(request.User)
+	}
+
+	if err != nil {
+		logger.Error("failed to get users of approval request",
+			slog.Any("error", err),
+			slog.String("request", request.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not find the member of this request")
+	}
+
+	role, err := ctx.resolvePersonalRoleForTarget(caller, target, r)
+	if err != nil || role == nil {
+		return err
+	}
+
+	params := &discordgo.RoleParams{Name: request.Name, Color: request.Color}
+	if _, err = s.GuildRoleEdit(request.Guild, role.ID, params); err != nil {
+		logger.Error("failed to apply approved role change",
+			slog.Any("error", err),
+			slog.String("role", role.ID),
+			slog.String("request", request.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not apply the role change")
+	}
+
+	ctx.recordRoleState(target, role, r)
+
+	reviewer := getInteractionUser(i)
+
+	if err = r.backend.DeleteApproval(ctx.ctx, request.Guild, request.ID); err != nil {
+		logger.Error("failed to remove approval request",
+			slog.Any("error", err),
+			slog.String("request", request.ID))
+	}
+
+	notifyRequester(s, logger, *request, "Your role change "+describeApproval(*request)+" was approved")
+
+	return respondWithClosedApproval(s, i, *request, "Approved by <@"+reviewer.ID+">")
+}
+
+func (r *RoleCommand) deny(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, request *backend.ApprovalRequest) error {
+	if err := r.backend.DeleteApproval(context.Background(), request.Guild, request.ID); err != nil {
+		logger.Error("failed to remove approval request",
+			slog.Any("error", err),
+			slog.String("request", request.ID))
+
+		return respondWithEphemeralMessage(s, i, "Could not deny the request")
+	}
+
+	reviewer := getInteractionUser(i)
+
+	notifyRequester(s, logger, *request, "Your role change "+describeApproval(*request)+" was denied by staff")
+
+	return respondWithClosedApproval(s, i, *request, "Denied by <@"+reviewer.ID+">")
+}
+
+// isStaff reports whether the user of an interaction may review role changes
+func (r *RoleCommand) isStaff(i *discordgo.InteractionCreate) bool {
+	if user := getInteractionUser(i); user != nil && r.isAdminFunction(user.ID) {
+		return true
+	}
+
+	return i.Member != nil && i.Member.Permissions&discordgo.PermissionManageRoles != 0
+}
+
+// ExpireApproval removes an approval request that was not reviewed in time, closing its staff message and
+// letting the requester know
+func ExpireApproval(s Session, approvalBackend backend.ApprovalBackend, logger *slog.Logger, request backend.ApprovalRequest) {
+	if err := approvalBackend.DeleteApproval(context.Background(), request.Guild, request.ID); err != nil {
+		logger.Error("failed to remove expired approval request",
+			slog.Any("error", err),
+			slog.String("request", request.ID))
+		return
+	}
+
+	if request.Channel != "" && request.Message != "" {
+		empty := make([]discordgo.MessageComponent, 0)
+
+		_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:         request.Message,
+			Channel:    request.Channel,
+			Embeds:     &[]*discordgo.MessageEmbed{generateApprovalEmbed(request, "Expired without review")},
+			Components: &empty,
+		})
+		if err != nil {
+			logger.Error("failed to close expired approval request",
+				slog.Any("error", err),
+				slog.String("request", request.ID))
+		}
+	}
+
+	notifyRequester(s, logger, request, "Your role change "+describeApproval(request)+" expired before staff reviewed it")
+}
+
+// notifyRequester tells the member who requested a role change about its outcome, by DM or, if they do not
+// accept DMs, by a follow-up to their command while Discord still allows it
+func notifyRequester(s Session, logger *slog.Logger, request backend.ApprovalRequest, content string) {
+	channel, err := s.UserChannelCreate(request.Requester)
+	if err == nil {
+		_, err = s.ChannelMessageSend(channel.ID, content)
+	}
+
+	if err != nil && time.Since(request.CreatedAt) < interactionTokenLifetime {
+		_, err = s.FollowupMessageCreate(&discordgo.Interaction{AppID: request.AppID, Token: request.Token}, false, &discordgo.WebhookParams{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		})
+	}
+
+	if err != nil {
+		logger.Error("failed to notify requester",
+			slog.Any("error", err),
+			slog.String("request", request.ID),
+			slog.String("requester", request.Requester))
+	}
+}
+
+func respondWithClosedApproval(s Session, i *discordgo.InteractionCreate, request backend.ApprovalRequest, status string) error {
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{generateApprovalEmbed(request, status)},
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+}
+
+func approvalButtons(id string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Approve",
+					Style:    discordgo.SuccessButton,
+					CustomID: ComponentID(approvalNamespace, approvalActionApprove, id),
+				},
+				discordgo.Button{
+					Label:    "Deny",
+					Style:    discordgo.DangerButton,
+					CustomID: ComponentID(approvalNamespace, approvalActionDeny, id),
+				},
+				discordgo.Button{
+					Label:    "Edit",
+					Style:    discordgo.SecondaryButton,
+					CustomID: ComponentID(approvalNamespace, approvalActionEdit, id),
+				},
+			},
+		},
+	}
+}
+
+func generateApprovalEmbed(request backend.ApprovalRequest, status string) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       "Role Change Request",
+		Description: fmt.Sprintf("<@%s> requested a change to the role of <@%s>", request.Requester, request.User),
+		Fields:      make([]*discordgo.MessageEmbedField, 0),
+	}
+
+	if request.Name != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Name",
+			Value:  request.Name,
+			Inline: true,
+		})
+	}
+
+	if request.Color != nil {
+		embed.Color = *request.Color
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Color",
+			Value:  "`" + common.FormatColorHex(*request.Color) + "`",
+			Inline: true,
+		})
+	}
+
+	if status == "" {
+		status = fmt.Sprintf("Pending, expires <t:%d:R>", request.ExpiresAt.Unix())
+	}
+
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+		Name:   "Status",
+		Value:  status,
+		Inline: false,
+	})
+
+	return embed
+}
+
+func describeApproval(request backend.ApprovalRequest) string {
+	changes := make([]string, 0, 2)
+
+	if request.Name != "" {
+		changes = append(changes, "name \""+request.Name+"\"")
+	}
+
+	if request.Color != nil {
+		changes = append(changes, "color "+common.FormatColorHex(*request.Color))
+	}
+
+	return "(" + strings.Join(changes, ", ") + ")"
+}
+
+func approvalColorInput(request *backend.ApprovalRequest) string {
+	if request.Color == nil {
+		return ""
+	}
+
+	return common.FormatColorHex(*request.Color)
+}
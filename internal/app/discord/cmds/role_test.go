@@ -0,0 +1,461 @@
+package cmds
+
+import (
+	"context"
+	"emperror.dev/errors"
+	appbackend "github.com/Sxtanna/chromatic_curator/internal/app/backend"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds/cmdstest"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var _ Session = (*cmdstest.Session)(nil)
+
+// roleInteraction returns an invocation of a role subcommand by the caller in the test guild
+func roleInteraction(caller string, subcommand string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	interaction := newTestInteraction("guild", caller)
+	interaction.Data = discordgo.ApplicationCommandInteractionData{
+		Name: "role",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{
+			{Type: discordgo.ApplicationCommandOptionSubCommand, Name: subcommand, Options: options},
+		},
+		Resolved: &discordgo.ApplicationCommandInteractionDataResolved{
+			Users: map[string]*discordgo.User{"admin": {ID: "admin"}, "other": {ID: "other"}, "member": {ID: "member"}},
+		},
+	}
+
+	return interaction
+}
+
+func stringOption(name string, value string) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionString, Name: name, Value: value}
+}
+
+func userOption(id string) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Type: discordgo.ApplicationCommandOptionUser, Name: "user", Value: id}
+}
+
+func TestRoleCommand(t *testing.T) {
+	existing := &discordgo.Role{ID: "existing", Name: "Existing", Color: 0x112233}
+
+	tests := []struct {
+		name        string
+		setup       func(session *cmdstest.Session, store backend.Backend)
+		interaction *discordgo.InteractionCreate
+		reply       string
+		check       func(t *testing.T, session *cmdstest.Session, store backend.Backend)
+	}{
+		{
+			name:        "set creates a role when the member has none",
+			interaction: roleInteraction("member", "set", stringOption("color", "#FF0000")),
+			reply:       "Role color updated",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				role, _ := store.GetRole(context.Background(), "guild", "member")
+				if role == "" || !slices.Contains(session.MemberRoles("guild", "member"), role) {
+					t.Errorf("expected a stored role given to the member, got %q", role)
+				}
+
+				if roles := session.Roles["guild"]; len(roles) != 1 || roles[0].Color != 0xFF0000 {
+					t.Errorf("expected the created role to be colored, got %v", roles)
+				}
+			},
+		},
+		{
+			name: "set edits the role in the guild state",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				session.AddGuild("guild", existing)
+				_ = store.SetRole(context.Background(), "guild", "member", existing.ID)
+			},
+			interaction: roleInteraction("member", "set", stringOption("name", "Renamed")),
+			reply:       `Role name updated to "Renamed"`,
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if calls := session.Calls("Guild", "GuildRoles", "GuildRoleCreate"); len(calls) != 0 {
+					t.Errorf("expected the role to be found in the cached guild roles, got %v", calls)
+				}
+
+				history, _ := store.GetHistory(context.Background(), "guild", "member")
+				if len(history) != 1 || history[0].Name != existing.Name {
+					t.Errorf("expected the previous role state in the history, got %v", history)
+				}
+			},
+		},
+		{
+			name: "set fetches a role missing from the guild state",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				session.AddGuild("guild")
+				session.Roles["guild"] = []*discordgo.Role{existing}
+				_ = store.SetRole(context.Background(), "guild", "member", existing.ID)
+			},
+			interaction: roleInteraction("member", "set", stringOption("color", "blue")),
+			reply:       "Role color updated",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if calls := session.Calls("GuildRoles"); len(calls) != 1 {
+					t.Errorf("expected the roles to be fetched once, got %v", calls)
+				}
+
+				if calls := session.Calls("GuildRoleCreate"); len(calls) != 0 {
+					t.Errorf("expected no role to be created, got %v", calls)
+				}
+			},
+		},
+		{
+			name: "set replaces a role deleted from the guild",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				_ = store.SetRole(context.Background(), "guild", "member", "deleted")
+			},
+			interaction: roleInteraction("member", "set", stringOption("color", "blue")),
+			reply:       "Role color updated",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				role, _ := store.GetRole(context.Background(), "guild", "member")
+				if role == "" || role == "deleted" {
+					t.Errorf("expected the deleted role to be replaced, got %q", role)
+				}
+			},
+		},
+		{
+			name: "set reports a role that cannot be created",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				session.Errors["GuildRoleCreate"] = errors.New("missing permissions")
+			},
+			interaction: roleInteraction("member", "set", stringOption("color", "blue")),
+			reply:       "Could not create role for user: member",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if role, _ := store.GetRole(context.Background(), "guild", "member"); role != "" {
+					t.Errorf("expected no role to be stored, got %q", role)
+				}
+			},
+		},
+		{
+			name: "set reports a role that cannot be given",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				session.Errors["GuildMemberRoleAdd"] = errors.New("missing permissions")
+			},
+			interaction: roleInteraction("member", "set", stringOption("color", "blue")),
+			reply:       "Could not add role to user: member",
+		},
+		{
+			name:        "set refuses an invalid color",
+			interaction: roleInteraction("member", "set", stringOption("color", "not a color")),
+			reply:       "Invalid role color",
+		},
+		{
+			name:        "set requires a name or color",
+			interaction: roleInteraction("member", "set"),
+			reply:       "Specify a new name or color",
+		},
+		{
+			name: "set holds changes for approval in moderated guilds",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				_ = store.SetGuildSettings(context.Background(), "guild", backend.GuildSettings{ApprovalRequired: true, ApprovalChannel: "approvals"})
+			},
+			interaction: roleInteraction("member", "set", stringOption("color", "blue")),
+			reply:       "sent to staff for approval",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if calls := session.Calls("ChannelMessageSendComplex"); len(calls) != 1 || calls[0].Args[0] != "approvals" {
+					t.Errorf("expected the request to be posted to the approval channel, got %v", calls)
+				}
+
+				if calls := session.Calls("GuildRoleCreate", "GuildRoleEdit"); len(calls) != 0 {
+					t.Errorf("expected the role to be left alone, got %v", calls)
+				}
+			},
+		},
+		{
+			name: "undo holds the change for approval in moderated guilds",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				moderate(store)
+				session.AddGuild("guild", existing)
+				_ = store.SetRole(context.Background(), "guild", "member", existing.ID)
+				_ = store.PushHistory(context.Background(), "guild", "member", backend.RoleState{Name: "Before", Color: 0x00FF00, Time: time.Now()})
+			},
+			interaction: roleInteraction("member", "undo"),
+			reply:       "sent to staff for approval",
+			check:       expectHeldForApproval("Before", 0x00FF00),
+		},
+		{
+			name: "restore holds the change for approval in moderated guilds",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				moderate(store)
+				session.AddGuild("guild", existing)
+				_ = store.SetRole(context.Background(), "guild", "member", existing.ID)
+				_ = store.PushHistory(context.Background(), "guild", "member", backend.RoleState{Name: "Before", Color: 0x00FF00, Time: time.Now()})
+			},
+			interaction: roleInteraction("member", "restore", intOption("index", 1)),
+			reply:       "sent to staff for approval",
+			check:       expectHeldForApproval("Before", 0x00FF00),
+		},
+		{
+			name: "schedule is refused in moderated guilds",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				moderate(store)
+			},
+			interaction: roleInteraction("member", "schedule", intOption("interval", 1), stringOption("color", "#336699")),
+			reply:       "color schedules are not available",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if schedule, _ := store.GetSchedule(context.Background(), "guild", "member"); schedule != nil {
+					t.Errorf("expected no schedule to be saved, got %v", schedule)
+				}
+			},
+		},
+		{
+			name: "admins schedule colors in moderated guilds",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				moderate(store)
+			},
+			interaction: roleInteraction("admin", "schedule", intOption("interval", 1)),
+			reply:       "every hour",
+		},
+		{
+			name:        "members cannot change the role of others",
+			interaction: roleInteraction("member", "set", stringOption("color", "blue"), userOption("other")),
+			reply:       "do not have permission to modify another user's role",
+		},
+		{
+			name: "admins cannot change the role of other admins",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				session.Users["admin2"] = &discordgo.User{ID: "admin2"}
+			},
+			interaction: roleInteraction("admin", "set", stringOption("color", "blue"), userOption("admin2")),
+			reply:       "cannot modify another admin's role",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if calls := session.Calls("User"); len(calls) != 1 {
+					t.Errorf("expected the unresolved user to be fetched, got %v", calls)
+				}
+			},
+		},
+		{
+			name:        "admins can change the role of members",
+			interaction: roleInteraction("admin", "set", stringOption("color", "blue"), userOption("other")),
+			reply:       "Role color updated",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if role, _ := store.GetRole(context.Background(), "guild", "other"); role == "" {
+					t.Error("expected the role to be created for the target")
+				}
+			},
+		},
+		{
+			name:        "an unknown target is reported",
+			interaction: roleInteraction("admin", "set", stringOption("color", "blue"), userOption("unknown")),
+			reply:       "Could not find user with ID: unknown",
+		},
+		{
+			name: "roles that cannot be loaded are reported",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				session.Errors["GuildRoles"] = errors.New("unavailable")
+				_ = store.SetRole(context.Background(), "guild", "member", existing.ID)
+			},
+			interaction: roleInteraction("member", "set", stringOption("color", "blue")),
+			reply:       "Could not get current guild",
+		},
+		{
+			name:        "history without entries",
+			interaction: roleInteraction("member", "history"),
+			reply:       "no role history",
+		},
+		{
+			name:        "undo without history",
+			interaction: roleInteraction("member", "undo"),
+			reply:       "nothing to undo",
+		},
+		{
+			name: "a failed set leaves the history alone",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				session.AddGuild("guild", existing)
+				session.Errors["GuildRoleEdit"] = errors.New("missing permissions")
+				_ = store.SetRole(context.Background(), "guild", "member", existing.ID)
+			},
+			interaction: roleInteraction("member", "set", stringOption("color", "blue")),
+			reply:       "Could not update role color",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if history, _ := store.GetHistory(context.Background(), "guild", "member"); len(history) != 0 {
+					t.Errorf("expected no history for a change that was not made, got %v", history)
+				}
+			},
+		},
+		{
+			name: "a failed restore leaves the history alone",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				session.AddGuild("guild", existing)
+				session.Errors["GuildRoleEdit"] = errors.New("missing permissions")
+				_ = store.SetRole(context.Background(), "guild", "member", existing.ID)
+				_ = store.PushHistory(context.Background(), "guild", "member", backend.RoleState{Name: "Before", Color: 0x00FF00, Time: time.Now()})
+			},
+			interaction: roleInteraction("member", "restore", intOption("index", 1)),
+			reply:       "Could not restore role",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if history, _ := store.GetHistory(context.Background(), "guild", "member"); len(history) != 1 {
+					t.Errorf("expected only the entry that was there before, got %v", history)
+				}
+			},
+		},
+		{
+			name: "undo applies the last history entry",
+			setup: func(session *cmdstest.Session, store backend.Backend) {
+				session.AddGuild("guild", existing)
+				_ = store.SetRole(context.Background(), "guild", "member", existing.ID)
+				_ = store.PushHistory(context.Background(), "guild", "member", backend.RoleState{Name: "Before", Color: 0x00FF00, Time: time.Now()})
+			},
+			interaction: roleInteraction("member", "undo"),
+			reply:       `Role reverted to "Before"`,
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if roles := session.Roles["guild"]; roles[0].Name != "Before" || roles[0].Color != 0x00FF00 {
+					t.Errorf("expected the role to be reverted, got %v", roles[0])
+				}
+
+				if history, _ := store.GetHistory(context.Background(), "guild", "member"); len(history) != 0 {
+					t.Errorf("expected the entry to be removed from the history, got %v", history)
+				}
+			},
+		},
+		{
+			name:        "schedule refuses a base color beyond the range of colors",
+			interaction: roleInteraction("member", "schedule", intOption("interval", 1), stringOption("color", "99999999")),
+			reply:       "Invalid base color",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if schedule, _ := store.GetSchedule(context.Background(), "guild", "member"); schedule != nil {
+					t.Errorf("expected no schedule to be saved, got %v", schedule)
+				}
+			},
+		},
+		{
+			name:        "schedule saves the base color",
+			interaction: roleInteraction("member", "schedule", intOption("interval", 1), stringOption("color", "#336699")),
+			reply:       "every hour",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if schedule, _ := store.GetSchedule(context.Background(), "guild", "member"); schedule == nil || schedule.BaseColor != 0x336699 {
+					t.Errorf("expected a schedule from the base color, got %v", schedule)
+				}
+
+				if history, _ := store.GetHistory(context.Background(), "guild", "member"); len(history) != 0 {
+					t.Errorf("expected saving a schedule to leave the history untouched, got %v", history)
+				}
+			},
+		},
+		{
+			name:        "unknown subcommands change nothing",
+			interaction: roleInteraction("member", "reset", stringOption("color", "blue")),
+			reply:       "Unknown subcommand",
+			check: func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+				if calls := session.Calls("GuildRoleCreate", "GuildRoleEdit"); len(calls) != 0 {
+					t.Errorf("expected no role changes, got %v", calls)
+				}
+			},
+		},
+		{
+			name:        "unschedule without a schedule",
+			interaction: roleInteraction("member", "unschedule"),
+			reply:       "no color schedule",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := cmdstest.NewSession()
+			session.AddGuild("guild")
+
+			store := appbackend.NewMemoryBackend()
+			if test.setup != nil {
+				test.setup(session, store)
+			}
+
+			command := NewRoleCommand(store, appbackend.NewLocalCoordinator(), session, func(id string) bool {
+				return strings.HasPrefix(id, "admin")
+			})
+
+			if err := command.Execute(session, test.interaction, slog.New(slog.DiscardHandler)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if replies := session.Replies(); len(replies) != 1 || !strings.Contains(replies[0], test.reply) {
+				t.Errorf("expected a reply containing %q, got %v", test.reply, replies)
+			}
+
+			if test.check != nil {
+				test.check(t, session, store)
+			}
+		})
+	}
+}
+
+// moderate holds the role changes of members in the test guild for staff approval
+func moderate(store backend.Backend) {
+	_ = store.SetGuildSettings(context.Background(), "guild", backend.GuildSettings{ApprovalRequired: true, ApprovalChannel: "approvals"})
+}
+
+// expectHeldForApproval checks that a change to the name and color was submitted for approval without editing roles
+func expectHeldForApproval(name string, color int) func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+	return func(t *testing.T, session *cmdstest.Session, store backend.Backend) {
+		approvals, _ := store.ListApprovals(context.Background())
+		if len(approvals) != 1 || approvals[0].Name != name || approvals[0].Color == nil || *approvals[0].Color != color {
+			t.Errorf("expected a request for %q %06X, got %v", name, color, approvals)
+		}
+
+		if calls := session.Calls("GuildRoleCreate", "GuildRoleEdit"); len(calls) != 0 {
+			t.Errorf("expected the role to be left alone, got %v", calls)
+		}
+	}
+}
+
+func TestRoleCommandDefersWhileLocked(t *testing.T) {
+	session := cmdstest.NewSession()
+	session.AddGuild("guild")
+
+	coordinator := appbackend.NewLocalCoordinator()
+
+	// Another change to the role of the member outlasts the time Discord gives the interaction to be responded to
+	unlock, err := coordinator.Lock(context.Background(), backend.RoleLock("guild", "member"))
+	if err != nil {
+		t.Fatalf("failed to lock role: %v", err)
+	}
+
+	time.AfterFunc(DefaultDeferThreshold+200*time.Millisecond, unlock)
+
+	registry := NewRegistry(slog.New(slog.DiscardHandler), NewComponentSigner("secret"))
+	registry.RegisterCommand(NewRoleCommand(appbackend.NewMemoryBackend(), coordinator, session, func(id string) bool {
+		return false
+	}))
+
+	if err = registry.Execute(session, roleInteraction("member", "set", stringOption("color", "blue")), slog.New(slog.DiscardHandler)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	calls := session.Calls("InteractionRespond", "InteractionResponseEdit")
+	if len(calls) != 2 {
+		t.Fatalf("expected a deferral and an edit, got %v", calls)
+	}
+
+	if deferral, _ := calls[0].Args[1].(*discordgo.InteractionResponse); deferral == nil || deferral.Type != discordgo.InteractionResponseDeferredChannelMessageWithSource {
+		t.Errorf("expected the response to be deferred while waiting for the lock, got %v", calls[0])
+	}
+
+	if replies := session.Replies(); len(replies) != 1 || !strings.Contains(replies[0], "Role color updated") {
+		t.Errorf("expected the deferred response to be edited with the result, got %v", replies)
+	}
+}
+
+func TestGenerateHistoryEmbedFitsFields(t *testing.T) {
+	history := make([]backend.RoleState, backend.MaxHistoryEntries)
+	for index := range history {
+		history[index] = backend.RoleState{Name: strings.Repeat("n", maxRoleNameLength), Color: 0x336699, Time: time.Now()}
+	}
+
+	embed := generateHistoryEmbed(&discordgo.User{ID: "member"}, history)
+
+	entries := 0
+	for _, field := range embed.Fields {
+		if length := len([]rune(field.Value)); length > maxEmbedFieldLength {
+			t.Errorf("expected fields within %d characters, got %d", maxEmbedFieldLength, length)
+		}
+
+		entries += strings.Count(field.Value, "\n")
+	}
+
+	if len(embed.Fields) < 2 || entries != len(history) {
+		t.Errorf("expected %d entries split over several fields, got %d in %d fields", len(history), entries, len(embed.Fields))
+	}
+}
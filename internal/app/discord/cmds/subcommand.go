@@ -0,0 +1,214 @@
+package cmds
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+)
+
+// SubcommandHandler executes a subcommand with the options it was invoked with
+type SubcommandHandler func(s Session, i *discordgo.InteractionCreate, logger *slog.Logger, options Options) error
+
+// Subcommand is a subcommand of a command, executed by its own handler
+type Subcommand struct {
+	Name        string
+	Description string
+	Options     []*discordgo.ApplicationCommandOption
+	Handler     SubcommandHandler
+
+	NameLocalizations        map[discordgo.Locale]string
+	DescriptionLocalizations map[discordgo.Locale]string
+}
+
+// SubcommandGroup groups subcommands of a command under a common name
+type SubcommandGroup struct {
+	Name        string
+	Description string
+	Subcommands []*Subcommand
+
+	NameLocalizations        map[discordgo.Locale]string
+	DescriptionLocalizations map[discordgo.Locale]string
+}
+
+func (s *Subcommand) option() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:                     discordgo.ApplicationCommandOptionSubCommand,
+		Name:                     s.Name,
+		Description:              s.Description,
+		Options:                  s.Options,
+		NameLocalizations:        s.NameLocalizations,
+		DescriptionLocalizations: s.DescriptionLocalizations,
+	}
+}
+
+func (g *SubcommandGroup) option() *discordgo.ApplicationCommandOption {
+	options := make([]*discordgo.ApplicationCommandOption, 0, len(g.Subcommands))
+	for _, subcommand := range g.Subcommands {
+		options = append(options, subcommand.option())
+	}
+
+	return &discordgo.ApplicationCommandOption{
+		Type:                     discordgo.ApplicationCommandOptionSubCommandGroup,
+		Name:                     g.Name,
+		Description:              g.Description,
+		Options:                  options,
+		NameLocalizations:        g.NameLocalizations,
+		DescriptionLocalizations: g.DescriptionLocalizations,
+	}
+}
+
+// Options are the options a command was invoked with, those of the invoked subcommand if it has subcommands
+type Options struct {
+	values   map[string]*discordgo.ApplicationCommandInteractionDataOption
+	resolved *discordgo.ApplicationCommandInteractionDataResolved
+}
+
+// DecodeOptions returns the options the command of the interaction was invoked with
+func DecodeOptions(i *discordgo.Interaction) Options {
+	data := i.ApplicationCommandData()
+
+	options := data.Options
+	if subcommand := GetSubcommand(i); subcommand != nil {
+		options = subcommand.Options
+	}
+
+	values := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options))
+	for _, option := range options {
+		values[option.Name] = option
+	}
+
+	return Options{values: values, resolved: data.Resolved}
+}
+
+func (o Options) find(name string, types ...discordgo.ApplicationCommandOptionType) *discordgo.ApplicationCommandInteractionDataOption {
+	option := o.values[name]
+	if option == nil {
+		return nil
+	}
+
+	for _, optionType := range types {
+		if option.Type == optionType {
+			return option
+		}
+	}
+
+	return nil
+}
+
+// Has reports whether the option was given
+func (o Options) Has(name string) bool {
+	return o.values[name] != nil
+}
+
+// String returns the value of a string option, and whether it was given
+func (o Options) String(name string) (string, bool) {
+	if option := o.find(name, discordgo.ApplicationCommandOptionString); option != nil {
+		return option.StringValue(), true
+	}
+
+	return "", false
+}
+
+// Int returns the value of an integer option, and whether it was given
+func (o Options) Int(name string) (int64, bool) {
+	if option := o.find(name, discordgo.ApplicationCommandOptionInteger); option != nil {
+		return option.IntValue(), true
+	}
+
+	return 0, false
+}
+
+// Bool returns the value of a boolean option, and whether it was given
+func (o Options) Bool(name string) (bool, bool) {
+	if option := o.find(name, discordgo.ApplicationCommandOptionBoolean); option != nil {
+		return option.BoolValue(), true
+	}
+
+	return false, false
+}
+
+// ID returns the ID of a user, role, channel or mentionable option, and whether it was given
+func (o Options) ID(name string) (string, bool) {
+	option := o.find(name,
+		discordgo.ApplicationCommandOptionUser,
+		discordgo.ApplicationCommandOptionRole,
+		discordgo.ApplicationCommandOptionChannel,
+		discordgo.ApplicationCommandOptionMentionable)
+
+	if option == nil {
+		return "", false
+	}
+
+	id, ok := option.Value.(string)
+	return id, ok
+}
+
+// User returns the user of a user option as resolved by Discord, and whether it was given
+func (o Options) User(name string) (*discordgo.User, bool) {
+	id, ok := o.ID(name)
+	if !ok || o.resolved == nil {
+		return nil, false
+	}
+
+	user := o.resolved.Users[id]
+	return user, user != nil
+}
+
+// Role returns the role of a role option as resolved by Discord, and whether it was given
+func (o Options) Role(name string) (*discordgo.Role, bool) {
+	id, ok := o.ID(name)
+	if !ok || o.resolved == nil {
+		return nil, false
+	}
+
+	role := o.resolved.Roles[id]
+	return role, role != nil
+}
+
+// Channel returns the channel of a channel option as resolved by Discord, and whether it was given
+func (o Options) Channel(name string) (*discordgo.Channel, bool) {
+	id, ok := o.ID(name)
+	if !ok || o.resolved == nil {
+		return nil, false
+	}
+
+	channel := o.resolved.Channels[id]
+	return channel, channel != nil
+}
+
+// findSubcommand returns the declared subcommand that was invoked, nil if it is not declared
+func (c *BaseCommand) findSubcommand(i *discordgo.Interaction) *Subcommand {
+	invoked := GetSubcommand(i)
+	if invoked == nil {
+		return nil
+	}
+
+	subcommands := c.Subcommands
+
+	if group := GetSubcommandGroup(i); group != nil {
+		subcommands = nil
+
+		for _, declared := range c.Groups {
+			if declared.Name == group.Name {
+				subcommands = declared.Subcommands
+			}
+		}
+	}
+
+	for _, subcommand := range subcommands {
+		if subcommand.Name == invoked.Name {
+			return subcommand
+		}
+	}
+
+	return nil
+}
+
+// Dispatch executes the handler of the invoked subcommand with its decoded options
+func (c *BaseCommand) Dispatch(s Session, i *discordgo.InteractionCreate, logger *slog.Logger) error {
+	subcommand := c.findSubcommand(i.Interaction)
+	if subcommand == nil || subcommand.Handler == nil {
+		return respondWithEphemeralMessage(s, i, "Unknown subcommand")
+	}
+
+	return subcommand.Handler(s, i, logger, DecodeOptions(i.Interaction))
+}
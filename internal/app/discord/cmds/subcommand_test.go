@@ -0,0 +1,109 @@
+package cmds
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"testing"
+)
+
+func commandInteraction(options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.Interaction {
+	return &discordgo.Interaction{
+		Type: discordgo.InteractionApplicationCommand,
+		Data: discordgo.ApplicationCommandInteractionData{
+			Name:    "command",
+			Options: options,
+			Resolved: &discordgo.ApplicationCommandInteractionDataResolved{
+				Users: map[string]*discordgo.User{"1": {ID: "1"}},
+			},
+		},
+	}
+}
+
+func TestBaseCommandFindSubcommand(t *testing.T) {
+	list := &Subcommand{Name: "list"}
+	apply := &Subcommand{Name: "apply"}
+
+	command := &BaseCommand{
+		Subcommands: []*Subcommand{list},
+		Groups:      []*SubcommandGroup{{Name: "theme", Subcommands: []*Subcommand{apply}}},
+	}
+
+	tests := []struct {
+		name        string
+		interaction *discordgo.Interaction
+		expected    *Subcommand
+	}{
+		{
+			name: "top level subcommand",
+			interaction: commandInteraction(&discordgo.ApplicationCommandInteractionDataOption{
+				Type: discordgo.ApplicationCommandOptionSubCommand,
+				Name: "list",
+			}),
+			expected: list,
+		},
+		{
+			name: "subcommand in a group",
+			interaction: commandInteraction(&discordgo.ApplicationCommandInteractionDataOption{
+				Type: discordgo.ApplicationCommandOptionSubCommandGroup,
+				Name: "theme",
+				Options: []*discordgo.ApplicationCommandInteractionDataOption{
+					{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "apply"},
+				},
+			}),
+			expected: apply,
+		},
+		{
+			name: "top level name inside a group",
+			interaction: commandInteraction(&discordgo.ApplicationCommandInteractionDataOption{
+				Type: discordgo.ApplicationCommandOptionSubCommandGroup,
+				Name: "theme",
+				Options: []*discordgo.ApplicationCommandInteractionDataOption{
+					{Type: discordgo.ApplicationCommandOptionSubCommand, Name: "list"},
+				},
+			}),
+		},
+		{
+			name:        "no subcommand",
+			interaction: commandInteraction(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if found := command.findSubcommand(test.interaction); found != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, found)
+			}
+		})
+	}
+}
+
+func TestDecodeOptions(t *testing.T) {
+	options := DecodeOptions(commandInteraction(&discordgo.ApplicationCommandInteractionDataOption{
+		Type: discordgo.ApplicationCommandOptionSubCommand,
+		Name: "add",
+		Options: []*discordgo.ApplicationCommandInteractionDataOption{
+			{Type: discordgo.ApplicationCommandOptionString, Name: "color", Value: "red"},
+			{Type: discordgo.ApplicationCommandOptionInteger, Name: "count", Value: float64(3)},
+			{Type: discordgo.ApplicationCommandOptionUser, Name: "user", Value: "1"},
+		},
+	}))
+
+	if color, ok := options.String("color"); !ok || color != "red" {
+		t.Errorf("expected color red, got %q", color)
+	}
+
+	if count, ok := options.Int("count"); !ok || count != 3 {
+		t.Errorf("expected count 3, got %d", count)
+	}
+
+	if _, ok := options.Int("color"); ok {
+		t.Error("expected a string option not to decode as an integer")
+	}
+
+	if user, ok := options.User("user"); !ok || user.ID != "1" {
+		t.Errorf("expected the resolved user, got %v", user)
+	}
+
+	if _, ok := options.String("label"); ok {
+		t.Error("expected a missing option not to be given")
+	}
+}
@@ -1,14 +1,56 @@
 package discord
 
-import "emperror.dev/errors"
+import (
+	"crypto/ed25519"
+	"emperror.dev/errors"
+	"encoding/hex"
+	discord "github.com/bwmarrin/discordgo"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
 
 const (
 	tokenRequired = errors.Sentinel("token is required")
+
+	unknownInteractionsMode = errors.Sentinel("interactions mode must be gateway or http")
+	publicKeyRequired       = errors.Sentinel("interactions public key is required in http mode")
+	publicKeyInvalid        = errors.Sentinel("interactions public key must be a hex encoded ed25519 key")
+	responseTimeoutInvalid  = errors.Sentinel("interactions response timeout must be between zero and three seconds")
+
+	shardCountInvalid  = errors.Sentinel("shard count cannot be negative")
+	shardCountRequired = errors.Sentinel("shard count is required when running a range of shards")
+	shardRangeInvalid  = errors.Sentinel("shard range must be a shard ID or two shard IDs separated by a dash, like 0-3")
+	shardRangeExceeded = errors.Sentinel("shard range must be within the shard count")
+
+	metricsAddressInvalid = errors.Sentinel("metrics address must be a host and port, like :9090")
+)
+
+const (
+	// InteractionsGateway receives interactions as events of the gateway session
+	InteractionsGateway = "gateway"
+	// InteractionsHTTP receives interactions as requests to the interactions endpoint, the gateway is not opened
+	InteractionsHTTP = "http"
+)
+
+const (
+	defaultInteractionsAddress = ":8080"
+
+	// Discord fails an interaction that is not responded to within three seconds
+	defaultResponseTimeout = 2500 * time.Millisecond
+	maximumResponseTimeout = 3 * time.Second
 )
 
 type BotConfiguration struct {
 	Token  string
 	Admins string
+	// CommandGuilds are the comma separated guilds commands are synced to instead of globally, guild commands
+	// update instantly so this is meant for development
+	CommandGuilds string
+	// MemberCleanup deletes the personal role of a member when they leave a guild, this needs the privileged
+	// server members intent
+	MemberCleanup bool
 }
 
 func (c *BotConfiguration) Validate() error {
@@ -18,3 +60,181 @@ func (c *BotConfiguration) Validate() error {
 
 	return nil
 }
+
+// Intents returns the gateway intents the enabled features need, privileged intents are only requested for the
+// features that use them
+func (c *BotConfiguration) Intents() discord.Intent {
+	intents := discord.IntentsGuilds
+
+	if c.MemberCleanup {
+		intents |= discord.IntentsGuildMembers
+	}
+
+	return intents
+}
+
+// SyncGuilds returns the guilds commands are synced to, a single empty guild for the global commands
+func (c *BotConfiguration) SyncGuilds() []string {
+	var guilds []string
+
+	for _, guild := range strings.Split(c.CommandGuilds, ",") {
+		if guild = strings.TrimSpace(guild); guild != "" {
+			guilds = append(guilds, guild)
+		}
+	}
+
+	if len(guilds) == 0 {
+		return []string{""}
+	}
+
+	return guilds
+}
+
+// InteractionsConfig selects how the bot receives interactions from Discord
+type InteractionsConfig struct {
+	// Mode is InteractionsGateway or InteractionsHTTP
+	Mode string
+	// Address is where the interactions endpoint listens in http mode
+	Address string
+	// PublicKey is the hex encoded public key of the application, requests not signed with it are refused
+	PublicKey string
+	// ResponseTimeout is how long a command has to respond before the endpoint defers the interaction for it
+	ResponseTimeout time.Duration
+
+	publicKey ed25519.PublicKey
+}
+
+func (c *InteractionsConfig) Process() error {
+	if c.Mode == "" {
+		c.Mode = InteractionsGateway
+	}
+
+	if c.Address == "" {
+		c.Address = defaultInteractionsAddress
+	}
+
+	if c.ResponseTimeout == 0 {
+		c.ResponseTimeout = defaultResponseTimeout
+	}
+
+	if c.PublicKey != "" {
+		key, err := hex.DecodeString(c.PublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return publicKeyInvalid
+		}
+
+		c.publicKey = key
+	}
+
+	return nil
+}
+
+func (c *InteractionsConfig) Validate() error {
+	if c.Mode != InteractionsGateway && c.Mode != InteractionsHTTP {
+		return unknownInteractionsMode
+	}
+
+	if c.Mode == InteractionsHTTP && c.publicKey == nil {
+		return publicKeyRequired
+	}
+
+	if c.ResponseTimeout <= 0 || c.ResponseTimeout >= maximumResponseTimeout {
+		return responseTimeoutInvalid
+	}
+
+	return nil
+}
+
+// MetricsConfig selects where the metrics and health endpoint listens
+type MetricsConfig struct {
+	// Address is where the endpoint listens, it is not served when empty
+	Address string
+}
+
+func (c *MetricsConfig) Validate() error {
+	if c.Address == "" {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return metricsAddressInvalid
+	}
+
+	return nil
+}
+
+// ShardingConfig selects how many shards the bot connects with, and which of them this process runs
+type ShardingConfig struct {
+	// Count is the total number of shards across every process, zero uses the count Discord recommends
+	Count int
+	// Range is the shard IDs this process runs, a single ID or an inclusive range like 0-3, every shard when empty.
+	// Processes running ranges must agree on the count, so it has to be set.
+	Range string
+
+	first int
+	last  int
+}
+
+func (c *ShardingConfig) Process() error {
+	c.first, c.last = 0, -1
+
+	if c.Range == "" {
+		return nil
+	}
+
+	first, last, isRange := strings.Cut(c.Range, "-")
+	if !isRange {
+		last = first
+	}
+
+	var err error
+
+	if c.first, err = strconv.Atoi(strings.TrimSpace(first)); err != nil {
+		return shardRangeInvalid
+	}
+
+	if c.last, err = strconv.Atoi(strings.TrimSpace(last)); err != nil {
+		return shardRangeInvalid
+	}
+
+	if c.first < 0 || c.last < c.first {
+		return shardRangeInvalid
+	}
+
+	return nil
+}
+
+func (c *ShardingConfig) Validate() error {
+	if c.Count < 0 {
+		return shardCountInvalid
+	}
+
+	if c.Range == "" {
+		return nil
+	}
+
+	if c.Count == 0 {
+		return shardCountRequired
+	}
+
+	if c.last >= c.Count {
+		return shardRangeExceeded
+	}
+
+	return nil
+}
+
+// ShardIDs returns the IDs of the shards this process runs out of the total count
+func (c *ShardingConfig) ShardIDs(count int) []int {
+	first, last := c.first, c.last
+	if last < 0 || last >= count {
+		last = count - 1
+	}
+
+	ids := make([]int, 0, last-first+1)
+	for id := first; id <= last; id++ {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"emperror.dev/errors"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"time"
+)
+
+const (
+	generationTTLTooShort = errors.Sentinel("generation expiry must be at least one minute")
+	capacityTooSmall      = errors.Sentinel("generation capacity must be at least one")
+)
+
+const (
+	defaultGenerationTTL      = 15 * time.Minute
+	defaultGenerationCapacity = 256
+
+	// Role edits share a rate limit per guild on Discord, so a few members must not be able to use it all up
+	defaultUserRateLimits  = "role=5/1m,group=5/1m"
+	defaultGuildRateLimits = "role=30/1m,group=30/1m"
+)
+
+// GenerationConfig controls how long color previews can be shared for
+type GenerationConfig struct {
+	// TTL is how long a preview can be shared to the channel after it was generated
+	TTL time.Duration
+	// Capacity is the most previews kept in memory, it does not apply when they are kept in redis
+	Capacity int
+}
+
+func (c *GenerationConfig) Process() error {
+	if c.TTL == 0 {
+		c.TTL = defaultGenerationTTL
+	}
+
+	if c.Capacity == 0 {
+		c.Capacity = defaultGenerationCapacity
+	}
+
+	return nil
+}
+
+func (c *GenerationConfig) Validate() error {
+	if c.TTL < time.Minute {
+		return generationTTLTooShort
+	}
+
+	if c.Capacity < 1 {
+		return capacityTooSmall
+	}
+
+	return nil
+}
+
+// RateLimitConfig limits how often commands are used, unless a guild overrides the limits of a command
+type RateLimitConfig struct {
+	// Users are the limits of each member, comma separated and keyed by command like role=5/1m
+	Users string
+	// Guilds are the limits of every member of a guild together, in the same format
+	Guilds string
+
+	users  map[string]backend.RateLimit
+	guilds map[string]backend.RateLimit
+}
+
+func (c *RateLimitConfig) Process() error {
+	if c.Users == "" {
+		c.Users = defaultUserRateLimits
+	}
+
+	if c.Guilds == "" {
+		c.Guilds = defaultGuildRateLimits
+	}
+
+	var err error
+
+	if c.users, err = backend.ParseRateLimits(c.Users); err != nil {
+		return errors.Wrap(err, "failed to parse user rate limits")
+	}
+
+	if c.guilds, err = backend.ParseRateLimits(c.Guilds); err != nil {
+		return errors.Wrap(err, "failed to parse guild rate limits")
+	}
+
+	return nil
+}
+
+// Limits returns the configured limits of the command, the limits a guild sets replace them
+func (c *RateLimitConfig) Limits(command string, guild backend.GuildSettings) backend.CommandRateLimits {
+	var limits backend.CommandRateLimits
+
+	if limit, exists := c.users[command]; exists {
+		limits.User = &limit
+	}
+
+	if limit, exists := c.guilds[command]; exists {
+		limits.Guild = &limit
+	}
+
+	if override, exists := guild.RateLimits[command]; exists {
+		if override.User != nil {
+			limits.User = override.User
+		}
+
+		if override.Guild != nil {
+			limits.Guild = override.Guild
+		}
+	}
+
+	return limits
+}
@@ -1,15 +1,12 @@
 package data
 
 import (
+	"container/list"
+	"context"
 	"github.com/bwmarrin/discordgo"
 	"github.com/google/uuid"
 	"sync"
-)
-
-// Global cache for storing color images
-var (
-	cache = make(map[string]*ColorGeneration)
-	mutex sync.RWMutex
+	"time"
 )
 
 type ColorGeneration struct {
@@ -21,28 +18,101 @@ type ColorGeneration struct {
 	TempMsgID string
 }
 
-func FindGeneration(id string) *ColorGeneration {
-	mutex.RLock()
+// GenerationStore keeps color previews until they are shared to the channel, or expire
+type GenerationStore interface {
+	// Save stores the generation under the given ID, replacing what was stored under it
+	Save(ctx context.Context, id string, generation *ColorGeneration) error
+
+	// Take removes and returns the generation with the given ID, nil if it expired or was already taken
+	Take(ctx context.Context, id string) (*ColorGeneration, error)
+}
+
+// NewGenerationID returns a new ID to save a generation under
+func NewGenerationID() string {
+	return uuid.New().String()
+}
+
+type memoryGeneration struct {
+	id         string
+	generation *ColorGeneration
+	expires    time.Time
+}
+
+// MemoryGenerationStore keeps generations in memory. When it is full the least recently saved generation is
+// evicted first, expired generations are evicted as soon as they are looked at.
+type MemoryGenerationStore struct {
+	capacity int
+	ttl      time.Duration
+
+	mutex   sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// NewMemoryGenerationStore creates a store holding at most capacity generations for at most ttl each
+func NewMemoryGenerationStore(capacity int, ttl time.Duration) *MemoryGenerationStore {
+	return &MemoryGenerationStore{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (m *MemoryGenerationStore) Save(_ context.Context, id string, generation *ColorGeneration) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if element, exists := m.entries[id]; exists {
+		m.remove(element)
+	}
+
+	m.evictExpired(time.Now())
+
+	for m.order.Len() >= m.capacity {
+		m.remove(m.order.Back())
+	}
+
+	m.entries[id] = m.order.PushFront(&memoryGeneration{
+		id:         id,
+		generation: generation,
+		expires:    time.Now().Add(m.ttl),
+	})
+
+	return nil
+}
+
+func (m *MemoryGenerationStore) Take(_ context.Context, id string) (*ColorGeneration, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 
-	gen, exists := cache[id]
-	if exists {
-		delete(cache, id)
+	element, exists := m.entries[id]
+	if !exists {
+		return nil, nil
 	}
 
-	mutex.RUnlock()
+	m.remove(element)
 
-	return gen
+	entry := element.Value.(*memoryGeneration)
+	if time.Now().After(entry.expires) {
+		return nil, nil
+	}
+
+	return entry.generation, nil
 }
 
-// SaveGeneration stores an image in the cache with the given ID
-func SaveGeneration(gen *ColorGeneration) string {
-	// Generate a UUID for the image
-	id := uuid.New().String()
+// evictExpired removes expired generations, which are always the oldest since every generation lives as long
+func (m *MemoryGenerationStore) evictExpired(now time.Time) {
+	for element := m.order.Back(); element != nil; element = m.order.Back() {
+		if now.Before(element.Value.(*memoryGeneration).expires) {
+			return
+		}
 
-	// Store the image in the cache
-	mutex.Lock()
-	cache[id] = gen
-	mutex.Unlock()
+		m.remove(element)
+	}
+}
 
-	return id
+func (m *MemoryGenerationStore) remove(element *list.Element) {
+	m.order.Remove(element)
+	delete(m.entries, element.Value.(*memoryGeneration).id)
 }
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryGenerationStore(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		saved []string
+		ttl   time.Duration
+		take  string
+		found bool
+	}{
+		{
+			name:  "saved generation is found",
+			saved: []string{"first"},
+			ttl:   time.Minute,
+			take:  "first",
+			found: true,
+		},
+		{
+			name:  "unknown generation is not found",
+			saved: []string{"first"},
+			ttl:   time.Minute,
+			take:  "second",
+		},
+		{
+			name:  "oldest generation is evicted when full",
+			saved: []string{"first", "second", "third"},
+			ttl:   time.Minute,
+			take:  "first",
+		},
+		{
+			name:  "newest generation is kept when full",
+			saved: []string{"first", "second", "third"},
+			ttl:   time.Minute,
+			take:  "third",
+			found: true,
+		},
+		{
+			name:  "expired generation is not found",
+			saved: []string{"first"},
+			ttl:   -time.Second,
+			take:  "first",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewMemoryGenerationStore(2, test.ttl)
+
+			for _, id := range test.saved {
+				if err := store.Save(ctx, id, &ColorGeneration{Input: id}); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+
+			generation, err := store.Take(ctx, test.take)
+			if err != nil {
+				t.Fatalf("Take() error = %v", err)
+			}
+
+			if (generation != nil) != test.found {
+				t.Fatalf("Take() = %v, want found %v", generation, test.found)
+			}
+
+			if generation != nil && generation.Input != test.take {
+				t.Errorf("Take() input = %q, want %q", generation.Input, test.take)
+			}
+
+			if again, _ := store.Take(ctx, test.take); again != nil {
+				t.Errorf("Take() returned the generation twice")
+			}
+
+			if store.order.Len() > 2 {
+				t.Errorf("store holds %d generations, want at most 2", store.order.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package data
+
+import (
+	"context"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimiterSweepSize is how many buckets the memory rate limiter keeps before the full ones are forgotten
+const rateLimiterSweepSize = 1024
+
+// RateLimiter hands out uses from token buckets, each holding as many uses as its limit allows and given back
+// gradually over the duration of the limit
+type RateLimiter interface {
+	// Take takes a use from every one of the buckets, or from none of them when any is empty. When one is empty,
+	// the index of the first empty bucket is returned with how long to wait for a use from it. Buckets taken
+	// together must share the part of their keys before the first colon.
+	Take(ctx context.Context, buckets ...Bucket) (int, time.Duration, error)
+}
+
+// Bucket identifies a token bucket along with the limit of its uses
+type Bucket struct {
+	Key   string
+	Limit backend.RateLimit
+}
+
+// refill returns the uses a bucket holds after the elapsed time, never more than the limit allows
+func refill(tokens float64, elapsed time.Duration, limit backend.RateLimit) float64 {
+	rate := float64(limit.Uses) / float64(limit.Per)
+
+	return math.Min(float64(limit.Uses), tokens+float64(elapsed)*rate)
+}
+
+// waitFor returns how long until a bucket holding the tokens has a whole use
+func waitFor(tokens float64, limit backend.RateLimit) time.Duration {
+	rate := float64(limit.Uses) / float64(limit.Per)
+
+	return time.Duration(math.Ceil((1 - tokens) / rate))
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	limit   backend.RateLimit
+}
+
+// MemoryRateLimiter keeps the buckets in memory, so every instance limits on its own
+type MemoryRateLimiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+// NewMemoryRateLimiter creates a rate limiter with every bucket full
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		buckets: make(map[string]*memoryBucket),
+	}
+}
+
+func (m *MemoryRateLimiter) Take(_ context.Context, buckets ...Bucket) (int, time.Duration, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+
+	// Sweep before looking the buckets up, so none of them is forgotten halfway through
+	if len(m.buckets) >= rateLimiterSweepSize {
+		m.sweep(now)
+	}
+
+	refilled := make([]*memoryBucket, 0, len(buckets))
+
+	for _, taken := range buckets {
+		bucket, exists := m.buckets[taken.Key]
+		if !exists {
+			bucket = &memoryBucket{tokens: float64(taken.Limit.Uses), updated: now, limit: taken.Limit}
+			m.buckets[taken.Key] = bucket
+		}
+
+		bucket.tokens = refill(bucket.tokens, now.Sub(bucket.updated), taken.Limit)
+		bucket.updated = now
+		bucket.limit = taken.Limit
+
+		refilled = append(refilled, bucket)
+	}
+
+	for index, bucket := range refilled {
+		if bucket.tokens < 1 {
+			return index, waitFor(bucket.tokens, bucket.limit), nil
+		}
+	}
+
+	for _, bucket := range refilled {
+		bucket.tokens--
+	}
+
+	return 0, 0, nil
+}
+
+// sweep forgets the buckets that are full again, they are the same as new ones
+func (m *MemoryRateLimiter) sweep(now time.Time) {
+	for key, bucket := range m.buckets {
+		if refill(bucket.tokens, now.Sub(bucket.updated), bucket.limit) >= float64(bucket.limit.Uses) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"context"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	limit := backend.RateLimit{Uses: 2, Per: time.Minute}
+
+	tests := []struct {
+		name  string
+		takes int
+		wait  bool
+	}{
+		{name: "first use", takes: 1},
+		{name: "every use of the limit", takes: 2},
+		{name: "one use over the limit", takes: 3, wait: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewMemoryRateLimiter()
+
+			var wait time.Duration
+			for range test.takes {
+				_, wait, _ = limiter.Take(context.Background(), Bucket{Key: "key", Limit: limit})
+			}
+
+			if (wait > 0) != test.wait {
+				t.Errorf("Take() = %v, want a wait: %v", wait, test.wait)
+			}
+
+			if wait > 30*time.Second {
+				t.Errorf("Take() = %v, want at most the time to give back one use", wait)
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimiterTakesTogether(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewMemoryRateLimiter()
+
+	user := Bucket{Key: "guild:command:user:user", Limit: backend.RateLimit{Uses: 1, Per: time.Minute}}
+	guild := Bucket{Key: "guild:command", Limit: backend.RateLimit{Uses: 2, Per: time.Minute}}
+
+	if _, wait, _ := limiter.Take(ctx, user, guild); wait != 0 {
+		t.Fatalf("Take() of both buckets = %v, want no wait", wait)
+	}
+
+	// The user bucket is empty, the refused use must not be taken from the guild bucket
+	for range 3 {
+		if empty, wait, _ := limiter.Take(ctx, user, guild); wait == 0 || empty != 0 {
+			t.Fatalf("Take() with an empty user bucket = %d, %v, want a wait for bucket 0", empty, wait)
+		}
+	}
+
+	if _, wait, _ := limiter.Take(ctx, guild); wait != 0 {
+		t.Fatalf("Take() of the guild bucket = %v, want its last use left", wait)
+	}
+
+	// The guild bucket is empty now, another user must keep their use
+	other := Bucket{Key: "guild:command:user:other", Limit: user.Limit}
+
+	if empty, wait, _ := limiter.Take(ctx, other, guild); wait == 0 || empty != 1 {
+		t.Fatalf("Take() with an empty guild bucket = %d, %v, want a wait for bucket 1", empty, wait)
+	}
+
+	if _, wait, _ := limiter.Take(ctx, other); wait != 0 {
+		t.Errorf("Take() of the other user bucket = %v, want its use left", wait)
+	}
+}
+
+func TestRefill(t *testing.T) {
+	limit := backend.RateLimit{Uses: 4, Per: time.Minute}
+
+	if tokens := refill(0, 15*time.Second, limit); tokens != 1 {
+		t.Errorf("refill() after a quarter of the duration = %v, want 1", tokens)
+	}
+
+	if tokens := refill(3, time.Hour, limit); tokens != 4 {
+		t.Errorf("refill() after a long time = %v, want the full 4", tokens)
+	}
+}
@@ -1,15 +1,18 @@
 package discord
 
 import (
-	"bytes"
+	"context"
 	"emperror.dev/errors"
 	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds"
 	"github.com/Sxtanna/chromatic_curator/internal/app/discord/data"
+	"github.com/Sxtanna/chromatic_curator/internal/app/jobs"
 	"github.com/Sxtanna/chromatic_curator/internal/common"
 	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
 	discord "github.com/bwmarrin/discordgo"
 	"log/slog"
+	"net/http"
 	"strings"
+	"sync"
 )
 
 const (
@@ -17,14 +20,27 @@ const (
 )
 
 type BotService struct {
-	Bot    *discord.Session
-	Config *BotConfiguration
-
-	Logger  *slog.Logger
-	Backend backend.Backend
-
-	commands       *cmds.Registry
-	registeredCmds map[string][]*discord.ApplicationCommand
+	Bot          *discord.Session
+	Config       *BotConfiguration
+	Interactions *InteractionsConfig
+	Sharding     *ShardingConfig
+
+	Logger      *slog.Logger
+	Backend     backend.Backend
+	Health      backend.HealthReporter
+	Coordinator backend.Coordinator
+	Generations data.GenerationStore
+	RateLimiter data.RateLimiter
+	Jobs        *jobs.Queue
+
+	commands *cmds.Registry
+
+	shardsMutex sync.RWMutex
+	shards      map[int]*Shard
+	shardCount  int
+
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 func (d *BotService) Init(config common.Configuration) error {
@@ -33,8 +49,6 @@ func (d *BotService) Init(config common.Configuration) error {
 		return configurationMissing
 	}
 
-	d.registeredCmds = make(map[string][]*discord.ApplicationCommand)
-
 	session, err := discord.New("Bot " + discordConfiguration.Token)
 	if err != nil {
 		return errors.Wrap(err, "failed to create discord session")
@@ -43,233 +57,255 @@ func (d *BotService) Init(config common.Configuration) error {
 	d.Bot = session
 	d.Config = discordConfiguration
 
-	// Initialize command registry
-	d.commands = cmds.NewRegistry(d.Logger)
-
-	// Register commands
-	d.commands.RegisterCommand(cmds.NewRoleCommand(d.Backend, func(id string) bool { return strings.Contains(d.Config.Admins, id) }))
-	d.commands.RegisterCommand(cmds.NewColorCommand())
-	d.commands.RegisterCommand(cmds.NewPaletteCommand())
-
-	return nil
-}
-
-func (d *BotService) Start() error {
-	d.Bot.Identify.Intents = discord.IntentsAll
-
-	d.Bot.AddHandlerOnce(func(s *discord.Session, event *discord.Disconnect) {
-		d.Logger.Info("Discord Session has been disconnected!")
-	})
-
-	// Add handler for slash commands
-	d.Bot.AddHandler(func(s *discord.Session, i *discord.InteractionCreate) {
-		if i.Type != discord.InteractionApplicationCommand {
-			return
+	d.Interactions = common.FindConfiguration[InteractionsConfig](config)
+	if d.Interactions == nil {
+		d.Interactions = &InteractionsConfig{}
+		if err = d.Interactions.Process(); err != nil {
+			return err
 		}
+	}
 
-		commandName := i.ApplicationCommandData().Name
-		d.Logger.Info("Received slash command",
-			slog.String("command", commandName))
-
-		// Get the command from the registry
-		cmd, exists := d.commands.GetCommand(commandName)
-		if !exists {
-			err := s.InteractionRespond(i.Interaction, &discord.InteractionResponse{
-				Type: discord.InteractionResponseChannelMessageWithSource,
-				Data: &discord.InteractionResponseData{
-					Content: "Unknown command: " + commandName,
-					Flags:   discord.MessageFlagsEphemeral,
-				},
-			})
-			if err != nil {
-				d.Logger.Error("Failed to respond to unknown command",
-					slog.String("command", commandName),
-					slog.Any("error", err))
-			}
-			return
+	d.Sharding = common.FindConfiguration[ShardingConfig](config)
+	if d.Sharding == nil {
+		d.Sharding = &ShardingConfig{}
+		if err = d.Sharding.Process(); err != nil {
+			return err
 		}
+	}
 
-		// Execute the command
-		err := cmd.Execute(s, i, d.Logger)
-		if err != nil {
-			d.Logger.Error("Failed to execute command",
-				slog.String("command", commandName),
-				slog.Any("error", err))
-		}
-	})
+	d.stop = make(chan struct{})
 
-	d.Bot.AddHandler(func(s *discord.Session, i *discord.InteractionCreate) {
-		// Only handle button interactions
-		if i.Type != discord.InteractionMessageComponent {
-			return
+	rateLimitConfiguration := common.FindConfiguration[data.RateLimitConfig](config)
+	if rateLimitConfiguration == nil {
+		rateLimitConfiguration = &data.RateLimitConfig{}
+		if err = rateLimitConfiguration.Process(); err != nil {
+			return err
 		}
+	}
 
-		// Get the custom ID from the interaction
-		customID := i.MessageComponentData().CustomID
+	isAdminFunction := func(id string) bool { return strings.Contains(d.Config.Admins, id) }
 
-		// Check if this is a share color button
-		if !strings.HasPrefix(customID, "share_color:") {
-			return
-		}
+	// Initialize command registry, custom IDs are signed with a key derived from the token shared by every instance
+	signer := cmds.NewComponentSigner(discordConfiguration.Token)
+	d.commands = cmds.NewRegistry(d.Logger, signer)
+	d.commands.SetHealth(d.Health)
+	d.commands.Use(
+		cmds.Logging(),
+		cmds.Metrics(),
+		cmds.Recover(),
+		cmds.RequireBackend(d.Health),
+		cmds.RateLimit(d.RateLimiter, rateLimitConfiguration, d.Backend, isAdminFunction))
 
-		d.Logger.Info("Received share color button click",
-			slog.String("customID", customID))
+	// Register commands
 
-		// Parse the custom ID to get the image ID
-		// Format: share_color:<uuid>
-		parts := strings.Split(customID, ":")
-		if len(parts) != 2 {
-			d.Logger.Error("Invalid custom ID format",
-				slog.String("customID", customID))
-			return
-		}
+	d.commands.RegisterCommand(cmds.NewRoleCommand(d.Backend, d.Coordinator, stateRoleCache{d.stateFor}, isAdminFunction))
+	d.commands.RegisterCommand(cmds.NewColorCommand(d.Generations))
+	d.commands.RegisterCommand(cmds.NewPaletteCommand(d.Generations))
 
-		imageID := parts[1]
+	d.commands.RegisterCommand(cmds.NewFavoritesCommand(d.Backend))
+	d.commands.RegisterCommand(cmds.NewCuratorCommand(d.Backend, d.Jobs, isAdminFunction))
 
-		// Retrieve the image from the cache
-		generation := data.FindGeneration(imageID)
+	d.commands.RegisterCommand(cmds.NewGroupCommand(d.Backend, signer, isAdminFunction))
 
-		if generation == nil {
-			d.Logger.Error("Image not found in cache",
-				slog.String("imageID", imageID))
-			return
-		}
+	return nil
+}
 
-		// Acknowledge the interaction
-		err := s.InteractionRespond(i.Interaction, &discord.InteractionResponse{
-			Type: discord.InteractionResponseChannelMessageWithSource,
-			Data: &discord.InteractionResponseData{
-				Embeds: []*discord.MessageEmbed{generation.Embed},
-				Files: []*discord.File{
-					{
-						Name:   "color_preview.png",
-						Reader: bytes.NewReader(generation.ImageData),
-					},
-				},
-			},
-		})
+func (d *BotService) Start() error {
+	// Interactions arrive at the interactions endpoint instead, the session is only used for requests
+	if d.Interactions.Mode == InteractionsHTTP {
+		d.Logger.Debug("bot receives interactions over http, not opening the gateway...")
+	} else if err := d.openShards(); err != nil {
+		return err
+	}
 
-		if err != nil {
-			d.Logger.Error("Failed to respond to button interaction",
-				slog.Any("error", err))
+	d.Logger.Debug("syncing commands once elected leader...")
 
-			empty := make([]discord.MessageComponent, 0)
+	// Sync commands with Discord, only from the leader so instances do not race each other
+	d.Coordinator.OnElected(func() {
+		for _, guild := range d.Config.SyncGuilds() {
+			if _, err := d.SyncCommands(guild, false); err != nil {
+				d.Logger.Error("failed to sync commands",
+					slog.Any("error", err),
+					slog.String("guild", guild))
+			}
+		}
+	})
 
-			_, err = s.FollowupMessageEdit(i.Interaction, generation.TempMsgID, &discord.WebhookEdit{Components: &empty})
+	d.Logger.Debug("service start complete...")
 
-			d.Logger.Error("Failed to remove button interaction",
-				slog.Any("error", err))
+	return common.ServiceStartedNormallyButDoesNotBlock
+}
 
-			return
-		}
+// addEventHandlers adds the handlers of the gateway events to the session of a shard, receiving interactions and
+// role deletions as its events
+func (d *BotService) addEventHandlers(session *discord.Session) {
+	session.AddHandler(func(s *discord.Session, i *discord.InteractionCreate) {
+		d.HandleInteraction(s, i)
+	})
 
-		err = s.FollowupMessageDelete(i.Interaction, generation.TempMsgID)
-		if err != nil {
-			d.Logger.Error("Failed to delete temp message",
-				slog.Any("error", err))
-		}
+	// Forget roles that were deleted outside the bot, so they are not edited or listed anymore
+	session.AddHandler(func(s *discord.Session, event *discord.GuildRoleDelete) {
+		d.cleanupDeletedRole(event.GuildID, event.RoleID)
 	})
 
-	if err := d.Bot.Open(); err != nil {
-		return errors.Wrap(err, "failed to open bot session")
+	// Member events are only received with the members intent, which is only requested for this
+	if d.Config.MemberCleanup {
+		session.AddHandler(func(s *discord.Session, event *discord.GuildMemberRemove) {
+			d.cleanupDepartedMember(event.GuildID, event.User.ID)
+		})
 	}
+}
 
-	d.Logger.Debug("bot session has been opened, registering commands...")
+// stateFor returns the state holding a guild, which is empty when this process does not run its shard
+func (d *BotService) stateFor(guildID string) *discord.State {
+	return d.SessionFor(guildID).State
+}
 
-	// Register global commands with Discord
-	if err := d.registerCommands(""); err != nil {
-		return errors.Wrap(err, "failed to register commands")
+// HandleInteraction routes an interaction to the command, autocomplete or component handler it is meant for,
+// whether it arrived over the gateway or at the interactions endpoint
+func (d *BotService) HandleInteraction(s cmds.Session, i *discord.InteractionCreate) {
+	switch i.Type {
+	case discord.InteractionApplicationCommand:
+		// Failures are logged by the logging middleware
+		_ = d.commands.Execute(s, i, d.Logger)
+	case discord.InteractionApplicationCommandAutocomplete:
+		d.autocomplete(s, i)
+	case discord.InteractionMessageComponent, discord.InteractionModalSubmit:
+		// Buttons and modals are routed to the command owning the namespace of their custom ID
+		d.commands.HandleComponent(s, i, d.Logger)
 	}
-
-	d.Logger.Debug("commands registered, service start complete...")
-
-	return common.ServiceStartedNormallyButDoesNotBlock
 }
 
-func (d *BotService) Close(_ error) error {
-	d.Logger.Debug("bot close requested, enabling sync events...")
-	d.Bot.SyncEvents = true
-
-	// delete global commands
-	// d.deleteRegisteredCommands("")
-
-	return d.Bot.Close()
+func (d *BotService) autocomplete(s cmds.Session, i *discord.InteractionCreate) {
+	if err := d.commands.Autocomplete(s, i, d.Logger); err != nil {
+		d.Logger.Error("Failed to autocomplete command",
+			slog.String("command", i.ApplicationCommandData().Name),
+			slog.Any("error", err))
+	}
 }
 
-func (d *BotService) registerCommands(guildID string) error {
-	// Get all commands from the registry
-	commands := d.commands.GetApplicationCommands()
+func (d *BotService) cleanupDeletedRole(guild string, role string) {
+	ctx := context.Background()
 
-	d.Logger.Info("Registering slash commands",
-		slog.Int("count", len(commands)),
-		slog.String("guild", guildID))
+	owner, err := d.Backend.GetRoleOwner(ctx, guild, role)
+	if err != nil {
+		d.Logger.Error("failed to get owner of deleted role",
+			slog.Any("error", err),
+			slog.String("guild", guild),
+			slog.String("role", role))
+		return
+	}
 
-	d.registeredCmds[guildID] = make([]*discord.ApplicationCommand, 0)
+	if owner != "" {
+		if _, err = d.Backend.DeleteRole(ctx, guild, owner); err == nil {
+			err = d.Backend.DeleteSchedule(ctx, guild, owner)
+		}
 
-	// Register commands with Discord
-	for _, cmd := range commands {
-		registeredCmd, err := d.Bot.ApplicationCommandCreate(d.Bot.State.User.ID, guildID, cmd)
 		if err != nil {
-			d.Logger.Error("failed to register slash command",
-				slog.String("command", cmd.Name),
-				slog.Any("error", err))
-
-			return errors.Wrap(err, "failed to register slash command")
+			d.Logger.Error("failed to remove deleted personal role",
+				slog.Any("error", err),
+				slog.String("guild", guild),
+				slog.String("role", role))
+			return
 		}
 
-		d.registeredCmds[guildID] = append(d.registeredCmds[guildID], registeredCmd)
+		d.Logger.Info("removed deleted personal role",
+			slog.String("guild", guild),
+			slog.String("role", role),
+			slog.String("user", owner))
+		return
+	}
 
-		d.Logger.Info("registered slash command",
-			slog.String("command", cmd.Name))
+	group, err := d.Backend.GetGroup(ctx, guild, role)
+	if err != nil || group == nil {
+		return
 	}
 
-	return nil
+	if err = d.Backend.DeleteGroup(ctx, guild, role); err != nil {
+		d.Logger.Error("failed to remove deleted group role",
+			slog.Any("error", err),
+			slog.String("guild", guild),
+			slog.String("role", role))
+		return
+	}
+
+	d.Logger.Info("removed deleted group role",
+		slog.String("guild", guild),
+		slog.String("role", role))
 }
 
-func (d *BotService) deleteRegisteredCommands(guildID string) {
-	d.Logger.Info("deleting registered slash commands",
-		slog.String("guild", guildID))
+// cleanupDepartedMember deletes the personal role of a member that left the guild
+func (d *BotService) cleanupDepartedMember(guild string, user string) {
+	ctx := context.Background()
 
-	deleteRegisteredCommand := func(guildID string, cmd *discord.ApplicationCommand) {
-		err := d.Bot.ApplicationCommandDelete(d.Bot.State.User.ID, guildID, cmd.ID)
+	role, err := d.Backend.GetRole(ctx, guild, user)
+	if err != nil || role == "" {
 		if err != nil {
-			d.Logger.Error("failed to delete slash command",
-				slog.String("command", cmd.Name),
-				slog.Any("error", err))
-		} else {
-			d.Logger.Info("deleted slash command",
-				slog.String("command", cmd.Name))
+			d.Logger.Error("failed to get role of departed member",
+				slog.Any("error", err),
+				slog.String("guild", guild),
+				slog.String("user", user))
 		}
+		return
 	}
 
-	// If we have tracked registered commands, use those
-	if d.registeredCmds[guildID] != nil && len(d.registeredCmds[guildID]) > 0 {
-		registeredCmds := d.registeredCmds[guildID]
+	session := d.SessionFor(guild)
 
-		d.Logger.Info("deleting tracked registered commands",
-			slog.Int("count", len(registeredCmds)))
+	// The deletion runs on the job queue, behind the other jobs of the guild and retried while Discord rate limits
+	// it or fails on its side
+	var deleteErr error
 
-		for _, cmd := range registeredCmds {
-			deleteRegisteredCommand(guildID, cmd)
-		}
+	_, err = d.Jobs.Run(ctx, jobs.Job{
+		Name:  "delete departed member role",
+		Guild: guild,
+		Operations: []jobs.Operation{{
+			Target: role,
+			Run: func(ctx context.Context) error {
+				deleteErr = session.GuildRoleDelete(guild, role, discord.WithContext(ctx))
+				return deleteErr
+			},
+		}},
+	})
+	if err == nil {
+		err = deleteErr
+	}
 
-		// Clear the registered commands list
-		delete(d.registeredCmds, guildID)
+	// A role that was already deleted only has to be forgotten
+	var restErr *discord.RESTError
+	if err != nil && !(errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound) {
+		d.Logger.Error("failed to delete role of departed member",
+			slog.Any("error", err),
+			slog.String("guild", guild),
+			slog.String("role", role),
+			slog.String("user", user))
 		return
 	}
 
-	// Fallback: fetch and delete all commands
-	commands, err := d.Bot.ApplicationCommands(d.Bot.State.User.ID, guildID)
+	if _, err = d.Backend.DeleteRole(ctx, guild, user); err == nil {
+		err = d.Backend.DeleteSchedule(ctx, guild, user)
+	}
+
 	if err != nil {
-		d.Logger.Error("failed to fetch slash commands",
-			slog.Any("error", err))
+		d.Logger.Error("failed to remove role of departed member",
+			slog.Any("error", err),
+			slog.String("guild", guild),
+			slog.String("role", role),
+			slog.String("user", user))
 		return
 	}
 
-	d.Logger.Info("deleting fetched slash commands",
-		slog.Int("count", len(commands)))
+	d.Logger.Info("removed role of departed member",
+		slog.String("guild", guild),
+		slog.String("role", role),
+		slog.String("user", user))
+}
+
+func (d *BotService) Close(_ error) error {
+	d.Logger.Debug("bot close requested, closing shards...")
 
-	for _, cmd := range commands {
-		deleteRegisteredCommand(guildID, cmd)
-	}
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+
+	return d.closeShards()
 }
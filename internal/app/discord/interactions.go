@@ -0,0 +1,298 @@
+package discord
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"encoding/json"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	discord "github.com/bwmarrin/discordgo"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	alreadyResponded = errors.Sentinel("interaction has already been responded to")
+	cannotBeDeferred = errors.Sentinel("response cannot be sent after the interaction was deferred")
+)
+
+const (
+	// maximumInteractionSize is the largest interaction body read, interactions are far smaller
+	maximumInteractionSize = 1 << 20
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// InteractionServer serves the interactions endpoint Discord sends interactions to in http mode, routing them into
+// the commands of the bot. It does nothing in gateway mode.
+type InteractionServer struct {
+	Logger *slog.Logger
+	Bot    *BotService
+
+	config *InteractionsConfig
+	server *http.Server
+}
+
+func (s *InteractionServer) Init(config common.Configuration) error {
+	s.config = common.FindConfiguration[InteractionsConfig](config)
+	if s.config == nil || s.config.Mode != InteractionsHTTP {
+		return nil
+	}
+
+	s.server = &http.Server{
+		Addr:              s.config.Address,
+		Handler:           s,
+		ReadHeaderTimeout: shutdownTimeout,
+	}
+
+	return nil
+}
+
+func (s *InteractionServer) Start() error {
+	if s.server == nil {
+		return common.ServiceStartedNormallyButDoesNotBlock
+	}
+
+	s.Logger.Info("serving interactions endpoint",
+		slog.String("address", s.config.Address))
+
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return errors.Wrap(err, "failed to serve interactions endpoint")
+	}
+
+	return nil
+}
+
+func (s *InteractionServer) Close(_ error) error {
+	if s.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return s.server.Shutdown(ctx)
+}
+
+func (s *InteractionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maximumInteractionSize)
+
+	// Discord checks that the endpoint refuses requests with invalid signatures before it can be used
+	if !discord.VerifyInteraction(r, s.config.publicKey) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read interaction", http.StatusBadRequest)
+		return
+	}
+
+	interaction := &discord.InteractionCreate{}
+	if err = json.Unmarshal(body, interaction); err != nil {
+		http.Error(w, "failed to decode interaction", http.StatusBadRequest)
+		return
+	}
+
+	if interaction.Type == discord.InteractionPing {
+		s.write(w, &discord.InteractionResponse{Type: discord.InteractionResponsePong})
+		return
+	}
+
+	responder := newHTTPResponder(s.Bot.Bot, interaction.Interaction)
+
+	go func() {
+		defer responder.finish()
+		s.Bot.HandleInteraction(responder, interaction)
+	}()
+
+	timer := time.NewTimer(s.config.ResponseTimeout)
+	defer timer.Stop()
+
+	var response *discord.InteractionResponse
+
+	select {
+	case response = <-responder.responses:
+	case <-timer.C:
+		// The command keeps running, what it responds with later replaces the deferred response
+		response = responder.deferResponse()
+	case <-r.Context().Done():
+		return
+	}
+
+	if response == nil {
+		s.Logger.Warn("interaction was not responded to",
+			slog.String("interaction", interaction.ID))
+
+		http.Error(w, "interaction was not responded to", http.StatusInternalServerError)
+		return
+	}
+
+	s.write(w, response)
+}
+
+// write responds to the request with the interaction response, as a multipart body when it has files attached
+func (s *InteractionServer) write(w http.ResponseWriter, response *discord.InteractionResponse) {
+	var (
+		contentType = "application/json"
+		body        []byte
+		err         error
+	)
+
+	if response.Data != nil && len(response.Data.Files) > 0 {
+		contentType, body, err = discord.MultipartBodyWithJSON(response, response.Data.Files)
+	} else {
+		body, err = json.Marshal(response)
+	}
+
+	if err != nil {
+		s.Logger.Error("failed to encode interaction response",
+			slog.Any("error", err))
+
+		http.Error(w, "failed to encode interaction response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+
+	if _, err = w.Write(body); err != nil {
+		s.Logger.Warn("failed to write interaction response",
+			slog.Any("error", err))
+	}
+}
+
+// httpResponder is the session commands see for an interaction received over http. The first response to the
+// interaction is handed to the request instead of being sent to Discord, everything else goes through the session.
+type httpResponder struct {
+	cmds.Session
+
+	interaction *discord.Interaction
+	responses   chan *discord.InteractionResponse
+
+	mutex     sync.Mutex
+	responded bool
+	deferred  bool
+}
+
+func newHTTPResponder(session cmds.Session, interaction *discord.Interaction) *httpResponder {
+	return &httpResponder{
+		Session:     session,
+		interaction: interaction,
+		responses:   make(chan *discord.InteractionResponse, 1),
+	}
+}
+
+func (h *httpResponder) InteractionRespond(interaction *discord.Interaction, resp *discord.InteractionResponse, options ...discord.RequestOption) error {
+	if interaction.ID != h.interaction.ID {
+		return h.Session.InteractionRespond(interaction, resp, options...)
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.deferred {
+		return h.replaceDeferred(resp, options...)
+	}
+
+	if h.responded {
+		return alreadyResponded
+	}
+
+	h.responded = true
+	h.responses <- resp
+
+	return nil
+}
+
+// deferResponse returns the response deferring the interaction for a command that is taking too long, unless the
+// command responded or finished without responding in the meantime
+func (h *httpResponder) deferResponse() *discord.InteractionResponse {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.responded {
+		return <-h.responses
+	}
+
+	h.responded = true
+	h.deferred = true
+
+	switch h.interaction.Type {
+	case discord.InteractionMessageComponent:
+		return &discord.InteractionResponse{Type: discord.InteractionResponseDeferredMessageUpdate}
+	case discord.InteractionApplicationCommandAutocomplete:
+		// Autocomplete cannot be deferred, offering no choices is the closest
+		return &discord.InteractionResponse{
+			Type: discord.InteractionApplicationCommandAutocompleteResult,
+			Data: &discord.InteractionResponseData{Choices: []*discord.ApplicationCommandOptionChoice{}},
+		}
+	default:
+		return &discord.InteractionResponse{
+			Type: discord.InteractionResponseDeferredChannelMessageWithSource,
+			Data: &discord.InteractionResponseData{Flags: discord.MessageFlagsEphemeral},
+		}
+	}
+}
+
+// replaceDeferred edits the deferred response into the message the command responded with
+func (h *httpResponder) replaceDeferred(resp *discord.InteractionResponse, options ...discord.RequestOption) error {
+	switch resp.Type {
+	case discord.InteractionResponseDeferredChannelMessageWithSource, discord.InteractionResponseDeferredMessageUpdate:
+		return nil
+	case discord.InteractionResponseChannelMessageWithSource, discord.InteractionResponseUpdateMessage:
+	default:
+		return cannotBeDeferred
+	}
+
+	// Editing the deferred response of a component edits the message it belongs to, a new message is sent instead
+	if h.interaction.Type == discord.InteractionMessageComponent && resp.Type == discord.InteractionResponseChannelMessageWithSource {
+		params := &discord.WebhookParams{}
+
+		if data := resp.Data; data != nil {
+			params.Content = data.Content
+			params.Embeds = data.Embeds
+			params.Components = data.Components
+			params.Files = data.Files
+			params.Flags = data.Flags
+			params.AllowedMentions = data.AllowedMentions
+		}
+
+		_, err := h.Session.FollowupMessageCreate(h.interaction, true, params, options...)
+
+		return err
+	}
+
+	edit := &discord.WebhookEdit{}
+
+	if data := resp.Data; data != nil {
+		edit.Content = &data.Content
+		edit.Embeds = &data.Embeds
+		edit.Components = &data.Components
+		edit.Files = data.Files
+		edit.AllowedMentions = data.AllowedMentions
+	}
+
+	_, err := h.Session.InteractionResponseEdit(h.interaction, edit, options...)
+
+	return err
+}
+
+// finish closes the responses once the command is done, so a request does not wait on a command that never responds
+func (h *httpResponder) finish() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.responded {
+		h.responded = true
+		close(h.responses)
+	}
+}
@@ -0,0 +1,202 @@
+package discord
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds/cmdstest"
+	discord "github.com/bwmarrin/discordgo"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type testCommand struct {
+	cmds.BaseCommand
+
+	execute cmds.Handler
+}
+
+func (c *testCommand) Execute(s cmds.Session, i *discord.InteractionCreate, logger *slog.Logger) error {
+	return c.execute(s, i, logger)
+}
+
+func newTestInteractionServer(t *testing.T, execute cmds.Handler) (*InteractionServer, ed25519.PrivateKey) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+
+	bot := &BotService{Logger: logger, commands: cmds.NewRegistry(logger, cmds.NewComponentSigner("secret"))}
+	bot.commands.RegisterCommand(&testCommand{BaseCommand: cmds.BaseCommand{Name: "test"}, execute: execute})
+
+	server := &InteractionServer{
+		Logger: logger,
+		Bot:    bot,
+		config: &InteractionsConfig{Mode: InteractionsHTTP, ResponseTimeout: time.Second, publicKey: public},
+	}
+
+	return server, private
+}
+
+func signedRequest(private ed25519.PrivateKey, body string) *http.Request {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := ed25519.Sign(private, []byte(timestamp+body))
+
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	request.Header.Set("X-Signature-Ed25519", hex.EncodeToString(signature))
+	request.Header.Set("X-Signature-Timestamp", timestamp)
+
+	return request
+}
+
+func TestInteractionServer(t *testing.T) {
+	command := `{"id":"1","type":2,"data":{"name":"test"},"guild_id":"guild","member":{"user":{"id":"user"}}}`
+
+	respond := func(s cmds.Session, i *discord.InteractionCreate, logger *slog.Logger) error {
+		return s.InteractionRespond(i.Interaction, &discord.InteractionResponse{
+			Type: discord.InteractionResponseChannelMessageWithSource,
+			Data: &discord.InteractionResponseData{Content: "hello"},
+		})
+	}
+
+	tests := []struct {
+		name     string
+		request  func(private ed25519.PrivateKey) *http.Request
+		execute  cmds.Handler
+		status   int
+		response discord.InteractionResponse
+	}{
+		{
+			name:     "answers pings",
+			request:  func(private ed25519.PrivateKey) *http.Request { return signedRequest(private, `{"id":"1","type":1}`) },
+			status:   http.StatusOK,
+			response: discord.InteractionResponse{Type: discord.InteractionResponsePong},
+		},
+		{
+			name: "refuses unsigned requests",
+			request: func(private ed25519.PrivateKey) *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"id":"1","type":1}`))
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "refuses requests signed with another key",
+			request: func(private ed25519.PrivateKey) *http.Request {
+				_, other, _ := ed25519.GenerateKey(nil)
+				return signedRequest(other, `{"id":"1","type":1}`)
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "refuses other methods",
+			request: func(private ed25519.PrivateKey) *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/", nil)
+			},
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:     "responds with the response of the command",
+			request:  func(private ed25519.PrivateKey) *http.Request { return signedRequest(private, command) },
+			execute:  respond,
+			status:   http.StatusOK,
+			response: discord.InteractionResponse{Type: discord.InteractionResponseChannelMessageWithSource, Data: &discord.InteractionResponseData{Content: "hello"}},
+		},
+		{
+			name:    "fails interactions the command does not respond to",
+			request: func(private ed25519.PrivateKey) *http.Request { return signedRequest(private, command) },
+			execute: func(s cmds.Session, i *discord.InteractionCreate, logger *slog.Logger) error { return nil },
+			status:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, private := newTestInteractionServer(t, test.execute)
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, test.request(private))
+
+			if recorder.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, recorder.Code, recorder.Body.String())
+			}
+
+			if test.status != http.StatusOK {
+				return
+			}
+
+			expected, _ := json.Marshal(test.response)
+			if recorder.Body.String() != string(expected) {
+				t.Errorf("expected response %s, got %s", expected, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestHTTPResponderDeferral(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     discord.InteractionType
+		response discord.InteractionResponseType
+		deferred discord.InteractionResponseType
+		method   string
+	}{
+		{
+			name:     "command message edits the deferred response",
+			kind:     discord.InteractionApplicationCommand,
+			response: discord.InteractionResponseChannelMessageWithSource,
+			deferred: discord.InteractionResponseDeferredChannelMessageWithSource,
+			method:   "InteractionResponseEdit",
+		},
+		{
+			name:     "component update edits the message",
+			kind:     discord.InteractionMessageComponent,
+			response: discord.InteractionResponseUpdateMessage,
+			deferred: discord.InteractionResponseDeferredMessageUpdate,
+			method:   "InteractionResponseEdit",
+		},
+		{
+			name:     "component message is sent as a follow-up",
+			kind:     discord.InteractionMessageComponent,
+			response: discord.InteractionResponseChannelMessageWithSource,
+			deferred: discord.InteractionResponseDeferredMessageUpdate,
+			method:   "FollowupMessageCreate",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session := cmdstest.NewSession()
+			interaction := &discord.Interaction{ID: "1", Type: test.kind}
+
+			responder := newHTTPResponder(session, interaction)
+
+			if deferred := responder.deferResponse(); deferred.Type != test.deferred {
+				t.Errorf("expected deferral %d, got %d", test.deferred, deferred.Type)
+			}
+
+			err := responder.InteractionRespond(interaction, &discord.InteractionResponse{
+				Type: test.response,
+				Data: &discord.InteractionResponseData{Content: "late"},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if calls := session.Calls(); len(calls) != 1 || calls[0].Method != test.method {
+				t.Errorf("expected a single %s, got %v", test.method, calls)
+			}
+
+			if replies := session.Replies(); len(replies) != 1 || replies[0] != "late" {
+				t.Errorf("expected the late response to be sent, got %v", replies)
+			}
+		})
+	}
+}
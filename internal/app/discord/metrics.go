@@ -0,0 +1,115 @@
+package discord
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"encoding/json"
+	"expvar"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// MetricsServer serves the metrics published with expvar, like ShardMetrics and the command metrics, along with
+// the health of the shards this process runs, for monitoring to scrape and orchestrators to probe. It does nothing
+// without a configured address.
+type MetricsServer struct {
+	Logger *slog.Logger
+	Bot    *BotService
+
+	config *MetricsConfig
+	server *http.Server
+}
+
+// HealthStatus is the health of this process as it is served by the health endpoint
+type HealthStatus struct {
+	Healthy bool                   `json:"healthy"`
+	Backend bool                   `json:"backend"`
+	Shards  map[string]ShardStatus `json:"shards"`
+}
+
+func (s *MetricsServer) Init(config common.Configuration) error {
+	s.config = common.FindConfiguration[MetricsConfig](config)
+	if s.config == nil || s.config.Address == "" {
+		return nil
+	}
+
+	s.server = &http.Server{
+		Addr:              s.config.Address,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: shutdownTimeout,
+	}
+
+	return nil
+}
+
+func (s *MetricsServer) Start() error {
+	if s.server == nil {
+		return common.ServiceStartedNormallyButDoesNotBlock
+	}
+
+	s.Logger.Info("serving metrics endpoint",
+		slog.String("address", s.config.Address))
+
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return errors.Wrap(err, "failed to serve metrics endpoint")
+	}
+
+	return nil
+}
+
+func (s *MetricsServer) Close(_ error) error {
+	if s.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return s.server.Shutdown(ctx)
+}
+
+// Handler returns the routes of the endpoint, the expvar metrics at /debug/vars and the health at /health
+func (s *MetricsServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("GET /health", s.serveHealth)
+
+	return mux
+}
+
+// Health reports the process healthy while the backend is reachable and every shard it runs is connected. In http
+// mode no shards are run, so only the backend is checked.
+func (s *MetricsServer) Health() HealthStatus {
+	status := HealthStatus{
+		Backend: s.Bot.Health == nil || s.Bot.Health.Healthy(),
+		Shards:  make(map[string]ShardStatus),
+	}
+
+	status.Healthy = status.Backend
+
+	for id, shard := range s.Bot.Shards() {
+		shardStatus := shard.Status()
+
+		status.Shards[strconv.Itoa(id)] = shardStatus
+		status.Healthy = status.Healthy && shardStatus.Connected
+	}
+
+	return status
+}
+
+func (s *MetricsServer) serveHealth(w http.ResponseWriter, _ *http.Request) {
+	status := s.Health()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if !status.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		s.Logger.Error("failed to write health",
+			slog.Any("error", err))
+	}
+}
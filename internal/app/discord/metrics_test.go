@@ -0,0 +1,163 @@
+package discord
+
+import (
+	"emperror.dev/errors"
+	"encoding/json"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds/cmdstest"
+	discord "github.com/bwmarrin/discordgo"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testHealth reports the backend as reachable or not
+type testHealth bool
+
+func (h testHealth) Healthy() bool {
+	return bool(h)
+}
+
+func TestMetricsServerHealth(t *testing.T) {
+	tests := []struct {
+		name      string
+		backend   bool
+		connected []bool
+		status    int
+	}{
+		{
+			name:      "healthy while every shard is connected",
+			backend:   true,
+			connected: []bool{true, true},
+			status:    http.StatusOK,
+		},
+		{
+			name:      "unhealthy while a shard is disconnected",
+			backend:   true,
+			connected: []bool{true, false},
+			status:    http.StatusServiceUnavailable,
+		},
+		{
+			name:      "unhealthy while the backend is unreachable",
+			connected: []bool{true},
+			status:    http.StatusServiceUnavailable,
+		},
+		{
+			name:    "healthy without shards in http mode",
+			backend: true,
+			status:  http.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bot := &BotService{Health: testHealth(test.backend), shards: make(map[int]*Shard)}
+
+			for id, connected := range test.connected {
+				session, _ := discord.New("Bot token")
+
+				shard := &Shard{ID: id, Session: session}
+				shard.connected.Store(connected)
+
+				bot.shards[id] = shard
+			}
+
+			server := &MetricsServer{Logger: slog.New(slog.DiscardHandler), Bot: bot}
+
+			recorder := httptest.NewRecorder()
+			server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			if recorder.Code != test.status {
+				t.Errorf("GET /health status = %d, want %d", recorder.Code, test.status)
+			}
+
+			var status HealthStatus
+			if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+				t.Fatalf("failed to decode health: %v", err)
+			}
+
+			if status.Backend != test.backend || len(status.Shards) != len(test.connected) {
+				t.Errorf("health = %+v, want the backend and %d shards", status, len(test.connected))
+			}
+		})
+	}
+}
+
+func TestMetricsServerServesExpvar(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+
+	// Executions are counted by the metrics middleware of the registry
+	registry := cmds.NewRegistry(logger, cmds.NewComponentSigner("secret"))
+	registry.Use(cmds.Metrics())
+	registry.RegisterCommand(&testCommand{
+		BaseCommand: cmds.BaseCommand{Name: "metrics-test"},
+		execute: func(s cmds.Session, i *discord.InteractionCreate, logger *slog.Logger) error {
+			return nil
+		},
+	})
+
+	interaction := &discord.InteractionCreate{Interaction: &discord.Interaction{
+		Type: discord.InteractionApplicationCommand,
+		Data: discord.ApplicationCommandInteractionData{Name: "metrics-test"},
+	}}
+
+	if err := registry.Execute(cmdstest.NewSession(), interaction, logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	server := &MetricsServer{Logger: logger, Bot: &BotService{}}
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET /debug/vars status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	var vars struct {
+		Shards   map[string]ShardStatus `json:"shards"`
+		Commands map[string]float64     `json:"commands"`
+	}
+
+	if err := json.NewDecoder(recorder.Body).Decode(&vars); err != nil {
+		t.Fatalf("failed to decode metrics: %v", err)
+	}
+
+	if vars.Shards == nil {
+		t.Errorf("GET /debug/vars left out the shard metrics")
+	}
+
+	if executions := vars.Commands["metrics-test.executions"]; executions != 1 {
+		t.Errorf("GET /debug/vars counted %v executions of the command, want 1", executions)
+	}
+}
+
+func TestMetricsConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MetricsConfig
+		err    error
+	}{
+		{
+			name: "disabled without an address",
+		},
+		{
+			name:   "listens on a port",
+			config: MetricsConfig{Address: ":9090"},
+		},
+		{
+			name:   "refuses an address without a port",
+			config: MetricsConfig{Address: "localhost"},
+			err:    metricsAddressInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.config.Validate(); !errors.Is(err, test.err) {
+				t.Errorf("Validate() error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
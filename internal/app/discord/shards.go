@@ -0,0 +1,200 @@
+package discord
+
+import (
+	"emperror.dev/errors"
+	"expvar"
+	discord "github.com/bwmarrin/discordgo"
+	"log/slog"
+	"maps"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ShardMetrics publishes the status of every shard run by this process with expvar, keyed by shard ID
+var ShardMetrics = expvar.NewMap("shards")
+
+// identifyInterval is how long Discord wants between the identifies of consecutive buckets of shards
+const identifyInterval = 5 * time.Second
+
+// ShardID returns the shard a guild is assigned to out of the total count of shards
+func ShardID(guildID string, count int) int {
+	id, err := strconv.ParseUint(guildID, 10, 64)
+	if err != nil || count <= 1 {
+		return 0
+	}
+
+	return int((id >> 22) % uint64(count))
+}
+
+// Shard is a gateway session of the bot, receiving the events of the guilds assigned to it
+type Shard struct {
+	ID      int
+	Session *discord.Session
+
+	connected   atomic.Bool
+	disconnects atomic.Int64
+}
+
+// ShardStatus is the health of a shard as it is published in ShardMetrics
+type ShardStatus struct {
+	Connected   bool    `json:"connected"`
+	Guilds      int     `json:"guilds"`
+	Disconnects int64   `json:"disconnects"`
+	Latency     float64 `json:"latency_seconds"`
+}
+
+// Healthy reports whether the shard is connected to the gateway
+func (s *Shard) Healthy() bool {
+	return s.connected.Load()
+}
+
+func (s *Shard) Status() ShardStatus {
+	s.Session.State.RLock()
+	guilds := len(s.Session.State.Guilds)
+	s.Session.State.RUnlock()
+
+	return ShardStatus{
+		Connected:   s.Healthy(),
+		Guilds:      guilds,
+		Disconnects: s.disconnects.Load(),
+		Latency:     s.Session.HeartbeatLatency().Seconds(),
+	}
+}
+
+// Shards returns the shards this process runs, keyed by shard ID
+func (d *BotService) Shards() map[int]*Shard {
+	d.shardsMutex.RLock()
+	defer d.shardsMutex.RUnlock()
+
+	return maps.Clone(d.shards)
+}
+
+// SessionFor returns the session of the shard a guild is assigned to when this process runs it, and the session
+// of the bot otherwise. Requests work through any session, only the shard of a guild has the guild in its state.
+func (d *BotService) SessionFor(guildID string) *discord.Session {
+	d.shardsMutex.RLock()
+	defer d.shardsMutex.RUnlock()
+
+	if shard, exists := d.shards[ShardID(guildID, d.shardCount)]; exists {
+		return shard.Session
+	}
+
+	return d.Bot
+}
+
+// openShards opens a gateway session for every shard this process runs, with the count Discord recommends
+// unless one is configured
+func (d *BotService) openShards() error {
+	gateway, err := d.Bot.GatewayBot()
+	if err != nil {
+		return errors.Wrap(err, "failed to get gateway information")
+	}
+
+	count := d.Sharding.Count
+	if count == 0 {
+		count = max(gateway.Shards, 1)
+	}
+
+	ids := d.Sharding.ShardIDs(count)
+
+	shards := make(map[int]*Shard, len(ids))
+	for _, id := range ids {
+		if shards[id], err = d.newShard(id, count); err != nil {
+			return err
+		}
+	}
+
+	d.shardsMutex.Lock()
+	d.shards, d.shardCount = shards, count
+	d.shardsMutex.Unlock()
+
+	d.Logger.Info("opening shards",
+		slog.Int("count", count),
+		slog.Any("shards", ids))
+
+	// Shards identify in buckets of the concurrency Discord allows, waiting between each bucket
+	concurrency := max(gateway.SessionStartLimit.MaxConcurrency, 1)
+
+	for index, id := range ids {
+		if index > 0 && index%concurrency == 0 {
+			select {
+			case <-d.stop:
+				return nil
+			case <-time.After(identifyInterval):
+			}
+		}
+
+		if err = shards[id].Session.Open(); err != nil {
+			return errors.WrapWithDetails(err, "failed to open shard", "shard", id)
+		}
+
+		d.Logger.Debug("shard has been opened",
+			slog.Int("shard", id))
+	}
+
+	return nil
+}
+
+// newShard creates the session of a shard, sharing the rate limits of the bot
+func (d *BotService) newShard(id int, count int) (*Shard, error) {
+	session, err := discord.New("Bot " + d.Config.Token)
+	if err != nil {
+		return nil, errors.WrapWithDetails(err, "failed to create shard session", "shard", id)
+	}
+
+	session.ShardID = id
+	session.ShardCount = count
+	session.Ratelimiter = d.Bot.Ratelimiter
+	session.Identify.Intents = d.Config.Intents()
+	configureState(session.State)
+
+	shard := &Shard{ID: id, Session: session}
+
+	session.AddHandler(func(s *discord.Session, event *discord.Ready) {
+		shard.connected.Store(true)
+
+		d.Logger.Info("shard is ready",
+			slog.Int("shard", id),
+			slog.Int("guilds", len(event.Guilds)))
+	})
+
+	session.AddHandler(func(s *discord.Session, event *discord.Resumed) {
+		shard.connected.Store(true)
+
+		d.Logger.Debug("shard has resumed",
+			slog.Int("shard", id))
+	})
+
+	session.AddHandler(func(s *discord.Session, event *discord.Disconnect) {
+		if shard.connected.Swap(false) {
+			shard.disconnects.Add(1)
+
+			d.Logger.Warn("shard has been disconnected",
+				slog.Int("shard", id))
+		}
+	})
+
+	d.addEventHandlers(session)
+
+	ShardMetrics.Set(strconv.Itoa(id), expvar.Func(func() any {
+		return shard.Status()
+	}))
+
+	return shard, nil
+}
+
+// closeShards closes the session of every shard
+func (d *BotService) closeShards() error {
+	d.shardsMutex.RLock()
+	defer d.shardsMutex.RUnlock()
+
+	var err error
+
+	for _, shard := range d.shards {
+		shard.Session.SyncEvents = true
+		err = errors.Combine(err, shard.Session.Close())
+	}
+
+	return err
+}
@@ -0,0 +1,123 @@
+package discord
+
+import (
+	"emperror.dev/errors"
+	discord "github.com/bwmarrin/discordgo"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestShardingConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ShardingConfig
+		err    error
+		ids    []int
+	}{
+		{
+			name: "runs every shard by default",
+			ids:  []int{0, 1, 2, 3},
+		},
+		{
+			name:   "runs a range of shards",
+			config: ShardingConfig{Count: 4, Range: "1-2"},
+			ids:    []int{1, 2},
+		},
+		{
+			name:   "runs a single shard",
+			config: ShardingConfig{Count: 4, Range: "3"},
+			ids:    []int{3},
+		},
+		{
+			name:   "refuses a range beyond the count",
+			config: ShardingConfig{Count: 4, Range: "2-4"},
+			err:    shardRangeExceeded,
+		},
+		{
+			name:   "refuses a range without a count",
+			config: ShardingConfig{Range: "0-1"},
+			err:    shardCountRequired,
+		},
+		{
+			name:   "refuses a reversed range",
+			config: ShardingConfig{Count: 4, Range: "2-1"},
+			err:    shardRangeInvalid,
+		},
+		{
+			name:   "refuses a range that is not numbers",
+			config: ShardingConfig{Count: 4, Range: "first-last"},
+			err:    shardRangeInvalid,
+		},
+		{
+			name:   "refuses a negative count",
+			config: ShardingConfig{Count: -1},
+			err:    shardCountInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.Process()
+			if err == nil {
+				err = test.config.Validate()
+			}
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if ids := test.config.ShardIDs(4); !slices.Equal(ids, test.ids) {
+				t.Errorf("expected shards %v, got %v", test.ids, ids)
+			}
+		})
+	}
+}
+
+func TestShardID(t *testing.T) {
+	guild := func(shard uint64) string {
+		return strconv.FormatUint(shard<<22|12345, 10)
+	}
+
+	tests := []struct {
+		name     string
+		guild    string
+		count    int
+		expected int
+	}{
+		{name: "a single shard has every guild", guild: guild(7), count: 1, expected: 0},
+		{name: "guilds are assigned by their timestamp", guild: guild(7), count: 4, expected: 3},
+		{name: "direct messages are on the first shard", guild: "", count: 4, expected: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if shard := ShardID(test.guild, test.count); shard != test.expected {
+				t.Errorf("expected shard %d, got %d", test.expected, shard)
+			}
+		})
+	}
+}
+
+func TestSessionFor(t *testing.T) {
+	bot := &discord.Session{}
+	local := &discord.Session{}
+
+	service := &BotService{
+		Bot:        bot,
+		shards:     map[int]*Shard{1: {ID: 1, Session: local}},
+		shardCount: 2,
+	}
+
+	if session := service.SessionFor(strconv.FormatUint(1<<22, 10)); session != local {
+		t.Error("expected a guild of a local shard to use the session of the shard")
+	}
+
+	if session := service.SessionFor(strconv.FormatUint(2<<22, 10)); session != bot {
+		t.Error("expected a guild of another process to use the session of the bot")
+	}
+}
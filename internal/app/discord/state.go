@@ -0,0 +1,45 @@
+package discord
+
+import (
+	discord "github.com/bwmarrin/discordgo"
+	"slices"
+)
+
+// configureState limits the state to what the commands read from it, the roles of each guild. Members are not
+// cached even when their events are received, nothing looks them up.
+func configureState(state *discord.State) {
+	state.TrackRoles = true
+
+	state.TrackChannels = false
+	state.TrackThreads = false
+	state.TrackThreadMembers = false
+	state.TrackEmojis = false
+	state.TrackMembers = false
+	state.TrackVoice = false
+	state.TrackPresences = false
+	state.MaxMessageCount = 0
+}
+
+// stateRoleCache serves the roles of guilds from the state of the shard each guild is assigned to
+type stateRoleCache struct {
+	stateFor func(guildID string) *discord.State
+}
+
+func (c stateRoleCache) CachedRoles(guildID string) ([]*discord.Role, bool) {
+	state := c.stateFor(guildID)
+
+	guild, err := state.Guild(guildID)
+	if err != nil {
+		return nil, false
+	}
+
+	state.RLock()
+	defer state.RUnlock()
+
+	// Unavailable guilds have not been sent yet, their roles are not known
+	if guild.Unavailable {
+		return nil, false
+	}
+
+	return slices.Clone(guild.Roles), true
+}
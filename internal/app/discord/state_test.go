@@ -0,0 +1,52 @@
+package discord
+
+import (
+	discord "github.com/bwmarrin/discordgo"
+	"testing"
+)
+
+func TestBotConfigurationIntents(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   BotConfiguration
+		expected discord.Intent
+	}{
+		{
+			name:     "only guilds by default",
+			expected: discord.IntentsGuilds,
+		},
+		{
+			name:     "members for member cleanup",
+			config:   BotConfiguration{MemberCleanup: true},
+			expected: discord.IntentsGuilds | discord.IntentsGuildMembers,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if intents := test.config.Intents(); intents != test.expected {
+				t.Errorf("expected intents %b, got %b", test.expected, intents)
+			}
+		})
+	}
+}
+
+func TestStateRoleCache(t *testing.T) {
+	state := discord.NewState()
+	configureState(state)
+
+	_ = state.GuildAdd(&discord.Guild{ID: "guild", Roles: []*discord.Role{{ID: "role"}}})
+	_ = state.GuildAdd(&discord.Guild{ID: "unavailable", Unavailable: true})
+
+	cache := stateRoleCache{func(string) *discord.State { return state }}
+
+	if roles, cached := cache.CachedRoles("guild"); !cached || len(roles) != 1 || roles[0].ID != "role" {
+		t.Errorf("expected the roles of the guild, got %v", roles)
+	}
+
+	for _, guild := range []string{"unavailable", "unknown"} {
+		if _, cached := cache.CachedRoles(guild); cached {
+			t.Errorf("expected the roles of %s to not be cached", guild)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package discord
+
+import (
+	"emperror.dev/errors"
+	"encoding/json"
+	discord "github.com/bwmarrin/discordgo"
+	"log/slog"
+	"reflect"
+)
+
+// CommandChanges are the changes a sync makes to the commands registered with Discord
+type CommandChanges struct {
+	Create    []*discord.ApplicationCommand
+	Update    []*discord.ApplicationCommand
+	Delete    []*discord.ApplicationCommand
+	Unchanged int
+}
+
+// Empty reports whether the registered commands already match
+func (c CommandChanges) Empty() bool {
+	return len(c.Create) == 0 && len(c.Update) == 0 && len(c.Delete) == 0
+}
+
+// LogValue lists the names of the changed commands
+func (c CommandChanges) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Any("create", commandNames(c.Create)),
+		slog.Any("update", commandNames(c.Update)),
+		slog.Any("delete", commandNames(c.Delete)),
+		slog.Int("unchanged", c.Unchanged))
+}
+
+func commandNames(commands []*discord.ApplicationCommand) []string {
+	names := make([]string, 0, len(commands))
+	for _, command := range commands {
+		names = append(names, command.Name)
+	}
+
+	return names
+}
+
+// DiffCommands compares the commands registered with Discord to the desired ones, by name
+func DiffCommands(existing []*discord.ApplicationCommand, desired []*discord.ApplicationCommand) (CommandChanges, error) {
+	var changes CommandChanges
+
+	registered := make(map[string]*discord.ApplicationCommand, len(existing))
+	for _, command := range existing {
+		registered[command.Name] = command
+	}
+
+	for _, command := range desired {
+		current, exists := registered[command.Name]
+		if !exists {
+			changes.Create = append(changes.Create, command)
+			continue
+		}
+
+		delete(registered, command.Name)
+
+		equal, err := commandsEqual(current, command)
+		if err != nil {
+			return changes, errors.WrapWithDetails(err, "failed to compare command", "command", command.Name)
+		}
+
+		if equal {
+			changes.Unchanged++
+		} else {
+			changes.Update = append(changes.Update, command)
+		}
+	}
+
+	for _, command := range existing {
+		if _, stale := registered[command.Name]; stale {
+			changes.Delete = append(changes.Delete, command)
+		}
+	}
+
+	return changes, nil
+}
+
+// commandsEqual compares two commands as Discord sees them, ignoring the fields it assigns and the defaults it
+// fills in
+func commandsEqual(a *discord.ApplicationCommand, b *discord.ApplicationCommand) (bool, error) {
+	normalizedA, err := normalizeCommand(a)
+	if err != nil {
+		return false, err
+	}
+
+	normalizedB, err := normalizeCommand(b)
+	if err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(normalizedA, normalizedB), nil
+}
+
+func normalizeCommand(command *discord.ApplicationCommand) (map[string]any, error) {
+	encoded, err := json.Marshal(command)
+	if err != nil {
+		return nil, err
+	}
+
+	var normalized map[string]any
+	if err = json.Unmarshal(encoded, &normalized); err != nil {
+		return nil, err
+	}
+
+	for _, assigned := range []string{"id", "application_id", "guild_id", "version"} {
+		delete(normalized, assigned)
+	}
+
+	if normalized["type"] == float64(discord.ChatApplicationCommand) {
+		delete(normalized, "type")
+	}
+
+	for _, allowed := range []string{"dm_permission", "default_permission"} {
+		if normalized[allowed] == true {
+			delete(normalized, allowed)
+		}
+	}
+
+	return pruneEmpty(normalized).(map[string]any), nil
+}
+
+// pruneEmpty removes the empty and false values Discord omits from the commands it returns
+func pruneEmpty(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, inner := range value {
+			inner = pruneEmpty(inner)
+
+			switch inner := inner.(type) {
+			case nil:
+				delete(value, key)
+			case bool:
+				if !inner {
+					delete(value, key)
+				}
+			case string:
+				if inner == "" {
+					delete(value, key)
+				}
+			case []any:
+				if len(inner) == 0 {
+					delete(value, key)
+				}
+			case map[string]any:
+				if len(inner) == 0 {
+					delete(value, key)
+				}
+			}
+
+			if _, kept := value[key]; kept {
+				value[key] = inner
+			}
+		}
+	case []any:
+		for index, inner := range value {
+			value[index] = pruneEmpty(inner)
+		}
+	}
+
+	return value
+}
+
+// SyncCommands makes the commands registered with Discord match the registry, globally or in a single guild.
+// Nothing is sent when they already match, otherwise every command is sent in one bulk overwrite, which only
+// creates, updates and deletes the ones that differ.
+func (d *BotService) SyncCommands(guildID string, dryRun bool) (CommandChanges, error) {
+	applicationID, err := d.applicationID()
+	if err != nil {
+		return CommandChanges{}, err
+	}
+
+	existing, err := d.Bot.ApplicationCommands(applicationID, guildID)
+	if err != nil {
+		return CommandChanges{}, errors.WrapWithDetails(err, "failed to fetch registered commands", "guild", guildID)
+	}
+
+	desired := d.commands.GetApplicationCommands()
+
+	changes, err := DiffCommands(existing, desired)
+	if err != nil {
+		return changes, err
+	}
+
+	d.Logger.Info("compared slash commands",
+		slog.String("guild", guildID),
+		slog.Bool("dry_run", dryRun),
+		slog.Any("changes", changes))
+
+	if dryRun || changes.Empty() {
+		return changes, nil
+	}
+
+	if _, err = d.Bot.ApplicationCommandBulkOverwrite(applicationID, guildID, desired); err != nil {
+		return changes, errors.WrapWithDetails(err, "failed to overwrite registered commands", "guild", guildID)
+	}
+
+	d.Logger.Info("synced slash commands",
+		slog.String("guild", guildID),
+		slog.Int("count", len(desired)))
+
+	return changes, nil
+}
+
+// applicationID returns the ID of the bot application, from the session once it is open or from the API when the
+// session is only used for requests
+func (d *BotService) applicationID() (string, error) {
+	if d.Bot.State != nil && d.Bot.State.User != nil {
+		return d.Bot.State.User.ID, nil
+	}
+
+	user, err := d.Bot.User("@me")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch bot user")
+	}
+
+	return user.ID, nil
+}
@@ -0,0 +1,114 @@
+package discord
+
+import (
+	discord "github.com/bwmarrin/discordgo"
+	"slices"
+	"testing"
+)
+
+func TestDiffCommands(t *testing.T) {
+	permissions := int64(discord.PermissionManageServer)
+	allowed, denied := true, false
+
+	desired := func() *discord.ApplicationCommand {
+		return &discord.ApplicationCommand{
+			Name:                     "curator",
+			Description:              "Manage the guild",
+			DefaultMemberPermissions: &permissions,
+			DMPermission:             &denied,
+			Options: []*discord.ApplicationCommandOption{
+				{
+					Type:        discord.ApplicationCommandOptionString,
+					Name:        "theme",
+					Description: "The theme",
+					Required:    true,
+					Choices: []*discord.ApplicationCommandOptionChoice{
+						{Name: "Halloween", Value: "halloween"},
+					},
+				},
+			},
+		}
+	}
+
+	// registered is the command as Discord returns it, with the fields it assigns and fills in
+	registered := func(edit func(command *discord.ApplicationCommand)) *discord.ApplicationCommand {
+		command := desired()
+		command.ID = "1"
+		command.ApplicationID = "2"
+		command.Version = "3"
+		command.Type = discord.ChatApplicationCommand
+		command.DefaultPermission = &allowed
+		command.NSFW = &denied
+
+		if edit != nil {
+			edit(command)
+		}
+
+		return command
+	}
+
+	tests := []struct {
+		name     string
+		existing []*discord.ApplicationCommand
+		desired  []*discord.ApplicationCommand
+		create   []string
+		update   []string
+		delete   []string
+	}{
+		{
+			name:     "nothing registered",
+			existing: nil,
+			desired:  []*discord.ApplicationCommand{desired()},
+			create:   []string{"curator"},
+		},
+		{
+			name:     "registered command matches",
+			existing: []*discord.ApplicationCommand{registered(nil)},
+			desired:  []*discord.ApplicationCommand{desired()},
+		},
+		{
+			name: "description changed",
+			existing: []*discord.ApplicationCommand{registered(func(command *discord.ApplicationCommand) {
+				command.Description = "Old description"
+			})},
+			desired: []*discord.ApplicationCommand{desired()},
+			update:  []string{"curator"},
+		},
+		{
+			name: "permissions changed",
+			existing: []*discord.ApplicationCommand{registered(func(command *discord.ApplicationCommand) {
+				command.DefaultMemberPermissions = nil
+				command.DMPermission = &allowed
+			})},
+			desired: []*discord.ApplicationCommand{desired()},
+			update:  []string{"curator"},
+		},
+		{
+			name:     "stale command",
+			existing: []*discord.ApplicationCommand{registered(nil), {ID: "4", Name: "stale", Description: "Stale"}},
+			desired:  []*discord.ApplicationCommand{desired()},
+			delete:   []string{"stale"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := DiffCommands(test.existing, test.desired)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if names := commandNames(changes.Create); !slices.Equal(names, test.create) {
+				t.Errorf("expected create %v, got %v", test.create, names)
+			}
+
+			if names := commandNames(changes.Update); !slices.Equal(names, test.update) {
+				t.Errorf("expected update %v, got %v", test.update, names)
+			}
+
+			if names := commandNames(changes.Delete); !slices.Equal(names, test.delete) {
+				t.Errorf("expected delete %v, got %v", test.delete, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often the response of an interaction is edited with the progress of a job, each edit
+// takes from the same webhook bucket as the summary the command edits in once the job is done
+const progressInterval = 2 * time.Second
+
+// ResponseEditor is the part of the Discord session that edits the response of an interaction
+type ResponseEditor interface {
+	InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+// InteractionProgress returns a progress callback editing the deferred response of the interaction with how
+// many of the operations are done, prefixed with the label. Edits are throttled and skipped for the last
+// operation, the command replaces the response with its own summary once the job is done.
+func InteractionProgress(session ResponseEditor, interaction *discordgo.Interaction, logger *slog.Logger, label string) func(progress Progress) {
+	var mutex sync.Mutex
+	var last time.Time
+
+	return func(progress Progress) {
+		if progress.Finished() {
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		now := time.Now()
+		if now.Sub(last) < progressInterval {
+			return
+		}
+
+		last = now
+
+		content := describeProgress(label, progress)
+
+		if _, err := session.InteractionResponseEdit(interaction, &discordgo.WebhookEdit{Content: &content}); err != nil {
+			logger.Warn("failed to report job progress",
+				slog.Any("error", err),
+				slog.Any("progress", progress))
+		}
+	}
+}
+
+func describeProgress(label string, progress Progress) string {
+	content := fmt.Sprintf("%s... %d/%d", label, progress.Done+progress.Failed, progress.Total)
+	if progress.Failed > 0 {
+		content += fmt.Sprintf(" (%d failed)", progress.Failed)
+	}
+
+	return content
+}
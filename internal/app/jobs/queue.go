@@ -0,0 +1,250 @@
+package jobs
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	queueClosed = errors.Sentinel("job queue is closed")
+
+	// attempts is how many times a failing operation is tried before it counts as failed
+	attempts = 5
+
+	initialBackoff = time.Second
+	maximumBackoff = 30 * time.Second
+)
+
+// Operation is a single Discord request of a job. It should pass the context on with discordgo.WithContext, so
+// a request waiting on its rate limit bucket is abandoned when the job is cancelled.
+type Operation struct {
+	// Target names what the operation changes in logs, such as the ID of a role
+	Target string
+	Run    func(ctx context.Context) error
+}
+
+// Progress is how far a job has gotten through its operations
+type Progress struct {
+	Done   int
+	Failed int
+	Total  int
+}
+
+// Finished reports whether every operation of the job has been attempted
+func (p Progress) Finished() bool {
+	return p.Done+p.Failed >= p.Total
+}
+
+func (p Progress) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("done", p.Done),
+		slog.Int("failed", p.Failed),
+		slog.Int("total", p.Total))
+}
+
+// Job is a batch of mutations to a guild, run after every job queued for the guild before it
+type Job struct {
+	Name       string
+	Guild      string
+	Operations []Operation
+
+	// OnProgress is called after each operation from the goroutine running the job, and may be nil
+	OnProgress func(progress Progress)
+}
+
+type pendingJob struct {
+	ctx  context.Context
+	job  Job
+	done chan jobResult
+}
+
+type jobResult struct {
+	progress Progress
+	err      error
+}
+
+// Queue runs the jobs of each guild one at a time, so bulk features do not race each other editing the same
+// roles or crowd out each other's requests in the role buckets of a guild. Requests wait on discordgo's rate
+// limit buckets, rate limited and failed requests are retried with backoff.
+type Queue struct {
+	Logger *slog.Logger
+	Abort  <-chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex   sync.Mutex
+	guilds  map[string][]*pendingJob
+	workers sync.WaitGroup
+}
+
+func (q *Queue) Init(_ common.Configuration) error {
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	q.guilds = make(map[string][]*pendingJob)
+
+	return nil
+}
+
+func (q *Queue) Start() error {
+	// Jobs are abandoned as soon as the app starts shutting down rather than once the queue is closed
+	go func() {
+		select {
+		case <-q.Abort:
+			q.cancel()
+		case <-q.ctx.Done():
+		}
+	}()
+
+	return common.ServiceStartedNormallyButDoesNotBlock
+}
+
+func (q *Queue) Close(_ error) error {
+	q.cancel()
+	q.workers.Wait()
+
+	return nil
+}
+
+// Run queues the job behind the other jobs of its guild and waits for it to finish, returning how far it got.
+// Failed operations are logged and counted, an error is only returned when the job was cancelled.
+func (q *Queue) Run(ctx context.Context, job Job) (Progress, error) {
+	pending := &pendingJob{ctx: ctx, job: job, done: make(chan jobResult, 1)}
+
+	q.mutex.Lock()
+
+	if q.ctx.Err() != nil {
+		q.mutex.Unlock()
+		return Progress{Total: len(job.Operations)}, queueClosed
+	}
+
+	queued, running := q.guilds[job.Guild]
+	q.guilds[job.Guild] = append(queued, pending)
+
+	// The guild has no worker while nothing is queued for it, the first job starts one
+	if !running {
+		q.workers.Add(1)
+		go q.work(job.Guild)
+	}
+
+	q.mutex.Unlock()
+
+	result := <-pending.done
+
+	return result.progress, result.err
+}
+
+// work runs the jobs queued for the guild until there are none left
+func (q *Queue) work(guild string) {
+	defer q.workers.Done()
+
+	for {
+		q.mutex.Lock()
+
+		queued := q.guilds[guild]
+		if len(queued) == 0 {
+			delete(q.guilds, guild)
+			q.mutex.Unlock()
+			return
+		}
+
+		pending := queued[0]
+		q.guilds[guild] = queued[1:]
+
+		q.mutex.Unlock()
+
+		progress, err := q.run(pending.ctx, pending.job)
+		pending.done <- jobResult{progress: progress, err: err}
+	}
+}
+
+func (q *Queue) run(parent context.Context, job Job) (Progress, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	stop := context.AfterFunc(q.ctx, cancel)
+	defer stop()
+
+	progress := Progress{Total: len(job.Operations)}
+
+	logger := q.Logger.With(
+		slog.String("job", job.Name),
+		slog.String("guild", job.Guild))
+
+	for _, operation := range job.Operations {
+		if ctx.Err() != nil {
+			logger.Warn("job cancelled",
+				slog.Any("progress", progress))
+
+			return progress, errors.Wrap(ctx.Err(), "job cancelled")
+		}
+
+		if err := q.attempt(ctx, logger, operation); err != nil {
+			logger.Error("job operation failed",
+				slog.Any("error", err),
+				slog.String("target", operation.Target))
+
+			progress.Failed++
+		} else {
+			progress.Done++
+		}
+
+		if job.OnProgress != nil {
+			job.OnProgress(progress)
+		}
+	}
+
+	return progress, nil
+}
+
+// attempt runs the operation, retrying it while Discord rate limits it or fails on its side
+func (q *Queue) attempt(ctx context.Context, logger *slog.Logger, operation Operation) error {
+	var permanent error
+
+	err := common.Retry(ctx.Done(), attempts, initialBackoff, maximumBackoff,
+		func() error {
+			err := operation.Run(ctx)
+			if err != nil && !IsRetryable(err) {
+				permanent = err
+				return nil
+			}
+
+			return err
+		},
+		func(attempt int, wait time.Duration, err error) {
+			logger.Warn("retrying job operation",
+				slog.Any("error", err),
+				slog.String("target", operation.Target),
+				slog.Int("attempt", attempt+1),
+				slog.Duration("wait", wait))
+		})
+
+	if err != nil {
+		return err
+	}
+
+	return permanent
+}
+
+// IsRetryable reports whether a failed Discord request may succeed when sent again, which is when it was rate
+// limited or Discord failed on its side
+func IsRetryable(err error) bool {
+	var rateLimitErr *discordgo.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return true
+	}
+
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil {
+		status := restErr.Response.StatusCode
+
+		return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+	}
+
+	return false
+}
@@ -0,0 +1,159 @@
+package jobs
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestQueue(t *testing.T) *Queue {
+	queue := &Queue{Logger: slog.New(slog.DiscardHandler), Abort: make(chan struct{})}
+	if err := queue.Init(nil); err != nil {
+		t.Fatalf("failed to init queue: %v", err)
+	}
+
+	_ = queue.Start()
+	t.Cleanup(func() { _ = queue.Close(nil) })
+
+	return queue
+}
+
+func restError(status int) error {
+	return &discordgo.RESTError{Response: &http.Response{StatusCode: status}}
+}
+
+func TestQueueRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures []error
+		done     int
+		failed   int
+		calls    int
+	}{
+		{
+			name:  "succeeds",
+			done:  1,
+			calls: 1,
+		},
+		{
+			name:     "retries a server error",
+			failures: []error{restError(http.StatusBadGateway)},
+			done:     1,
+			calls:    2,
+		},
+		{
+			name:     "does not retry a missing role",
+			failures: []error{restError(http.StatusNotFound)},
+			failed:   1,
+			calls:    1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := newTestQueue(t)
+			calls := 0
+
+			operation := Operation{
+				Target: "role",
+				Run: func(ctx context.Context) error {
+					calls++
+					if calls <= len(test.failures) {
+						return test.failures[calls-1]
+					}
+
+					return nil
+				},
+			}
+
+			progress, err := queue.Run(context.Background(), Job{Name: "test", Guild: "guild", Operations: []Operation{operation}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if progress.Done != test.done || progress.Failed != test.failed {
+				t.Errorf("expected %d done and %d failed, got %+v", test.done, test.failed, progress)
+			}
+
+			if calls != test.calls {
+				t.Errorf("expected %d calls, got %d", test.calls, calls)
+			}
+		})
+	}
+}
+
+func TestQueueSerializesGuildJobs(t *testing.T) {
+	queue := newTestQueue(t)
+
+	var mutex sync.Mutex
+	running := 0
+	overlapped := false
+
+	operation := Operation{
+		Run: func(ctx context.Context) error {
+			mutex.Lock()
+			running++
+			overlapped = overlapped || running > 1
+			mutex.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+
+			return nil
+		},
+	}
+
+	var jobs sync.WaitGroup
+	for range 10 {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			_, _ = queue.Run(context.Background(), Job{Guild: "guild", Operations: []Operation{operation, operation}})
+		}()
+	}
+
+	jobs.Wait()
+
+	if overlapped {
+		t.Error("expected the jobs of a guild to run one at a time")
+	}
+}
+
+func TestQueueCancelledOnAbort(t *testing.T) {
+	abort := make(chan struct{})
+
+	queue := &Queue{Logger: slog.New(slog.DiscardHandler), Abort: abort}
+	_ = queue.Init(nil)
+	_ = queue.Start()
+
+	operation := Operation{
+		Run: func(ctx context.Context) error {
+			close(abort)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	progress, err := queue.Run(context.Background(), Job{Guild: "guild", Operations: []Operation{operation, operation}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the job to be cancelled, got %v", err)
+	}
+
+	if progress.Done != 0 || progress.Failed != 1 {
+		t.Errorf("expected the second operation to be skipped, got %+v", progress)
+	}
+
+	if _, err = queue.Run(context.Background(), Job{Guild: "guild"}); !errors.Is(err, queueClosed) {
+		t.Errorf("expected the queue to refuse jobs after abort, got %v", err)
+	}
+
+	_ = queue.Close(nil)
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"emperror.dev/errors"
+	"time"
+)
+
+const (
+	tickTooShort      = errors.Sentinel("scheduler tick must be at least one second")
+	batchSizeNegative = errors.Sentinel("scheduler batch size cannot be negative")
+)
+
+const (
+	defaultTick      = time.Minute
+	defaultBatchSize = 50
+	defaultReserve   = 2
+)
+
+type Config struct {
+	// Tick is how often due schedules are checked
+	Tick time.Duration
+	// BatchSize is the most role edits issued per tick across all guilds
+	BatchSize int
+	// Reserve is the number of role edit requests per guild left for interactive commands
+	Reserve int
+}
+
+func (c *Config) Process() error {
+	if c.Tick == 0 {
+		c.Tick = defaultTick
+	}
+
+	if c.BatchSize == 0 {
+		c.BatchSize = defaultBatchSize
+	}
+
+	if c.Reserve == 0 {
+		c.Reserve = defaultReserve
+	}
+
+	return nil
+}
+
+func (c *Config) Validate() error {
+	if c.Tick < time.Second {
+		return tickTooShort
+	}
+
+	if c.BatchSize < 0 {
+		return batchSizeNegative
+	}
+
+	return nil
+}
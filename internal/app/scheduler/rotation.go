@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"emperror.dev/errors"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"math/rand/v2"
+	"slices"
+	"sort"
+)
+
+const (
+	noFavoritesToRotate = errors.Sentinel("user has no favorite colors to rotate through")
+	unknownSource       = errors.Sentinel("unknown schedule source")
+)
+
+const (
+	// paletteRotationSize is the number of palette colors cycled through by a palette schedule
+	paletteRotationSize = 5
+	// hueDriftDegrees is how far the hue moves on each run of a hue drift schedule
+	hueDriftDegrees = 15.0
+)
+
+// NextColor computes the color a schedule applies on its current step
+func NextColor(schedule backend.Schedule, favorites []backend.Favorite) (int, error) {
+	switch schedule.Source {
+	case backend.ScheduleSourceRandom:
+		randomColor := common.ColorsAndNames[rand.IntN(len(common.ColorsAndNames))]
+		return common.ParseTextToColorInt(randomColor.Color)
+
+	case backend.ScheduleSourcePalette:
+		paletteType, err := common.PaletteTypeFromString(schedule.Palette)
+		if err != nil {
+			return 0, err
+		}
+
+		palette, err := common.GeneratePalette(schedule.BaseColor, paletteType, paletteRotationSize)
+		if err != nil {
+			return 0, err
+		}
+
+		return palette[schedule.Step%len(palette)].ColorInt, nil
+
+	case backend.ScheduleSourceFavorites:
+		if len(favorites) == 0 {
+			return 0, noFavoritesToRotate
+		}
+
+		return favorites[schedule.Step%len(favorites)].Color, nil
+
+	case backend.ScheduleSourceHueDrift:
+		h, s, v := common.RGBToHSV(common.IntToRGB(schedule.BaseColor))
+		r, g, b := common.HSVToRGB(h+float64(schedule.Step+1)*hueDriftDegrees, s, v)
+
+		return common.RGBToInt(r, g, b), nil
+	}
+
+	return 0, errors.WithDetails(unknownSource, "source", schedule.Source)
+}
+
+// interleave orders schedules round-robin across guilds, so a guild with many due schedules
+// cannot use up a whole batch while other guilds wait
+func interleave(schedules []backend.Schedule) []backend.Schedule {
+	byGuild := make(map[string][]backend.Schedule)
+	for _, schedule := range schedules {
+		byGuild[schedule.Guild] = append(byGuild[schedule.Guild], schedule)
+	}
+
+	guilds := make([]string, 0, len(byGuild))
+	for guild, guildSchedules := range byGuild {
+		guilds = append(guilds, guild)
+
+		sort.SliceStable(guildSchedules, func(i, j int) bool {
+			return guildSchedules[i].NextRun.Before(guildSchedules[j].NextRun)
+		})
+	}
+
+	slices.Sort(guilds)
+
+	ordered := make([]backend.Schedule, 0, len(schedules))
+
+	for round := 0; len(ordered) < len(schedules); round++ {
+		for _, guild := range guilds {
+			if round < len(byGuild[guild]) {
+				ordered = append(ordered, byGuild[guild][round])
+			}
+		}
+	}
+
+	return ordered
+}
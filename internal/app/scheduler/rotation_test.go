@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"testing"
+	"time"
+)
+
+func TestNextColor(t *testing.T) {
+	favorites := []backend.Favorite{
+		{Color: 0xFF0000},
+		{Color: 0x00FF00},
+		{Color: 0x0000FF},
+	}
+
+	tests := []struct {
+		name     string
+		schedule backend.Schedule
+		expected int
+		wantErr  bool
+	}{
+		{
+			name:     "Favorites - first step",
+			schedule: backend.Schedule{Source: backend.ScheduleSourceFavorites, Step: 0},
+			expected: 0xFF0000,
+		},
+		{
+			name:     "Favorites - wraps around",
+			schedule: backend.Schedule{Source: backend.ScheduleSourceFavorites, Step: 4},
+			expected: 0x00FF00,
+		},
+		{
+			name:     "Hue drift - moves away from base",
+			schedule: backend.Schedule{Source: backend.ScheduleSourceHueDrift, BaseColor: 0xFF0000, Step: 3},
+			expected: 0xFFFF00,
+		},
+		{
+			name:     "Palette - unknown palette type",
+			schedule: backend.Schedule{Source: backend.ScheduleSourcePalette, Palette: "plaid"},
+			wantErr:  true,
+		},
+		{
+			name:     "Unknown source",
+			schedule: backend.Schedule{Source: "sideways"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextColor(tt.schedule, favorites)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NextColor() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.expected {
+				t.Errorf("NextColor() = %06X, want %06X", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestInterleave(t *testing.T) {
+	now := time.Now()
+
+	schedules := []backend.Schedule{
+		{Guild: "b", User: "1", NextRun: now},
+		{Guild: "a", User: "2", NextRun: now.Add(time.Second)},
+		{Guild: "a", User: "1", NextRun: now},
+		{Guild: "a", User: "3", NextRun: now.Add(2 * time.Second)},
+		{Guild: "c", User: "1", NextRun: now},
+	}
+
+	expected := []string{"a:1", "b:1", "c:1", "a:2", "a:3"}
+
+	got := interleave(schedules)
+	if len(got) != len(expected) {
+		t.Fatalf("interleave() returned %d schedules, want %d", len(got), len(expected))
+	}
+
+	for i, schedule := range got {
+		if key := schedule.Guild + ":" + schedule.User; key != expected[i] {
+			t.Errorf("interleave()[%d] = %s, want %s", i, key, expected[i])
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package scheduler
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord"
+	"github.com/Sxtanna/chromatic_curator/internal/app/discord/cmds"
+	"github.com/Sxtanna/chromatic_curator/internal/app/jobs"
+	"github.com/Sxtanna/chromatic_curator/internal/app/themes"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	configurationMissing = errors.Sentinel("scheduler configuration missing")
+)
+
+// Scheduler periodically applies the color rotation schedules members opted in to
+type Scheduler struct {
+	Logger      *slog.Logger
+	Backend     backend.Backend
+	Health      backend.HealthReporter
+	Coordinator backend.Coordinator
+	Bot         *discord.BotService
+
+	config *Config
+
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// themeJobs holds the guilds whose theme is being applied or reverted. Those jobs outlive the tick that
+	// started them, and run until they finish or the job queue is aborted.
+	themeMutex   sync.Mutex
+	themeJobs    map[string]bool
+	themeWorkers sync.WaitGroup
+}
+
+func (s *Scheduler) Init(config common.Configuration) error {
+	schedulerConfiguration := common.FindConfiguration[Config](config)
+	if schedulerConfiguration == nil {
+		return configurationMissing
+	}
+
+	s.config = schedulerConfiguration
+	s.stop = make(chan struct{})
+	s.themeJobs = make(map[string]bool)
+
+	return nil
+}
+
+func (s *Scheduler) Start() error {
+	ticker := time.NewTicker(s.config.Tick)
+	defer ticker.Stop()
+
+	s.Logger.Debug("scheduler started",
+		slog.Duration("tick", s.config.Tick),
+		slog.Int("batch", s.config.BatchSize))
+
+	for {
+		select {
+		case <-s.stop:
+			return nil
+		case <-ticker.C:
+			s.tick()
+		}
+	}
+}
+
+func (s *Scheduler) Close(_ error) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+
+	s.themeWorkers.Wait()
+
+	return nil
+}
+
+func (s *Scheduler) tick() {
+	// Only the leader runs schedules, every instance running them would apply each schedule several times. Each
+	// guild is edited through the session of its shard, guilds on shards of other processes through the bot session.
+	if !s.Coordinator.Leader() {
+		return
+	}
+
+	// Schedules stay due while the backend is unreachable and are caught up on once it recovers
+	if !s.Health.Healthy() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Tick)
+	defer cancel()
+
+	now := time.Now()
+
+	s.tickApprovals(ctx, now)
+
+	themed := s.tickThemes(ctx, now)
+
+	schedules, err := s.Backend.ListSchedules(ctx)
+	if err != nil {
+		s.Logger.Error("failed to list schedules",
+			slog.Any("error", err))
+		return
+	}
+
+	due := s.dueSchedules(ctx, schedules, themed, now)
+	if len(due) == 0 {
+		return
+	}
+
+	roles := s.resolveRoles(ctx, due)
+
+	edits := 0
+	deferred := make(map[string]bool)
+
+	for _, schedule := range interleave(due) {
+		if edits >= s.config.BatchSize {
+			break
+		}
+
+		// Leave the remaining requests of a nearly exhausted guild to its members, the schedule
+		// stays due and is picked up again on the next tick
+		if deferred[schedule.Guild] || !s.guildHasCapacity(schedule.Guild) {
+			deferred[schedule.Guild] = true
+			continue
+		}
+
+		guildRoles, resolved := roles[schedule.Guild]
+		if !resolved {
+			continue
+		}
+
+		if err := s.run(ctx, schedule, guildRoles[schedule.User], now); err != nil {
+			s.Logger.Error("failed to run schedule",
+				slog.Any("error", err),
+				slog.String("guild", schedule.Guild),
+				slog.String("user", schedule.User))
+		}
+
+		edits++
+	}
+
+	s.Logger.Debug("scheduler tick complete",
+		slog.Int("due", len(due)),
+		slog.Int("edits", edits),
+		slog.Int("deferred_guilds", len(deferred)))
+}
+
+// dueSchedules returns the schedules whose next run has passed, leaving out the guilds that have a theme applied and
+// the guilds that hold role changes for staff approval. Rotations are paused in those guilds, a theme would be painted
+// over and a rotation would change roles without staff signing off. The schedules stay due and resume once the theme
+// is reverted or approval is turned off.
+func (s *Scheduler) dueSchedules(ctx context.Context, schedules []backend.Schedule, themed map[string]bool, now time.Time) []backend.Schedule {
+	moderated := make(map[string]bool)
+	due := make([]backend.Schedule, 0)
+
+	for _, schedule := range schedules {
+		if schedule.NextRun.After(now) || themed[schedule.Guild] {
+			continue
+		}
+
+		paused, checked := moderated[schedule.Guild]
+		if !checked {
+			settings, err := s.Backend.GetGuildSettings(ctx, schedule.Guild)
+			if err != nil {
+				s.Logger.Error("failed to get guild settings for schedules",
+					slog.Any("error", err),
+					slog.String("guild", schedule.Guild))
+			}
+
+			// Schedules of a guild whose settings cannot be loaded are retried on the next tick
+			paused = err != nil || settings.ApprovalRequired
+			moderated[schedule.Guild] = paused
+		}
+
+		if !paused {
+			due = append(due, schedule)
+		}
+	}
+
+	return due
+}
+
+// resolveRoles looks up the personal roles of the due schedules with one request per guild, keyed by guild
+// and then user. Guilds whose lookup failed are left out, their schedules are retried on the next tick
+func (s *Scheduler) resolveRoles(ctx context.Context, due []backend.Schedule) map[string]map[string]string {
+	users := make(map[string][]string)
+	for _, schedule := range due {
+		users[schedule.Guild] = append(users[schedule.Guild], schedule.User)
+	}
+
+	roles := make(map[string]map[string]string, len(users))
+
+	for guild, guildUsers := range users {
+		guildRoles, err := s.Backend.GetRolesBatch(ctx, guild, guildUsers)
+		if err != nil {
+			s.Logger.Error("failed to get roles for schedules",
+				slog.Any("error", err),
+				slog.String("guild", guild))
+			continue
+		}
+
+		roles[guild] = guildRoles
+	}
+
+	return roles
+}
+
+// tickApprovals expires the approval requests that staff did not review in time
+func (s *Scheduler) tickApprovals(ctx context.Context, now time.Time) {
+	requests, err := s.Backend.ListApprovals(ctx)
+	if err != nil {
+		s.Logger.Error("failed to list approval requests",
+			slog.Any("error", err))
+		return
+	}
+
+	for _, request := range requests {
+		if request.ExpiresAt.After(now) {
+			continue
+		}
+
+		s.Logger.Info("approval request expired",
+			slog.String("guild", request.Guild),
+			slog.String("request", request.ID))
+
+		cmds.ExpireApproval(s.Bot.SessionFor(request.Guild), s.Backend, s.Logger, request)
+	}
+}
+
+// tickThemes starts applying and reverting the guild themes whose start or end time has passed, returning the
+// guilds that have a theme applied or one being applied or reverted
+func (s *Scheduler) tickThemes(ctx context.Context, now time.Time) map[string]bool {
+	themed := make(map[string]bool)
+
+	guildThemes, err := s.Backend.ListGuildThemes(ctx)
+	if err != nil {
+		s.Logger.Error("failed to list guild themes",
+			slog.Any("error", err))
+		return themed
+	}
+
+	for _, guildTheme := range guildThemes {
+		if !themes.IsDue(guildTheme, now) {
+			themed[guildTheme.Guild] = guildTheme.Applied
+			continue
+		}
+
+		// Rotations stay paused until the theme is done, the next tick sees whether it is still applied
+		themed[guildTheme.Guild] = true
+
+		s.startTheme(guildTheme)
+	}
+
+	return themed
+}
+
+// startTheme applies or reverts a due guild theme in the background, unless the theme of the guild is already
+// being applied or reverted. Recoloring every role of a guild can take far longer than a tick, so the job does not
+// run under the deadline of the tick, only an abort of the job queue cancels it.
+func (s *Scheduler) startTheme(guildTheme backend.GuildTheme) {
+	s.themeMutex.Lock()
+	defer s.themeMutex.Unlock()
+
+	if s.themeJobs[guildTheme.Guild] {
+		return
+	}
+
+	s.themeJobs[guildTheme.Guild] = true
+	s.themeWorkers.Add(1)
+
+	go func() {
+		defer s.themeWorkers.Done()
+
+		defer func() {
+			s.themeMutex.Lock()
+			delete(s.themeJobs, guildTheme.Guild)
+			s.themeMutex.Unlock()
+		}()
+
+		ctx := context.Background()
+		session := s.Bot.SessionFor(guildTheme.Guild)
+
+		var err error
+
+		if !guildTheme.Applied {
+			_, err = themes.Apply(ctx, session, s.Bot.Jobs, s.Backend, s.Logger, guildTheme, nil)
+		} else {
+			_, err = themes.Revert(ctx, session, s.Bot.Jobs, s.Backend, s.Logger, guildTheme, nil)
+		}
+
+		if err != nil {
+			s.Logger.Error("failed to run scheduled guild theme",
+				slog.Any("error", err),
+				slog.String("guild", guildTheme.Guild),
+				slog.String("theme", guildTheme.Theme))
+		}
+	}()
+}
+
+// guildHasCapacity reports whether the role edit bucket of a guild has requests to spare
+func (s *Scheduler) guildHasCapacity(guild string) bool {
+	limiter := s.Bot.SessionFor(guild).Ratelimiter
+
+	bucket := limiter.GetBucket(discordgo.EndpointGuildRole(guild, ""))
+	bucket.Lock()
+	defer bucket.Unlock()
+
+	return limiter.GetWaitTime(bucket, s.config.Reserve+1) == 0
+}
+
+func (s *Scheduler) run(ctx context.Context, schedule backend.Schedule, role string, now time.Time) error {
+	if role == "" {
+		return s.Backend.DeleteSchedule(ctx, schedule.Guild, schedule.User)
+	}
+
+	var favorites []backend.Favorite
+	var err error
+
+	if schedule.Source == backend.ScheduleSourceFavorites {
+		if favorites, err = s.Backend.GetFavorites(ctx, schedule.Guild, schedule.User); err != nil {
+			return errors.Wrap(err, "failed to get favorites for schedule")
+		}
+	}
+
+	color, err := NextColor(schedule, favorites)
+	if err != nil {
+		// Push the schedule back so a schedule that cannot produce a color is not retried on every tick
+		schedule.NextRun = now.Add(schedule.Interval)
+
+		return errors.Combine(errors.Wrap(err, "failed to compute next color"), s.Backend.SetSchedule(ctx, schedule))
+	}
+
+	session := s.Bot.SessionFor(schedule.Guild)
+
+	// The edit waits behind the other jobs of the guild and is retried while Discord rate limits it or fails on its
+	// side, the queue only reports cancellation so the outcome of the last attempt is kept here
+	var editErr error
+
+	_, err = s.Bot.Jobs.Run(ctx, jobs.Job{
+		Name:  "rotate role color",
+		Guild: schedule.Guild,
+		Operations: []jobs.Operation{{
+			Target: role,
+			Run: func(ctx context.Context) error {
+				_, editErr = session.GuildRoleEdit(schedule.Guild, role, &discordgo.RoleParams{Color: &color}, discordgo.WithContext(ctx))
+				return editErr
+			},
+		}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to queue role color edit")
+	}
+
+	if err = editErr; err != nil {
+		var restErr *discordgo.RESTError
+		if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound {
+			s.Logger.Info("personal role no longer exists, removing schedule",
+				slog.String("guild", schedule.Guild),
+				slog.String("user", schedule.User),
+				slog.String("role", role))
+
+			_, err = s.Backend.DeleteRole(ctx, schedule.Guild, schedule.User)
+
+			return errors.Combine(err, s.Backend.DeleteSchedule(ctx, schedule.Guild, schedule.User))
+		}
+
+		return errors.Wrap(err, "failed to edit role color")
+	}
+
+	schedule.Step++
+	schedule.NextRun = now.Add(schedule.Interval)
+
+	return s.Backend.SetSchedule(ctx, schedule)
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"context"
+	appbackend "github.com/Sxtanna/chromatic_curator/internal/app/backend"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDueSchedules(t *testing.T) {
+	now := time.Now()
+
+	schedules := []backend.Schedule{
+		{Guild: "open", User: "due", NextRun: now.Add(-time.Minute)},
+		{Guild: "open", User: "later", NextRun: now.Add(time.Minute)},
+		{Guild: "moderated", User: "due", NextRun: now.Add(-time.Minute)},
+		{Guild: "themed", User: "due", NextRun: now.Add(-time.Minute)},
+	}
+
+	tests := []struct {
+		name      string
+		moderated bool
+		due       []string
+	}{
+		{
+			name: "every due schedule of unthemed guilds runs",
+			due:  []string{"open/due", "moderated/due"},
+		},
+		{
+			name:      "schedules pause while the guild requires approval",
+			moderated: true,
+			due:       []string{"open/due"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			store := appbackend.NewMemoryBackend()
+			_ = store.SetGuildSettings(ctx, "moderated", backend.GuildSettings{ApprovalRequired: test.moderated})
+
+			scheduler := &Scheduler{Logger: slog.New(slog.DiscardHandler), Backend: store}
+
+			due := make([]string, 0)
+			for _, schedule := range scheduler.dueSchedules(ctx, schedules, map[string]bool{"themed": true}, now) {
+				due = append(due, schedule.Guild+"/"+schedule.User)
+			}
+
+			if !slices.Equal(due, test.due) {
+				t.Errorf("dueSchedules() = %v, want %v", due, test.due)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package themes
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"github.com/Sxtanna/chromatic_curator/internal/app/jobs"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	themeAlreadyApplied = errors.Sentinel("a theme is already applied to this guild")
+	themeNotApplied     = errors.Sentinel("no theme is applied to this guild")
+	themeRevertFailed   = errors.Sentinel("some roles could not be restored, revert the theme again to retry")
+)
+
+// Session is the part of the Discord session themes use to recolor roles
+type Session interface {
+	GuildRoles(guildID string, options ...discordgo.RequestOption) ([]*discordgo.Role, error)
+	GuildRoleEdit(guildID, roleID string, data *discordgo.RoleParams, options ...discordgo.RequestOption) (*discordgo.Role, error)
+}
+
+// Apply recolors every personal role of the guild to the nearest color of the theme palette. The original
+// colors are stored with the theme before any role is edited, so an interrupted apply can still be reverted.
+// The roles are edited through the job queue, which reports its progress to onProgress when it is not nil.
+func Apply(ctx context.Context, session Session, queue *jobs.Queue, store backend.Backend, logger *slog.Logger, guildTheme backend.GuildTheme, onProgress func(jobs.Progress)) (int, error) {
+	if guildTheme.Applied {
+		return 0, themeAlreadyApplied
+	}
+
+	theme, err := common.ThemeFromString(guildTheme.Theme)
+	if err != nil {
+		return 0, err
+	}
+
+	personalRoles, err := backend.ListAllRoles(ctx, store, guildTheme.Guild)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list personal roles")
+	}
+
+	guildRoles, err := session.GuildRoles(guildTheme.Guild)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get guild roles")
+	}
+
+	isPersonalRole := make(map[string]bool, len(personalRoles))
+	for _, personalRole := range personalRoles {
+		isPersonalRole[personalRole.Role] = true
+	}
+
+	roles := make([]*discordgo.Role, 0, len(personalRoles))
+	for _, role := range guildRoles {
+		if isPersonalRole[role.ID] {
+			roles = append(roles, role)
+		}
+	}
+
+	// Keep the assignment of uncolored roles stable between runs
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].ID < roles[j].ID
+	})
+
+	guildTheme.Applied = true
+	guildTheme.StartAt = time.Now()
+	guildTheme.Originals = make(map[string]int, len(roles))
+
+	for _, role := range roles {
+		guildTheme.Originals[role.ID] = role.Color
+	}
+
+	if err = store.SetGuildTheme(ctx, guildTheme); err != nil {
+		return 0, errors.Wrap(err, "failed to store original role colors")
+	}
+
+	operations := make([]jobs.Operation, 0, len(roles))
+
+	for index, role := range roles {
+		// Roles without a color are spread across the palette instead of all becoming its darkest color
+		color := theme.Colors[index%len(theme.Colors)]
+		if role.Color != 0 {
+			color = common.FindClosestColor(role.Color, theme.Colors)
+		}
+
+		operations = append(operations, editRoleColor(session, guildTheme.Guild, role.ID, color))
+	}
+
+	progress, err := queue.Run(ctx, jobs.Job{
+		Name:       "apply theme",
+		Guild:      guildTheme.Guild,
+		Operations: operations,
+		OnProgress: onProgress,
+	})
+	if err != nil {
+		return progress.Done, errors.Wrap(err, "failed to apply theme to every role")
+	}
+
+	logger.Info("applied guild theme",
+		slog.String("guild", guildTheme.Guild),
+		slog.String("theme", guildTheme.Theme),
+		slog.Int("roles", progress.Done),
+		slog.Int("failed", progress.Failed))
+
+	return progress.Done, nil
+}
+
+// Revert restores the colors every personal role had before the theme was applied and removes the theme. When
+// some roles could not be restored, or the revert is cancelled, the theme is kept with only those roles left in
+// it, so reverting again does not undo changes made to the others since. Roles that no longer exist count as
+// restored.
+func Revert(ctx context.Context, session Session, queue *jobs.Queue, store backend.Backend, logger *slog.Logger, guildTheme backend.GuildTheme, onProgress func(jobs.Progress)) (int, error) {
+	if !guildTheme.Applied {
+		return 0, themeNotApplied
+	}
+
+	roles := make([]string, 0, len(guildTheme.Originals))
+	for role := range guildTheme.Originals {
+		roles = append(roles, role)
+	}
+
+	sort.Strings(roles)
+
+	// Operations run one at a time on the worker of the guild, and are done once the queue returns
+	restored := make(map[string]bool, len(roles))
+
+	operations := make([]jobs.Operation, 0, len(roles))
+	for _, role := range roles {
+		operation := editRoleColor(session, guildTheme.Guild, role, guildTheme.Originals[role])
+		edit := operation.Run
+
+		operation.Run = func(ctx context.Context) error {
+			err := edit(ctx)
+			if isUnknownRole(err) {
+				err = nil
+			}
+
+			restored[role] = err == nil
+
+			return err
+		}
+
+		operations = append(operations, operation)
+	}
+
+	progress, err := queue.Run(ctx, jobs.Job{
+		Name:       "revert theme",
+		Guild:      guildTheme.Guild,
+		Operations: operations,
+		OnProgress: onProgress,
+	})
+
+	remaining := make(map[string]int)
+	for role, color := range guildTheme.Originals {
+		if !restored[role] {
+			remaining[role] = color
+		}
+	}
+
+	if len(remaining) > 0 {
+		guildTheme.Originals = remaining
+
+		if storeErr := store.SetGuildTheme(ctx, guildTheme); storeErr != nil {
+			return progress.Done, errors.Combine(err, errors.Wrap(storeErr, "failed to store the roles left to revert"))
+		}
+	}
+
+	if err != nil {
+		return progress.Done, errors.Wrap(err, "failed to revert theme for every role")
+	}
+
+	if len(remaining) > 0 {
+		return progress.Done, errors.WithDetails(themeRevertFailed, "failed", len(remaining))
+	}
+
+	if err = store.DeleteGuildTheme(ctx, guildTheme.Guild); err != nil {
+		return progress.Done, errors.Wrap(err, "failed to remove guild theme")
+	}
+
+	logger.Info("reverted guild theme",
+		slog.String("guild", guildTheme.Guild),
+		slog.String("theme", guildTheme.Theme),
+		slog.Int("roles", progress.Done),
+		slog.Int("failed", progress.Failed))
+
+	return progress.Done, nil
+}
+
+// editRoleColor returns an operation setting the color of a role
+func editRoleColor(session Session, guild string, role string, color int) jobs.Operation {
+	return jobs.Operation{
+		Target: role,
+		Run: func(ctx context.Context) error {
+			_, err := session.GuildRoleEdit(guild, role, &discordgo.RoleParams{Color: &color}, discordgo.WithContext(ctx))
+			return err
+		},
+	}
+}
+
+// isUnknownRole reports whether a request failed because the role it edits no longer exists
+func isUnknownRole(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusNotFound
+}
+
+// IsDue reports whether a theme should be applied or reverted at the given time
+func IsDue(guildTheme backend.GuildTheme, now time.Time) bool {
+	if !guildTheme.Applied {
+		return !guildTheme.StartAt.After(now)
+	}
+
+	return !guildTheme.EndAt.IsZero() && !guildTheme.EndAt.After(now)
+}
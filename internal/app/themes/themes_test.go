@@ -0,0 +1,233 @@
+package themes
+
+import (
+	"context"
+	"emperror.dev/errors"
+	appbackend "github.com/Sxtanna/chromatic_curator/internal/app/backend"
+	"github.com/Sxtanna/chromatic_curator/internal/app/jobs"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"github.com/bwmarrin/discordgo"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSession is a guild whose role edits fail with the error set for the role
+type testSession struct {
+	mutex  sync.Mutex
+	roles  []*discordgo.Role
+	errors map[string]error
+	edits  map[string]int
+}
+
+func newTestSession(roles ...*discordgo.Role) *testSession {
+	return &testSession{roles: roles, errors: make(map[string]error), edits: make(map[string]int)}
+}
+
+func (s *testSession) GuildRoles(_ string, _ ...discordgo.RequestOption) ([]*discordgo.Role, error) {
+	return s.roles, nil
+}
+
+func (s *testSession) GuildRoleEdit(_ string, roleID string, data *discordgo.RoleParams, _ ...discordgo.RequestOption) (*discordgo.Role, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.errors[roleID]; err != nil {
+		return nil, err
+	}
+
+	s.edits[roleID] = *data.Color
+
+	return &discordgo.Role{ID: roleID, Color: *data.Color}, nil
+}
+
+func newTestQueue(t *testing.T) *jobs.Queue {
+	queue := &jobs.Queue{Logger: slog.New(slog.DiscardHandler), Abort: make(chan struct{})}
+	if err := queue.Init(nil); err != nil {
+		t.Fatalf("failed to init queue: %v", err)
+	}
+
+	_ = queue.Start()
+	t.Cleanup(func() { _ = queue.Close(nil) })
+
+	return queue
+}
+
+func restError(status int) error {
+	return &discordgo.RESTError{Response: &http.Response{StatusCode: status}}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	halloween, _ := common.ThemeFromString("halloween")
+
+	session := newTestSession(
+		&discordgo.Role{ID: "first", Color: 0x00FF00},
+		&discordgo.Role{ID: "second"},
+		&discordgo.Role{ID: "unrelated", Color: 0x0000FF})
+
+	store := appbackend.NewMemoryBackend()
+	_ = store.SetRolesBatch(ctx, "guild", map[string]string{"first-user": "first", "second-user": "second"})
+
+	edited, err := Apply(ctx, session, newTestQueue(t), store, slog.New(slog.DiscardHandler),
+		backend.GuildTheme{Guild: "guild", Theme: "halloween"}, nil)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	if edited != 2 {
+		t.Errorf("Apply() edited %d roles, want 2", edited)
+	}
+
+	if _, touched := session.edits["unrelated"]; touched {
+		t.Errorf("Apply() edited a role that is not a personal role")
+	}
+
+	for role, color := range session.edits {
+		if !slices.Contains(halloween.Colors, color) {
+			t.Errorf("Apply() colored %s %06X, want a color of the theme", role, color)
+		}
+	}
+
+	stored, _ := store.GetGuildTheme(ctx, "guild")
+	if stored == nil || !stored.Applied || stored.Originals["first"] != 0x00FF00 || len(stored.Originals) != 2 {
+		t.Fatalf("stored theme = %+v, want it applied with the original colors of both roles", stored)
+	}
+
+	if _, err = Apply(ctx, session, newTestQueue(t), store, slog.New(slog.DiscardHandler), *stored, nil); !errors.Is(err, themeAlreadyApplied) {
+		t.Errorf("Apply() of an applied theme error = %v, want %v", err, themeAlreadyApplied)
+	}
+}
+
+func TestRevert(t *testing.T) {
+	originals := map[string]int{"first": 0x111111, "second": 0x222222, "third": 0x333333}
+
+	tests := []struct {
+		name      string
+		errors    map[string]error
+		restored  int
+		remaining []string
+	}{
+		{
+			name:     "every role is restored",
+			restored: 3,
+		},
+		{
+			name:      "failed roles are kept to revert again",
+			errors:    map[string]error{"second": restError(http.StatusForbidden)},
+			restored:  2,
+			remaining: []string{"second"},
+		},
+		{
+			name:     "deleted roles count as restored",
+			errors:   map[string]error{"third": restError(http.StatusNotFound)},
+			restored: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			session := newTestSession()
+			for role, err := range test.errors {
+				session.errors[role] = err
+			}
+
+			store := appbackend.NewMemoryBackend()
+
+			guildTheme := backend.GuildTheme{Guild: "guild", Theme: "halloween", Applied: true, Originals: originals}
+			_ = store.SetGuildTheme(ctx, guildTheme)
+
+			restored, err := Revert(ctx, session, newTestQueue(t), store, slog.New(slog.DiscardHandler), guildTheme, nil)
+			if restored != test.restored {
+				t.Errorf("Revert() restored %d roles, want %d", restored, test.restored)
+			}
+
+			stored, _ := store.GetGuildTheme(ctx, "guild")
+
+			if len(test.remaining) == 0 {
+				if err != nil || stored != nil {
+					t.Fatalf("Revert() error = %v, stored theme = %+v, want the theme removed", err, stored)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, themeRevertFailed) {
+				t.Errorf("Revert() error = %v, want %v", err, themeRevertFailed)
+			}
+
+			if stored == nil || !stored.Applied || len(stored.Originals) != len(test.remaining) {
+				t.Fatalf("stored theme = %+v, want it applied with only %v left", stored, test.remaining)
+			}
+
+			for _, role := range test.remaining {
+				if stored.Originals[role] != originals[role] {
+					t.Errorf("stored original of %s = %06X, want %06X", role, stored.Originals[role], originals[role])
+				}
+			}
+
+			// Reverting again only touches the roles that are left
+			session.errors = make(map[string]error)
+			session.edits = make(map[string]int)
+
+			if _, err = Revert(ctx, session, newTestQueue(t), store, slog.New(slog.DiscardHandler), *stored, nil); err != nil {
+				t.Fatalf("second Revert() error = %v", err)
+			}
+
+			if len(session.edits) != len(test.remaining) {
+				t.Errorf("second Revert() edited %v, want only %v", session.edits, test.remaining)
+			}
+
+			if stored, _ = store.GetGuildTheme(ctx, "guild"); stored != nil {
+				t.Errorf("stored theme = %+v after reverting every role, want it removed", stored)
+			}
+		})
+	}
+}
+
+func TestIsDue(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		theme backend.GuildTheme
+		due   bool
+	}{
+		{
+			name:  "pending theme before its start",
+			theme: backend.GuildTheme{StartAt: now.Add(time.Hour)},
+		},
+		{
+			name:  "pending theme after its start",
+			theme: backend.GuildTheme{StartAt: now.Add(-time.Hour)},
+			due:   true,
+		},
+		{
+			name:  "applied theme without an end",
+			theme: backend.GuildTheme{Applied: true},
+		},
+		{
+			name:  "applied theme before its end",
+			theme: backend.GuildTheme{Applied: true, EndAt: now.Add(time.Hour)},
+		},
+		{
+			name:  "applied theme after its end",
+			theme: backend.GuildTheme{Applied: true, EndAt: now.Add(-time.Hour)},
+			due:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if due := IsDue(test.theme, now); due != test.due {
+				t.Errorf("IsDue() = %v, want %v", due, test.due)
+			}
+		})
+	}
+}
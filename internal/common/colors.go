@@ -96,6 +96,12 @@ func IntToRGB(color int) (r uint8, g uint8, b uint8) {
 	return uint8((color >> 16) & 0xFF), uint8((color >> 8) & 0xFF), uint8(color & 0xFF)
 }
 
+// FormatColorHex formats a color as a "#RRGGBB" hex code
+func FormatColorHex(color int) string {
+	r, g, b := IntToRGB(color)
+	return fmt.Sprintf("#%02X%02X%02X", r, g, b)
+}
+
 func SlightlyDarker(ir, ig, ib uint8) (r uint8, g uint8, b uint8) {
 	return uint8(max(0, int(r)-40)), uint8(max(0, int(g)-40)), uint8(max(0, int(b)-40))
 }
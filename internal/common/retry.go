@@ -0,0 +1,67 @@
+package common
+
+import (
+	"emperror.dev/errors"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	RetryStopped = errors.Sentinel("retry stopped before the operation succeeded")
+)
+
+// Backoff returns how long to wait before the given retry attempt, starting at zero. The wait doubles with every
+// attempt up to the maximum, and is jittered to a random duration between half and all of it, so many clients
+// restarting at once do not retry in lockstep.
+func Backoff(attempt int, initial time.Duration, maximum time.Duration) time.Duration {
+	wait := initial
+	for range attempt {
+		if wait >= maximum/2 {
+			wait = maximum
+			break
+		}
+
+		wait *= 2
+	}
+
+	wait = min(wait, maximum)
+	if wait <= 1 {
+		return wait
+	}
+
+	return wait/2 + rand.N(wait/2)
+}
+
+// Retry calls the operation until it succeeds or has been attempted the given number of times, waiting the
+// Backoff between attempts. The retry is abandoned with RetryStopped when stop is closed, onFailure is called
+// with every failure that will be retried and may be nil.
+func Retry(stop <-chan struct{}, attempts int, initial time.Duration, maximum time.Duration, operation func() error, onFailure func(attempt int, wait time.Duration, err error)) error {
+	var err error
+
+	for attempt := range attempts {
+		if err = operation(); err == nil {
+			return nil
+		}
+
+		if attempt == attempts-1 {
+			break
+		}
+
+		wait := Backoff(attempt, initial, maximum)
+
+		if onFailure != nil {
+			onFailure(attempt, wait, err)
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-stop:
+			timer.Stop()
+			return errors.Combine(RetryStopped, err)
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,152 @@
+package common
+
+import (
+	"emperror.dev/errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt int
+		initial time.Duration
+		maximum time.Duration
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{
+			name:    "First attempt waits up to the initial backoff",
+			attempt: 0,
+			initial: time.Second,
+			maximum: time.Minute,
+			wantMin: 500 * time.Millisecond,
+			wantMax: time.Second,
+		},
+		{
+			name:    "Backoff doubles with every attempt",
+			attempt: 3,
+			initial: time.Second,
+			maximum: time.Minute,
+			wantMin: 4 * time.Second,
+			wantMax: 8 * time.Second,
+		},
+		{
+			name:    "Backoff is capped at the maximum",
+			attempt: 10,
+			initial: time.Second,
+			maximum: 30 * time.Second,
+			wantMin: 15 * time.Second,
+			wantMax: 30 * time.Second,
+		},
+		{
+			name:    "Large attempts do not overflow",
+			attempt: 200,
+			initial: time.Second,
+			maximum: 30 * time.Second,
+			wantMin: 15 * time.Second,
+			wantMax: 30 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				got := Backoff(tt.attempt, tt.initial, tt.maximum)
+				if got < tt.wantMin || got > tt.wantMax {
+					t.Fatalf("Backoff() = %v, want between %v and %v", got, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	failure := errors.New("operation failed")
+
+	tests := []struct {
+		name         string
+		attempts     int
+		failures     int
+		wantCalls    int
+		wantFailures int
+		wantErr      bool
+	}{
+		{
+			name:         "Succeeds on the first attempt",
+			attempts:     3,
+			failures:     0,
+			wantCalls:    1,
+			wantFailures: 0,
+		},
+		{
+			name:         "Succeeds after failed attempts",
+			attempts:     5,
+			failures:     3,
+			wantCalls:    4,
+			wantFailures: 3,
+		},
+		{
+			name:         "Gives up after the last attempt",
+			attempts:     3,
+			failures:     10,
+			wantCalls:    3,
+			wantFailures: 2,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			failures := 0
+
+			err := Retry(make(chan struct{}), tt.attempts, time.Millisecond, time.Millisecond, func() error {
+				calls++
+				if calls <= tt.failures {
+					return failure
+				}
+				return nil
+			}, func(attempt int, wait time.Duration, err error) {
+				failures++
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Retry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, failure) {
+				t.Fatalf("Retry() error = %v, want the last failure", err)
+			}
+			if calls != tt.wantCalls {
+				t.Fatalf("Retry() called the operation %d times, want %d", calls, tt.wantCalls)
+			}
+			if failures != tt.wantFailures {
+				t.Fatalf("Retry() reported %d failures, want %d", failures, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestRetryStopped(t *testing.T) {
+	failure := errors.New("operation failed")
+
+	stop := make(chan struct{})
+	calls := 0
+
+	err := Retry(stop, 10, time.Hour, time.Hour, func() error {
+		calls++
+		return failure
+	}, func(attempt int, wait time.Duration, err error) {
+		close(stop)
+	})
+
+	if !errors.Is(err, RetryStopped) {
+		t.Fatalf("Retry() error = %v, want %v", err, RetryStopped)
+	}
+	if !errors.Is(err, failure) {
+		t.Fatalf("Retry() error = %v, want the last failure", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Retry() called the operation %d times after being stopped, want 1", calls)
+	}
+}
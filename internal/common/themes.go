@@ -0,0 +1,77 @@
+package common
+
+import (
+	"emperror.dev/errors"
+	"math"
+)
+
+// Theme is a named palette that can be applied to every personal role of a guild
+type Theme struct {
+	Name        string
+	DisplayName string
+	Colors      []int
+}
+
+// Themes are the seasonal and event themes available to guild admins
+var Themes = []Theme{
+	{
+		Name:        "halloween",
+		DisplayName: "Halloween",
+		Colors:      []int{0xFF7518, 0x6A0DAD, 0x39FF14, 0xE3DAC9, 0x8B0000},
+	},
+	{
+		Name:        "pride",
+		DisplayName: "Pride",
+		Colors:      []int{0xE40303, 0xFF8C00, 0xFFED00, 0x008026, 0x24408E, 0x732982},
+	},
+	{
+		Name:        "winter",
+		DisplayName: "Winter Holidays",
+		Colors:      []int{0xC0392B, 0x1E8449, 0xF1C40F, 0xF8F9F9, 0x5DADE2},
+	},
+	{
+		Name:        "valentines",
+		DisplayName: "Valentine's Day",
+		Colors:      []int{0xFF69B4, 0xE0115F, 0xFF007F, 0xDE5D83, 0xE6E6FA},
+	},
+	{
+		Name:        "spring",
+		DisplayName: "Spring",
+		Colors:      []int{0xB5EAD7, 0xFFDAC1, 0xE2F0CB, 0xC7CEEA, 0xFFB7B2},
+	},
+}
+
+// ThemeFromString finds a theme by its name
+func ThemeFromString(s string) (Theme, error) {
+	for _, theme := range Themes {
+		if theme.Name == s {
+			return theme, nil
+		}
+	}
+
+	return Theme{}, errors.Errorf("unknown theme: %s", s)
+}
+
+// FindClosestColor returns the color of the palette nearest to the given color
+func FindClosestColor(colorInt int, palette []int) int {
+	r1, g1, b1 := IntToRGB(colorInt)
+
+	minDistance := math.MaxFloat64
+	closest := colorInt
+
+	for _, candidate := range palette {
+		r2, g2, b2 := IntToRGB(candidate)
+
+		// Calculate Euclidean distance in RGB space
+		distance := math.Sqrt(math.Pow(float64(r2)-float64(r1), 2) +
+			math.Pow(float64(g2)-float64(g1), 2) +
+			math.Pow(float64(b2)-float64(b1), 2))
+
+		if distance < minDistance {
+			minDistance = distance
+			closest = candidate
+		}
+	}
+
+	return closest
+}
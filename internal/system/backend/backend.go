@@ -3,11 +3,172 @@ package backend
 import "context"
 
 type Backend interface {
+	HealthBackend
 	RoleBackend
+	HistoryBackend
+	FavoriteBackend
+	ScheduleBackend
+	ThemeBackend
+	GroupBackend
+	SettingsBackend
+	ApprovalBackend
+}
+
+type HealthBackend interface {
+	// Ping returns an error when the backend cannot currently serve requests
+	Ping(ctx context.Context) error
+}
+
+// HealthReporter reports whether the backend was reachable when it was last checked
+type HealthReporter interface {
+	Healthy() bool
 }
 
 type RoleBackend interface {
 	GetRole(ctx context.Context, guild string, user string) (string, error)
 
 	SetRole(ctx context.Context, guild string, user string, role string) error
+
+	// DeleteRole removes the personal role of a user, returning the removed role or an empty string if they had none
+	DeleteRole(ctx context.Context, guild string, user string) (string, error)
+
+	// GetRoleOwner returns the user a personal role belongs to, or an empty string if it is not a personal role
+	GetRoleOwner(ctx context.Context, guild string, role string) (string, error)
+
+	// ListRoles returns a page of roughly limit personal roles of a guild, starting at cursor. An empty cursor
+	// starts at the beginning, the returned cursor is empty once every role has been listed
+	ListRoles(ctx context.Context, guild string, cursor string, limit int) ([]PersonalRole, string, error)
+
+	// GetRolesBatch returns the personal roles of the given users keyed by user, leaving out users without one
+	GetRolesBatch(ctx context.Context, guild string, users []string) (map[string]string, error)
+
+	// SetRolesBatch stores the personal roles of many users at once, keyed by user
+	SetRolesBatch(ctx context.Context, guild string, roles map[string]string) error
+}
+
+// ListAllRoles pages through every personal role of a guild
+func ListAllRoles(ctx context.Context, roles RoleBackend, guild string) ([]PersonalRole, error) {
+	all := make([]PersonalRole, 0)
+	cursor := ""
+
+	for {
+		page, next, err := roles.ListRoles(ctx, guild, cursor, RolePageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, page...)
+
+		if next == "" {
+			return all, nil
+		}
+
+		cursor = next
+	}
+}
+
+type HistoryBackend interface {
+	// PushHistory records a previous role state, discarding the oldest entries beyond MaxHistoryEntries
+	PushHistory(ctx context.Context, guild string, user string, state RoleState) error
+
+	// PopHistory removes and returns the most recent role state, or nil if there is none
+	PopHistory(ctx context.Context, guild string, user string) (*RoleState, error)
+
+	// GetHistory returns the recorded role states, most recent first
+	GetHistory(ctx context.Context, guild string, user string) ([]RoleState, error)
+
+	// ListHistoryUsers returns the users of a guild that have recorded role states
+	ListHistoryUsers(ctx context.Context, guild string) ([]string, error)
+}
+
+type FavoriteBackend interface {
+	// AddFavorite stores a favorite color, replacing the label of an existing favorite with the same color
+	AddFavorite(ctx context.Context, guild string, user string, favorite Favorite) error
+
+	// RemoveFavorite deletes a favorite color, returning false if it was not saved
+	RemoveFavorite(ctx context.Context, guild string, user string, color int) (bool, error)
+
+	// GetFavorites returns the saved favorites, oldest first
+	GetFavorites(ctx context.Context, guild string, user string) ([]Favorite, error)
+
+	// ListFavoriteUsers returns the users of a guild that have saved favorites
+	ListFavoriteUsers(ctx context.Context, guild string) ([]string, error)
+}
+
+type ScheduleBackend interface {
+	// SetSchedule creates or replaces the color rotation schedule of a user
+	SetSchedule(ctx context.Context, schedule Schedule) error
+
+	// GetSchedule returns the color rotation schedule of a user, or nil if they have none
+	GetSchedule(ctx context.Context, guild string, user string) (*Schedule, error)
+
+	DeleteSchedule(ctx context.Context, guild string, user string) error
+
+	// ListSchedules returns the color rotation schedules of every guild
+	ListSchedules(ctx context.Context) ([]Schedule, error)
+
+	// ListGuildSchedules returns the color rotation schedules of a guild
+	ListGuildSchedules(ctx context.Context, guild string) ([]Schedule, error)
+}
+
+type ThemeBackend interface {
+	// SetGuildTheme creates or replaces the pending or applied theme of a guild
+	SetGuildTheme(ctx context.Context, theme GuildTheme) error
+
+	// GetGuildTheme returns the pending or applied theme of a guild, or nil if there is none
+	GetGuildTheme(ctx context.Context, guild string) (*GuildTheme, error)
+
+	DeleteGuildTheme(ctx context.Context, guild string) error
+
+	// ListGuildThemes returns the pending or applied themes of every guild
+	ListGuildThemes(ctx context.Context) ([]GuildTheme, error)
+}
+
+type GroupBackend interface {
+	// SetGroup creates or replaces the settings of a group role
+	SetGroup(ctx context.Context, group GroupRole) error
+
+	// GetGroup returns the settings of a group role, or nil if the role is not a group role
+	GetGroup(ctx context.Context, guild string, role string) (*GroupRole, error)
+
+	// DeleteGroup removes a group role along with its memberships
+	DeleteGroup(ctx context.Context, guild string, role string) error
+
+	// AddGroupMember adds a user to a group role, returning GroupMemberLimitReached when it already has limit members.
+	// A limit of zero or less adds the user regardless of the member count.
+	AddGroupMember(ctx context.Context, guild string, role string, user string, limit int) error
+
+	RemoveGroupMember(ctx context.Context, guild string, role string, user string) error
+
+	// GetGroupMembers returns the users that are members of a group role
+	GetGroupMembers(ctx context.Context, guild string, role string) ([]string, error)
+
+	// GetMemberGroups returns the group roles a user is a member of
+	GetMemberGroups(ctx context.Context, guild string, user string) ([]string, error)
+
+	// ListGroups returns the settings of every group role of a guild
+	ListGroups(ctx context.Context, guild string) ([]GroupRole, error)
+}
+
+type SettingsBackend interface {
+	// GetGuildSettings returns the settings of a guild, or the zero settings if none were stored
+	GetGuildSettings(ctx context.Context, guild string) (GuildSettings, error)
+
+	SetGuildSettings(ctx context.Context, guild string, settings GuildSettings) error
+}
+
+type ApprovalBackend interface {
+	// SetApproval creates or replaces a pending approval request
+	SetApproval(ctx context.Context, request ApprovalRequest) error
+
+	// GetApproval returns a pending approval request, or nil if there is none with the given id
+	GetApproval(ctx context.Context, guild string, id string) (*ApprovalRequest, error)
+
+	DeleteApproval(ctx context.Context, guild string, id string) error
+
+	// ListApprovals returns the pending approval requests of every guild, including expired ones
+	ListApprovals(ctx context.Context) ([]ApprovalRequest, error)
+
+	// ListGuildApprovals returns the pending approval requests of a guild, including expired ones
+	ListGuildApprovals(ctx context.Context, guild string) ([]ApprovalRequest, error)
 }
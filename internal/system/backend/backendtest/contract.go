@@ -0,0 +1,730 @@
+// Package backendtest holds the conformance suite every backend.Backend implementation is expected to pass
+package backendtest
+
+import (
+	"context"
+	"emperror.dev/errors"
+	"github.com/Sxtanna/chromatic_curator/internal/system/backend"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory creates an empty backend for a single test, cleaning it up with t.Cleanup when needed
+type Factory func(t *testing.T) backend.Backend
+
+// Run runs the conformance suite against the backends created by the factory, each test gets a fresh backend
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, ctx context.Context, store backend.Backend)
+	}{
+		{"Roles", testRoles},
+		{"RolesPagination", testRolesPagination},
+		{"RolesBatch", testRolesBatch},
+		{"History", testHistory},
+		{"Favorites", testFavorites},
+		{"ConcurrentFavorites", testConcurrentFavorites},
+		{"Schedules", testSchedules},
+		{"Themes", testThemes},
+		{"Groups", testGroups},
+		{"Settings", testSettings},
+		{"Approvals", testApprovals},
+		{"GuildListings", testGuildListings},
+		{"GuildIsolation", testGuildIsolation},
+		{"ConcurrentWriters", testConcurrentWriters},
+		{"ContextCancellation", testContextCancellation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, context.Background(), factory(t))
+		})
+	}
+}
+
+// moment is a fixed point in time, so time round-trips can be compared exactly
+var moment = time.Date(2025, time.October, 31, 18, 30, 15, 123456789, time.UTC)
+
+func must(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error = %v", err)
+	}
+}
+
+func testRoles(t *testing.T, ctx context.Context, store backend.Backend) {
+	role, err := store.GetRole(ctx, "guild", "user")
+	must(t, err)
+
+	if role != "" {
+		t.Errorf("GetRole() on missing user = %q, want empty", role)
+	}
+
+	must(t, store.SetRole(ctx, "guild", "user", "first"))
+	must(t, store.SetRole(ctx, "guild", "user", "second"))
+
+	if role, _ = store.GetRole(ctx, "guild", "user"); role != "second" {
+		t.Errorf("GetRole() = %q, want %q", role, "second")
+	}
+
+	if owner, _ := store.GetRoleOwner(ctx, "guild", "second"); owner != "user" {
+		t.Errorf("GetRoleOwner() = %q, want %q", owner, "user")
+	}
+
+	if owner, _ := store.GetRoleOwner(ctx, "guild", "first"); owner != "" {
+		t.Errorf("GetRoleOwner() of replaced role = %q, want empty", owner)
+	}
+
+	deleted, err := store.DeleteRole(ctx, "guild", "user")
+	must(t, err)
+
+	if deleted != "second" {
+		t.Errorf("DeleteRole() = %q, want %q", deleted, "second")
+	}
+
+	if owner, _ := store.GetRoleOwner(ctx, "guild", "second"); owner != "" {
+		t.Errorf("GetRoleOwner() of deleted role = %q, want empty", owner)
+	}
+
+	if deleted, _ = store.DeleteRole(ctx, "guild", "user"); deleted != "" {
+		t.Errorf("DeleteRole() on missing user = %q, want empty", deleted)
+	}
+}
+
+func testRolesPagination(t *testing.T, ctx context.Context, store backend.Backend) {
+	expected := make(map[string]string)
+	for index := 0; index < 25; index++ {
+		expected["user"+strconv.Itoa(index)] = "role" + strconv.Itoa(index)
+	}
+
+	must(t, store.SetRolesBatch(ctx, "guild", expected))
+
+	seen := make(map[string]string)
+	cursor := ""
+
+	for pages := 0; ; pages++ {
+		if pages > len(expected) {
+			t.Fatalf("ListRoles() did not finish after %d pages", pages)
+		}
+
+		page, next, err := store.ListRoles(ctx, "guild", cursor, 10)
+		must(t, err)
+
+		for _, role := range page {
+			seen[role.User] = role.Role
+		}
+
+		if next == "" {
+			break
+		}
+
+		cursor = next
+	}
+
+	if len(seen) != len(expected) {
+		t.Fatalf("ListRoles() listed %d roles, want %d", len(seen), len(expected))
+	}
+
+	for user, role := range expected {
+		if seen[user] != role {
+			t.Errorf("ListRoles() role of %s = %q, want %q", user, seen[user], role)
+		}
+	}
+
+	all, err := backend.ListAllRoles(ctx, store, "guild")
+	must(t, err)
+
+	if len(all) != len(expected) {
+		t.Errorf("ListAllRoles() listed %d roles, want %d", len(all), len(expected))
+	}
+
+	empty, next, err := store.ListRoles(ctx, "empty", "", 10)
+	must(t, err)
+
+	if len(empty) != 0 || next != "" {
+		t.Errorf("ListRoles() on empty guild = %v, %q, want nothing", empty, next)
+	}
+}
+
+func testRolesBatch(t *testing.T, ctx context.Context, store backend.Backend) {
+	must(t, store.SetRolesBatch(ctx, "guild", map[string]string{"a": "role-a", "b": "role-b"}))
+
+	roles, err := store.GetRolesBatch(ctx, "guild", []string{"a", "b", "missing"})
+	must(t, err)
+
+	if len(roles) != 2 || roles["a"] != "role-a" || roles["b"] != "role-b" {
+		t.Errorf("GetRolesBatch() = %v, want a and b only", roles)
+	}
+
+	roles, err = store.GetRolesBatch(ctx, "guild", nil)
+	must(t, err)
+
+	if len(roles) != 0 {
+		t.Errorf("GetRolesBatch() without users = %v, want empty", roles)
+	}
+
+	if owner, _ := store.GetRoleOwner(ctx, "guild", "role-b"); owner != "b" {
+		t.Errorf("GetRoleOwner() after batch = %q, want %q", owner, "b")
+	}
+}
+
+func testHistory(t *testing.T, ctx context.Context, store backend.Backend) {
+	state, err := store.PopHistory(ctx, "guild", "user")
+	must(t, err)
+
+	if state != nil {
+		t.Errorf("PopHistory() on empty history = %v, want nil", state)
+	}
+
+	history, err := store.GetHistory(ctx, "guild", "user")
+	must(t, err)
+
+	if len(history) != 0 {
+		t.Errorf("GetHistory() on empty history = %v, want empty", history)
+	}
+
+	for index := 0; index < backend.MaxHistoryEntries+3; index++ {
+		must(t, store.PushHistory(ctx, "guild", "user", backend.RoleState{Name: "name", Color: index, Time: moment}))
+	}
+
+	history, err = store.GetHistory(ctx, "guild", "user")
+	must(t, err)
+
+	if len(history) != backend.MaxHistoryEntries {
+		t.Fatalf("GetHistory() kept %d entries, want %d", len(history), backend.MaxHistoryEntries)
+	}
+
+	if last := backend.MaxHistoryEntries + 2; history[0].Color != last {
+		t.Errorf("GetHistory() first color = %d, want most recent %d", history[0].Color, last)
+	}
+
+	if !history[0].Time.Equal(moment) || history[0].Name != "name" {
+		t.Errorf("GetHistory() first entry = %v, want name at %v", history[0], moment)
+	}
+
+	state, err = store.PopHistory(ctx, "guild", "user")
+	must(t, err)
+
+	if state == nil || state.Color != backend.MaxHistoryEntries+2 {
+		t.Errorf("PopHistory() = %v, want the most recent entry", state)
+	}
+
+	if history, _ = store.GetHistory(ctx, "guild", "user"); len(history) != backend.MaxHistoryEntries-1 {
+		t.Errorf("GetHistory() after pop kept %d entries, want %d", len(history), backend.MaxHistoryEntries-1)
+	}
+}
+
+func testFavorites(t *testing.T, ctx context.Context, store backend.Backend) {
+	favorites, err := store.GetFavorites(ctx, "guild", "user")
+	must(t, err)
+
+	if len(favorites) != 0 {
+		t.Errorf("GetFavorites() on no favorites = %v, want empty", favorites)
+	}
+
+	for index := 0; index < backend.MaxFavorites; index++ {
+		favorite := backend.Favorite{Color: index, Time: moment.Add(time.Duration(backend.MaxFavorites-index) * time.Minute)}
+		must(t, store.AddFavorite(ctx, "guild", "user", favorite))
+	}
+
+	if err = store.AddFavorite(ctx, "guild", "user", backend.Favorite{Color: 0xFFFFFF, Time: moment}); !errors.Is(err, backend.FavoriteLimitReached) {
+		t.Errorf("AddFavorite() beyond the limit error = %v, want %v", err, backend.FavoriteLimitReached)
+	}
+
+	// Replacing the label of a saved color does not count against the limit
+	must(t, store.AddFavorite(ctx, "guild", "user", backend.Favorite{Color: 0, Label: "black", Time: moment}))
+
+	favorites, err = store.GetFavorites(ctx, "guild", "user")
+	must(t, err)
+
+	if len(favorites) != backend.MaxFavorites {
+		t.Fatalf("GetFavorites() returned %d favorites, want %d", len(favorites), backend.MaxFavorites)
+	}
+
+	if favorites[0].Color != 0 || favorites[0].Label != "black" || !favorites[0].Time.Equal(moment) {
+		t.Errorf("GetFavorites() first favorite = %v, want the relabeled oldest", favorites[0])
+	}
+
+	if favorites[1].Color != backend.MaxFavorites-1 {
+		t.Errorf("GetFavorites() second color = %d, want %d", favorites[1].Color, backend.MaxFavorites-1)
+	}
+
+	removed, err := store.RemoveFavorite(ctx, "guild", "user", 0)
+	must(t, err)
+
+	if !removed {
+		t.Errorf("RemoveFavorite() of saved color = false, want true")
+	}
+
+	if removed, _ = store.RemoveFavorite(ctx, "guild", "user", 0); removed {
+		t.Errorf("RemoveFavorite() of removed color = true, want false")
+	}
+}
+
+func testConcurrentFavorites(t *testing.T, ctx context.Context, store backend.Backend) {
+	const writers = 10
+
+	for index := 0; index < backend.MaxFavorites-1; index++ {
+		must(t, store.AddFavorite(ctx, "guild", "user", backend.Favorite{Color: index, Time: moment}))
+	}
+
+	var wait sync.WaitGroup
+	failures := make(chan error, writers)
+
+	// Only one of the writers fits in the last free slot
+	for index := 0; index < writers; index++ {
+		wait.Add(1)
+
+		go func(index int) {
+			defer wait.Done()
+
+			failures <- store.AddFavorite(ctx, "guild", "user", backend.Favorite{Color: 0xFF0000 + index, Time: moment})
+		}(index)
+	}
+
+	wait.Wait()
+	close(failures)
+
+	added := 0
+	for err := range failures {
+		switch {
+		case err == nil:
+			added++
+		case !errors.Is(err, backend.FavoriteLimitReached):
+			t.Errorf("AddFavorite() concurrently error = %v, want nil or %v", err, backend.FavoriteLimitReached)
+		}
+	}
+
+	if added != 1 {
+		t.Errorf("AddFavorite() concurrently added %d favorites, want 1", added)
+	}
+
+	if favorites, _ := store.GetFavorites(ctx, "guild", "user"); len(favorites) != backend.MaxFavorites {
+		t.Errorf("GetFavorites() after concurrent adds returned %d favorites, want %d", len(favorites), backend.MaxFavorites)
+	}
+}
+
+func testSchedules(t *testing.T, ctx context.Context, store backend.Backend) {
+	schedule, err := store.GetSchedule(ctx, "guild", "user")
+	must(t, err)
+
+	if schedule != nil {
+		t.Errorf("GetSchedule() on missing schedule = %v, want nil", schedule)
+	}
+
+	expected := backend.Schedule{
+		Guild:     "guild",
+		User:      "user",
+		Source:    backend.ScheduleSourcePalette,
+		Palette:   "triadic",
+		BaseColor: 0x123456,
+		Interval:  6 * time.Hour,
+		Step:      3,
+		NextRun:   moment,
+	}
+
+	must(t, store.SetSchedule(ctx, expected))
+	must(t, store.SetSchedule(ctx, backend.Schedule{Guild: "other", User: "user", Source: backend.ScheduleSourceRandom}))
+
+	schedule, err = store.GetSchedule(ctx, "guild", "user")
+	must(t, err)
+
+	if schedule == nil || !schedule.NextRun.Equal(expected.NextRun) {
+		t.Fatalf("GetSchedule() = %v, want %v", schedule, expected)
+	}
+
+	schedule.NextRun = expected.NextRun
+	if *schedule != expected {
+		t.Errorf("GetSchedule() = %v, want %v", *schedule, expected)
+	}
+
+	schedules, err := store.ListSchedules(ctx)
+	must(t, err)
+
+	if len(schedules) != 2 {
+		t.Errorf("ListSchedules() returned %d schedules, want 2", len(schedules))
+	}
+
+	must(t, store.DeleteSchedule(ctx, "guild", "user"))
+
+	if schedule, _ = store.GetSchedule(ctx, "guild", "user"); schedule != nil {
+		t.Errorf("GetSchedule() after delete = %v, want nil", schedule)
+	}
+
+	if schedules, _ = store.ListSchedules(ctx); len(schedules) != 1 {
+		t.Errorf("ListSchedules() after delete returned %d schedules, want 1", len(schedules))
+	}
+}
+
+func testThemes(t *testing.T, ctx context.Context, store backend.Backend) {
+	theme, err := store.GetGuildTheme(ctx, "guild")
+	must(t, err)
+
+	if theme != nil {
+		t.Errorf("GetGuildTheme() on missing theme = %v, want nil", theme)
+	}
+
+	must(t, store.SetGuildTheme(ctx, backend.GuildTheme{
+		Guild:     "guild",
+		Theme:     "halloween",
+		StartAt:   moment,
+		EndAt:     moment.Add(24 * time.Hour),
+		Applied:   true,
+		Originals: map[string]int{"role": 0xFF0000},
+	}))
+
+	theme, err = store.GetGuildTheme(ctx, "guild")
+	must(t, err)
+
+	if theme == nil || theme.Theme != "halloween" || !theme.Applied || !theme.StartAt.Equal(moment) || !theme.EndAt.Equal(moment.Add(24*time.Hour)) {
+		t.Fatalf("GetGuildTheme() = %v, want the applied halloween theme", theme)
+	}
+
+	if theme.Originals["role"] != 0xFF0000 {
+		t.Errorf("GetGuildTheme() originals = %v, want role colored 0xFF0000", theme.Originals)
+	}
+
+	themes, err := store.ListGuildThemes(ctx)
+	must(t, err)
+
+	if len(themes) != 1 {
+		t.Errorf("ListGuildThemes() returned %d themes, want 1", len(themes))
+	}
+
+	must(t, store.DeleteGuildTheme(ctx, "guild"))
+
+	if theme, _ = store.GetGuildTheme(ctx, "guild"); theme != nil {
+		t.Errorf("GetGuildTheme() after delete = %v, want nil", theme)
+	}
+
+	if themes, _ = store.ListGuildThemes(ctx); len(themes) != 0 {
+		t.Errorf("ListGuildThemes() after delete returned %d themes, want 0", len(themes))
+	}
+}
+
+func testGroups(t *testing.T, ctx context.Context, store backend.Backend) {
+	group, err := store.GetGroup(ctx, "guild", "role")
+	must(t, err)
+
+	if group != nil {
+		t.Errorf("GetGroup() on missing group = %v, want nil", group)
+	}
+
+	expected := backend.GroupRole{Guild: "guild", Role: "role", Owner: "owner", CoEdit: true, MaxMembers: 5}
+	must(t, store.SetGroup(ctx, expected))
+
+	if group, _ = store.GetGroup(ctx, "guild", "role"); group == nil || *group != expected {
+		t.Errorf("GetGroup() = %v, want %v", group, expected)
+	}
+
+	must(t, store.AddGroupMember(ctx, "guild", "role", "owner", 2))
+	must(t, store.AddGroupMember(ctx, "guild", "role", "member", 2))
+	must(t, store.AddGroupMember(ctx, "guild", "role", "member", 2))
+	must(t, store.AddGroupMember(ctx, "guild", "other", "member", 0))
+
+	if err = store.AddGroupMember(ctx, "guild", "role", "extra", 2); !errors.Is(err, backend.GroupMemberLimitReached) {
+		t.Errorf("AddGroupMember() beyond the limit error = %v, want %v", err, backend.GroupMemberLimitReached)
+	}
+
+	members, err := store.GetGroupMembers(ctx, "guild", "role")
+	must(t, err)
+
+	if !slices.Equal(members, []string{"member", "owner"}) {
+		t.Errorf("GetGroupMembers() = %v, want [member owner]", members)
+	}
+
+	groups, err := store.GetMemberGroups(ctx, "guild", "member")
+	must(t, err)
+
+	if !slices.Equal(groups, []string{"other", "role"}) {
+		t.Errorf("GetMemberGroups() = %v, want [other role]", groups)
+	}
+
+	must(t, store.RemoveGroupMember(ctx, "guild", "other", "member"))
+
+	if groups, _ = store.GetMemberGroups(ctx, "guild", "member"); !slices.Equal(groups, []string{"role"}) {
+		t.Errorf("GetMemberGroups() after remove = %v, want [role]", groups)
+	}
+
+	must(t, store.DeleteGroup(ctx, "guild", "role"))
+
+	if group, _ = store.GetGroup(ctx, "guild", "role"); group != nil {
+		t.Errorf("GetGroup() after delete = %v, want nil", group)
+	}
+
+	if members, _ = store.GetGroupMembers(ctx, "guild", "role"); len(members) != 0 {
+		t.Errorf("GetGroupMembers() after delete = %v, want empty", members)
+	}
+
+	if groups, _ = store.GetMemberGroups(ctx, "guild", "owner"); len(groups) != 0 {
+		t.Errorf("GetMemberGroups() after delete = %v, want empty", groups)
+	}
+}
+
+func testSettings(t *testing.T, ctx context.Context, store backend.Backend) {
+	settings, err := store.GetGuildSettings(ctx, "guild")
+	must(t, err)
+
+	if !settings.IsZero() {
+		t.Errorf("GetGuildSettings() on missing settings = %v, want zero settings", settings)
+	}
+
+	expected := backend.GuildSettings{
+		ApprovalRequired: true,
+		ApprovalChannel:  "channel",
+		RateLimits: map[string]backend.CommandRateLimits{
+			"role": {User: &backend.RateLimit{Uses: 5, Per: time.Minute}},
+		},
+	}
+	must(t, store.SetGuildSettings(ctx, "guild", expected))
+
+	if settings, _ = store.GetGuildSettings(ctx, "guild"); !settings.Equal(expected) {
+		t.Errorf("GetGuildSettings() = %v, want %v", settings, expected)
+	}
+}
+
+func testApprovals(t *testing.T, ctx context.Context, store backend.Backend) {
+	request, err := store.GetApproval(ctx, "guild", "missing")
+	must(t, err)
+
+	if request != nil {
+		t.Errorf("GetApproval() on missing request = %v, want nil", request)
+	}
+
+	color := 0x00FF00
+
+	must(t, store.SetApproval(ctx, backend.ApprovalRequest{
+		ID:        "colored",
+		Guild:     "guild",
+		User:      "user",
+		Requester: "requester",
+		Color:     &color,
+		AppID:     "app",
+		Token:     "token",
+		CreatedAt: moment,
+		ExpiresAt: moment.Add(backend.ApprovalExpiry),
+	}))
+
+	must(t, store.SetApproval(ctx, backend.ApprovalRequest{ID: "named", Guild: "guild", User: "user", Name: "name"}))
+
+	request, err = store.GetApproval(ctx, "guild", "colored")
+	must(t, err)
+
+	if request == nil || request.Color == nil || *request.Color != color || request.Token != "token" {
+		t.Fatalf("GetApproval() = %v, want the colored request", request)
+	}
+
+	if !request.CreatedAt.Equal(moment) || !request.ExpiresAt.Equal(moment.Add(backend.ApprovalExpiry)) {
+		t.Errorf("GetApproval() times = %v, %v, want %v, %v", request.CreatedAt, request.ExpiresAt, moment, moment.Add(backend.ApprovalExpiry))
+	}
+
+	if request, _ = store.GetApproval(ctx, "guild", "named"); request == nil || request.Color != nil || request.Name != "name" {
+		t.Errorf("GetApproval() = %v, want the named request without a color", request)
+	}
+
+	requests, err := store.ListApprovals(ctx)
+	must(t, err)
+
+	if len(requests) != 2 {
+		t.Errorf("ListApprovals() returned %d requests, want 2", len(requests))
+	}
+
+	must(t, store.DeleteApproval(ctx, "guild", "colored"))
+
+	if request, _ = store.GetApproval(ctx, "guild", "colored"); request != nil {
+		t.Errorf("GetApproval() after delete = %v, want nil", request)
+	}
+
+	if requests, _ = store.ListApprovals(ctx); len(requests) != 1 {
+		t.Errorf("ListApprovals() after delete returned %d requests, want 1", len(requests))
+	}
+}
+
+func testGuildListings(t *testing.T, ctx context.Context, store backend.Backend) {
+	for _, guild := range []string{"guild", "other"} {
+		must(t, store.PushHistory(ctx, guild, "first", backend.RoleState{Color: 0x112233}))
+		must(t, store.AddFavorite(ctx, guild, "second", backend.Favorite{Color: 0x445566}))
+		must(t, store.SetSchedule(ctx, backend.Schedule{Guild: guild, User: "first", Source: backend.ScheduleSourceRandom}))
+		must(t, store.SetGroup(ctx, backend.GroupRole{Guild: guild, Role: "group", Owner: "first", MaxMembers: 5}))
+		must(t, store.SetApproval(ctx, backend.ApprovalRequest{Guild: guild, ID: "request", User: "first"}))
+	}
+
+	must(t, store.PushHistory(ctx, "guild", "third", backend.RoleState{Color: 0x778899}))
+	must(t, store.PushHistory(ctx, "guild", "emptied", backend.RoleState{Color: 0x778899}))
+
+	if _, err := store.PopHistory(ctx, "guild", "emptied"); err != nil {
+		t.Fatalf("PopHistory() error = %v", err)
+	}
+
+	users, err := store.ListHistoryUsers(ctx, "guild")
+	must(t, err)
+
+	if !slices.Equal(users, []string{"first", "third"}) {
+		t.Errorf("ListHistoryUsers() = %v, want [first third]", users)
+	}
+
+	users, err = store.ListFavoriteUsers(ctx, "guild")
+	must(t, err)
+
+	if !slices.Equal(users, []string{"second"}) {
+		t.Errorf("ListFavoriteUsers() = %v, want [second]", users)
+	}
+
+	schedules, err := store.ListGuildSchedules(ctx, "guild")
+	must(t, err)
+
+	if len(schedules) != 1 || schedules[0].Guild != "guild" || schedules[0].User != "first" {
+		t.Errorf("ListGuildSchedules() = %+v, want the schedule of first in guild", schedules)
+	}
+
+	groups, err := store.ListGroups(ctx, "guild")
+	must(t, err)
+
+	if len(groups) != 1 || groups[0].Guild != "guild" || groups[0].Role != "group" || groups[0].MaxMembers != 5 {
+		t.Errorf("ListGroups() = %+v, want the group of guild", groups)
+	}
+
+	requests, err := store.ListGuildApprovals(ctx, "guild")
+	must(t, err)
+
+	if len(requests) != 1 || requests[0].Guild != "guild" || requests[0].ID != "request" {
+		t.Errorf("ListGuildApprovals() = %+v, want the request of guild", requests)
+	}
+
+	if users, _ = store.ListHistoryUsers(ctx, "empty"); len(users) != 0 {
+		t.Errorf("ListHistoryUsers() of a guild without data = %v, want empty", users)
+	}
+}
+
+func testGuildIsolation(t *testing.T, ctx context.Context, store backend.Backend) {
+	must(t, store.SetRole(ctx, "first", "user", "role"))
+	must(t, store.PushHistory(ctx, "first", "user", backend.RoleState{Name: "name"}))
+	must(t, store.AddFavorite(ctx, "first", "user", backend.Favorite{Color: 1}))
+	must(t, store.SetSchedule(ctx, backend.Schedule{Guild: "first", User: "user"}))
+	must(t, store.SetGroup(ctx, backend.GroupRole{Guild: "first", Role: "role"}))
+	must(t, store.AddGroupMember(ctx, "first", "role", "user", 0))
+	must(t, store.SetGuildSettings(ctx, "first", backend.GuildSettings{ApprovalRequired: true}))
+	must(t, store.SetApproval(ctx, backend.ApprovalRequest{ID: "id", Guild: "first"}))
+
+	if role, _ := store.GetRole(ctx, "second", "user"); role != "" {
+		t.Errorf("GetRole() leaked across guilds = %q", role)
+	}
+
+	if owner, _ := store.GetRoleOwner(ctx, "second", "role"); owner != "" {
+		t.Errorf("GetRoleOwner() leaked across guilds = %q", owner)
+	}
+
+	if roles, _, _ := store.ListRoles(ctx, "second", "", 10); len(roles) != 0 {
+		t.Errorf("ListRoles() leaked across guilds = %v", roles)
+	}
+
+	if history, _ := store.GetHistory(ctx, "second", "user"); len(history) != 0 {
+		t.Errorf("GetHistory() leaked across guilds = %v", history)
+	}
+
+	if favorites, _ := store.GetFavorites(ctx, "second", "user"); len(favorites) != 0 {
+		t.Errorf("GetFavorites() leaked across guilds = %v", favorites)
+	}
+
+	if schedule, _ := store.GetSchedule(ctx, "second", "user"); schedule != nil {
+		t.Errorf("GetSchedule() leaked across guilds = %v", schedule)
+	}
+
+	if group, _ := store.GetGroup(ctx, "second", "role"); group != nil {
+		t.Errorf("GetGroup() leaked across guilds = %v", group)
+	}
+
+	if groups, _ := store.GetMemberGroups(ctx, "second", "user"); len(groups) != 0 {
+		t.Errorf("GetMemberGroups() leaked across guilds = %v", groups)
+	}
+
+	if settings, _ := store.GetGuildSettings(ctx, "second"); settings.ApprovalRequired {
+		t.Errorf("GetGuildSettings() leaked across guilds = %v", settings)
+	}
+
+	if request, _ := store.GetApproval(ctx, "second", "id"); request != nil {
+		t.Errorf("GetApproval() leaked across guilds = %v", request)
+	}
+}
+
+func testConcurrentWriters(t *testing.T, ctx context.Context, store backend.Backend) {
+	const writers = 20
+
+	var wait sync.WaitGroup
+	failures := make(chan error, writers*4)
+
+	for index := 0; index < writers; index++ {
+		wait.Add(1)
+
+		go func(index int) {
+			defer wait.Done()
+
+			user := "user" + strconv.Itoa(index)
+
+			failures <- store.SetRole(ctx, "guild", user, "role"+strconv.Itoa(index))
+			failures <- store.PushHistory(ctx, "guild", "shared", backend.RoleState{Color: index})
+			failures <- store.AddGroupMember(ctx, "guild", "group", user, 0)
+
+			if err := store.AddGroupMember(ctx, "guild", "capped", user, writers/2); !errors.Is(err, backend.GroupMemberLimitReached) {
+				failures <- err
+			}
+		}(index)
+	}
+
+	wait.Wait()
+	close(failures)
+
+	for err := range failures {
+		must(t, err)
+	}
+
+	roles, err := backend.ListAllRoles(ctx, store, "guild")
+	must(t, err)
+
+	if len(roles) != writers {
+		t.Errorf("ListAllRoles() after concurrent writes returned %d roles, want %d", len(roles), writers)
+	}
+
+	for _, role := range roles {
+		if owner, _ := store.GetRoleOwner(ctx, "guild", role.Role); owner != role.User {
+			t.Errorf("GetRoleOwner() of %s = %q, want %q", role.Role, owner, role.User)
+		}
+	}
+
+	if history, _ := store.GetHistory(ctx, "guild", "shared"); len(history) != backend.MaxHistoryEntries {
+		t.Errorf("GetHistory() after concurrent pushes kept %d entries, want %d", len(history), backend.MaxHistoryEntries)
+	}
+
+	if members, _ := store.GetGroupMembers(ctx, "guild", "group"); len(members) != writers {
+		t.Errorf("GetGroupMembers() after concurrent adds returned %d members, want %d", len(members), writers)
+	}
+
+	if members, _ := store.GetGroupMembers(ctx, "guild", "capped"); len(members) != writers/2 {
+		t.Errorf("GetGroupMembers() after concurrent capped adds returned %d members, want %d", len(members), writers/2)
+	}
+}
+
+func testContextCancellation(t *testing.T, ctx context.Context, store backend.Backend) {
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := store.SetRole(cancelled, "guild", "user", "role"); err == nil {
+		t.Errorf("SetRole() with a cancelled context succeeded, want an error")
+	}
+
+	if _, err := store.GetRole(cancelled, "guild", "user"); err == nil {
+		t.Errorf("GetRole() with a cancelled context succeeded, want an error")
+	}
+
+	if _, err := store.ListSchedules(cancelled); err == nil {
+		t.Errorf("ListSchedules() with a cancelled context succeeded, want an error")
+	}
+
+	if role, _ := store.GetRole(ctx, "guild", "user"); role != "" {
+		t.Errorf("SetRole() with a cancelled context stored %q, want nothing", role)
+	}
+}
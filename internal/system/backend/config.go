@@ -1,12 +1,59 @@
 package backend
 
-import "emperror.dev/errors"
+import (
+	"emperror.dev/errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+)
 
 const (
 	hostIsRequired     = errors.Sentinel("host is required")
 	portIsRequired     = errors.Sentinel("port is required")
 	usernameIsRequired = errors.Sentinel("username is required")
 	passwordIsRequired = errors.Sentinel("password is required")
+	unknownStorageType = errors.Sentinel("storage type must be redis, memory or sqlite")
+	unknownRedisMode   = errors.Sentinel("redis mode must be standalone, sentinel or cluster")
+	masterIsRequired   = errors.Sentinel("master name is required in sentinel mode")
+	databaseInCluster  = errors.Sentinel("database selection is not supported in cluster mode")
+	databaseNegative   = errors.Sentinel("database cannot be negative")
+	attemptsTooFew     = errors.Sentinel("retry attempts must be at least one")
+	healthTooFrequent  = errors.Sentinel("health interval must be at least one second")
+	leaseTooShort      = errors.Sentinel("leadership lease must be at least three seconds")
+	lockTooShort       = errors.Sentinel("lock expiry must be at least one second")
+)
+
+const (
+	// StorageRedis keeps all data in a redis database
+	StorageRedis = "redis"
+	// StorageMemory keeps all data in memory, optionally snapshotted to a file between runs
+	StorageMemory = "memory"
+	// StorageSQLite keeps all data in a SQLite database file
+	StorageSQLite = "sqlite"
+)
+
+const (
+	// RedisStandalone connects to a single redis server
+	RedisStandalone = "standalone"
+	// RedisSentinel connects to the master of a sentinel monitored deployment, following failovers
+	RedisSentinel = "sentinel"
+	// RedisCluster connects to a redis cluster
+	RedisCluster = "cluster"
+)
+
+const (
+	defaultDatabase       = "curator.db"
+	defaultRedisPrefix    = "curator"
+	defaultHealthInterval = 15 * time.Second
+
+	defaultRetryAttempts       = 10
+	defaultRetryInitialBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff     = 30 * time.Second
+
+	defaultLeaseTTL = 15 * time.Second
+	defaultLockTTL  = 30 * time.Second
 )
 
 type Config struct {
@@ -14,12 +61,79 @@ type Config struct {
 	Port int
 }
 
+// StorageConfig selects where the bot keeps its data
+type StorageConfig struct {
+	// Type is one of StorageRedis, StorageMemory or StorageSQLite
+	Type string
+	// Snapshot is the file memory storage is loaded from on start and saved to on shutdown, empty to disable
+	Snapshot string
+	// Database is the file sqlite storage keeps its data in
+	Database string
+	// HealthInterval is how often the backend is checked, commands that need it are refused while it is unreachable
+	HealthInterval time.Duration
+}
+
 type AuthenticatedConfig struct {
-	*Config
+	*Config  `mapstructure:",squash"`
 	Username string
 	Password string
 }
 
+// RedisConfig is the connection to the redis database. Username and password are optional, a password alone
+// authenticates as the default user.
+type RedisConfig struct {
+	AuthenticatedConfig `mapstructure:",squash"`
+
+	// Mode is one of RedisStandalone, RedisSentinel or RedisCluster
+	Mode string
+	// Addresses are the sentinels or cluster nodes to connect to, Host and Port are used when empty
+	Addresses []string
+	// MasterName is the name of the master monitored by the sentinels
+	MasterName string
+	// SentinelPassword authenticates with the sentinels themselves, when it differs from the master
+	SentinelPassword string
+
+	DB int
+	// Prefix is prepended to every key, so several bots can share a database
+	Prefix string
+
+	TLS   RedisTLSConfig
+	Retry RetryConfig
+
+	PoolSize     int
+	MinIdleConns int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// RetryConfig controls how connecting is retried at startup, while the database may still be coming up
+type RetryConfig struct {
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+type RedisTLSConfig struct {
+	Enabled bool
+	// CA is a PEM file of the certificate authorities trusted in addition to the system ones
+	CA string
+	// ServerName overrides the name the server certificate is verified against
+	ServerName string
+	// InsecureSkipVerify disables server certificate verification, only for testing
+	InsecureSkipVerify bool
+}
+
+// CoordinationConfig controls how several instances sharing a redis database divide work between them
+type CoordinationConfig struct {
+	// Instance identifies this instance in leadership and locks, the host name and a random suffix by default
+	Instance string
+	// LeaseTTL is how long leadership is held without being renewed, a new leader takes over after it expires
+	LeaseTTL time.Duration
+	// LockTTL is how long a lock is held at most, in case the instance holding it stops without releasing it
+	LockTTL time.Duration
+}
+
 func (c *Config) Validate() error {
 	if c.Host == "" {
 		return hostIsRequired
@@ -47,3 +161,140 @@ func (c *AuthenticatedConfig) Validate() error {
 
 	return nil
 }
+
+func (c *StorageConfig) Process() error {
+	if c.Type == "" {
+		c.Type = StorageRedis
+	}
+
+	c.Type = strings.ToLower(c.Type)
+
+	if c.Type == StorageSQLite && c.Database == "" {
+		c.Database = defaultDatabase
+	}
+
+	if c.HealthInterval == 0 {
+		c.HealthInterval = defaultHealthInterval
+	}
+
+	return nil
+}
+
+func (c *StorageConfig) Validate() error {
+	if c.Type != StorageRedis && c.Type != StorageMemory && c.Type != StorageSQLite {
+		return unknownStorageType
+	}
+
+	if c.HealthInterval < time.Second {
+		return healthTooFrequent
+	}
+
+	return nil
+}
+
+func (c *RedisConfig) Process() error {
+	if c.Config == nil {
+		c.Config = &Config{}
+	}
+
+	if c.Mode == "" {
+		c.Mode = RedisStandalone
+	}
+
+	c.Mode = strings.ToLower(c.Mode)
+
+	if c.Prefix == "" {
+		c.Prefix = defaultRedisPrefix
+	}
+
+	return c.Retry.Process()
+}
+
+func (c *RedisConfig) Validate() error {
+	if c.Mode != RedisStandalone && c.Mode != RedisSentinel && c.Mode != RedisCluster {
+		return unknownRedisMode
+	}
+
+	if len(c.Addresses) == 0 {
+		if err := c.Config.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// A username without a password cannot authenticate, a password alone is the legacy AUTH
+	if c.Username != "" && c.Password == "" {
+		return passwordIsRequired
+	}
+
+	if c.Mode == RedisSentinel && c.MasterName == "" {
+		return masterIsRequired
+	}
+
+	if c.DB < 0 {
+		return databaseNegative
+	}
+
+	if c.Mode == RedisCluster && c.DB != 0 {
+		return databaseInCluster
+	}
+
+	return c.Retry.Validate()
+}
+
+func (c *RetryConfig) Process() error {
+	if c.Attempts == 0 {
+		c.Attempts = defaultRetryAttempts
+	}
+
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = defaultRetryInitialBackoff
+	}
+
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultRetryMaxBackoff
+	}
+
+	return nil
+}
+
+func (c *RetryConfig) Validate() error {
+	if c.Attempts < 1 {
+		return attemptsTooFew
+	}
+
+	return nil
+}
+
+func (c *CoordinationConfig) Process() error {
+	if c.Instance == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "curator"
+		}
+
+		c.Instance = fmt.Sprintf("%s-%08x", host, rand.Uint32())
+	}
+
+	if c.LeaseTTL == 0 {
+		c.LeaseTTL = defaultLeaseTTL
+	}
+
+	if c.LockTTL == 0 {
+		c.LockTTL = defaultLockTTL
+	}
+
+	return nil
+}
+
+func (c *CoordinationConfig) Validate() error {
+	// Leadership is renewed three times per lease, shorter leases would be renewed too often
+	if c.LeaseTTL < 3*time.Second {
+		return leaseTooShort
+	}
+
+	if c.LockTTL < time.Second {
+		return lockTooShort
+	}
+
+	return nil
+}
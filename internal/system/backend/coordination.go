@@ -0,0 +1,33 @@
+package backend
+
+import (
+	"context"
+)
+
+const (
+	// SettingsTopic is published with the guild whenever its settings change
+	SettingsTopic = "settings"
+)
+
+// Coordinator lets several instances of the bot share one backend without doing the same work twice
+type Coordinator interface {
+	// Leader reports whether this instance runs the singleton jobs, like registering commands and scheduling
+	Leader() bool
+
+	// OnElected calls the handler every time this instance becomes the leader, right away if it already is
+	OnElected(handler func())
+
+	// Lock blocks until this instance holds the named lock or ctx is done. The returned function releases it.
+	Lock(ctx context.Context, name string) (func(), error)
+
+	// Publish sends the message to every instance subscribed to the topic, including this one
+	Publish(ctx context.Context, topic string, message string) error
+
+	// Subscribe calls the handler with every message published to the topic
+	Subscribe(topic string, handler func(message string))
+}
+
+// RoleLock is the name of the lock held while the personal role of a user is created
+func RoleLock(guild string, user string) string {
+	return "role:" + guild + ":" + user
+}
@@ -0,0 +1,807 @@
+package backend
+
+import (
+	"cmp"
+	"context"
+	"emperror.dev/errors"
+	"slices"
+	"time"
+)
+
+// ExportVersion is the version of the export format written by ExportGuild, imports of other versions are refused
+const ExportVersion = 1
+
+const (
+	unsupportedExportVersion = errors.Sentinel("unsupported export version")
+	exportGuildMissing       = errors.Sentinel("export is missing its guild")
+	exportRoleIncomplete     = errors.Sentinel("export has a role mapping without a user or role")
+	exportUserDuplicated     = errors.Sentinel("export maps a user more than once")
+	exportColorOutOfRange    = errors.Sentinel("export has a color outside of 0x000000 to 0xFFFFFF")
+	exportHistoryTooLong     = errors.Sentinel("export has more history entries for a user than are kept")
+	exportFavoritesTooMany   = errors.Sentinel("export has more favorites for a user than are allowed")
+	exportGuildMismatch      = errors.Sentinel("export has data belonging to another guild")
+	exportScheduleIncomplete = errors.Sentinel("export has a schedule without a user")
+	exportGroupIncomplete    = errors.Sentinel("export has a group role without a role or owner")
+	exportGroupDuplicated    = errors.Sentinel("export has a group role more than once")
+	exportGroupTooLarge      = errors.Sentinel("export has a group role with more members than are allowed")
+	exportApprovalIncomplete = errors.Sentinel("export has an approval request without an id or user")
+	unknownImportMode        = errors.Sentinel("import mode must be merge or overwrite")
+)
+
+// ImportMode decides what happens to data that already exists when importing
+type ImportMode string
+
+const (
+	// ImportMerge only adds what is missing, existing data of the guild is kept
+	ImportMerge ImportMode = "merge"
+	// ImportOverwrite replaces the data of the guild with the data of the export
+	ImportOverwrite ImportMode = "overwrite"
+)
+
+// Export is the versioned file format holding the data of one or more guilds
+type Export struct {
+	Version    int           `json:"version"`
+	ExportedAt time.Time     `json:"exported_at"`
+	Guilds     []GuildExport `json:"guilds"`
+}
+
+// GuildExport is the data of a guild. History and favorites are keyed by user.
+type GuildExport struct {
+	Guild     string                 `json:"guild"`
+	Settings  GuildSettings          `json:"settings"`
+	Roles     []PersonalRole         `json:"roles"`
+	History   map[string][]RoleState `json:"history,omitempty"`
+	Favorites map[string][]Favorite  `json:"favorites,omitempty"`
+	Schedules []Schedule             `json:"schedules,omitempty"`
+	Theme     *GuildTheme            `json:"theme,omitempty"`
+	Groups    []GroupExport          `json:"groups,omitempty"`
+	Approvals []ApprovalRequest      `json:"approvals,omitempty"`
+}
+
+// GroupExport is a group role along with its members
+type GroupExport struct {
+	GroupRole
+	Members []string `json:"members,omitempty"`
+}
+
+// ImportReport counts what an import changed, or would change when it is a dry run
+type ImportReport struct {
+	Roles     int `json:"roles"`
+	History   int `json:"history"`
+	Favorites int `json:"favorites"`
+	Settings  int `json:"settings"`
+	Schedules int `json:"schedules"`
+	Themes    int `json:"themes"`
+	Groups    int `json:"groups"`
+	Approvals int `json:"approvals"`
+	// Removed counts entries deleted because they are not part of an overwriting export
+	Removed int `json:"removed"`
+	// Skipped counts entries left alone because the guild already has data for them in merge mode
+	Skipped int `json:"skipped"`
+}
+
+// Add sums the counts of another report into this one
+func (r *ImportReport) Add(other ImportReport) {
+	r.Roles += other.Roles
+	r.History += other.History
+	r.Favorites += other.Favorites
+	r.Settings += other.Settings
+	r.Schedules += other.Schedules
+	r.Themes += other.Themes
+	r.Groups += other.Groups
+	r.Approvals += other.Approvals
+	r.Removed += other.Removed
+	r.Skipped += other.Skipped
+}
+
+// ExportGuilds exports the data of the given guilds in the current export format
+func ExportGuilds(ctx context.Context, store Backend, guilds ...string) (Export, error) {
+	export := Export{
+		Version:    ExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Guilds:     make([]GuildExport, 0, len(guilds)),
+	}
+
+	for _, guild := range guilds {
+		guildExport, err := ExportGuild(ctx, store, guild)
+		if err != nil {
+			return export, errors.WrapWithDetails(err, "failed to export guild", "guild", guild)
+		}
+
+		export.Guilds = append(export.Guilds, guildExport)
+	}
+
+	return export, nil
+}
+
+// ExportGuild reads all data of a guild
+func ExportGuild(ctx context.Context, store Backend, guild string) (GuildExport, error) {
+	export := GuildExport{
+		Guild:     guild,
+		History:   make(map[string][]RoleState),
+		Favorites: make(map[string][]Favorite),
+	}
+
+	var err error
+
+	if export.Settings, err = store.GetGuildSettings(ctx, guild); err != nil {
+		return export, errors.Wrap(err, "failed to get guild settings")
+	}
+
+	if export.Roles, err = ListAllRoles(ctx, store, guild); err != nil {
+		return export, errors.Wrap(err, "failed to list personal roles")
+	}
+
+	historyUsers, err := store.ListHistoryUsers(ctx, guild)
+	if err != nil {
+		return export, errors.Wrap(err, "failed to list users with role history")
+	}
+
+	for _, user := range historyUsers {
+		history, err := store.GetHistory(ctx, guild, user)
+		if err != nil {
+			return export, errors.Wrap(err, "failed to get role history")
+		}
+
+		if len(history) > 0 {
+			export.History[user] = history
+		}
+	}
+
+	favoriteUsers, err := store.ListFavoriteUsers(ctx, guild)
+	if err != nil {
+		return export, errors.Wrap(err, "failed to list users with favorites")
+	}
+
+	for _, user := range favoriteUsers {
+		favorites, err := store.GetFavorites(ctx, guild, user)
+		if err != nil {
+			return export, errors.Wrap(err, "failed to get favorites")
+		}
+
+		if len(favorites) > 0 {
+			export.Favorites[user] = favorites
+		}
+	}
+
+	if export.Schedules, err = store.ListGuildSchedules(ctx, guild); err != nil {
+		return export, errors.Wrap(err, "failed to list schedules")
+	}
+
+	slices.SortFunc(export.Schedules, func(a, b Schedule) int {
+		return cmp.Compare(a.User, b.User)
+	})
+
+	if export.Theme, err = store.GetGuildTheme(ctx, guild); err != nil {
+		return export, errors.Wrap(err, "failed to get guild theme")
+	}
+
+	groups, err := store.ListGroups(ctx, guild)
+	if err != nil {
+		return export, errors.Wrap(err, "failed to list group roles")
+	}
+
+	slices.SortFunc(groups, func(a, b GroupRole) int {
+		return cmp.Compare(a.Role, b.Role)
+	})
+
+	for _, group := range groups {
+		members, err := store.GetGroupMembers(ctx, guild, group.Role)
+		if err != nil {
+			return export, errors.Wrap(err, "failed to get group members")
+		}
+
+		export.Groups = append(export.Groups, GroupExport{GroupRole: group, Members: members})
+	}
+
+	if export.Approvals, err = store.ListGuildApprovals(ctx, guild); err != nil {
+		return export, errors.Wrap(err, "failed to list approval requests")
+	}
+
+	slices.SortFunc(export.Approvals, func(a, b ApprovalRequest) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return export, nil
+}
+
+// Validate checks that the export can be imported without partially failing halfway through
+func (e *Export) Validate() error {
+	if e.Version != ExportVersion {
+		return errors.WithDetails(unsupportedExportVersion, "version", e.Version, "supported", ExportVersion)
+	}
+
+	for _, guild := range e.Guilds {
+		if err := guild.Validate(); err != nil {
+			return errors.WithDetails(err, "guild", guild.Guild)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that the guild export can be imported without partially failing halfway through
+func (g *GuildExport) Validate() error {
+	if g.Guild == "" {
+		return exportGuildMissing
+	}
+
+	users := make(map[string]bool, len(g.Roles))
+
+	for _, role := range g.Roles {
+		if role.User == "" || role.Role == "" {
+			return exportRoleIncomplete
+		}
+
+		if users[role.User] {
+			return errors.WithDetails(exportUserDuplicated, "user", role.User)
+		}
+
+		users[role.User] = true
+	}
+
+	for user, history := range g.History {
+		if len(history) > MaxHistoryEntries {
+			return errors.WithDetails(exportHistoryTooLong, "user", user)
+		}
+
+		for _, state := range history {
+			if !validColor(state.Color) {
+				return errors.WithDetails(exportColorOutOfRange, "user", user)
+			}
+		}
+	}
+
+	for user, favorites := range g.Favorites {
+		if len(favorites) > MaxFavorites {
+			return errors.WithDetails(exportFavoritesTooMany, "user", user)
+		}
+
+		for _, favorite := range favorites {
+			if !validColor(favorite.Color) {
+				return errors.WithDetails(exportColorOutOfRange, "user", user)
+			}
+		}
+	}
+
+	for _, schedule := range g.Schedules {
+		if schedule.Guild != g.Guild {
+			return errors.WithDetails(exportGuildMismatch, "schedule", schedule.User)
+		}
+
+		if schedule.User == "" {
+			return exportScheduleIncomplete
+		}
+
+		if !validColor(schedule.BaseColor) {
+			return errors.WithDetails(exportColorOutOfRange, "schedule", schedule.User)
+		}
+	}
+
+	if g.Theme != nil {
+		if g.Theme.Guild != g.Guild {
+			return errors.WithDetails(exportGuildMismatch, "theme", g.Theme.Theme)
+		}
+
+		for role, color := range g.Theme.Originals {
+			if !validColor(color) {
+				return errors.WithDetails(exportColorOutOfRange, "role", role)
+			}
+		}
+	}
+
+	groups := make(map[string]bool, len(g.Groups))
+
+	for _, group := range g.Groups {
+		if group.Guild != g.Guild {
+			return errors.WithDetails(exportGuildMismatch, "group", group.Role)
+		}
+
+		if group.Role == "" || group.Owner == "" {
+			return exportGroupIncomplete
+		}
+
+		if groups[group.Role] {
+			return errors.WithDetails(exportGroupDuplicated, "group", group.Role)
+		}
+
+		if len(group.Members) > MaxGroupMembers {
+			return errors.WithDetails(exportGroupTooLarge, "group", group.Role)
+		}
+
+		groups[group.Role] = true
+	}
+
+	for _, request := range g.Approvals {
+		if request.Guild != g.Guild {
+			return errors.WithDetails(exportGuildMismatch, "approval", request.ID)
+		}
+
+		if request.ID == "" || request.User == "" {
+			return exportApprovalIncomplete
+		}
+
+		if request.Color != nil && !validColor(*request.Color) {
+			return errors.WithDetails(exportColorOutOfRange, "approval", request.ID)
+		}
+	}
+
+	return nil
+}
+
+func validColor(color int) bool {
+	return color >= 0 && color <= 0xFFFFFF
+}
+
+// ParseImportMode returns the import mode with the given name
+func ParseImportMode(mode string) (ImportMode, error) {
+	switch ImportMode(mode) {
+	case ImportMerge, ImportOverwrite:
+		return ImportMode(mode), nil
+	}
+
+	return "", unknownImportMode
+}
+
+// ImportGuild writes the data of a validated guild export. A dry run reads the current data of the guild to
+// report what would change, without writing anything.
+func ImportGuild(ctx context.Context, store Backend, export GuildExport, mode ImportMode, dryRun bool) (ImportReport, error) {
+	var report ImportReport
+
+	guild := export.Guild
+
+	existing, err := ListAllRoles(ctx, store, guild)
+	if err != nil {
+		return report, errors.Wrap(err, "failed to list personal roles")
+	}
+
+	current := make(map[string]string, len(existing))
+	for _, role := range existing {
+		current[role.User] = role.Role
+	}
+
+	roles := make(map[string]string, len(export.Roles))
+	for _, role := range export.Roles {
+		if previous, exists := current[role.User]; exists && (mode == ImportMerge || previous == role.Role) {
+			if previous != role.Role {
+				report.Skipped++
+			}
+			continue
+		}
+
+		roles[role.User] = role.Role
+	}
+
+	report.Roles = len(roles)
+
+	if mode == ImportOverwrite {
+		imported := make(map[string]bool, len(export.Roles))
+		for _, role := range export.Roles {
+			imported[role.User] = true
+		}
+
+		for user := range current {
+			if imported[user] {
+				continue
+			}
+
+			report.Removed++
+
+			if !dryRun {
+				if _, err = store.DeleteRole(ctx, guild, user); err != nil {
+					return report, errors.Wrap(err, "failed to delete personal role")
+				}
+			}
+		}
+	}
+
+	if !dryRun {
+		if err = store.SetRolesBatch(ctx, guild, roles); err != nil {
+			return report, errors.Wrap(err, "failed to store personal roles")
+		}
+	}
+
+	settings, err := store.GetGuildSettings(ctx, guild)
+	if err != nil {
+		return report, errors.Wrap(err, "failed to get guild settings")
+	}
+
+	switch {
+	case settings.Equal(export.Settings):
+	case mode == ImportMerge && !settings.IsZero():
+		report.Skipped++
+	default:
+		report.Settings++
+
+		if !dryRun {
+			if err = store.SetGuildSettings(ctx, guild, export.Settings); err != nil {
+				return report, errors.Wrap(err, "failed to store guild settings")
+			}
+		}
+	}
+
+	for user, history := range export.History {
+		imported, err := importHistory(ctx, store, guild, user, history, mode, dryRun)
+		if err != nil {
+			return report, err
+		}
+
+		if imported {
+			report.History += len(history)
+		} else {
+			report.Skipped += len(history)
+		}
+	}
+
+	for user, favorites := range export.Favorites {
+		added, skipped, err := importFavorites(ctx, store, guild, user, favorites, mode, dryRun)
+		if err != nil {
+			return report, err
+		}
+
+		report.Favorites += added
+		report.Skipped += skipped
+	}
+
+	if mode == ImportOverwrite {
+		removed, err := removeUnexportedLists(ctx, store, export, dryRun)
+		if err != nil {
+			return report, err
+		}
+
+		report.Removed += removed
+	}
+
+	for _, importer := range []func(context.Context, Backend, GuildExport, ImportMode, bool) (ImportReport, error){
+		importSchedules,
+		importTheme,
+		importGroups,
+		importApprovals,
+	} {
+		imported, err := importer(ctx, store, export, mode, dryRun)
+		if err != nil {
+			return report, err
+		}
+
+		report.Add(imported)
+	}
+
+	return report, nil
+}
+
+// importHistory replaces the history of a user, in merge mode only when the user has no history yet
+func importHistory(ctx context.Context, store Backend, guild string, user string, history []RoleState, mode ImportMode, dryRun bool) (bool, error) {
+	current, err := store.GetHistory(ctx, guild, user)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get role history")
+	}
+
+	if len(current) > 0 && mode == ImportMerge {
+		return false, nil
+	}
+
+	if dryRun {
+		return true, nil
+	}
+
+	for range current {
+		if _, err = store.PopHistory(ctx, guild, user); err != nil {
+			return false, errors.Wrap(err, "failed to clear role history")
+		}
+	}
+
+	// History is most recent first, push the oldest entry first to keep that order
+	for index := len(history) - 1; index >= 0; index-- {
+		if err = store.PushHistory(ctx, guild, user, history[index]); err != nil {
+			return false, errors.Wrap(err, "failed to store role history")
+		}
+	}
+
+	return true, nil
+}
+
+// importFavorites adds the favorites of a user, in merge mode keeping the favorites the user already saved
+func importFavorites(ctx context.Context, store Backend, guild string, user string, favorites []Favorite, mode ImportMode, dryRun bool) (int, int, error) {
+	current, err := store.GetFavorites(ctx, guild, user)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to get favorites")
+	}
+
+	saved := make(map[int]bool, len(current))
+	for _, favorite := range current {
+		saved[favorite.Color] = true
+	}
+
+	if mode == ImportOverwrite && !dryRun {
+		for _, favorite := range current {
+			if _, err = store.RemoveFavorite(ctx, guild, user, favorite.Color); err != nil {
+				return 0, 0, errors.Wrap(err, "failed to clear favorites")
+			}
+		}
+	}
+
+	added, skipped := 0, 0
+	remaining := MaxFavorites - len(current)
+
+	for _, favorite := range favorites {
+		if mode == ImportMerge && (saved[favorite.Color] || remaining <= 0) {
+			skipped++
+			continue
+		}
+
+		added++
+		remaining--
+
+		if dryRun {
+			continue
+		}
+
+		if err = store.AddFavorite(ctx, guild, user, favorite); err != nil {
+			return added, skipped, errors.Wrap(err, "failed to store favorite")
+		}
+	}
+
+	return added, skipped, nil
+}
+
+// removeUnexportedLists clears the history and favorites of users that have none in an overwriting export
+func removeUnexportedLists(ctx context.Context, store Backend, export GuildExport, dryRun bool) (int, error) {
+	removed := 0
+
+	historyUsers, err := store.ListHistoryUsers(ctx, export.Guild)
+	if err != nil {
+		return removed, errors.Wrap(err, "failed to list users with role history")
+	}
+
+	for _, user := range historyUsers {
+		if _, exported := export.History[user]; exported {
+			continue
+		}
+
+		history, err := store.GetHistory(ctx, export.Guild, user)
+		if err != nil {
+			return removed, errors.Wrap(err, "failed to get role history")
+		}
+
+		removed += len(history)
+
+		if !dryRun {
+			if _, err = importHistory(ctx, store, export.Guild, user, nil, ImportOverwrite, false); err != nil {
+				return removed, err
+			}
+		}
+	}
+
+	favoriteUsers, err := store.ListFavoriteUsers(ctx, export.Guild)
+	if err != nil {
+		return removed, errors.Wrap(err, "failed to list users with favorites")
+	}
+
+	for _, user := range favoriteUsers {
+		if _, exported := export.Favorites[user]; exported {
+			continue
+		}
+
+		favorites, err := store.GetFavorites(ctx, export.Guild, user)
+		if err != nil {
+			return removed, errors.Wrap(err, "failed to get favorites")
+		}
+
+		removed += len(favorites)
+
+		if !dryRun {
+			if _, _, err = importFavorites(ctx, store, export.Guild, user, nil, ImportOverwrite, false); err != nil {
+				return removed, err
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// importSchedules stores the schedules of a guild, in merge mode keeping the schedules users already have
+func importSchedules(ctx context.Context, store Backend, export GuildExport, mode ImportMode, dryRun bool) (ImportReport, error) {
+	var report ImportReport
+
+	existing, err := store.ListGuildSchedules(ctx, export.Guild)
+	if err != nil {
+		return report, errors.Wrap(err, "failed to list schedules")
+	}
+
+	current := make(map[string]bool, len(existing))
+	for _, schedule := range existing {
+		current[schedule.User] = true
+	}
+
+	imported := make(map[string]bool, len(export.Schedules))
+
+	for _, schedule := range export.Schedules {
+		imported[schedule.User] = true
+
+		if mode == ImportMerge && current[schedule.User] {
+			report.Skipped++
+			continue
+		}
+
+		report.Schedules++
+
+		if !dryRun {
+			if err = store.SetSchedule(ctx, schedule); err != nil {
+				return report, errors.Wrap(err, "failed to store schedule")
+			}
+		}
+	}
+
+	if mode == ImportOverwrite {
+		for user := range current {
+			if imported[user] {
+				continue
+			}
+
+			report.Removed++
+
+			if !dryRun {
+				if err = store.DeleteSchedule(ctx, export.Guild, user); err != nil {
+					return report, errors.Wrap(err, "failed to delete schedule")
+				}
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// importTheme stores the theme of a guild, in merge mode only when the guild has no theme yet
+func importTheme(ctx context.Context, store Backend, export GuildExport, mode ImportMode, dryRun bool) (ImportReport, error) {
+	var report ImportReport
+
+	current, err := store.GetGuildTheme(ctx, export.Guild)
+	if err != nil {
+		return report, errors.Wrap(err, "failed to get guild theme")
+	}
+
+	switch {
+	case export.Theme == nil:
+		if current == nil || mode == ImportMerge {
+			return report, nil
+		}
+
+		report.Removed++
+
+		if !dryRun {
+			err = store.DeleteGuildTheme(ctx, export.Guild)
+		}
+
+		return report, errors.Wrap(err, "failed to delete guild theme")
+	case current != nil && mode == ImportMerge:
+		report.Skipped++
+	default:
+		report.Themes++
+
+		if !dryRun {
+			err = store.SetGuildTheme(ctx, *export.Theme)
+		}
+	}
+
+	return report, errors.Wrap(err, "failed to store guild theme")
+}
+
+// importGroups stores the group roles of a guild along with their members, in merge mode keeping the group roles
+// that already exist. Replaced group roles lose their previous members.
+func importGroups(ctx context.Context, store Backend, export GuildExport, mode ImportMode, dryRun bool) (ImportReport, error) {
+	var report ImportReport
+
+	existing, err := store.ListGroups(ctx, export.Guild)
+	if err != nil {
+		return report, errors.Wrap(err, "failed to list group roles")
+	}
+
+	current := make(map[string]bool, len(existing))
+	for _, group := range existing {
+		current[group.Role] = true
+	}
+
+	imported := make(map[string]bool, len(export.Groups))
+
+	for _, group := range export.Groups {
+		imported[group.Role] = true
+
+		if mode == ImportMerge && current[group.Role] {
+			report.Skipped++
+			continue
+		}
+
+		report.Groups++
+
+		if dryRun {
+			continue
+		}
+
+		if current[group.Role] {
+			if err = store.DeleteGroup(ctx, export.Guild, group.Role); err != nil {
+				return report, errors.Wrap(err, "failed to delete group role")
+			}
+		}
+
+		if err = store.SetGroup(ctx, group.GroupRole); err != nil {
+			return report, errors.Wrap(err, "failed to store group role")
+		}
+
+		for _, member := range group.Members {
+			if err = store.AddGroupMember(ctx, export.Guild, group.Role, member, 0); err != nil {
+				return report, errors.Wrap(err, "failed to store group member")
+			}
+		}
+	}
+
+	if mode == ImportOverwrite {
+		for role := range current {
+			if imported[role] {
+				continue
+			}
+
+			report.Removed++
+
+			if !dryRun {
+				if err = store.DeleteGroup(ctx, export.Guild, role); err != nil {
+					return report, errors.Wrap(err, "failed to delete group role")
+				}
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// importApprovals stores the pending approval requests of a guild, in merge mode keeping the requests that
+// already exist
+func importApprovals(ctx context.Context, store Backend, export GuildExport, mode ImportMode, dryRun bool) (ImportReport, error) {
+	var report ImportReport
+
+	existing, err := store.ListGuildApprovals(ctx, export.Guild)
+	if err != nil {
+		return report, errors.Wrap(err, "failed to list approval requests")
+	}
+
+	current := make(map[string]bool, len(existing))
+	for _, request := range existing {
+		current[request.ID] = true
+	}
+
+	imported := make(map[string]bool, len(export.Approvals))
+
+	for _, request := range export.Approvals {
+		imported[request.ID] = true
+
+		if mode == ImportMerge && current[request.ID] {
+			report.Skipped++
+			continue
+		}
+
+		report.Approvals++
+
+		if !dryRun {
+			if err = store.SetApproval(ctx, request); err != nil {
+				return report, errors.Wrap(err, "failed to store approval request")
+			}
+		}
+	}
+
+	if mode == ImportOverwrite {
+		for id := range current {
+			if imported[id] {
+				continue
+			}
+
+			report.Removed++
+
+			if !dryRun {
+				if err = store.DeleteApproval(ctx, export.Guild, id); err != nil {
+					return report, errors.Wrap(err, "failed to delete approval request")
+				}
+			}
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,162 @@
+package backend
+
+import (
+	"emperror.dev/errors"
+	"maps"
+	"time"
+)
+
+const (
+	// MaxHistoryEntries is the number of previous role states retained per user
+	MaxHistoryEntries = 10
+
+	// MaxFavorites is the number of favorite colors a user may save
+	MaxFavorites = 25
+
+	// MaxGroupMembers is the largest member cap a group role may have
+	MaxGroupMembers = 25
+
+	// MaxOwnedGroups is the number of group roles a user may own in a guild
+	MaxOwnedGroups = 3
+
+	// ApprovalExpiry is how long an approval request waits for staff before it expires
+	ApprovalExpiry = 48 * time.Hour
+
+	// RolePageSize is the number of personal roles requested per page when listing every role of a guild
+	RolePageSize = 100
+)
+
+const (
+	FavoriteLimitReached    = errors.Sentinel("favorite limit reached")
+	GroupMemberLimitReached = errors.Sentinel("group member limit reached")
+)
+
+// PersonalRole is the role a user owns in a guild
+type PersonalRole struct {
+	User string `json:"user"`
+	Role string `json:"role"`
+}
+
+// RoleState is a snapshot of the name and color of a personal role
+type RoleState struct {
+	Name  string    `json:"name"`
+	Color int       `json:"color"`
+	Time  time.Time `json:"time"`
+}
+
+// Favorite is a color bookmarked by a user, with an optional label
+type Favorite struct {
+	Color int       `json:"color"`
+	Label string    `json:"label,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// ScheduleSource is where a color rotation schedule picks its next color from
+type ScheduleSource string
+
+const (
+	// ScheduleSourceRandom picks a random named color
+	ScheduleSourceRandom ScheduleSource = "random"
+	// ScheduleSourcePalette cycles through a palette generated from the base color
+	ScheduleSourcePalette ScheduleSource = "palette"
+	// ScheduleSourceFavorites cycles through the user's favorite colors
+	ScheduleSourceFavorites ScheduleSource = "favorites"
+	// ScheduleSourceHueDrift slowly rotates the hue of the base color
+	ScheduleSourceHueDrift ScheduleSource = "hue"
+)
+
+// Schedule is an opt-in rotation of the color of a user's personal role
+type Schedule struct {
+	Guild     string         `json:"guild"`
+	User      string         `json:"user"`
+	Source    ScheduleSource `json:"source"`
+	Palette   string         `json:"palette,omitempty"`
+	BaseColor int            `json:"base_color"`
+	Interval  time.Duration  `json:"interval"`
+	Step      int            `json:"step"`
+	NextRun   time.Time      `json:"next_run"`
+}
+
+// GuildTheme is a themed palette temporarily applied to every personal role of a guild
+type GuildTheme struct {
+	Guild   string    `json:"guild"`
+	Theme   string    `json:"theme"`
+	StartAt time.Time `json:"start_at"`
+	EndAt   time.Time `json:"end_at,omitempty"`
+	Applied bool      `json:"applied"`
+	// Originals holds the color of each role before the theme was applied, keyed by role
+	Originals map[string]int `json:"originals,omitempty"`
+}
+
+// GroupRole is a role shared by several members, owned by the member who created it
+type GroupRole struct {
+	Guild string `json:"guild"`
+	Role  string `json:"role"`
+	Owner string `json:"owner"`
+	// CoEdit allows every member, not only the owner, to change the name and color
+	CoEdit     bool `json:"co_edit"`
+	MaxMembers int  `json:"max_members"`
+}
+
+// GuildSettings are the per-guild options set by guild admins
+type GuildSettings struct {
+	// ApprovalRequired holds role changes for staff sign-off before they are applied
+	ApprovalRequired bool `json:"approval_required"`
+	// ApprovalChannel is where approval requests are posted for staff
+	ApprovalChannel string `json:"approval_channel,omitempty"`
+	// RateLimits override the configured rate limits of commands in the guild, keyed by command
+	RateLimits map[string]CommandRateLimits `json:"rate_limits,omitempty"`
+}
+
+// IsZero reports whether every setting has its default value
+func (s GuildSettings) IsZero() bool {
+	return s.Equal(GuildSettings{})
+}
+
+// Equal reports whether both settings have the same values
+func (s GuildSettings) Equal(other GuildSettings) bool {
+	return s.ApprovalRequired == other.ApprovalRequired &&
+		s.ApprovalChannel == other.ApprovalChannel &&
+		maps.EqualFunc(s.RateLimits, other.RateLimits, CommandRateLimits.Equal)
+}
+
+// CommandRateLimits limit how often a command is used by each member, and by every member of a guild together
+type CommandRateLimits struct {
+	User  *RateLimit `json:"user,omitempty"`
+	Guild *RateLimit `json:"guild,omitempty"`
+}
+
+// Equal reports whether both limit the command the same way
+func (c CommandRateLimits) Equal(other CommandRateLimits) bool {
+	return equalRateLimit(c.User, other.User) && equalRateLimit(c.Guild, other.Guild)
+}
+
+func equalRateLimit(a *RateLimit, b *RateLimit) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+// ApprovalRequest is a role change waiting for staff sign-off
+type ApprovalRequest struct {
+	ID        string `json:"id"`
+	Guild     string `json:"guild"`
+	User      string `json:"user"`
+	Requester string `json:"requester"`
+	Name      string `json:"name,omitempty"`
+	// Color is nil when the request does not change the color
+	Color *int `json:"color,omitempty"`
+
+	// Channel and Message identify the staff channel message showing the request
+	Channel string `json:"channel,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	// AppID and Token identify the interaction of the request, used to follow up when a DM cannot be sent
+	AppID string `json:"app_id"`
+	Token string `json:"token"`
+
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
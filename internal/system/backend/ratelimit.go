@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"emperror.dev/errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	rateLimitInvalid = errors.Sentinel("rate limit must be uses per duration, like 5/1m")
+)
+
+// RateLimit allows Uses uses per duration, given back gradually over the duration
+type RateLimit struct {
+	Uses int           `json:"uses"`
+	Per  time.Duration `json:"per"`
+}
+
+// ParseRateLimit reads a rate limit written as uses per duration, like 5/1m
+func ParseRateLimit(input string) (RateLimit, error) {
+	uses, per, found := strings.Cut(strings.TrimSpace(input), "/")
+	if !found {
+		return RateLimit{}, errors.WithDetails(rateLimitInvalid, "rate_limit", input)
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(uses))
+	if err != nil || count < 1 {
+		return RateLimit{}, errors.WithDetails(rateLimitInvalid, "rate_limit", input)
+	}
+
+	duration, err := time.ParseDuration(strings.TrimSpace(per))
+	if err != nil || duration <= 0 {
+		return RateLimit{}, errors.WithDetails(rateLimitInvalid, "rate_limit", input)
+	}
+
+	return RateLimit{Uses: count, Per: duration}, nil
+}
+
+// ParseRateLimits reads comma separated rate limits keyed by command, like role=5/1m,color=10/1m
+func ParseRateLimits(input string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+
+	for _, entry := range strings.Split(input, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		command, limit, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, errors.WithDetails(rateLimitInvalid, "rate_limit", entry)
+		}
+
+		parsed, err := ParseRateLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+
+		limits[strings.TrimSpace(command)] = parsed
+	}
+
+	return limits, nil
+}
+
+func (r RateLimit) String() string {
+	return fmt.Sprintf("%d/%s", r.Uses, r.Per)
+}
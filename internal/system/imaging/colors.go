@@ -70,17 +70,8 @@ func GenerateColorImage(mainColor int, similarColors []common.ColorDistance) ([]
 				ALTS_COLOR_SIZE,
 				SQUARE_BORDER_SIZE)
 
-			// Choose contrasting color for the text (white or black depending on color brightness)
-			textColor := color.RGBA{R: 255, G: 255, B: 255, A: 255} // Default to white
-
-			// Use black for light colors (simple brightness calculation)
-			brightness := (int(distR) + int(distG) + int(distB)) / 3
-			if brightness > 128 {
-				textColor = color.RGBA{A: 255}
-			}
-
 			// Draw the index number directly on the color square
-			DrawNumber(imageData, i+1, x+ALTS_COLOR_SIZE/2, y+ALTS_COLOR_SIZE/2, textColor)
+			DrawNumber(imageData, i+1, x+ALTS_COLOR_SIZE/2, y+ALTS_COLOR_SIZE/2, ContrastingTextColor(distR, distG, distB))
 		}
 	}
 
@@ -92,3 +83,13 @@ func GenerateColorImage(mainColor int, similarColors []common.ColorDistance) ([]
 
 	return buf.Bytes(), nil
 }
+
+// ContrastingTextColor chooses white or black text depending on the brightness of the background
+func ContrastingTextColor(r, g, b uint8) color.RGBA {
+	// Use black for light colors (simple brightness calculation)
+	if (int(r)+int(g)+int(b))/3 > 128 {
+		return color.RGBA{A: 255}
+	}
+
+	return color.RGBA{R: 255, G: 255, B: 255, A: 255}
+}
@@ -0,0 +1,54 @@
+package imaging
+
+import (
+	"bytes"
+	"github.com/Sxtanna/chromatic_curator/internal/common"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+// GenerateSwatchStrip creates an image showing the given colors as a single numbered row
+func GenerateSwatchStrip(colors []int) ([]byte, error) {
+	return GenerateSwatchGrid(colors, max(1, len(colors)))
+}
+
+// GenerateSwatchGrid creates an image showing the given colors as numbered rows of at most perRow squares
+func GenerateSwatchGrid(colors []int, perRow int) ([]byte, error) {
+	count := max(1, len(colors))
+	perRow = max(1, min(perRow, count))
+	rowCount := (count + perRow - 1) / perRow
+
+	fullImageWidth := perRow*ALTS_COLOR_SIZE + (perRow+1)*SQUARE_PADDING
+	fullImageHeight := rowCount*ALTS_COLOR_SIZE + (rowCount+1)*SQUARE_PADDING
+
+	imageData := image.NewRGBA(image.Rect(0, 0, fullImageWidth, fullImageHeight))
+
+	draw.Draw(imageData, imageData.Bounds(), &image.Uniform{C: color.RGBA{R: 0, G: 0, B: 0, A: 0}}, image.Point{}, draw.Src)
+
+	for i, colorInt := range colors {
+		r, g, b := common.IntToRGB(colorInt)
+		darkR, darkG, darkB := common.SlightlyDarker(r, g, b)
+
+		x := SQUARE_PADDING + (i%perRow)*(ALTS_COLOR_SIZE+SQUARE_PADDING)
+		y := SQUARE_PADDING + (i/perRow)*(ALTS_COLOR_SIZE+SQUARE_PADDING)
+
+		DrawSquareWithBorder(imageData,
+			color.RGBA{R: r, G: g, B: b, A: 255},
+			color.RGBA{R: darkR, G: darkG, B: darkB, A: 255},
+			x,
+			y,
+			ALTS_COLOR_SIZE,
+			SQUARE_BORDER_SIZE)
+
+		DrawNumber(imageData, i+1, x+ALTS_COLOR_SIZE/2, y+ALTS_COLOR_SIZE/2, ContrastingTextColor(r, g, b))
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, imageData); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
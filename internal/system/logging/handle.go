@@ -26,7 +26,7 @@ func (h *slogHandler) Handle(err error) {
 
 	// Extract details from the error and attach it to the log
 	if details := errors.GetDetails(err); len(details) > 0 {
-		logger = h.logger.With(details)
+		logger = h.logger.With(details...)
 	}
 
 	type errorCollection interface {